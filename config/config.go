@@ -2,6 +2,7 @@ package config
 
 import (
 	"os"
+	"strconv"
 )
 
 // Config содержит настройки приложения
@@ -12,6 +13,20 @@ type Config struct {
 	DBPassword  string // Пароль БД
 	DBName      string // Имя базы данных
 	SandboxPath string // Путь к изолированной папке sandbox
+
+	// Лимиты распаковки архивов (0 — значение по умолчанию из пакета fs)
+	ArchiveMaxSize    int64 // Максимальный суммарный размер распакованных данных (байт)
+	ArchiveMaxRatio   int64 // Максимальная степень сжатия записи (N:1)
+	ArchiveMaxEntries int   // Максимальное количество записей в архиве
+	ArchiveMaxDepth   int   // Максимальная глубина вложенности папок внутри архива
+	ArchiveMaxNesting int   // Максимальная глубина вложенности архивов друг в друга
+
+	// Лимиты разбора JSON (0 — значение по умолчанию из пакета fs)
+	JSONMaxDepth            int  // Максимальная вложенность объектов и массивов
+	JSONMaxTokens           int  // Максимальное количество значений и ключей
+	JSONMaxStringLength     int  // Максимальная длина строки (байт)
+	JSONMaxNumberLength     int  // Максимальная длина записи числа (символов)
+	JSONRejectDuplicateKeys bool // Отклонять объекты с повторяющимися ключами
 }
 
 // LoadConfig загружает конфигурацию из переменных окружения
@@ -24,6 +39,18 @@ func LoadConfig() *Config {
 		DBPassword:  getEnv("DB_PASSWORD", "secret"),
 		DBName:      getEnv("DB_NAME", "securefm"),
 		SandboxPath: getEnv("SANDBOX_PATH", "./sandbox"),
+
+		ArchiveMaxSize:    getEnvInt64("ARCHIVE_MAX_SIZE", 0),
+		ArchiveMaxRatio:   getEnvInt64("ARCHIVE_MAX_RATIO", 0),
+		ArchiveMaxEntries: int(getEnvInt64("ARCHIVE_MAX_ENTRIES", 0)),
+		ArchiveMaxDepth:   int(getEnvInt64("ARCHIVE_MAX_DEPTH", 0)),
+		ArchiveMaxNesting: int(getEnvInt64("ARCHIVE_MAX_NESTING", 0)),
+
+		JSONMaxDepth:            int(getEnvInt64("JSON_MAX_DEPTH", 0)),
+		JSONMaxTokens:           int(getEnvInt64("JSON_MAX_TOKENS", 0)),
+		JSONMaxStringLength:     int(getEnvInt64("JSON_MAX_STRING_LENGTH", 0)),
+		JSONMaxNumberLength:     int(getEnvInt64("JSON_MAX_NUMBER_LENGTH", 0)),
+		JSONRejectDuplicateKeys: getEnvBool("JSON_REJECT_DUPLICATE_KEYS", false),
 	}
 }
 
@@ -34,3 +61,31 @@ func getEnv(key, fallback string) string {
 	}
 	return fallback
 }
+
+// getEnvInt64 получает целое значение переменной окружения
+// Некорректные и отрицательные значения заменяются значением по умолчанию
+func getEnvInt64(key string, fallback int64) int64 {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 {
+		return fallback
+	}
+	return n
+}
+
+// getEnvBool получает логическое значение переменной окружения (true/false, 1/0)
+// Некорректные значения заменяются значением по умолчанию
+func getEnvBool(key string, fallback bool) bool {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return fallback
+	}
+	return b
+}
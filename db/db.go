@@ -59,6 +59,10 @@ func createTables() {
 			location TEXT,
 			owner_id INT REFERENCES users(id)
 		);`,
+		// Результат последней проверки целостности (для архивов)
+		`ALTER TABLE files ADD COLUMN IF NOT EXISTS verified_at TIMESTAMP;`,
+		`ALTER TABLE files ADD COLUMN IF NOT EXISTS verify_status VARCHAR(20);`,
+		`ALTER TABLE files ADD COLUMN IF NOT EXISTS verify_details TEXT;`,
 		// Таблица логов операций
 		`CREATE TABLE IF NOT EXISTS operations (
 			id SERIAL PRIMARY KEY,
@@ -67,6 +71,16 @@ func createTables() {
 			file_id INT REFERENCES files(id),
 			user_id INT REFERENCES users(id)
 		);`,
+		// Полнотекстовый индекс содержимого файлов (entry — файл внутри архива)
+		`CREATE TABLE IF NOT EXISTS content_index (
+			path TEXT NOT NULL,
+			entry TEXT NOT NULL DEFAULT '',
+			content TEXT NOT NULL,
+			tsv TSVECTOR GENERATED ALWAYS AS (to_tsvector('simple', content)) STORED,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (path, entry)
+		);`,
+		`CREATE INDEX IF NOT EXISTS content_index_tsv_idx ON content_index USING GIN (tsv);`,
 	}
 
 	for _, query := range queries {
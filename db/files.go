@@ -1,17 +1,27 @@
 package db
 
 import (
+	"database/sql"
 	"time"
 )
 
 // FileMetadata — структура метаданных файла
 type FileMetadata struct {
-	ID        int       // Уникальный идентификатор
-	Filename  string    // Имя файла
-	CreatedAt time.Time // Дата создания
-	Size      int64     // Размер в байтах
-	Location  string    // Путь к файлу
-	OwnerID   int       // ID владельца (FK на users)
+	ID            int          // Уникальный идентификатор
+	Filename      string       // Имя файла
+	CreatedAt     time.Time    // Дата создания
+	Size          int64        // Размер в байтах
+	Location      string       // Путь к файлу
+	OwnerID       int          // ID владельца (FK на users)
+	VerifiedAt    sql.NullTime // Время последней проверки целостности
+	VerifyStatus  string       // Результат проверки (ok, incomplete, failed) или пусто
+	VerifyDetails string       // Описание результата проверки
+}
+
+// scanFile читает строку результата в FileMetadata
+func scanFile(row interface{ Scan(...interface{}) error }, f *FileMetadata) error {
+	return row.Scan(&f.ID, &f.Filename, &f.CreatedAt, &f.Size, &f.Location, &f.OwnerID,
+		&f.VerifiedAt, &f.VerifyStatus, &f.VerifyDetails)
 }
 
 // CreateFileMetadata создаёт запись о файле в БД
@@ -30,14 +40,15 @@ func CreateFileMetadata(filename string, size int64, location string, ownerID in
 
 // GetFileMetadata получает метаданные файла по ID
 func GetFileMetadata(id int) (*FileMetadata, error) {
-	stmt, err := DB.Prepare("SELECT id, filename, created_at, size, location, owner_id FROM files WHERE id = $1")
+	stmt, err := DB.Prepare(`SELECT id, filename, created_at, size, location, owner_id, verified_at,
+		COALESCE(verify_status, ''), COALESCE(verify_details, '') FROM files WHERE id = $1`)
 	if err != nil {
 		return nil, err
 	}
 	defer stmt.Close()
 
 	var f FileMetadata
-	err = stmt.QueryRow(id).Scan(&f.ID, &f.Filename, &f.CreatedAt, &f.Size, &f.Location, &f.OwnerID)
+	err = scanFile(stmt.QueryRow(id), &f)
 	if err != nil {
 		return nil, err
 	}
@@ -46,7 +57,8 @@ func GetFileMetadata(id int) (*FileMetadata, error) {
 
 // GetFilesByUser получает все файлы пользователя
 func GetFilesByUser(userID int) ([]FileMetadata, error) {
-	stmt, err := DB.Prepare("SELECT id, filename, created_at, size, location, owner_id FROM files WHERE owner_id = $1")
+	stmt, err := DB.Prepare(`SELECT id, filename, created_at, size, location, owner_id, verified_at,
+		COALESCE(verify_status, ''), COALESCE(verify_details, '') FROM files WHERE owner_id = $1`)
 	if err != nil {
 		return nil, err
 	}
@@ -61,7 +73,7 @@ func GetFilesByUser(userID int) ([]FileMetadata, error) {
 	var files []FileMetadata
 	for rows.Next() {
 		var f FileMetadata
-		if err := rows.Scan(&f.ID, &f.Filename, &f.CreatedAt, &f.Size, &f.Location, &f.OwnerID); err != nil {
+		if err := scanFile(rows, &f); err != nil {
 			return nil, err
 		}
 		files = append(files, f)
@@ -79,3 +91,36 @@ func DeleteFileMetadata(id int) error {
 	_, err = stmt.Exec(id)
 	return err
 }
+
+// RecordVerification сохраняет результат проверки целостности в метаданных файла
+// Обновляется только запись того же владельца: путь в sandbox не уникален
+// среди пользователей, и чужие метаданные не должны меняться. Если записи
+// нет (архив загружен извне или принадлежит другому пользователю), она создаётся.
+// status — итог проверки: ok, incomplete (часть записей не проверена) или failed
+func RecordVerification(filename string, size int64, location string, ownerID int, status, details string) (int, error) {
+	stmt, err := DB.Prepare(`UPDATE files SET verified_at = CURRENT_TIMESTAMP, verify_status = $1, verify_details = $2, size = $3
+		WHERE id = (SELECT id FROM files WHERE location = $4 AND owner_id = $5 ORDER BY id DESC LIMIT 1) RETURNING id`)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	var id int
+	err = stmt.QueryRow(status, details, size, location, ownerID).Scan(&id)
+	if err == nil {
+		return id, nil
+	}
+	if err != sql.ErrNoRows {
+		return 0, err
+	}
+
+	insert, err := DB.Prepare(`INSERT INTO files(filename, size, location, owner_id, verified_at, verify_status, verify_details)
+		VALUES($1, $2, $3, $4, CURRENT_TIMESTAMP, $5, $6) RETURNING id`)
+	if err != nil {
+		return 0, err
+	}
+	defer insert.Close()
+
+	err = insert.QueryRow(filename, size, location, ownerID, status, details).Scan(&id)
+	return id, err
+}
@@ -0,0 +1,84 @@
+package db
+
+// IndexHit — результат полнотекстового поиска
+type IndexHit struct {
+	Path    string  // путь к файлу относительно sandbox
+	Entry   string  // имя файла внутри архива (пусто для обычных файлов)
+	Rank    float64 // релевантность (ts_rank_cd)
+	Snippet string  // фрагмент текста с подсветкой совпадений
+}
+
+// ContentIndex — полнотекстовый индекс содержимого файлов в PostgreSQL
+// Реализует интерфейс fs.ContentIndexer
+type ContentIndex struct{}
+
+// IndexDocument добавляет документ в индекс или обновляет существующий
+// Использует Prepared Statement для защиты от SQL-инъекций
+func (ContentIndex) IndexDocument(path, entry, content string) error {
+	stmt, err := DB.Prepare(`INSERT INTO content_index(path, entry, content) VALUES($1, $2, $3)
+		ON CONFLICT (path, entry) DO UPDATE SET content = EXCLUDED.content, updated_at = CURRENT_TIMESTAMP`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(path, entry, content)
+	return err
+}
+
+// RemoveDocument удаляет файл из индекса (для архива — все его записи, для
+// папки — все файлы внутри неё). Префикс сравнивается без LIKE, чтобы «_» и «%»
+// в имени папки не задевали чужие пути
+func (ContentIndex) RemoveDocument(path string) error {
+	stmt, err := DB.Prepare("DELETE FROM content_index WHERE path = $1 OR left(path, length($1) + 1) = $1 || '/'")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(path)
+	return err
+}
+
+// ClearIndex удаляет все документы из индекса
+func (ContentIndex) ClearIndex() error {
+	stmt, err := DB.Prepare("DELETE FROM content_index")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec()
+	return err
+}
+
+// SearchContent выполняет ранжированный полнотекстовый поиск
+// Синтаксис запроса websearch: "точная фраза", слово1 слово2, -исключить, OR
+func SearchContent(query string, limit int) ([]IndexHit, error) {
+	stmt, err := DB.Prepare(`SELECT path, entry, ts_rank_cd(tsv, q) AS rank,
+			ts_headline('simple', content, q, 'StartSel=«, StopSel=», MaxWords=20, MinWords=5, MaxFragments=2')
+		FROM content_index, websearch_to_tsquery('simple', $1) q
+		WHERE tsv @@ q
+		ORDER BY rank DESC, path, entry
+		LIMIT $2`)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.Query(query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hits []IndexHit
+	for rows.Next() {
+		var h IndexHit
+		if err := rows.Scan(&h.Path, &h.Entry, &h.Rank, &h.Snippet); err != nil {
+			return nil, err
+		}
+		hits = append(hits, h)
+	}
+	return hits, rows.Err()
+}
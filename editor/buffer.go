@@ -0,0 +1,232 @@
+package editor
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Pos — позиция в тексте: номер строки и номер символа в строке (с 0)
+type Pos struct {
+	Row, Col int
+}
+
+func (p Pos) before(q Pos) bool {
+	return p.Row < q.Row || (p.Row == q.Row && p.Col < q.Col)
+}
+
+// endOf возвращает позицию после текста text, вставленного в позицию p
+func endOf(p Pos, text string) Pos {
+	n := strings.Count(text, "\n")
+	if n == 0 {
+		return Pos{p.Row, p.Col + utf8.RuneCountInString(text)}
+	}
+	return Pos{p.Row + n, utf8.RuneCountInString(text[strings.LastIndexByte(text, '\n')+1:])}
+}
+
+// edit — правка для отмены и повтора: в позиции at текст removed заменён на inserted
+type edit struct {
+	at       Pos
+	removed  string
+	inserted string
+	cursor   Pos // курсор до правки
+	group    int // правки одной группы отменяются вместе
+}
+
+// Buffer — редактируемый текст (строки без переводов строк) с историей правок.
+// Все изменения проходят через Edit, поэтому любую правку можно отменить
+type Buffer struct {
+	lines  [][]rune
+	undo   []edit
+	redo   []edit
+	group  int
+	batch  bool // правки объединяются в текущую группу (замена всех совпадений)
+	typing bool // следующий введённый символ продолжает последнюю правку
+}
+
+// NewBuffer создаёт буфер с текстом (строки разделены "\n")
+func NewBuffer(text string) *Buffer {
+	b := &Buffer{}
+	for _, line := range strings.Split(text, "\n") {
+		b.lines = append(b.lines, []rune(line))
+	}
+	return b
+}
+
+// Text возвращает текст буфера (строки разделены "\n")
+func (b *Buffer) Text() string {
+	parts := make([]string, len(b.lines))
+	for i, line := range b.lines {
+		parts[i] = string(line)
+	}
+	return strings.Join(parts, "\n")
+}
+
+// LineCount возвращает количество строк (в пустом буфере одна пустая строка)
+func (b *Buffer) LineCount() int {
+	return len(b.lines)
+}
+
+// Line возвращает строку по номеру
+func (b *Buffer) Line(row int) []rune {
+	return b.lines[row]
+}
+
+// clamp приводит позицию к существующей
+func (b *Buffer) clamp(p Pos) Pos {
+	p.Row = max(0, min(p.Row, len(b.lines)-1))
+	p.Col = max(0, min(p.Col, len(b.lines[p.Row])))
+	return p
+}
+
+// textBetween возвращает текст между позициями from и to (from не позже to)
+func (b *Buffer) textBetween(from, to Pos) string {
+	if from.Row == to.Row {
+		return string(b.lines[from.Row][from.Col:to.Col])
+	}
+	var s strings.Builder
+	s.WriteString(string(b.lines[from.Row][from.Col:]))
+	for row := from.Row + 1; row < to.Row; row++ {
+		s.WriteByte('\n')
+		s.WriteString(string(b.lines[row]))
+	}
+	s.WriteByte('\n')
+	s.WriteString(string(b.lines[to.Row][:to.Col]))
+	return s.String()
+}
+
+// replace заменяет текст между from и to на text без записи в историю;
+// возвращает удалённый текст и позицию после вставки
+func (b *Buffer) replace(from, to Pos, text string) (string, Pos) {
+	removed := b.textBetween(from, to)
+	head := b.lines[from.Row][:from.Col]
+	tail := b.lines[to.Row][to.Col:]
+
+	inserted := strings.Split(text, "\n")
+	middle := make([][]rune, len(inserted))
+	for i, part := range inserted {
+		middle[i] = []rune(part)
+	}
+	last := len(middle) - 1
+	end := Pos{from.Row + last, len(middle[last])}
+	middle[0] = append(append([]rune{}, head...), middle[0]...)
+	if last == 0 {
+		end.Col = len(middle[0])
+	}
+	middle[last] = append(middle[last], tail...)
+
+	lines := make([][]rune, 0, len(b.lines)-(to.Row-from.Row)+last)
+	lines = append(lines, b.lines[:from.Row]...)
+	lines = append(lines, middle...)
+	lines = append(lines, b.lines[to.Row+1:]...)
+	b.lines = lines
+	return removed, end
+}
+
+// Edit заменяет текст между from и to на text (вставка — from == to,
+// удаление — пустой text) и записывает правку в историю. cursor — положение
+// курсора до правки, оно восстанавливается при отмене. Возвращает позицию
+// после вставленного текста
+func (b *Buffer) Edit(from, to Pos, text string, cursor Pos) Pos {
+	from, to = b.clamp(from), b.clamp(to)
+	if to.before(from) {
+		from, to = to, from
+	}
+	removed, end := b.replace(from, to, text)
+	b.redo = nil
+
+	// Подряд введённые символы отменяются одним шагом
+	single := utf8.RuneCountInString(text) == 1 && text != "\n" && removed == ""
+	if single && b.typing && len(b.undo) > 0 {
+		last := &b.undo[len(b.undo)-1]
+		if last.removed == "" && endOf(last.at, last.inserted) == from {
+			last.inserted += text
+			return end
+		}
+	}
+	if !b.batch {
+		b.group++
+	}
+	b.undo = append(b.undo, edit{at: from, removed: removed, inserted: text, cursor: cursor, group: b.group})
+	b.typing = single && !b.batch
+	return end
+}
+
+// Batch выполняет правки fn как одну группу: они отменяются одним шагом
+func (b *Buffer) Batch(fn func()) {
+	b.group++
+	b.batch = true
+	defer func() { b.batch = false }()
+	fn()
+}
+
+// Seal завершает ввод символов: следующий символ начнёт новую правку
+func (b *Buffer) Seal() {
+	b.typing = false
+}
+
+// Undo отменяет последнюю группу правок; возвращает положение курсора
+func (b *Buffer) Undo() (Pos, bool) {
+	if len(b.undo) == 0 {
+		return Pos{}, false
+	}
+	b.typing = false
+	group := b.undo[len(b.undo)-1].group
+	var cursor Pos
+	for len(b.undo) > 0 && b.undo[len(b.undo)-1].group == group {
+		e := b.undo[len(b.undo)-1]
+		b.undo = b.undo[:len(b.undo)-1]
+		b.replace(e.at, endOf(e.at, e.inserted), e.removed)
+		b.redo = append(b.redo, e)
+		cursor = e.cursor
+	}
+	return cursor, true
+}
+
+// Redo повторяет отменённую группу правок; возвращает положение курсора
+func (b *Buffer) Redo() (Pos, bool) {
+	if len(b.redo) == 0 {
+		return Pos{}, false
+	}
+	b.typing = false
+	group := b.redo[len(b.redo)-1].group
+	var cursor Pos
+	for len(b.redo) > 0 && b.redo[len(b.redo)-1].group == group {
+		e := b.redo[len(b.redo)-1]
+		b.redo = b.redo[:len(b.redo)-1]
+		_, cursor = b.replace(e.at, endOf(e.at, e.removed), e.inserted)
+		b.undo = append(b.undo, e)
+	}
+	return cursor, true
+}
+
+// Find ищет query (без переводов строк) начиная с позиции from до конца текста
+func (b *Buffer) Find(query string, from Pos) (Pos, bool) {
+	q := []rune(query)
+	if len(q) == 0 {
+		return Pos{}, false
+	}
+	from = b.clamp(from)
+	for row := from.Row; row < len(b.lines); row++ {
+		start := 0
+		if row == from.Row {
+			start = from.Col
+		}
+		if col := indexRunes(b.lines[row], q, start); col >= 0 {
+			return Pos{row, col}, true
+		}
+	}
+	return Pos{}, false
+}
+
+func indexRunes(line, q []rune, start int) int {
+next:
+	for i := start; i+len(q) <= len(line); i++ {
+		for j, r := range q {
+			if line[i+j] != r {
+				continue next
+			}
+		}
+		return i
+	}
+	return -1
+}
@@ -0,0 +1,579 @@
+package editor
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"secure-fm/fs"
+)
+
+// Полноэкранный текстовый редактор для терминала. Файл читается и
+// записывается только через пакет fs (проверка пути, лимит размера,
+// блокировки, атомарная запись); при сохранении проверяется, что файл
+// не изменился на диске с момента открытия
+
+// ErrNoTerminal — ввод не является терминалом (или система не поддерживается),
+// полноэкранный режим недоступен
+var ErrNoTerminal = errors.New("полноэкранный режим недоступен: ввод не является терминалом")
+
+const (
+	defaultRows = 24
+	defaultCols = 80
+	tabWidth    = 4
+
+	helpLine = "Ctrl-S сохранить  Ctrl-Q выход  Ctrl-F поиск  Ctrl-N далее  Ctrl-R замена  Ctrl-Z отмена  Ctrl-Y повтор"
+)
+
+// key — нажатая клавиша: символ или одна из специальных клавиш (отрицательные значения)
+type key rune
+
+const (
+	keyNone key = -(iota + 1)
+	keyUp
+	keyDown
+	keyLeft
+	keyRight
+	keyHome
+	keyEnd
+	keyPageUp
+	keyPageDown
+	keyDelete
+)
+
+const (
+	keyCtrlC     key = 'c' & 0x1f
+	keyCtrlF     key = 'f' & 0x1f
+	keyCtrlH     key = 'h' & 0x1f
+	keyCtrlN     key = 'n' & 0x1f
+	keyCtrlQ     key = 'q' & 0x1f
+	keyCtrlR     key = 'r' & 0x1f
+	keyCtrlS     key = 's' & 0x1f
+	keyCtrlY     key = 'y' & 0x1f
+	keyCtrlZ     key = 'z' & 0x1f
+	keyTab       key = '\t'
+	keyEnter     key = '\r'
+	keyEscape    key = 0x1b
+	keyBackspace key = 0x7f
+)
+
+// escapeKeys — последовательности ESC [ ... специальных клавиш
+var escapeKeys = map[string]key{
+	"A": keyUp, "B": keyDown, "C": keyRight, "D": keyLeft,
+	"H": keyHome, "1~": keyHome, "7~": keyHome,
+	"F": keyEnd, "4~": keyEnd, "8~": keyEnd,
+	"3~": keyDelete, "5~": keyPageUp, "6~": keyPageDown,
+}
+
+// readKey читает одну клавишу
+func readKey(in *bufio.Reader) (key, error) {
+	r, _, err := in.ReadRune()
+	if err != nil {
+		return keyNone, err
+	}
+	switch {
+	case r == '\n':
+		return keyEnter, nil
+	case r != 0x1b:
+		return key(r), nil
+	case in.Buffered() == 0:
+		return keyEscape, nil // отдельное нажатие Esc: продолжение последовательности приходит сразу
+	}
+	if b, _ := in.ReadByte(); b != '[' && b != 'O' {
+		return keyNone, nil // Alt+клавиша не используется
+	}
+	var seq []byte
+	for len(seq) < 8 {
+		c, err := in.ReadByte()
+		if err != nil {
+			return keyNone, nil
+		}
+		seq = append(seq, c)
+		if c >= 0x40 && c <= 0x7e {
+			break
+		}
+	}
+	if k, ok := escapeKeys[string(seq)]; ok {
+		return k, nil
+	}
+	return keyNone, nil
+}
+
+// Editor — сеанс редактирования файла
+type Editor struct {
+	path         string
+	buf          *Buffer
+	version      string // версия файла при открытии или последнем сохранении ("" — файла не было)
+	crlf         bool   // строки разделены "\r\n"
+	finalNewline bool   // файл заканчивается переводом строки
+
+	cursor    Pos
+	top, left int // первая видимая строка и экранный столбец
+	textRows  int
+	dirty     bool
+	saved     bool
+	quitArmed bool // повторный Ctrl-Q выходит без сохранения
+	message   string
+	prompting bool
+	search    string
+
+	in   *bufio.Reader
+	out  *bufio.Writer
+	size func() (rows, cols int)
+}
+
+// Open загружает файл sandbox для редактирования; несуществующий файл
+// открывается пустым и будет создан при сохранении
+func Open(path string) (*Editor, error) {
+	e := &Editor{path: path, finalNewline: true}
+	content, version, err := fs.ReadFileVersion(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		content = ""
+	case err != nil:
+		return nil, err
+	case len(content) > fs.MaxFileSize:
+		return nil, fmt.Errorf("файл больше %d байт", fs.MaxFileSize)
+	case !utf8.ValidString(content):
+		if tf, err := fs.ReadText(path, ""); err == nil && strings.IndexByte(tf.Content, 0) < 0 {
+			return nil, fmt.Errorf("файл в кодировке %s: перекодируйте его в UTF-8 (пункт 33 меню)", tf.Encoding)
+		}
+		return nil, errors.New("файл не в кодировке UTF-8")
+	case strings.IndexByte(content, 0) >= 0:
+		return nil, errors.New("двоичный файл не редактируется как текст")
+	default:
+		e.version = version
+		e.crlf = strings.Contains(content, "\r\n")
+		if content != "" {
+			e.finalNewline = strings.HasSuffix(content, "\n")
+		}
+	}
+	text := strings.ReplaceAll(content, "\r\n", "\n")
+	e.buf = NewBuffer(strings.TrimSuffix(text, "\n"))
+	return e, nil
+}
+
+// Edit открывает файл в полноэкранном редакторе на терминале. Возвращает
+// ErrNoTerminal, если стандартный ввод не терминал, и true, если файл сохранён
+func Edit(path string, in *bufio.Reader) (bool, error) {
+	e, err := Open(path)
+	if err != nil {
+		return false, err
+	}
+	restore, err := makeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		return false, err
+	}
+	defer restore()
+	return e.Run(in, os.Stdout, func() (int, int) { return windowSize(int(os.Stdout.Fd())) })
+}
+
+// Run обрабатывает нажатия клавиш из in и рисует экран в out до выхода из
+// редактора или конца ввода. size возвращает размер экрана. Возвращает true,
+// если файл был сохранён
+func (e *Editor) Run(in *bufio.Reader, out io.Writer, size func() (rows, cols int)) (bool, error) {
+	e.in, e.out, e.size = in, bufio.NewWriter(out), size
+	e.out.WriteString("\x1b[?1049h") // альтернативный экран: после выхода терминал восстанавливается
+	defer func() {
+		e.out.WriteString("\x1b[2J\x1b[H\x1b[?1049l")
+		e.out.Flush()
+	}()
+
+	for {
+		e.render()
+		k, err := readKey(e.in)
+		if err == io.EOF {
+			return e.saved, nil
+		}
+		if err != nil {
+			return e.saved, err
+		}
+		e.message = ""
+		if !e.handle(k) {
+			return e.saved, nil
+		}
+	}
+}
+
+// Content возвращает текст для записи: с исходными переводами строк
+func (e *Editor) Content() string {
+	text := e.buf.Text()
+	if e.finalNewline && text != "" {
+		text += "\n"
+	}
+	if e.crlf {
+		text = strings.ReplaceAll(text, "\n", "\r\n")
+	}
+	return text
+}
+
+// handle выполняет действие клавиши; false — выход из редактора
+func (e *Editor) handle(k key) bool {
+	if k == keyCtrlQ || k == keyCtrlC {
+		if e.dirty && !e.quitArmed {
+			e.quitArmed = true
+			e.message = "Есть несохранённые изменения: Ctrl-Q ещё раз — выйти без сохранения"
+			return true
+		}
+		return false
+	}
+	e.quitArmed = false
+
+	switch k {
+	case keyUp, keyDown, keyPageUp, keyPageDown, keyLeft, keyRight, keyHome, keyEnd:
+		e.move(k)
+	case keyCtrlS:
+		e.save()
+	case keyCtrlF:
+		e.find(true)
+	case keyCtrlN:
+		e.find(false)
+	case keyCtrlR:
+		e.replace()
+	case keyCtrlZ:
+		if cursor, ok := e.buf.Undo(); ok {
+			e.cursor, e.dirty = cursor, true
+		} else {
+			e.message = "Нечего отменять"
+		}
+	case keyCtrlY:
+		if cursor, ok := e.buf.Redo(); ok {
+			e.cursor, e.dirty = cursor, true
+		} else {
+			e.message = "Нечего повторять"
+		}
+	case keyEnter:
+		e.insert("\n")
+	case keyTab:
+		e.insert("\t")
+	case keyBackspace, keyCtrlH:
+		from := Pos{e.cursor.Row, e.cursor.Col - 1}
+		if e.cursor.Col == 0 {
+			if e.cursor.Row == 0 {
+				break
+			}
+			from = Pos{e.cursor.Row - 1, len(e.buf.Line(e.cursor.Row - 1))}
+		}
+		e.remove(from, e.cursor)
+	case keyDelete:
+		to := Pos{e.cursor.Row, e.cursor.Col + 1}
+		if e.cursor.Col == len(e.buf.Line(e.cursor.Row)) {
+			if e.cursor.Row == e.buf.LineCount()-1 {
+				break
+			}
+			to = Pos{e.cursor.Row + 1, 0}
+		}
+		e.remove(e.cursor, to)
+	default:
+		if k >= 0 && unicode.IsPrint(rune(k)) {
+			e.insert(string(rune(k)))
+		}
+	}
+	return true
+}
+
+func (e *Editor) insert(text string) {
+	e.cursor = e.buf.Edit(e.cursor, e.cursor, text, e.cursor)
+	e.dirty = true
+}
+
+func (e *Editor) remove(from, to Pos) {
+	e.buf.Seal()
+	e.buf.Edit(from, to, "", e.cursor)
+	e.cursor = from
+	e.dirty = true
+}
+
+func (e *Editor) move(k key) {
+	e.buf.Seal()
+	c := &e.cursor
+	switch k {
+	case keyUp:
+		c.Row--
+	case keyDown:
+		c.Row++
+	case keyPageUp:
+		c.Row -= e.textRows
+	case keyPageDown:
+		c.Row += e.textRows
+	case keyLeft:
+		if c.Col > 0 {
+			c.Col--
+		} else if c.Row > 0 {
+			c.Row--
+			c.Col = len(e.buf.Line(c.Row))
+		}
+	case keyRight:
+		if c.Col < len(e.buf.Line(c.Row)) {
+			c.Col++
+		} else if c.Row < e.buf.LineCount()-1 {
+			c.Row++
+			c.Col = 0
+		}
+	case keyHome:
+		c.Col = 0
+	case keyEnd:
+		c.Col = len(e.buf.Line(c.Row))
+	}
+	*c = e.buf.clamp(*c)
+}
+
+// save записывает файл, только если он не изменился на диске после открытия
+// (версия совпадает). Перезапись чужих изменений требует подтверждения
+func (e *Editor) save() {
+	content := e.Content()
+	err := fs.WriteFileIfMatch(e.path, content, e.version)
+	var conflict *fs.VersionConflictError
+	if errors.As(err, &conflict) {
+		question := "Файл изменён на диске после открытия. Перезаписать чужие изменения? (y/N)"
+		if conflict.Actual == "" {
+			question = "Файл удалён на диске после открытия. Создать заново? (y/N)"
+		}
+		if !e.confirm(question) {
+			e.message = "Сохранение отменено: файл изменён на диске"
+			return
+		}
+		// Перезаписываем ровно ту версию, которую пользователь согласился заменить
+		err = fs.WriteFileIfMatch(e.path, content, conflict.Actual)
+	}
+	if err != nil {
+		e.message = "Ошибка: " + err.Error()
+		return
+	}
+	e.version = fs.ContentVersion(content)
+	e.dirty, e.saved = false, true
+	e.message = fmt.Sprintf("Сохранено: %d байт", len(content))
+}
+
+// find ищет строку после курсора с переходом в начало файла; ask — запросить строку поиска
+func (e *Editor) find(ask bool) {
+	from := Pos{e.cursor.Row, e.cursor.Col + 1}
+	if ask {
+		query, ok := e.prompt("Найти: ", e.search)
+		if !ok || query == "" {
+			return
+		}
+		e.search, from = query, e.cursor
+	}
+	if e.search == "" {
+		e.message = "Строка поиска не задана (Ctrl-F)"
+		return
+	}
+	pos, ok := e.buf.Find(e.search, from)
+	if !ok {
+		if pos, ok = e.buf.Find(e.search, Pos{}); ok {
+			e.message = "Поиск продолжен с начала файла"
+		}
+	}
+	if !ok {
+		e.message = "Не найдено: " + e.search
+		return
+	}
+	e.buf.Seal()
+	e.cursor = pos
+}
+
+// replace заменяет совпадения от курсора до конца файла и затем с начала до
+// курсора, спрашивая подтверждение для каждого. Вся замена отменяется одним шагом
+func (e *Editor) replace() {
+	query, ok := e.prompt("Заменить: ", e.search)
+	if !ok || query == "" {
+		return
+	}
+	replacement, ok := e.prompt("Заменить «"+query+"» на: ", "")
+	if !ok {
+		return
+	}
+	e.search = query
+	queryLen, replacementLen := utf8.RuneCountInString(query), utf8.RuneCountInString(replacement)
+
+	start, pos := e.cursor, e.cursor
+	wrapped, all, count := false, false, 0
+	e.buf.Batch(func() {
+		for {
+			match, ok := e.buf.Find(query, pos)
+			if ok && wrapped && !match.before(start) {
+				ok = false
+			}
+			if !ok {
+				if wrapped {
+					return
+				}
+				wrapped, pos = true, Pos{}
+				continue
+			}
+			e.cursor = match
+			if !all {
+				switch e.ask("Заменить? y — да, n — нет, a — все, q — закончить") {
+				case 'y':
+				case 'a':
+					all = true
+				case 'n':
+					pos = Pos{match.Row, match.Col + 1}
+					continue
+				default:
+					return
+				}
+			}
+			pos = e.buf.Edit(match, Pos{match.Row, match.Col + queryLen}, replacement, e.cursor)
+			if wrapped && match.Row == start.Row {
+				start.Col += replacementLen - queryLen
+			}
+			e.cursor = pos
+			e.dirty = true
+			count++
+		}
+	})
+	e.message = fmt.Sprintf("Заменено: %d", count)
+}
+
+// prompt запрашивает строку в строке сообщений; false — ввод отменён (Esc)
+func (e *Editor) prompt(label, initial string) (string, bool) {
+	input := []rune(initial)
+	e.prompting = true
+	defer func() { e.prompting = false }()
+	for {
+		e.message = label + string(input)
+		e.render()
+		k, err := readKey(e.in)
+		switch {
+		case err != nil, k == keyEscape, k == keyCtrlC, k == keyCtrlQ:
+			e.message = ""
+			return "", false
+		case k == keyEnter:
+			e.message = ""
+			return string(input), true
+		case k == keyBackspace || k == keyCtrlH:
+			if len(input) > 0 {
+				input = input[:len(input)-1]
+			}
+		case k >= 0 && unicode.IsPrint(rune(k)):
+			input = append(input, rune(k))
+		}
+	}
+}
+
+// ask задаёт вопрос и возвращает нажатую клавишу в нижнем регистре
+func (e *Editor) ask(question string) rune {
+	e.message = question
+	e.render()
+	k, err := readKey(e.in)
+	e.message = ""
+	if err != nil || k < 0 {
+		return 0
+	}
+	return unicode.ToLower(rune(k))
+}
+
+// confirm задаёт вопрос «да/нет»; да — y или д
+func (e *Editor) confirm(question string) bool {
+	switch e.ask(question) {
+	case 'y', 'д':
+		return true
+	}
+	return false
+}
+
+// render перерисовывает экран: текст, строку состояния и строку сообщений
+func (e *Editor) render() {
+	rows, cols := e.size()
+	e.textRows = max(rows-2, 1)
+	line := e.buf.Line(e.cursor.Row)
+	x := screenWidth(line[:e.cursor.Col])
+
+	// Прокрутка к курсору
+	if e.cursor.Row < e.top {
+		e.top = e.cursor.Row
+	}
+	if e.cursor.Row >= e.top+e.textRows {
+		e.top = e.cursor.Row - e.textRows + 1
+	}
+	if x < e.left {
+		e.left = x
+	}
+	if x >= e.left+cols {
+		e.left = x - cols + 1
+	}
+
+	w := e.out
+	w.WriteString("\x1b[?25l\x1b[H")
+	for y := 0; y < e.textRows; y++ {
+		if row := e.top + y; row < e.buf.LineCount() {
+			w.WriteString(visibleText(e.buf.Line(row), e.left, cols))
+		} else {
+			w.WriteString("~")
+		}
+		w.WriteString("\x1b[K\r\n")
+	}
+
+	modified := ""
+	if e.dirty {
+		modified = " [изменён]"
+	}
+	status := fmt.Sprintf(" %s%s — строка %d из %d, столбец %d", e.path, modified, e.cursor.Row+1, e.buf.LineCount(), e.cursor.Col+1)
+	status = visibleText([]rune(status), 0, cols)
+	w.WriteString("\x1b[7m" + status + strings.Repeat(" ", max(cols-utf8.RuneCountInString(status), 0)) + "\x1b[m\r\n")
+
+	message := e.message
+	if message == "" {
+		message = helpLine
+	}
+	message = visibleText([]rune(message), 0, cols)
+	w.WriteString(message + "\x1b[K")
+
+	if e.prompting {
+		fmt.Fprintf(w, "\x1b[%d;%dH", e.textRows+2, utf8.RuneCountInString(message)+1)
+	} else {
+		fmt.Fprintf(w, "\x1b[%d;%dH", e.cursor.Row-e.top+1, x-e.left+1)
+	}
+	w.WriteString("\x1b[?25h")
+	w.Flush()
+}
+
+// screenWidth — ширина текста на экране (табуляция до ближайшей позиции, кратной tabWidth)
+func screenWidth(line []rune) int {
+	x := 0
+	for _, r := range line {
+		if r == '\t' {
+			x += tabWidth - x%tabWidth
+		} else {
+			x++
+		}
+	}
+	return x
+}
+
+// visibleText возвращает часть строки, видимую с экранного столбца left на
+// ширину cols. Табуляция заменяется пробелами, управляющие символы — знаком «?»,
+// чтобы содержимое файла не могло управлять терминалом
+func visibleText(line []rune, left, cols int) string {
+	var b strings.Builder
+	x := 0
+	put := func(r rune) {
+		if x >= left && x < left+cols {
+			b.WriteRune(r)
+		}
+		x++
+	}
+	for _, r := range line {
+		switch {
+		case r == '\t':
+			for n := tabWidth - x%tabWidth; n > 0; n-- {
+				put(' ')
+			}
+		case unicode.IsControl(r):
+			put('?')
+		default:
+			put(r)
+		}
+		if x >= left+cols {
+			break
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package editor
+
+// Полноэкранный режим реализован только для Linux; на других системах
+// используется построчный редактор
+
+func makeRaw(fd int) (func(), error) {
+	return nil, ErrNoTerminal
+}
+
+func windowSize(fd int) (rows, cols int) {
+	return defaultRows, defaultCols
+}
@@ -6,8 +6,11 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 )
 
 const (
@@ -15,82 +18,530 @@ const (
 	MaxDecompressedSize = 100 * 1024 * 1024 // 100 MB
 	// MaxCompressionRatio — максимальная степень сжатия (защита от ZIP-бомб)
 	MaxCompressionRatio = 100 // 100:1
+	// MaxArchiveEntries — максимальное количество записей в архиве
+	MaxArchiveEntries = 10000
+	// MaxArchiveDepth — максимальная глубина вложенности путей внутри архива
+	MaxArchiveDepth = 32
+	// MaxArchiveNesting — максимальная глубина вложенности архивов друг в друга при проверке
+	MaxArchiveNesting = 3
 )
 
-// CreateZip создаёт ZIP-архив из файла или директории
-func CreateZip(source, target string) error {
-	safeSource, err := ResolvePath(source)
+// ratioCheckThreshold — объём распакованных данных, после которого проверяется степень сжатия
+// Небольшие файлы (например, пустые блоки tar по 512 байт) легально сжимаются сильнее 100:1
+const ratioCheckThreshold = 1024 * 1024 // 1 MB
+
+var (
+	// errTooLarge — общая ошибка превышения лимита распакованных данных
+	errTooLarge = errors.New("обнаружена архивная бомба: превышен лимит размера распакованных данных")
+	// errRatioTooHigh — фактическая степень сжатия превышает допустимую
+	errRatioTooHigh = errors.New("обнаружена архивная бомба: слишком высокая степень сжатия")
+	// errTooManyEntries — в архиве больше записей, чем разрешено
+	errTooManyEntries = errors.New("обнаружена архивная бомба: слишком много записей в архиве")
+)
+
+// ArchiveLimits — лимиты распаковки архивов
+// Нулевое значение поля означает значение по умолчанию
+type ArchiveLimits struct {
+	MaxSize    int64 // суммарный размер распакованных данных (байт)
+	MaxRatio   int64 // степень сжатия (N:1)
+	MaxEntries int   // количество записей
+	MaxDepth   int   // глубина вложенности пути записи
+	MaxNesting int   // глубина вложенности архивов друг в друга
+}
+
+// archiveLimits — действующие лимиты (устанавливаются в InitFS из конфигурации)
+var archiveLimits = DefaultArchiveLimits()
+
+// DefaultArchiveLimits возвращает лимиты распаковки по умолчанию
+func DefaultArchiveLimits() ArchiveLimits {
+	return ArchiveLimits{
+		MaxSize:    MaxDecompressedSize,
+		MaxRatio:   MaxCompressionRatio,
+		MaxEntries: MaxArchiveEntries,
+		MaxDepth:   MaxArchiveDepth,
+		MaxNesting: MaxArchiveNesting,
+	}
+}
+
+// SetArchiveLimits устанавливает лимиты распаковки; нулевые поля заменяются значениями по умолчанию
+func SetArchiveLimits(limits ArchiveLimits) {
+	defaults := DefaultArchiveLimits()
+	if limits.MaxSize <= 0 {
+		limits.MaxSize = defaults.MaxSize
+	}
+	if limits.MaxRatio <= 0 {
+		limits.MaxRatio = defaults.MaxRatio
+	}
+	if limits.MaxEntries <= 0 {
+		limits.MaxEntries = defaults.MaxEntries
+	}
+	if limits.MaxDepth <= 0 {
+		limits.MaxDepth = defaults.MaxDepth
+	}
+	if limits.MaxNesting <= 0 {
+		limits.MaxNesting = defaults.MaxNesting
+	}
+	archiveLimits = limits
+}
+
+// CurrentArchiveLimits возвращает действующие лимиты распаковки
+func CurrentArchiveLimits() ArchiveLimits {
+	return archiveLimits
+}
+
+// ratioReader считает фактически распакованные байты и проверяет степень сжатия
+// относительно сжатого размера (заголовкам архива не доверяем)
+type ratioReader struct {
+	r              io.Reader
+	compressedSize int64
+	total          int64
+}
+
+func (rr *ratioReader) Read(p []byte) (int, error) {
+	n, err := rr.r.Read(p)
+	rr.total += int64(n)
+	if ratioExceeded(rr.total, rr.compressedSize) {
+		return n, errRatioTooHigh
+	}
+	return n, err
+}
+
+// ratioExceeded — общая проверка степени сжатия для распаковки, просмотра и
+// проверки целостности: данные до ratioCheckThreshold не проверяются, поэтому
+// архив, который распаковывается, не помечается как опасный
+func ratioExceeded(uncompressed, compressed int64) bool {
+	return uncompressed > ratioCheckThreshold && uncompressed > compressed*archiveLimits.MaxRatio
+}
+
+// ratioProblem описывает превышение степени сжатия ("" — проблемы нет)
+func ratioProblem(uncompressed, compressed int64) string {
+	if !ratioExceeded(uncompressed, compressed) {
+		return ""
+	}
+	return fmt.Sprintf("степень сжатия %.0f:1 превышает %d:1",
+		compressionRatio(uint64(uncompressed), uint64(compressed)), archiveLimits.MaxRatio)
+}
+
+// copyLimited копирует не более limit байт; при превышении лимита возвращает ошибку,
+// а не обрезает файл молча (LimitReader читает на один байт больше лимита)
+func copyLimited(dst io.Writer, src io.Reader, limit int64) (int64, error) {
+	if limit < 0 {
+		limit = 0
+	}
+	n, err := io.Copy(dst, io.LimitReader(src, limit+1))
 	if err != nil {
-		return err
+		return n, err
 	}
-	safeTarget, err := ResolvePath(target)
+	if n > limit {
+		return n, errTooLarge
+	}
+	return n, nil
+}
+
+// Поддерживаемые форматы архивов
+const (
+	FormatZip   = "zip"
+	FormatTar   = "tar"
+	FormatTarGz = "tar.gz"
+	FormatGzip  = "gz"
+)
+
+// DetectArchiveFormat определяет формат архива по расширению имени файла
+func DetectArchiveFormat(name string) (string, error) {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return FormatZip, nil
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return FormatTarGz, nil
+	case strings.HasSuffix(lower, ".tar"):
+		return FormatTar, nil
+	case strings.HasSuffix(lower, ".gz"):
+		return FormatGzip, nil
+	}
+	return "", errors.New("неизвестный формат архива (поддерживаются .zip, .tar, .tar.gz, .tgz, .gz)")
+}
+
+// ExtractOptions — параметры распаковки архива
+type ExtractOptions struct {
+	// Patterns — glob-шаблоны записей для выборочной распаковки (пусто — все записи)
+	// Шаблон сравнивается с полным именем записи и с её базовым именем;
+	// шаблон с "/" на конце выбирает всё содержимое папки
+	Patterns []string
+	// Overwrite — политика для файлов, уже существующих в папке назначения
+	Overwrite OverwritePolicy
+	// Password — пароль для зашифрованных записей ZIP
+	Password string
+}
+
+// DefaultStoreExtensions — расширения уже сжатых форматов, которые сохраняются без сжатия
+var DefaultStoreExtensions = []string{
+	".zip", ".gz", ".tgz", ".bz2", ".xz", ".7z", ".rar",
+	".jpg", ".jpeg", ".png", ".gif", ".webp",
+	".mp3", ".mp4", ".mkv", ".avi", ".docx", ".xlsx", ".pptx", ".odt",
+}
+
+// zipEpoch — фиксированное время записей воспроизводимого архива (минимальная дата формата ZIP)
+var zipEpoch = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// ZipOptions — параметры создания ZIP-архива
+type ZipOptions struct {
+	// Deterministic — воспроизводимый архив: записи отсортированы по имени,
+	// время фиксировано (1980-01-01), права нормализованы до 0644/0755
+	Deterministic bool
+	// StoreExtensions — расширения файлов, сохраняемых без сжатия
+	// (nil — DefaultStoreExtensions, пустой срез — сжимать всё)
+	StoreExtensions []string
+	// Exclude — glob-шаблоны исключаемых файлов и папок (синтаксис как у ExtractOptions.Patterns)
+	Exclude []string
+	// Password — пароль для шифрования записей AES-256 (WinZip AE-2); пусто — без шифрования
+	// Соль случайна, поэтому зашифрованный архив не бывает побайтно воспроизводимым
+	Password string
+}
+
+// shouldStore сообщает, нужно ли сохранить запись без сжатия
+func (o ZipOptions) shouldStore(name string) bool {
+	extensions := o.StoreExtensions
+	if extensions == nil {
+		extensions = DefaultStoreExtensions
+	}
+	ext := strings.ToLower(path.Ext(name))
+	for _, e := range extensions {
+		if ext == strings.ToLower(e) {
+			return true
+		}
+	}
+	return false
+}
+
+// safePerm оставляет только безопасные права: без setuid/setgid/sticky и без записи
+// для группы и остальных; владелец всегда может читать (и, для папок, открывать) запись
+func safePerm(mode os.FileMode, isDir bool) os.FileMode {
+	perm := mode.Perm() & 0755
+	if isDir {
+		return perm | 0700
+	}
+	return perm | 0600
+}
+
+// normalizedPerm приводит права к 0755 для папок и исполняемых файлов, 0644 для остальных
+func normalizedPerm(mode os.FileMode, isDir bool) os.FileMode {
+	if isDir || mode.Perm()&0111 != 0 {
+		return 0755
+	}
+	return 0644
+}
+
+// CreateArchive создаёт архив из одного или нескольких источников;
+// формат определяется по расширению target
+func CreateArchive(sources []string, target string) error {
+	format, err := DetectArchiveFormat(target)
 	if err != nil {
 		return err
 	}
+	if len(sources) == 0 {
+		return errors.New("не указаны источники для архивации")
+	}
+	switch format {
+	case FormatZip:
+		return CreateZipFromSources(sources, target)
+	case FormatTar:
+		return CreateTarFromSources(sources, target, false)
+	case FormatTarGz:
+		return CreateTarFromSources(sources, target, true)
+	default:
+		if len(sources) != 1 {
+			return errors.New("gzip сжимает только один файл (для нескольких используйте .tar.gz)")
+		}
+		return Gzip(sources[0], target)
+	}
+}
 
-	zipFile, err := os.Create(safeTarget)
+// ExtractArchive распаковывает архив любого поддерживаемого формата в директорию dest
+func ExtractArchive(src, dest string, opts ExtractOptions) error {
+	format, err := DetectArchiveFormat(src)
 	if err != nil {
 		return err
 	}
-	defer zipFile.Close()
+	switch format {
+	case FormatZip:
+		return UnzipWithOptions(src, dest, opts)
+	case FormatTar, FormatTarGz:
+		return ExtractTarWithOptions(src, dest, opts)
+	default:
+		// Одиночный gzip-файл распаковывается в dest под исходным именем без .gz
+		name := strings.TrimSuffix(filepath.Base(src), filepath.Ext(src))
+		if len(opts.Patterns) > 0 && !matchEntry(name, opts.Patterns) {
+			return errors.New("ни одна запись архива не соответствует шаблонам")
+		}
+		return gunzipStaged(src, dest, name, opts.Overwrite)
+	}
+}
+
+// matchEntry проверяет, выбрана ли запись архива шаблонами
+func matchEntry(name string, patterns []string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	name = strings.TrimSuffix(filepath.ToSlash(name), "/")
+	for _, pattern := range patterns {
+		pattern = strings.TrimSpace(filepath.ToSlash(pattern))
+		if pattern == "" {
+			continue
+		}
+		if strings.HasSuffix(pattern, "/") {
+			dir := strings.TrimSuffix(pattern, "/")
+			if name == dir || strings.HasPrefix(name, dir+"/") {
+				return true
+			}
+			continue
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, path.Base(name)); ok {
+			return true
+		}
+	}
+	return false
+}
 
-	archive := zip.NewWriter(zipFile)
-	defer archive.Close()
+// validatePatterns проверяет синтаксис glob-шаблонов до начала распаковки
+func validatePatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(strings.TrimSpace(pattern), ""); err != nil {
+			return fmt.Errorf("некорректный шаблон %q: %v", pattern, err)
+		}
+	}
+	return nil
+}
 
-	info, err := os.Stat(safeSource)
-	if err != nil {
-		return err
+// safeJoin объединяет директорию назначения с именем из архива
+// Защита от Zip Slip: результат обязан оставаться внутри dest
+func safeJoin(dest, name string) (string, error) {
+	if strings.Contains(name, "\x00") {
+		return "", fmt.Errorf("недопустимый путь файла в архиве: %q", name)
+	}
+	fpath := filepath.Join(dest, name)
+	if !strings.HasPrefix(fpath, filepath.Clean(dest)+string(os.PathSeparator)) {
+		return "", fmt.Errorf("недопустимый путь файла в архиве: %s", name)
 	}
+	return fpath, nil
+}
 
-	var baseDir string
-	if info.IsDir() {
-		baseDir = filepath.Base(safeSource)
+// compressionRatio вычисляет степень сжатия (распакованный / сжатый размер)
+func compressionRatio(uncompressed, compressed uint64) float64 {
+	if uncompressed == 0 {
+		return 0
 	}
+	if compressed == 0 {
+		// Непустые данные из пустого потока — заведомо бомба
+		return float64(uncompressed)
+	}
+	return float64(uncompressed) / float64(compressed)
+}
 
-	// Обходим все файлы и добавляем их в архив
-	filepath.Walk(safeSource, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
+// CreateZip создаёт ZIP-архив из файла или директории
+func CreateZip(source, target string) error {
+	return CreateZipFromSources([]string{source}, target)
+}
+
+// CreateZipFromSources создаёт ZIP-архив из нескольких файлов и директорий
+// Каждый источник попадает в корень архива под своим базовым именем
+func CreateZipFromSources(sources []string, target string) error {
+	return CreateZipWithOptions(sources, target, ZipOptions{})
+}
+
+// CreateZipWithOptions создаёт ZIP-архив с параметрами сжатия, исключениями
+// и, при необходимости, воспроизводимым (побайтно одинаковым) результатом
+func CreateZipWithOptions(sources []string, target string, opts ZipOptions) error {
+	if err := validatePatterns(opts.Exclude); err != nil {
+		return err
+	}
+	if opts.Password != "" {
+		if err := validateArchivePassword(opts.Password); err != nil {
 			return err
 		}
+	}
+	safeSources, safeTarget, err := resolveSources(sources, target)
+	if err != nil {
+		return err
+	}
+
+	if err := createZip(safeSources, safeTarget, opts); err != nil {
+		return err
+	}
+
+	indexArchive(safeTarget)
+	return nil
+}
 
-		header, err := zip.FileInfoHeader(info)
+// resolveSources проверяет пути источников и архива
+func resolveSources(sources []string, target string) ([]string, string, error) {
+	safeTarget, err := ResolvePath(target)
+	if err != nil {
+		return nil, "", err
+	}
+	var safeSources []string
+	for _, source := range sources {
+		safeSource, err := ResolvePath(source)
 		if err != nil {
-			return err
+			return nil, "", err
 		}
-
-		if baseDir != "" {
-			header.Name = filepath.Join(baseDir, strings.TrimPrefix(path, safeSource))
+		if safeSource == safeTarget {
+			return nil, "", errors.New("архив не может быть собственным источником")
 		}
+		safeSources = append(safeSources, safeSource)
+	}
+	return safeSources, safeTarget, nil
+}
 
-		if info.IsDir() {
-			header.Name += "/"
-		} else {
-			header.Method = zip.Deflate // Используем сжатие Deflate
+// createZip записывает архив во временный файл и подменяет им safeTarget только
+// при успехе: ошибка в источниках не уничтожает уже существующий архив
+func createZip(safeSources []string, safeTarget string, opts ZipOptions) error {
+	items, err := collectZipItems(safeSources, safeTarget, opts)
+	if err != nil {
+		return err
+	}
+
+	return replaceViaTemp(safeTarget, func(zipFile *os.File) error {
+		archive := zip.NewWriter(zipFile)
+		for _, item := range items {
+			if err := writeZipItem(archive, item, opts, filepath.Dir(safeTarget)); err != nil {
+				archive.Close()
+				return err
+			}
 		}
+		return archive.Close()
+	})
+}
+
+// zipItem — файл или папка, попадающие в архив
+type zipItem struct {
+	name string // имя записи в архиве ("dir/file.txt", у папок — "/" на конце)
+	path string // путь в sandbox
+	info os.FileInfo
+}
+
+// collectZipItems обходит источники и составляет список записей архива
+// Символические ссылки и специальные файлы пропускаются: ссылка может указывать за пределы sandbox
+func collectZipItems(safeSources []string, safeTarget string, opts ZipOptions) ([]zipItem, error) {
+	var items []zipItem
+	seen := make(map[string]bool)
 
-		writer, err := archive.CreateHeader(header)
+	for _, safeSource := range safeSources {
+		info, err := os.Stat(safeSource)
 		if err != nil {
-			return err
+			return nil, err
 		}
-
+		var baseDir string
 		if info.IsDir() {
-			return nil
+			baseDir = filepath.Base(safeSource)
 		}
 
-		file, err := os.Open(path)
+		err = filepath.Walk(safeSource, func(path string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			// Создаваемый архив может лежать внутри архивируемой папки
+			if path == safeTarget || (!fi.Mode().IsRegular() && !fi.IsDir()) {
+				return nil
+			}
+
+			name := fi.Name()
+			if baseDir != "" {
+				name = filepath.ToSlash(filepath.Join(baseDir, strings.TrimPrefix(path, safeSource)))
+			}
+			if len(opts.Exclude) > 0 && matchEntry(name, opts.Exclude) {
+				if fi.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if fi.IsDir() {
+				name += "/"
+			}
+
+			if seen[name] {
+				return fmt.Errorf("повторяющееся имя в архиве: %s", name)
+			}
+			seen[name] = true
+			items = append(items, zipItem{name: name, path: path, info: fi})
+			return nil
+		})
 		if err != nil {
-			return err
+			return nil, err
 		}
-		defer file.Close()
-		_, err = io.Copy(writer, file)
+	}
+
+	if opts.Deterministic {
+		sort.Slice(items, func(i, j int) bool { return items[i].name < items[j].name })
+	}
+	return items, nil
+}
+
+// writeZipItem записывает заголовок и содержимое одной записи
+// tmpDir — папка для временного файла при шифровании
+func writeZipItem(archive *zip.Writer, item zipItem, opts ZipOptions, tmpDir string) error {
+	header, err := zip.FileInfoHeader(item.info)
+	if err != nil {
 		return err
-	})
+	}
+	header.Name = item.name
 
+	// Не переносим setuid/setgid и права записи для группы и остальных
+	mode := safePerm(item.info.Mode(), item.info.IsDir())
+	if opts.Deterministic {
+		header.Modified = zipEpoch
+		mode = normalizedPerm(item.info.Mode(), item.info.IsDir())
+	}
+	if item.info.IsDir() {
+		mode |= os.ModeDir
+	}
+	header.SetMode(mode)
+
+	if item.info.IsDir() {
+		header.Method = zip.Store
+	} else if opts.shouldStore(item.name) {
+		header.Method = zip.Store
+	} else {
+		header.Method = zip.Deflate
+	}
+
+	if item.info.IsDir() {
+		_, err := archive.CreateHeader(header)
+		return err
+	}
+
+	file, err := os.Open(item.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if opts.Password != "" {
+		return writeEncryptedEntry(archive, header, file, opts.Password, tmpDir)
+	}
+	writer, err := archive.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(writer, file)
 	return err
 }
 
 // Unzip распаковывает ZIP-архив с защитой от ZIP-бомб и Zip Slip
 func Unzip(src, dest string) error {
+	return UnzipWithOptions(src, dest, ExtractOptions{})
+}
+
+// UnzipWithOptions распаковывает ZIP-архив (целиком или выборочно по шаблонам)
+// Лимиты проверяются по фактически распакованным байтам. Архив распаковывается
+// во временную папку и переносится в dest только целиком, с учётом opts.Overwrite
+func UnzipWithOptions(src, dest string, opts ExtractOptions) error {
+	if err := validatePatterns(opts.Patterns); err != nil {
+		return err
+	}
 	safeSrc, err := ResolvePath(src)
 	if err != nil {
 		return err
@@ -106,57 +557,80 @@ func Unzip(src, dest string) error {
 	}
 	defer r.Close()
 
-	var totalSize int64
-
-	for _, f := range r.File {
-		// Защита от ZIP-бомб #1: проверка степени сжатия
-		if f.UncompressedSize64 > 0 && float64(f.UncompressedSize64)/float64(f.CompressedSize64) > MaxCompressionRatio {
-			return fmt.Errorf("обнаружена ZIP-бомба: слишком высокая степень сжатия для %s", f.Name)
-		}
+	budget := newExtractBudget()
+	// Защита от ZIP-бомб #1: количество записей известно из центрального каталога
+	if len(r.File) > budget.limits.MaxEntries {
+		return fmt.Errorf("%w: %d (лимит %d)", errTooManyEntries, len(r.File), budget.limits.MaxEntries)
+	}
 
-		// Защита от ZIP-бомб #2: проверка общего размера
-		totalSize += int64(f.UncompressedSize64)
-		if totalSize > MaxDecompressedSize {
-			return errors.New("обнаружена ZIP-бомба: превышен лимит размера распакованных данных")
-		}
+	extracted, err := extractStaged(safeDest, opts.Overwrite, func(stage string) error {
+		return unzipEntries(r, stage, opts, budget)
+	})
+	if err != nil {
+		return err
+	}
 
-		fpath := filepath.Join(safeDest, f.Name)
+	indexArchive(safeSrc)
+	for _, path := range extracted {
+		indexFile(path)
+	}
+	return nil
+}
 
-		// Защита от Zip Slip (Path Traversal внутри архива)
-		if !strings.HasPrefix(fpath, filepath.Clean(safeDest)+string(os.PathSeparator)) {
-			return fmt.Errorf("недопустимый путь файла: %s", fpath)
-		}
+// unzipEntries распаковывает выбранные записи в папку stage
+func unzipEntries(r *zip.ReadCloser, stage string, opts ExtractOptions, budget *extractBudget) error {
+	selected := 0
+	dirs := &dirTimes{}
 
-		if f.FileInfo().IsDir() {
-			os.MkdirAll(fpath, os.ModePerm)
+	for _, f := range r.File {
+		if !matchEntry(f.Name, opts.Patterns) {
 			continue
 		}
+		selected++
 
-		if err = os.MkdirAll(filepath.Dir(fpath), os.ModePerm); err != nil {
+		// Защита от ZIP-бомб #2: глубина вложенности пути
+		if err := budget.checkEntry(f.Name); err != nil {
 			return err
 		}
 
-		outFile, err := os.OpenFile(fpath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.Mode())
+		// Защита от Zip Slip (Path Traversal внутри архива)
+		fpath, err := safeJoin(stage, f.Name)
 		if err != nil {
 			return err
 		}
 
-		rc, err := f.Open()
-		if err != nil {
-			outFile.Close()
-			return err
+		if f.FileInfo().IsDir() {
+			if err := os.MkdirAll(fpath, 0755); err != nil {
+				return err
+			}
+			if err := restoreMetadata(fpath, f.Mode(), true, f.Modified); err != nil {
+				return err
+			}
+			dirs.add(fpath, f.Modified)
+			continue
 		}
 
-		// Ограничиваем чтение для предотвращения бесконечного потока
-		limitReader := io.LimitReader(rc, MaxDecompressedSize)
-		_, err = io.Copy(outFile, limitReader)
-
-		outFile.Close()
+		// Зашифрованные записи расшифровываются потоково; все лимиты ниже применяются к открытому тексту
+		rc, err := openZipEntry(f, opts.Password)
+		if err != nil {
+			return fmt.Errorf("%s: %w", f.Name, err)
+		}
+		// Защита от ZIP-бомб #3: фактическая степень сжатия записи и общий объём распакованных данных
+		rr := &ratioReader{r: rc, compressedSize: int64(f.CompressedSize64)}
+		_, err = budget.writeEntry(fpath, rr, safePerm(f.Mode(), false))
 		rc.Close()
-
 		if err != nil {
+			return fmt.Errorf("%s: %w", f.Name, err)
+		}
+		if err := restoreMetadata(fpath, f.Mode(), false, f.Modified); err != nil {
 			return err
 		}
 	}
+
+	if selected == 0 && len(opts.Patterns) > 0 {
+		return errors.New("ни одна запись архива не соответствует шаблонам")
+	}
+	// Время папок восстанавливается последним: запись файлов его изменяет
+	dirs.apply()
 	return nil
 }
@@ -0,0 +1,186 @@
+package fs
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ZipUpdate — набор изменений для существующего ZIP-архива
+type ZipUpdate struct {
+	Add    map[string]string // имя записи → путь файла в sandbox (добавить или заменить)
+	Remove []string          // glob-шаблоны удаляемых записей (как в ExtractOptions)
+	// Deterministic — новые записи получают фиксированное время и
+	// нормализованные права, как в ZipOptions (для воспроизводимых архивов)
+	Deterministic bool
+}
+
+// ZipUpdateResult — итог обновления архива
+type ZipUpdateResult struct {
+	Added    int // новых записей
+	Replaced int // заменённых записей
+	Removed  int // удалённых записей
+}
+
+// UpdateZip добавляет, заменяет и удаляет записи существующего ZIP-архива
+// Архив переписывается во временный файл рядом с оригиналом и атомарно
+// подменяет его через rename — при ошибке исходный архив не изменяется
+func UpdateZip(archivePath string, update ZipUpdate) (*ZipUpdateResult, error) {
+	safeArchive, err := ResolvePath(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	if err := validatePatterns(update.Remove); err != nil {
+		return nil, err
+	}
+
+	// Проверяем имена новых записей и пути исходных файлов до изменения архива
+	additions := make(map[string]string, len(update.Add))
+	for name, source := range update.Add {
+		entryName, err := normalizeEntryName(name)
+		if err != nil {
+			return nil, err
+		}
+		safeSource, err := ResolvePath(source)
+		if err != nil {
+			return nil, err
+		}
+		if safeSource == safeArchive {
+			return nil, errors.New("архив не может быть добавлен сам в себя")
+		}
+		info, err := os.Stat(safeSource)
+		if err != nil {
+			return nil, err
+		}
+		if !info.Mode().IsRegular() {
+			return nil, fmt.Errorf("%s: добавлять можно только обычные файлы", source)
+		}
+		if _, dup := additions[entryName]; dup {
+			return nil, fmt.Errorf("запись %s указана несколько раз", entryName)
+		}
+		additions[entryName] = safeSource
+	}
+
+	fileMutex.Lock()
+	result, err := rewriteZip(safeArchive, update.Remove, additions, ZipOptions{Deterministic: update.Deterministic})
+	fileMutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	indexArchive(safeArchive)
+	return result, nil
+}
+
+// normalizeEntryName приводит имя записи к виду "dir/file.txt" и проверяет его безопасность
+func normalizeEntryName(name string) (string, error) {
+	entryName := strings.TrimPrefix(filepath.ToSlash(strings.TrimSpace(name)), "./")
+	if entryName == "" || strings.HasSuffix(entryName, "/") {
+		return "", fmt.Errorf("недопустимое имя записи: %q", name)
+	}
+	if strings.HasPrefix(entryName, "/") || strings.Contains(entryName, "..") {
+		return "", fmt.Errorf("недопустимое имя записи: %s", name)
+	}
+	if _, err := safeJoin(inspectDest, entryName); err != nil {
+		return "", err
+	}
+	return entryName, nil
+}
+
+// rewriteZip копирует сохраняемые записи без перепаковки, добавляет новые и
+// подменяет архив, сохраняя его права доступа
+func rewriteZip(safeArchive string, remove []string, additions map[string]string, opts ZipOptions) (*ZipUpdateResult, error) {
+	info, err := os.Stat(safeArchive)
+	if err != nil {
+		return nil, err
+	}
+	r, err := zip.OpenReader(safeArchive)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(safeArchive), ".zipupdate-*")
+	if err != nil {
+		return nil, err
+	}
+	tmpPath := tmp.Name()
+	committed := false
+	defer func() {
+		if !committed {
+			tmp.Close()
+			os.Remove(tmpPath)
+		}
+	}()
+
+	result := &ZipUpdateResult{}
+	// Заменённые имена: запись с повторяющимся в архиве именем заменяется один раз
+	replaced := make(map[string]bool)
+	w := zip.NewWriter(tmp)
+
+	for _, f := range r.File {
+		if len(remove) > 0 && matchEntry(f.Name, remove) {
+			result.Removed++
+			continue
+		}
+		if _, ok := additions[f.Name]; ok {
+			replaced[f.Name] = true
+			continue
+		}
+		// Copy переносит сжатые данные как есть, без распаковки
+		if err := w.Copy(f); err != nil {
+			return nil, err
+		}
+	}
+
+	names := make([]string, 0, len(additions))
+	for name := range additions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := addFileEntry(w, name, additions[name], opts, filepath.Dir(safeArchive)); err != nil {
+			return nil, err
+		}
+	}
+	result.Replaced = len(replaced)
+	result.Added = len(additions) - result.Replaced
+
+	if len(remove) > 0 && result.Removed == 0 && len(additions) == 0 {
+		return nil, errors.New("ни одна запись архива не соответствует шаблонам")
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	if err := tmp.Chmod(info.Mode().Perm()); err != nil {
+		return nil, err
+	}
+	if err := tmp.Sync(); err != nil {
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+	r.Close()
+
+	if err := os.Rename(tmpPath, safeArchive); err != nil {
+		return nil, err
+	}
+	committed = true
+	return result, nil
+}
+
+// addFileEntry записывает файл sandbox в архив под именем name так же, как
+// при создании архива: права без setuid и записи для других (см. safePerm)
+func addFileEntry(w *zip.Writer, name, safeSource string, opts ZipOptions, tmpDir string) error {
+	info, err := os.Stat(safeSource)
+	if err != nil {
+		return err
+	}
+	return writeZipItem(w, zipItem{name: name, path: safeSource, info: info}, opts, tmpDir)
+}
@@ -0,0 +1,476 @@
+package fs
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Кодировки текстовых файлов: UTF-8 (с BOM и без), UTF-16 с BOM, Windows-1251,
+// в которой выгружают таблицы русские версии Excel и 1С, и KOI8-R из почты и
+// старых Unix-систем. Однобайтовые кириллические кодировки по байтам не
+// различить, поэтому выбирается та, в которой текст больше похож на русский
+
+const (
+	EncodingUTF8    = "UTF-8"
+	EncodingUTF16LE = "UTF-16LE"
+	EncodingUTF16BE = "UTF-16BE"
+	EncodingCP1251  = "Windows-1251"
+	EncodingKOI8R   = "KOI8-R"
+)
+
+// Encodings — поддерживаемые кодировки
+var Encodings = []string{EncodingUTF8, EncodingUTF16LE, EncodingUTF16BE, EncodingCP1251, EncodingKOI8R}
+
+// Переводы строк
+const (
+	LineEndingLF    = "LF"
+	LineEndingCRLF  = "CRLF"
+	LineEndingMixed = "смешанные"
+)
+
+// detectSampleSize — сколько байт учитывается при выборе однобайтовой кодировки
+const detectSampleSize = 64 << 10
+
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+)
+
+// cp1251High — символы Windows-1251 для байтов 0x80–0xBF; байты 0xC0–0xFF —
+// буквы А–я (U+0410–U+044F)
+var cp1251High = [64]rune{
+	0x0402, 0x0403, 0x201A, 0x0453, 0x201E, 0x2026, 0x2020, 0x2021,
+	0x20AC, 0x2030, 0x0409, 0x2039, 0x040A, 0x040C, 0x040B, 0x040F,
+	0x0452, 0x2018, 0x2019, 0x201C, 0x201D, 0x2022, 0x2013, 0x2014,
+	0xFFFD, 0x2122, 0x0459, 0x203A, 0x045A, 0x045C, 0x045B, 0x045F,
+	0x00A0, 0x040E, 0x045E, 0x0408, 0x00A4, 0x0490, 0x00A6, 0x00A7,
+	0x0401, 0x00A9, 0x0404, 0x00AB, 0x00AC, 0x00AD, 0x00AE, 0x0407,
+	0x00B0, 0x00B1, 0x0406, 0x0456, 0x0491, 0x00B5, 0x00B6, 0x00B7,
+	0x0451, 0x2116, 0x0454, 0x00BB, 0x0458, 0x0405, 0x0455, 0x0457,
+}
+
+// koi8rHigh — символы KOI8-R для байтов 0x80–0xBF (псевдографика, Ё и ё)
+var koi8rHigh = [64]rune{
+	0x2500, 0x2502, 0x250C, 0x2510, 0x2514, 0x2518, 0x251C, 0x2524,
+	0x252C, 0x2534, 0x253C, 0x2580, 0x2584, 0x2588, 0x258C, 0x2590,
+	0x2591, 0x2592, 0x2593, 0x2320, 0x25A0, 0x2219, 0x221A, 0x2248,
+	0x2264, 0x2265, 0x00A0, 0x2321, 0x00B0, 0x00B2, 0x00B7, 0x00F7,
+	0x2550, 0x2551, 0x2552, 0x0451, 0x2553, 0x2554, 0x2555, 0x2556,
+	0x2557, 0x2558, 0x2559, 0x255A, 0x255B, 0x255C, 0x255D, 0x255E,
+	0x255F, 0x2560, 0x2561, 0x0401, 0x2562, 0x2563, 0x2564, 0x2565,
+	0x2566, 0x2567, 0x2568, 0x2569, 0x256A, 0x256B, 0x256C, 0x00A9,
+}
+
+// koi8rLetters — буквы KOI8-R для байтов 0xC0–0xFF (порядок латинских созвучий)
+var koi8rLetters = []rune("юабцдефгхийклмнопярстужвьызшэщчъЮАБЦДЕФГХИЙКЛМНОПЯРСТУЖВЬЫЗШЭЩЧЪ")
+
+// cp1251Rune и koi8rRune возвращают символ для байта однобайтовой кодировки
+func cp1251Rune(c byte) rune {
+	switch {
+	case c < 0x80:
+		return rune(c)
+	case c < 0xC0:
+		return cp1251High[c-0x80]
+	}
+	return 0x0410 + rune(c-0xC0)
+}
+
+func koi8rRune(c byte) rune {
+	switch {
+	case c < 0x80:
+		return rune(c)
+	case c < 0xC0:
+		return koi8rHigh[c-0x80]
+	}
+	return koi8rLetters[c-0xC0]
+}
+
+// Обратные таблицы для записи в однобайтовых кодировках
+var (
+	cp1251Bytes = reverseTable(cp1251Rune)
+	koi8rBytes  = reverseTable(koi8rRune)
+)
+
+func reverseTable(decode func(byte) rune) map[rune]byte {
+	table := make(map[rune]byte, 128)
+	for c := 0x80; c <= 0xFF; c++ {
+		if r := decode(byte(c)); r != utf8.RuneError {
+			table[r] = byte(c)
+		}
+	}
+	return table
+}
+
+// decodeText определяет кодировку (см. detectEncoding) и возвращает текст в
+// UTF-8 без BOM
+func decodeText(data []byte) (text, encoding string) {
+	encoding = detectEncoding(data)
+	text, _ = decodeAs(data, encoding)
+	return text, encoding
+}
+
+// detectEncoding определяет кодировку по BOM и корректности UTF-8; остальные
+// данные считаются Windows-1251 или KOI8-R — в зависимости от того, в какой
+// из них текст больше похож на русский
+func detectEncoding(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, bomUTF8):
+		return EncodingUTF8
+	case bytes.HasPrefix(data, bomUTF16LE):
+		return EncodingUTF16LE
+	case bytes.HasPrefix(data, bomUTF16BE):
+		return EncodingUTF16BE
+	}
+	sample := data[:min(len(data), detectSampleSize)]
+	// UTF-16 без BOM проверяется до UTF-8: латиница в нём — корректный UTF-8 с нулевыми байтами
+	if encoding := detectUTF16(sample, len(data)); encoding != "" {
+		return encoding
+	}
+	if utf8.Valid(data) {
+		return EncodingUTF8
+	}
+	if russianScore(decodeSingleByte(sample, koi8rRune)) > russianScore(decodeSingleByte(sample, cp1251Rune)) {
+		return EncodingKOI8R
+	}
+	return EncodingCP1251
+}
+
+// detectUTF16 определяет UTF-16 без BOM по старшим байтам символов: у латиницы
+// это 0x00, у кириллицы — 0x04. В тексте UTF-16 такие байты занимают почти все
+// нечётные (LE) или чётные (BE) позиции и почти не встречаются на других
+func detectUTF16(sample []byte, size int) string {
+	if size%2 != 0 || len(sample) < 2 {
+		return ""
+	}
+	pairs := len(sample) / 2
+	var even, odd int
+	for i := 0; i+1 < len(sample); i += 2 {
+		if utf16HighByte(sample[i]) {
+			even++
+		}
+		if utf16HighByte(sample[i+1]) {
+			odd++
+		}
+	}
+	switch {
+	case odd*10 >= pairs*7 && even*10 <= pairs:
+		return EncodingUTF16LE
+	case even*10 >= pairs*7 && odd*10 <= pairs:
+		return EncodingUTF16BE
+	}
+	return ""
+}
+
+func utf16HighByte(b byte) bool {
+	return b == 0x00 || b == 0x04
+}
+
+// russianWeights — вес строчной русской буквы: от 33 у самой частой «о» до 1 у «ё»
+var russianWeights = func() map[rune]int {
+	letters := []rune("оеаинтсрвлкмдпуяыьгзбчйхжшюцщэфъё")
+	weights := make(map[rune]int, len(letters))
+	for i, r := range letters {
+		weights[r] = len(letters) - i
+	}
+	return weights
+}()
+
+// russianScore оценивает, насколько текст похож на русский. Частые буквы дают
+// больше очков, чем редкие; заглавная буква сразу после строчной и
+// псевдографика — признаки неверно выбранной кодировки
+func russianScore(text string) int {
+	penalty := len(russianWeights)
+	score := 0
+	prevLower := false
+	for _, r := range text {
+		lower := unicode.ToLower(r)
+		weight, letter := russianWeights[lower]
+		switch {
+		case letter:
+			if r != lower && prevLower {
+				score -= penalty
+			}
+			score += weight
+		case r >= 0x2500 && r <= 0x25FF:
+			score -= penalty
+		}
+		prevLower = letter && r == lower
+	}
+	return score
+}
+
+// decodeAs декодирует данные из кодировки encoding в UTF-8, отбрасывая BOM
+// этой кодировки
+func decodeAs(data []byte, encoding string) (string, error) {
+	switch encoding {
+	case EncodingUTF8:
+		data = bytes.TrimPrefix(data, bomUTF8)
+		if !utf8.Valid(data) {
+			return "", errors.New("данные не в кодировке UTF-8")
+		}
+		return string(data), nil
+	case EncodingUTF16LE, EncodingUTF16BE:
+		bigEndian := encoding == EncodingUTF16BE
+		if bigEndian {
+			data = bytes.TrimPrefix(data, bomUTF16BE)
+		} else {
+			data = bytes.TrimPrefix(data, bomUTF16LE)
+		}
+		if len(data)%2 != 0 {
+			return "", fmt.Errorf("нечётное число байт — данные не в кодировке %s", encoding)
+		}
+		return decodeUTF16(data, bigEndian), nil
+	case EncodingCP1251:
+		return decodeSingleByte(data, cp1251Rune), nil
+	case EncodingKOI8R:
+		return decodeSingleByte(data, koi8rRune), nil
+	}
+	return "", fmt.Errorf("неподдерживаемая кодировка %q", encoding)
+}
+
+func decodeUTF16(data []byte, bigEndian bool) string {
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		if bigEndian {
+			units[i] = uint16(data[2*i])<<8 | uint16(data[2*i+1])
+		} else {
+			units[i] = uint16(data[2*i+1])<<8 | uint16(data[2*i])
+		}
+	}
+	return string(utf16.Decode(units))
+}
+
+func decodeSingleByte(data []byte, decode func(byte) rune) string {
+	var b strings.Builder
+	b.Grow(len(data) * 2)
+	for _, c := range data {
+		b.WriteRune(decode(c))
+	}
+	return b.String()
+}
+
+// encodeText кодирует текст UTF-8 в кодировку encoding. bom — записать
+// метку порядка байт UTF-8; в UTF-16 она записывается всегда, иначе порядок
+// байт не определить. Символ, которого нет в однобайтовой кодировке, — ошибка
+// с номером строки
+func encodeText(text, encoding string, bom bool) ([]byte, error) {
+	switch encoding {
+	case EncodingUTF8:
+		if bom {
+			return append(append([]byte{}, bomUTF8...), text...), nil
+		}
+		return []byte(text), nil
+	case EncodingUTF16LE, EncodingUTF16BE:
+		units := utf16.Encode([]rune(text))
+		out := make([]byte, 2, 2+2*len(units))
+		if encoding == EncodingUTF16BE {
+			copy(out, bomUTF16BE)
+			for _, u := range units {
+				out = append(out, byte(u>>8), byte(u))
+			}
+		} else {
+			copy(out, bomUTF16LE)
+			for _, u := range units {
+				out = append(out, byte(u), byte(u>>8))
+			}
+		}
+		return out, nil
+	case EncodingCP1251:
+		return encodeSingleByte(text, encoding, cp1251Bytes)
+	case EncodingKOI8R:
+		return encodeSingleByte(text, encoding, koi8rBytes)
+	}
+	return nil, fmt.Errorf("неподдерживаемая кодировка %q", encoding)
+}
+
+func encodeSingleByte(text, encoding string, table map[rune]byte) ([]byte, error) {
+	out := make([]byte, 0, len(text))
+	line := 1
+	for _, r := range text {
+		if r < 0x80 {
+			if r == '\n' {
+				line++
+			}
+			out = append(out, byte(r))
+			continue
+		}
+		c, ok := table[r]
+		if !ok {
+			return nil, fmt.Errorf("строка %d: символ %q не представим в кодировке %s", line, r, encoding)
+		}
+		out = append(out, c)
+	}
+	return out, nil
+}
+
+// LookupEncoding приводит название кодировки к одному из Encodings;
+// допускаются варианты вроде utf8, cp1251, win-1251, koi8r, utf-16 (= UTF-16LE)
+func LookupEncoding(name string) (string, error) {
+	key := strings.NewReplacer("-", "", "_", "", " ", "").Replace(strings.ToLower(name))
+	switch key {
+	case "utf8":
+		return EncodingUTF8, nil
+	case "utf16", "utf16le", "unicode":
+		return EncodingUTF16LE, nil
+	case "utf16be":
+		return EncodingUTF16BE, nil
+	case "windows1251", "win1251", "cp1251", "1251", "ansi":
+		return EncodingCP1251, nil
+	case "koi8r", "koi8":
+		return EncodingKOI8R, nil
+	}
+	return "", fmt.Errorf("неизвестная кодировка %q, поддерживаются: %s", name, strings.Join(Encodings, ", "))
+}
+
+// detectLineEnding возвращает вид переводов строк текста ("" — переводов нет)
+func detectLineEnding(text string) string {
+	crlf := strings.Count(text, "\r\n")
+	lf := strings.Count(text, "\n") - crlf
+	switch {
+	case crlf == 0 && lf == 0:
+		return ""
+	case crlf == 0:
+		return LineEndingLF
+	case lf == 0:
+		return LineEndingCRLF
+	}
+	return LineEndingMixed
+}
+
+// normalizeLineEndings приводит все переводы строк к LF или CRLF
+func normalizeLineEndings(text, ending string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	if ending == LineEndingCRLF {
+		text = strings.ReplaceAll(text, "\n", "\r\n")
+	}
+	return text
+}
+
+// TextFile — текстовый файл, преобразованный в UTF-8
+type TextFile struct {
+	Content    string // текст в UTF-8 без BOM
+	Encoding   string // кодировка файла на диске
+	Detected   bool   // кодировка определена автоматически
+	BOM        bool   // файл начинается с метки порядка байт
+	LineEnding string // LineEndingLF, LineEndingCRLF, LineEndingMixed или "" (одна строка)
+	Version    string // версия содержимого на диске (см. WriteFileIfMatch)
+}
+
+// ReadText читает текстовый файл в кодировке encoding и возвращает текст в
+// UTF-8. Пустая кодировка — определить по BOM и содержимому
+func ReadText(path, encoding string) (*TextFile, error) {
+	safePath, err := ResolvePath(path)
+	if err != nil {
+		return nil, err
+	}
+	content, err := readStructuredFile(safePath)
+	if err != nil {
+		return nil, err
+	}
+	return decodeTextFile([]byte(content), encoding)
+}
+
+func decodeTextFile(data []byte, encoding string) (*TextFile, error) {
+	tf := &TextFile{Version: ContentVersion(string(data))}
+	if encoding == "" {
+		encoding, tf.Detected = detectEncoding(data), true
+	} else {
+		var err error
+		if encoding, err = LookupEncoding(encoding); err != nil {
+			return nil, err
+		}
+	}
+	text, err := decodeAs(data, encoding)
+	if err != nil {
+		return nil, err
+	}
+	tf.Content, tf.Encoding = text, encoding
+	switch encoding {
+	case EncodingUTF8:
+		tf.BOM = bytes.HasPrefix(data, bomUTF8)
+	case EncodingUTF16LE:
+		tf.BOM = bytes.HasPrefix(data, bomUTF16LE)
+	case EncodingUTF16BE:
+		tf.BOM = bytes.HasPrefix(data, bomUTF16BE)
+	}
+	tf.LineEnding = detectLineEnding(text)
+	return tf, nil
+}
+
+// RecodeOptions — параметры перекодирования файла (не путать с ConvertFile,
+// который преобразует формат данных)
+type RecodeOptions struct {
+	From       string // исходная кодировка ("" — определить)
+	To         string // новая кодировка ("" — не менять)
+	LineEnding string // LineEndingLF или LineEndingCRLF ("" — не менять)
+}
+
+// RecodeResult — итог перекодирования
+type RecodeResult struct {
+	From, To       string
+	LineEndingFrom string
+	LineEnding     string
+	Changed        bool // файл перезаписан
+}
+
+// RecodeFile перекодирует текстовый файл и/или приводит переводы строк к
+// одному виду. Файл записывается атомарно и только если не изменился после
+// чтения; символы, которых нет в новой кодировке, — ошибка, файл не меняется
+func RecodeFile(path string, opts RecodeOptions) (*RecodeResult, error) {
+	safePath, err := ResolvePath(path)
+	if err != nil {
+		return nil, err
+	}
+	content, err := readStructuredFile(safePath)
+	if err != nil {
+		return nil, err
+	}
+	tf, err := decodeTextFile([]byte(content), opts.From)
+	if err != nil {
+		return nil, err
+	}
+	if isBinaryText(tf.Content) {
+		return nil, errors.New(relPath(safePath) + ": двоичный файл не перекодируется")
+	}
+
+	to, bom := tf.Encoding, tf.BOM
+	if opts.To != "" {
+		if to, err = LookupEncoding(opts.To); err != nil {
+			return nil, err
+		}
+		// При смене кодировки BOM UTF-8 не добавляется (UTF-16 пишется с BOM всегда)
+		bom = bom && to == tf.Encoding
+	}
+	text := tf.Content
+	switch opts.LineEnding {
+	case "":
+	case LineEndingLF, LineEndingCRLF:
+		text = normalizeLineEndings(text, opts.LineEnding)
+	default:
+		return nil, fmt.Errorf("переводы строк должны быть %s или %s", LineEndingLF, LineEndingCRLF)
+	}
+
+	out, err := encodeText(text, to, bom)
+	if err != nil {
+		return nil, err
+	}
+	result := &RecodeResult{
+		From:           tf.Encoding,
+		To:             to,
+		LineEndingFrom: tf.LineEnding,
+		LineEnding:     detectLineEnding(text),
+		Changed:        string(out) != content,
+	}
+	if result.Changed {
+		if err := WriteFileIfMatch(path, string(out), tf.Version); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
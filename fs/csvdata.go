@@ -0,0 +1,134 @@
+package fs
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// CSV и TSV в общей модели данных — массив объектов: первая строка задаёт имена
+// колонок, значения читаются как строки. Кодировка определяется как при просмотре
+// таблиц (UTF-8, UTF-16 с BOM или Windows-1251)
+
+// csvDecoder возвращает функцию чтения таблицы с разделителем comma
+func csvDecoder(comma rune) func(string) (interface{}, []string, error) {
+	return func(content string) (interface{}, []string, error) {
+		text, _ := decodeText([]byte(content))
+		header, rows, err := readCSVTable(text, comma)
+		if err != nil {
+			return nil, nil, err
+		}
+		out := make([]interface{}, len(rows))
+		for i, row := range rows {
+			obj := newOrderedObject()
+			for j, name := range header {
+				obj.set(name, row[j])
+			}
+			out[i] = obj
+		}
+		return out, nil, nil
+	}
+}
+
+// readCSVTable читает заголовок и строки; количество полей во всех строках одинаково
+func readCSVTable(text string, comma rune) ([]string, [][]string, error) {
+	r := csv.NewReader(strings.NewReader(text))
+	r.Comma = comma
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil, errors.New("таблица пуста: нет строки заголовка")
+	}
+	header := records[0]
+	seen := make(map[string]bool, len(header))
+	for i, name := range header {
+		if name == "" {
+			return nil, nil, fmt.Errorf("колонка %d: пустое имя в заголовке", i+1)
+		}
+		if seen[name] {
+			return nil, nil, fmt.Errorf("колонка %d: имя %q повторяется в заголовке", i+1, name)
+		}
+		seen[name] = true
+	}
+	return header, records[1:], nil
+}
+
+// csvEncoder возвращает функцию записи таблицы с разделителем comma
+func csvEncoder(comma rune) func(interface{}) (string, []string, error) {
+	return func(data interface{}) (string, []string, error) {
+		rows, ok := data.([]interface{})
+		if !ok {
+			if obj, isObject := data.(*orderedObject); isObject {
+				// Объект с единственным массивом (например, {"users": [...]}) — таблица из массива
+				if len(obj.keys) == 1 {
+					if arr, isArray := obj.values[obj.keys[0]].([]interface{}); isArray {
+						rows = arr
+						ok = true
+					}
+				}
+			}
+		}
+		if !ok {
+			return "", nil, errors.New("таблицу можно построить только из массива объектов")
+		}
+
+		losses := &lossSet{}
+		// Колонки — объединение ключей всех строк в порядке появления
+		var header []string
+		columns := make(map[string]bool)
+		for i, row := range rows {
+			obj, isObject := row.(*orderedObject)
+			if !isObject {
+				return "", nil, fmt.Errorf("/%d: строка таблицы должна быть объектом", i)
+			}
+			for _, k := range obj.keys {
+				if !columns[k] {
+					columns[k] = true
+					header = append(header, k)
+				}
+			}
+		}
+		if len(header) == 0 {
+			return "", nil, errors.New("нет ни одной колонки: массив пуст или объекты без ключей")
+		}
+
+		var buf bytes.Buffer
+		w := csv.NewWriter(&buf)
+		w.Comma = comma
+		if err := w.Write(header); err != nil {
+			return "", nil, err
+		}
+		for i, row := range rows {
+			obj := row.(*orderedObject)
+			record := make([]string, len(header))
+			for j, k := range header {
+				v, present := obj.get(k)
+				switch t := v.(type) {
+				case *orderedObject, []interface{}:
+					losses.add("вложенные объекты и массивы записаны как JSON в ячейке (например, %s)", appendPointer(fmt.Sprintf("/%d", i), k))
+					record[j] = compactJSON(t)
+				case string:
+					record[j] = t
+				case nil:
+					if present {
+						losses.add("null записан как пустая ячейка")
+					} else {
+						losses.add("отсутствующие ключи записаны как пустые ячейки")
+					}
+				default:
+					losses.add("числа и логические значения записаны как текст (тип не сохраняется)")
+					record[j] = scalarText(t)
+				}
+			}
+			if err := w.Write(record); err != nil {
+				return "", nil, err
+			}
+		}
+		w.Flush()
+		return buf.String(), losses.losses, w.Error()
+	}
+}
@@ -0,0 +1,772 @@
+package fs
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// CSVTable — таблица CSV/TSV файла: заголовок и строки одинаковой длины
+type CSVTable struct {
+	Header    []string
+	Rows      [][]string
+	Delimiter rune
+	Encoding  string
+}
+
+// csvDelimiters — разделители, среди которых выбирается используемый в файле
+var csvDelimiters = []rune{',', ';', '\t', '|'}
+
+// csvSampleRows — сколько строк файла анализируется при выборе разделителя
+const csvSampleRows = 20
+
+// ReadCSV читает CSV/TSV файл, определяя кодировку и разделитель
+func ReadCSV(path string) (*CSVTable, error) {
+	safePath, err := ResolvePath(path)
+	if err != nil {
+		return nil, err
+	}
+	content, err := readStructuredFile(safePath)
+	if err != nil {
+		return nil, err
+	}
+	text, encoding := decodeText([]byte(content))
+	comma := detectDelimiter(text, filepath.Ext(path))
+	header, rows, err := readCSVTable(text, comma)
+	if err != nil {
+		return nil, err
+	}
+	return &CSVTable{Header: header, Rows: rows, Delimiter: comma, Encoding: encoding}, nil
+}
+
+// detectDelimiter выбирает разделитель, дающий больше всего колонок при
+// одинаковом их числе в первых строках; для .tsv — табуляция
+func detectDelimiter(text, ext string) rune {
+	if strings.EqualFold(ext, ".tsv") {
+		return '\t'
+	}
+	best, bestFields := ',', 1
+	for _, comma := range csvDelimiters {
+		r := csv.NewReader(strings.NewReader(text))
+		r.Comma = comma
+		r.FieldsPerRecord = -1
+		fields, consistent := 0, true
+		for i := 0; i < csvSampleRows; i++ {
+			record, err := r.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil || (fields != 0 && len(record) != fields) {
+				consistent = false
+				break
+			}
+			fields = len(record)
+		}
+		if consistent && fields > bestFields {
+			best, bestFields = comma, fields
+		}
+	}
+	return best
+}
+
+// Column возвращает номер колонки по имени (без учёта регистра)
+func (t *CSVTable) Column(name string) (int, error) {
+	for i, h := range t.Header {
+		if strings.EqualFold(h, name) {
+			return i, nil
+		}
+	}
+	return -1, fmt.Errorf("нет колонки %q (колонки: %s)", name, strings.Join(t.Header, ", "))
+}
+
+// ===== Запросы =====
+//
+// Запрос — упрощённый SQL без FROM (таблица — сам файл), все части необязательны:
+//
+//	SELECT city, COUNT(*), AVG(age) WHERE age >= 18 AND name LIKE 'А%'
+//	GROUP BY city ORDER BY count(*) DESC LIMIT 10
+//
+// Условия: =, !=, <>, <, <=, >, >=, LIKE (% и _), AND, OR, NOT, скобки.
+// Значения сравниваются как числа, если обе стороны — числа, иначе как строки.
+// Имена колонок с пробелами записываются в двойных кавычках, строки — в одинарных
+
+// csvAggregates — поддерживаемые агрегатные функции
+var csvAggregates = map[string]bool{"COUNT": true, "SUM": true, "AVG": true, "MIN": true, "MAX": true}
+
+// csvOperators — операторы и знаки препинания, допустимые в запросе
+var csvOperators = map[string]bool{
+	"=": true, "!=": true, "<>": true, "<": true, "<=": true, ">": true, ">=": true,
+	",": true, "(": true, ")": true, "*": true,
+}
+
+type csvToken struct {
+	kind byte // 'w' — слово, 'q' — имя в кавычках, 's' — строка, 'n' — число, 'p' — знак
+	text string
+}
+
+// csvSelectItem — колонка результата: колонка таблицы или агрегат над ней
+type csvSelectItem struct {
+	fn     string // пусто или COUNT/SUM/AVG/MIN/MAX
+	column int    // -1 для COUNT(*)
+	name   string
+}
+
+type csvOrder struct {
+	item csvSelectItem
+	desc bool
+}
+
+type csvPredicate func(row []string) bool
+
+type csvQuery struct {
+	items   []csvSelectItem // пусто — все колонки
+	where   csvPredicate
+	groupBy []int
+	orderBy []csvOrder
+	limit   int
+}
+
+// Query выполняет запрос к таблице и возвращает таблицу результата
+func (t *CSVTable) Query(query string) (*CSVTable, error) {
+	q, err := parseCSVQuery(query, t)
+	if err != nil {
+		return nil, err
+	}
+	return q.run(t)
+}
+
+type csvQueryParser struct {
+	tokens []csvToken
+	pos    int
+	table  *CSVTable
+}
+
+func parseCSVQuery(query string, t *CSVTable) (*csvQuery, error) {
+	tokens, err := tokenizeCSVQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	p := &csvQueryParser{tokens: tokens, table: t}
+	q := &csvQuery{limit: -1}
+
+	if p.keyword("SELECT") {
+		if !p.punct("*") {
+			for {
+				item, err := p.selectItem()
+				if err != nil {
+					return nil, err
+				}
+				q.items = append(q.items, item)
+				if !p.punct(",") {
+					break
+				}
+			}
+		}
+	}
+	if p.keyword("WHERE") {
+		if q.where, err = p.orExpr(); err != nil {
+			return nil, err
+		}
+	}
+	if p.keyword("GROUP") {
+		if !p.keyword("BY") {
+			return nil, errors.New("ожидалось GROUP BY")
+		}
+		for {
+			col, err := p.column()
+			if err != nil {
+				return nil, err
+			}
+			q.groupBy = append(q.groupBy, col)
+			if !p.punct(",") {
+				break
+			}
+		}
+	}
+	if p.keyword("ORDER") {
+		if !p.keyword("BY") {
+			return nil, errors.New("ожидалось ORDER BY")
+		}
+		for {
+			item, err := p.selectItem()
+			if err != nil {
+				return nil, err
+			}
+			order := csvOrder{item: item}
+			if p.keyword("DESC") {
+				order.desc = true
+			} else {
+				p.keyword("ASC")
+			}
+			q.orderBy = append(q.orderBy, order)
+			if !p.punct(",") {
+				break
+			}
+		}
+	}
+	if p.keyword("LIMIT") {
+		tok, ok := p.next()
+		n, err := strconv.Atoi(tok.text)
+		if !ok || tok.kind != 'n' || err != nil || n < 0 {
+			return nil, errors.New("LIMIT: ожидалось неотрицательное целое число")
+		}
+		q.limit = n
+	}
+	if tok, ok := p.peek(); ok {
+		return nil, fmt.Errorf("неожиданное %q в запросе", tok.text)
+	}
+	return q, q.check()
+}
+
+// check проверяет, что при группировке выбираются только колонки группы и агрегаты
+func (q *csvQuery) check() error {
+	if !q.aggregated() {
+		for _, o := range q.orderBy {
+			if o.item.fn != "" {
+				return fmt.Errorf("ORDER BY %s: агрегат без GROUP BY и агрегатов в SELECT", o.item.name)
+			}
+		}
+		return nil
+	}
+	if len(q.items) == 0 {
+		return errors.New("при группировке перечислите колонки SELECT явно")
+	}
+	for _, item := range q.items {
+		if item.fn != "" {
+			continue
+		}
+		grouped := false
+		for _, g := range q.groupBy {
+			grouped = grouped || g == item.column
+		}
+		if !grouped {
+			return fmt.Errorf("колонка %s должна входить в GROUP BY или быть аргументом агрегата", item.name)
+		}
+	}
+	return nil
+}
+
+func (q *csvQuery) aggregated() bool {
+	if len(q.groupBy) > 0 {
+		return true
+	}
+	for _, item := range q.items {
+		if item.fn != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func tokenizeCSVQuery(query string) ([]csvToken, error) {
+	var tokens []csvToken
+	for i := 0; i < len(query); {
+		r, size := utf8.DecodeRuneInString(query[i:])
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+		case r == '\'' || r == '"':
+			// Кавычка внутри строки удваивается: 'O''Brien'
+			var b strings.Builder
+			j := i + 1
+			for {
+				if j >= len(query) {
+					return nil, errors.New("незакрытая кавычка в запросе")
+				}
+				if query[j] == byte(r) {
+					if j+1 < len(query) && query[j+1] == byte(r) {
+						b.WriteByte(byte(r))
+						j += 2
+						continue
+					}
+					break
+				}
+				b.WriteByte(query[j])
+				j++
+			}
+			kind := byte('s')
+			if r == '"' {
+				kind = 'q'
+			}
+			tokens = append(tokens, csvToken{kind: kind, text: b.String()})
+			i = j + 1
+		case unicode.IsDigit(r) || (r == '-' && i+1 < len(query) && query[i+1] >= '0' && query[i+1] <= '9'):
+			j := i + 1
+			for j < len(query) && (query[j] >= '0' && query[j] <= '9' || query[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, csvToken{kind: 'n', text: query[i:j]})
+			i = j
+		case unicode.IsLetter(r) || r == '_':
+			j := i
+			for j < len(query) {
+				r, size := utf8.DecodeRuneInString(query[j:])
+				if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
+					break
+				}
+				j += size
+			}
+			tokens = append(tokens, csvToken{kind: 'w', text: query[i:j]})
+			i = j
+		default:
+			op := string(r)
+			if i+1 < len(query) && csvOperators[query[i:i+2]] {
+				op = query[i : i+2]
+			}
+			if !csvOperators[op] {
+				return nil, fmt.Errorf("недопустимый символ %q в запросе", r)
+			}
+			tokens = append(tokens, csvToken{kind: 'p', text: op})
+			i += len(op)
+		}
+	}
+	return tokens, nil
+}
+
+func (p *csvQueryParser) peek() (csvToken, bool) {
+	if p.pos >= len(p.tokens) {
+		return csvToken{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+func (p *csvQueryParser) next() (csvToken, bool) {
+	tok, ok := p.peek()
+	if ok {
+		p.pos++
+	}
+	return tok, ok
+}
+
+// keyword пропускает ключевое слово, если оно следующее
+func (p *csvQueryParser) keyword(word string) bool {
+	if tok, ok := p.peek(); ok && tok.kind == 'w' && strings.EqualFold(tok.text, word) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *csvQueryParser) punct(s string) bool {
+	if tok, ok := p.peek(); ok && tok.kind == 'p' && tok.text == s {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *csvQueryParser) column() (int, error) {
+	tok, ok := p.next()
+	if !ok || (tok.kind != 'w' && tok.kind != 'q') {
+		return -1, errors.New("ожидалось имя колонки")
+	}
+	return p.table.Column(tok.text)
+}
+
+// selectItem разбирает колонку или агрегат COUNT(*), SUM(col)...
+func (p *csvQueryParser) selectItem() (csvSelectItem, error) {
+	if tok, ok := p.peek(); ok && tok.kind == 'w' && csvAggregates[strings.ToUpper(tok.text)] &&
+		p.pos+1 < len(p.tokens) && p.tokens[p.pos+1].text == "(" {
+		fn := strings.ToUpper(tok.text)
+		p.pos += 2
+		item := csvSelectItem{fn: fn, column: -1}
+		if p.punct("*") {
+			if fn != "COUNT" {
+				return item, fmt.Errorf("%s(*) не поддерживается, укажите колонку", fn)
+			}
+			item.name = "count(*)"
+		} else {
+			col, err := p.column()
+			if err != nil {
+				return item, err
+			}
+			item.column = col
+			item.name = strings.ToLower(fn) + "(" + p.table.Header[col] + ")"
+		}
+		if !p.punct(")") {
+			return item, fmt.Errorf("%s: ожидалась «)»", fn)
+		}
+		return item, nil
+	}
+	col, err := p.column()
+	if err != nil {
+		return csvSelectItem{}, err
+	}
+	return csvSelectItem{column: col, name: p.table.Header[col]}, nil
+}
+
+func (p *csvQueryParser) orExpr() (csvPredicate, error) {
+	left, err := p.andExpr()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("OR") {
+		right, err := p.andExpr()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(row []string) bool { return l(row) || right(row) }
+	}
+	return left, nil
+}
+
+func (p *csvQueryParser) andExpr() (csvPredicate, error) {
+	left, err := p.unaryExpr()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("AND") {
+		right, err := p.unaryExpr()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(row []string) bool { return l(row) && right(row) }
+	}
+	return left, nil
+}
+
+func (p *csvQueryParser) unaryExpr() (csvPredicate, error) {
+	if p.keyword("NOT") {
+		inner, err := p.unaryExpr()
+		if err != nil {
+			return nil, err
+		}
+		return func(row []string) bool { return !inner(row) }, nil
+	}
+	if p.punct("(") {
+		inner, err := p.orExpr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.punct(")") {
+			return nil, errors.New("ожидалась «)»")
+		}
+		return inner, nil
+	}
+	return p.comparison()
+}
+
+// comparison разбирает условие «колонка оператор значение»
+func (p *csvQueryParser) comparison() (csvPredicate, error) {
+	col, err := p.column()
+	if err != nil {
+		return nil, err
+	}
+	op, ok := p.next()
+	if !ok || !(op.kind == 'p' || op.kind == 'w' && strings.EqualFold(op.text, "LIKE")) {
+		return nil, fmt.Errorf("после колонки %s ожидался оператор сравнения", p.table.Header[col])
+	}
+	value, ok := p.next()
+	if !ok || (value.kind != 's' && value.kind != 'n') {
+		return nil, fmt.Errorf("после %s ожидалось значение: число или строка в одинарных кавычках", op.text)
+	}
+
+	if op.kind == 'w' {
+		pattern := regexp.QuoteMeta(value.text)
+		pattern = strings.NewReplacer("%", ".*", "_", ".").Replace(pattern)
+		re := regexp.MustCompile("(?is)^" + pattern + "$")
+		return func(row []string) bool { return re.MatchString(row[col]) }, nil
+	}
+	var test func(c int) bool
+	switch op.text {
+	case "=":
+		test = func(c int) bool { return c == 0 }
+	case "!=", "<>":
+		test = func(c int) bool { return c != 0 }
+	case "<":
+		test = func(c int) bool { return c < 0 }
+	case "<=":
+		test = func(c int) bool { return c <= 0 }
+	case ">":
+		test = func(c int) bool { return c > 0 }
+	case ">=":
+		test = func(c int) bool { return c >= 0 }
+	default:
+		return nil, fmt.Errorf("неизвестный оператор %q", op.text)
+	}
+	return func(row []string) bool { return test(compareCSVValues(row[col], value.text)) }, nil
+}
+
+// parseCSVNumber разбирает число ячейки; десятичная запятая допускается
+func parseCSVNumber(s string) (float64, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, false
+	}
+	if !strings.Contains(s, ".") {
+		s = strings.Replace(s, ",", ".", 1)
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	return f, err == nil && !math.IsNaN(f) && !math.IsInf(f, 0)
+}
+
+// compareCSVValues сравнивает как числа, если оба значения — числа, иначе как строки
+func compareCSVValues(a, b string) int {
+	x, okA := parseCSVNumber(a)
+	y, okB := parseCSVNumber(b)
+	if okA && okB {
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(a, b)
+}
+
+func formatCSVNumber(f float64) string {
+	return strconv.FormatFloat(math.Round(f*1e6)/1e6, 'f', -1, 64)
+}
+
+// run выполняет запрос: фильтр, сортировка или группировка, выбор колонок, LIMIT
+func (q *csvQuery) run(t *CSVTable) (*CSVTable, error) {
+	// Номера строк сохраняются для сообщений об ошибках (строка 1 — заголовок)
+	var rows []int
+	for i, row := range t.Rows {
+		if q.where == nil || q.where(row) {
+			rows = append(rows, i)
+		}
+	}
+
+	result := &CSVTable{Delimiter: t.Delimiter, Encoding: t.Encoding}
+	if q.aggregated() {
+		if err := q.aggregate(t, rows, result); err != nil {
+			return nil, err
+		}
+	} else {
+		orderColumns := make([]int, len(q.orderBy))
+		for i, o := range q.orderBy {
+			orderColumns[i] = o.item.column
+		}
+		sort.SliceStable(rows, func(a, b int) bool {
+			return lessCSVRows(t.Rows[rows[a]], t.Rows[rows[b]], q.orderBy, orderColumns)
+		})
+		items := q.items
+		if len(items) == 0 {
+			for i, h := range t.Header {
+				items = append(items, csvSelectItem{column: i, name: h})
+			}
+		}
+		for _, item := range items {
+			result.Header = append(result.Header, item.name)
+		}
+		for _, i := range rows {
+			out := make([]string, len(items))
+			for j, item := range items {
+				out[j] = t.Rows[i][item.column]
+			}
+			result.Rows = append(result.Rows, out)
+		}
+	}
+
+	if q.limit >= 0 && len(result.Rows) > q.limit {
+		result.Rows = result.Rows[:q.limit]
+	}
+	return result, nil
+}
+
+// aggregate группирует строки и вычисляет агрегаты; группы выводятся в порядке
+// первого появления, затем сортируются по ORDER BY среди колонок результата
+func (q *csvQuery) aggregate(t *CSVTable, rows []int, result *CSVTable) error {
+	var keys []string
+	groups := make(map[string][]int)
+	for _, i := range rows {
+		parts := make([]string, len(q.groupBy))
+		for j, g := range q.groupBy {
+			parts[j] = t.Rows[i][g]
+		}
+		key := strings.Join(parts, "\x00")
+		if _, seen := groups[key]; !seen {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], i)
+	}
+	// Без GROUP BY агрегаты считаются по всем строкам, даже если их нет
+	if len(q.groupBy) == 0 && len(keys) == 0 {
+		keys = append(keys, "")
+	}
+
+	for _, item := range q.items {
+		result.Header = append(result.Header, item.name)
+	}
+	orderColumns := make([]int, len(q.orderBy))
+	for i, o := range q.orderBy {
+		orderColumns[i] = -1
+		for j, item := range q.items {
+			if item.fn == o.item.fn && item.column == o.item.column {
+				orderColumns[i] = j
+			}
+		}
+		if orderColumns[i] < 0 {
+			return fmt.Errorf("ORDER BY %s: при группировке сортировка возможна только по колонкам SELECT", o.item.name)
+		}
+	}
+
+	for _, key := range keys {
+		members := groups[key]
+		out := make([]string, len(q.items))
+		for j, item := range q.items {
+			if item.fn == "" {
+				if len(members) > 0 {
+					out[j] = t.Rows[members[0]][item.column]
+				}
+				continue
+			}
+			value, err := aggregateCSV(t, item, members)
+			if err != nil {
+				return err
+			}
+			out[j] = value
+		}
+		result.Rows = append(result.Rows, out)
+	}
+
+	sort.SliceStable(result.Rows, func(a, b int) bool {
+		return lessCSVRows(result.Rows[a], result.Rows[b], q.orderBy, orderColumns)
+	})
+	return nil
+}
+
+// aggregateCSV вычисляет агрегат по строкам группы; пустые ячейки пропускаются
+func aggregateCSV(t *CSVTable, item csvSelectItem, members []int) (string, error) {
+	if item.column < 0 {
+		return strconv.Itoa(len(members)), nil
+	}
+	count := 0
+	sum := 0.0
+	var best string
+	for _, i := range members {
+		cell := t.Rows[i][item.column]
+		if strings.TrimSpace(cell) == "" {
+			continue
+		}
+		count++
+		switch item.fn {
+		case "SUM", "AVG":
+			f, ok := parseCSVNumber(cell)
+			if !ok {
+				return "", fmt.Errorf("%s: строка %d: значение %q не число", item.name, i+2, cell)
+			}
+			sum += f
+		case "MIN":
+			if count == 1 || compareCSVValues(cell, best) < 0 {
+				best = cell
+			}
+		case "MAX":
+			if count == 1 || compareCSVValues(cell, best) > 0 {
+				best = cell
+			}
+		}
+	}
+	switch item.fn {
+	case "COUNT":
+		return strconv.Itoa(count), nil
+	case "SUM":
+		return formatCSVNumber(sum), nil
+	case "AVG":
+		if count == 0 {
+			return "", nil
+		}
+		return formatCSVNumber(sum / float64(count)), nil
+	}
+	return best, nil
+}
+
+// lessCSVRows сравнивает строки по ключам сортировки; columns — номера колонок
+// ключей в строке
+func lessCSVRows(a, b []string, orderBy []csvOrder, columns []int) bool {
+	for i, o := range orderBy {
+		c := compareCSVValues(a[columns[i]], b[columns[i]])
+		if c == 0 {
+			continue
+		}
+		if o.desc {
+			return c > 0
+		}
+		return c < 0
+	}
+	return false
+}
+
+// ===== Вывод =====
+
+// maxCellWidth — максимальная ширина колонки при выводе таблицы
+const maxCellWidth = 40
+
+// FormatTable выводит строки таблицы с from по to (не включая) с выравниванием
+// колонок; первая колонка — номер строки
+func FormatTable(t *CSVTable, from, to int) string {
+	if from < 0 {
+		from = 0
+	}
+	if to > len(t.Rows) {
+		to = len(t.Rows)
+	}
+	cell := func(s string) string {
+		s = strings.NewReplacer("\r\n", "↵", "\n", "↵", "\t", " ").Replace(s)
+		if utf8.RuneCountInString(s) > maxCellWidth {
+			s = string([]rune(s)[:maxCellWidth-1]) + "…"
+		}
+		return s
+	}
+
+	header := append([]string{"#"}, t.Header...)
+	lines := [][]string{header}
+	for i := from; i < to; i++ {
+		line := []string{strconv.Itoa(i + 1)}
+		for _, v := range t.Rows[i] {
+			line = append(line, cell(v))
+		}
+		lines = append(lines, line)
+	}
+	widths := make([]int, len(header))
+	for _, line := range lines {
+		for j, v := range line {
+			if w := utf8.RuneCountInString(cell(v)); w > widths[j] {
+				widths[j] = w
+			}
+		}
+	}
+
+	var b strings.Builder
+	for n, line := range lines {
+		var row strings.Builder
+		for j, v := range line {
+			v = cell(v)
+			pad := strings.Repeat(" ", widths[j]-utf8.RuneCountInString(v))
+			if j > 0 {
+				row.WriteString(" │ ")
+			}
+			// Номера строк и числа выравниваются вправо
+			if _, isNumber := parseCSVNumber(v); n > 0 && (j == 0 || isNumber) {
+				row.WriteString(pad + v)
+			} else {
+				row.WriteString(v + pad)
+			}
+		}
+		b.WriteString(strings.TrimRight(row.String(), " ") + "\n")
+		if n == 0 {
+			for j, w := range widths {
+				if j > 0 {
+					b.WriteString("─┼─")
+				}
+				b.WriteString(strings.Repeat("─", w))
+			}
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,295 @@
+package fs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// OverwritePolicy определяет, что делать с уже существующими файлами при распаковке
+type OverwritePolicy int
+
+const (
+	// OverwriteNever — конфликт с существующим файлом отменяет распаковку целиком (по умолчанию)
+	OverwriteNever OverwritePolicy = iota
+	// OverwriteSkip — существующие файлы сохраняются, записи архива для них пропускаются
+	OverwriteSkip
+	// OverwriteReplace — существующие файлы заменяются записями архива
+	OverwriteReplace
+)
+
+// errExtractConflict — в папке назначения уже есть файлы с именами записей архива
+var errExtractConflict = errors.New("файлы уже существуют (выберите пропуск или замену)")
+
+// maxConflictsInError — сколько конфликтующих путей перечислять в сообщении об ошибке
+const maxConflictsInError = 5
+
+// extractStagePrefix — префикс временных папок распаковки в корне sandbox;
+// их содержимое не попадает в поиск и индекс
+const extractStagePrefix = ".extract-"
+
+// isExtractStage проверяет имя временной папки распаковки
+func isExtractStage(name string) bool {
+	return strings.HasPrefix(name, extractStagePrefix)
+}
+
+// extractBudget учитывает фактически распакованные байты и количество записей
+// по всему архиву. Заявленным в заголовках размерам не доверяем
+type extractBudget struct {
+	limits  ArchiveLimits
+	entries int
+	total   int64
+}
+
+// newExtractBudget создаёт бюджет распаковки по действующим лимитам
+func newExtractBudget() *extractBudget {
+	return &extractBudget{limits: archiveLimits}
+}
+
+// checkEntry учитывает очередную запись и проверяет лимиты количества записей и глубины пути
+func (b *extractBudget) checkEntry(name string) error {
+	b.entries++
+	if b.entries > b.limits.MaxEntries {
+		return fmt.Errorf("%w (лимит %d)", errTooManyEntries, b.limits.MaxEntries)
+	}
+	if depth := entryDepth(name); depth > b.limits.MaxDepth {
+		return fmt.Errorf("слишком глубокая вложенность записи %s: %d уровней (лимит %d)", name, depth, b.limits.MaxDepth)
+	}
+	return nil
+}
+
+// writeEntry создаёт файл записи и копирует в него данные в пределах бюджета
+func (b *extractBudget) writeEntry(fpath string, r io.Reader, perm os.FileMode) (int64, error) {
+	if err := os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
+		return 0, err
+	}
+	n, err := writeFileLimited(fpath, r, b.limits.MaxSize-b.total, perm)
+	b.total += n
+	return n, err
+}
+
+// restoreMetadata устанавливает безопасные права (см. safePerm) и время изменения записи
+func restoreMetadata(fpath string, mode os.FileMode, isDir bool, modTime time.Time) error {
+	if err := os.Chmod(fpath, safePerm(mode, isDir)); err != nil {
+		return err
+	}
+	if modTime.IsZero() {
+		return nil
+	}
+	return os.Chtimes(fpath, modTime, modTime)
+}
+
+// dirTimes откладывает восстановление времени папок до записи их содержимого
+type dirTimes struct {
+	paths []string
+	times []time.Time
+}
+
+func (d *dirTimes) add(path string, modTime time.Time) {
+	if !modTime.IsZero() {
+		d.paths = append(d.paths, path)
+		d.times = append(d.times, modTime)
+	}
+}
+
+// apply восстанавливает время, начиная с самых вложенных папок
+func (d *dirTimes) apply() {
+	for i := len(d.paths) - 1; i >= 0; i-- {
+		os.Chtimes(d.paths[i], d.times[i], d.times[i])
+	}
+}
+
+// entryDepth возвращает количество компонентов пути записи архива
+func entryDepth(name string) int {
+	depth := 0
+	for _, part := range strings.FieldsFunc(name, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if part != "." {
+			depth++
+		}
+	}
+	return depth
+}
+
+// extractStaged распаковывает архив во временную папку внутри sandbox и переносит
+// результат в safeDest, только если распаковка прошла целиком. Возвращает пути
+// перенесённых файлов. При любой ошибке папка назначения остаётся без изменений
+func extractStaged(safeDest string, policy OverwritePolicy, extract func(stage string) error) ([]string, error) {
+	// Временная папка в самом sandbox: перенос через rename не выходит за его пределы
+	stage, err := os.MkdirTemp(BaseDir, extractStagePrefix+"*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(stage)
+
+	// data — распакованные записи, backup — оригиналы заменяемых файлов
+	data := filepath.Join(stage, "data")
+	if err := os.Mkdir(data, 0700); err != nil {
+		return nil, err
+	}
+	if err := extract(data); err != nil {
+		return nil, err
+	}
+
+	fileMutex.Lock()
+	defer fileMutex.Unlock()
+
+	steps, err := planCommit(data, safeDest, policy)
+	if err != nil {
+		return nil, err
+	}
+	return applyCommit(steps, filepath.Join(stage, "backup"))
+}
+
+// commitStep — перенос одного пути из временной папки в папку назначения
+type commitStep struct {
+	staged  string
+	target  string
+	isDir   bool
+	regular bool      // обычный файл (индексируется после переноса)
+	modTime time.Time // время изменения папки до переноса её содержимого
+	replace bool      // target существует и будет заменён
+}
+
+// planCommit сопоставляет распакованные пути с папкой назначения и применяет политику перезаписи
+// Ничего не изменяет: все конфликты обнаруживаются до первого переноса
+func planCommit(stage, safeDest string, policy OverwritePolicy) ([]commitStep, error) {
+	var steps []commitStep
+	if info, err := os.Lstat(safeDest); err != nil {
+		steps = append(steps, commitStep{target: safeDest, isDir: true})
+	} else if !info.IsDir() {
+		return nil, fmt.Errorf("папка назначения %s не является папкой", relPath(safeDest))
+	}
+
+	var conflicts []string
+	err := filepath.Walk(stage, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == stage {
+			return nil
+		}
+		rel, err := filepath.Rel(stage, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(safeDest, rel)
+		if err := checkNoSymlinkParents(safeDest, filepath.Dir(target)); err != nil {
+			return err
+		}
+
+		step := commitStep{
+			staged:  path,
+			target:  target,
+			isDir:   info.IsDir(),
+			regular: info.Mode().IsRegular(),
+			modTime: info.ModTime(),
+		}
+		existing, statErr := os.Lstat(target)
+		if statErr != nil {
+			steps = append(steps, step)
+			return nil
+		}
+
+		switch {
+		case step.isDir && existing.IsDir():
+			// Папка уже есть — переносим только её содержимое
+		case step.isDir || existing.IsDir():
+			return fmt.Errorf("%s: в папке назначения уже есть объект другого типа", filepath.ToSlash(rel))
+		case policy == OverwriteSkip:
+			return nil
+		case policy == OverwriteReplace:
+			step.replace = true
+			steps = append(steps, step)
+		default:
+			conflicts = append(conflicts, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(conflicts) > 0 {
+		shown := conflicts
+		if len(shown) > maxConflictsInError {
+			shown = shown[:maxConflictsInError]
+		}
+		msg := strings.Join(shown, ", ")
+		if len(conflicts) > len(shown) {
+			msg += fmt.Sprintf(" и ещё %d", len(conflicts)-len(shown))
+		}
+		return nil, fmt.Errorf("%w: %s", errExtractConflict, msg)
+	}
+	return steps, nil
+}
+
+// applyCommit переносит пути в папку назначения. Заменяемые файлы сначала
+// перемещаются в backupDir; при ошибке все изменения откатываются
+func applyCommit(steps []commitStep, backupDir string) ([]string, error) {
+	type undo struct {
+		target string // перенесённый или созданный путь
+		backup string // сохранённый оригинал (пусто — его не было)
+	}
+	var done []undo
+	rollback := func() {
+		for i := len(done) - 1; i >= 0; i-- {
+			os.Remove(done[i].target)
+			if done[i].backup != "" {
+				os.Rename(done[i].backup, done[i].target)
+			}
+		}
+	}
+
+	var files []string
+	created := &dirTimes{}
+	for i, step := range steps {
+		if step.isDir {
+			if _, err := os.Lstat(step.target); err == nil {
+				continue
+			}
+			if err := os.MkdirAll(step.target, 0755); err != nil {
+				rollback()
+				return nil, err
+			}
+			if step.staged != "" {
+				if info, err := os.Stat(step.staged); err == nil {
+					os.Chmod(step.target, info.Mode().Perm())
+				}
+				created.add(step.target, step.modTime)
+			}
+			done = append(done, undo{target: step.target})
+			continue
+		}
+
+		var backup string
+		if step.replace {
+			if err := os.MkdirAll(backupDir, 0700); err != nil {
+				rollback()
+				return nil, err
+			}
+			backup = filepath.Join(backupDir, fmt.Sprintf("%d", i))
+			if err := os.Rename(step.target, backup); err != nil {
+				rollback()
+				return nil, err
+			}
+		}
+		if err := os.Rename(step.staged, step.target); err != nil {
+			if backup != "" {
+				os.Rename(backup, step.target)
+			}
+			rollback()
+			return nil, err
+		}
+		done = append(done, undo{target: step.target, backup: backup})
+		if step.regular {
+			files = append(files, step.target)
+		}
+	}
+	// Перенос файлов изменил время созданных папок — восстанавливаем время из архива
+	created.apply()
+	return files, nil
+}
@@ -0,0 +1,232 @@
+package fs
+
+import (
+	"archive/zip"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxIndexedContent — максимальный объём текста одного документа в индексе (512 KB)
+// Ограничение PostgreSQL: tsvector не может превышать 1 MB
+const MaxIndexedContent = 512 * 1024
+
+// ContentIndexer получает уведомления об изменении содержимого файлов
+// Реализация хранит полнотекстовый индекс (см. db.ContentIndex)
+type ContentIndexer interface {
+	// IndexDocument добавляет или обновляет документ; entry — имя файла внутри архива
+	IndexDocument(path, entry, content string) error
+	// RemoveDocument удаляет из индекса файл и все его записи (для архивов),
+	// а для папки — все документы внутри неё
+	RemoveDocument(path string) error
+	// ClearIndex удаляет все документы (перед полной переиндексацией)
+	ClearIndex() error
+}
+
+// indexer — текущий получатель изменений (nil — индексация отключена)
+var indexer ContentIndexer
+
+// indexableExtensions — расширения текстовых файлов, попадающих в индекс
+var indexableExtensions = map[string]bool{
+	".txt": true, ".md": true, ".log": true, ".csv": true, ".tsv": true,
+	".json": true, ".jsonl": true, ".ndjson": true, ".xml": true,
+	".yaml": true, ".yml": true, ".toml": true, ".ini": true, ".conf": true,
+	".html": true, ".htm": true,
+}
+
+// SetIndexer подключает полнотекстовый индекс к файловым операциям
+func SetIndexer(ci ContentIndexer) {
+	indexer = ci
+}
+
+// isIndexable проверяет, является ли файл текстовым документом для индекса
+func isIndexable(name string) bool {
+	return indexableExtensions[strings.ToLower(filepath.Ext(name))]
+}
+
+// isZipName проверяет расширение ZIP-архива
+func isZipName(name string) bool {
+	return strings.ToLower(filepath.Ext(name)) == ".zip"
+}
+
+// prepareIndexText обрезает текст до MaxIndexedContent и отбрасывает бинарные данные
+func prepareIndexText(content string) (string, bool) {
+	if strings.Contains(content, "\x00") {
+		return "", false
+	}
+	if len(content) > MaxIndexedContent {
+		content = content[:MaxIndexedContent]
+		// Не разрываем многобайтовый символ UTF-8
+		for len(content) > 0 && !utf8.ValidString(content) {
+			content = content[:len(content)-1]
+		}
+	}
+	if !utf8.ValidString(content) {
+		return "", false
+	}
+	return content, true
+}
+
+// indexContent обновляет индекс для текстового файла с известным содержимым
+func indexContent(safePath, content string) {
+	if indexer == nil || !isIndexable(safePath) {
+		return
+	}
+	text, ok := prepareIndexText(content)
+	if !ok {
+		return
+	}
+	if err := indexer.IndexDocument(relPath(safePath), "", text); err != nil {
+		log.Printf("Ошибка индексации %s: %v", relPath(safePath), err)
+	}
+}
+
+// indexFile перечитывает файл с диска и обновляет индекс; для папки
+// индексируются все файлы внутри неё
+func indexFile(safePath string) {
+	if indexer == nil {
+		return
+	}
+	if info, err := os.Lstat(safePath); err == nil && info.IsDir() {
+		paths, _ := indexablePaths(safePath)
+		for _, path := range paths {
+			indexFile(path)
+		}
+		return
+	}
+	if isZipName(safePath) {
+		indexArchive(safePath)
+		return
+	}
+	if !isIndexable(safePath) {
+		return
+	}
+
+	fileMutex.RLock()
+	file, err := os.Open(safePath)
+	if err != nil {
+		fileMutex.RUnlock()
+		return
+	}
+	data, err := io.ReadAll(io.LimitReader(file, MaxIndexedContent))
+	file.Close()
+	fileMutex.RUnlock()
+	if err != nil {
+		return
+	}
+	indexContent(safePath, string(data))
+}
+
+// indexArchive индексирует текстовые файлы внутри ZIP-архива без распаковки на диск
+func indexArchive(safePath string) {
+	if indexer == nil {
+		return
+	}
+
+	fileMutex.RLock()
+	defer fileMutex.RUnlock()
+
+	r, err := zip.OpenReader(safePath)
+	if err != nil {
+		return
+	}
+	defer r.Close()
+
+	path := relPath(safePath)
+	if err := indexer.RemoveDocument(path); err != nil {
+		log.Printf("Ошибка индексации %s: %v", path, err)
+		return
+	}
+
+	// Общий бюджет чтения — защита от ZIP-бомб при индексации
+	var total int64
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() || !isIndexable(f.Name) {
+			continue
+		}
+		if total >= archiveLimits.MaxSize {
+			break
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			continue
+		}
+		data, err := io.ReadAll(io.LimitReader(rc, MaxIndexedContent))
+		rc.Close()
+		total += int64(len(data))
+		if err != nil {
+			continue
+		}
+
+		text, ok := prepareIndexText(string(data))
+		if !ok {
+			continue
+		}
+		if err := indexer.IndexDocument(path, f.Name, text); err != nil {
+			log.Printf("Ошибка индексации %s!%s: %v", path, f.Name, err)
+		}
+	}
+}
+
+// removeFromIndex удаляет файл из индекса
+func removeFromIndex(safePath string) {
+	if indexer == nil {
+		return
+	}
+	if err := indexer.RemoveDocument(relPath(safePath)); err != nil {
+		log.Printf("Ошибка удаления из индекса %s: %v", relPath(safePath), err)
+	}
+}
+
+// ReindexAll заново индексирует все текстовые файлы и архивы sandbox
+// Возвращает количество обработанных файлов
+func ReindexAll() (int, error) {
+	if indexer == nil {
+		return 0, nil
+	}
+	if err := indexer.ClearIndex(); err != nil {
+		return 0, err
+	}
+
+	paths, err := indexablePaths(BaseDir)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, path := range paths {
+		indexFile(path)
+	}
+	return len(paths), nil
+}
+
+// indexablePaths возвращает текстовые файлы и архивы внутри папки root.
+// Символические ссылки и временные папки распаковки пропускаются
+func indexablePaths(root string) ([]string, error) {
+	var paths []string
+	fileMutex.RLock()
+	defer fileMutex.RUnlock()
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.Type()&os.ModeSymlink != 0 {
+			return nil
+		}
+		if d.IsDir() {
+			if path != root && isExtractStage(d.Name()) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if isIndexable(path) || isZipName(path) {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	return paths, err
+}
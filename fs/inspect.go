@@ -0,0 +1,281 @@
+package fs
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// inspectDest — условная папка назначения для проверки путей без записи на диск
+var inspectDest = filepath.Join(string(os.PathSeparator), "inspect")
+
+// ArchiveEntry описывает запись архива (по данным заголовков, без распаковки)
+type ArchiveEntry struct {
+	Name           string      // имя внутри архива
+	Type           string      // file, dir, symlink, hardlink, device
+	Size           int64       // заявленный распакованный размер
+	CompressedSize int64       // сжатый размер (для TAR неизвестен — 0)
+	Ratio          float64     // степень сжатия (0 — неизвестна)
+	Mode           os.FileMode // права доступа
+	Modified       time.Time   // время изменения
+	LinkTarget     string      // цель ссылки (для symlink/hardlink)
+	Encrypted      bool        // запись зашифрована (ZIP AES)
+	Problems       []string    // причины, по которым распаковка отклонит запись
+}
+
+// ArchiveReport — результат просмотра архива
+type ArchiveReport struct {
+	Format          string         // формат архива (zip, tar, tar.gz, gz)
+	Entries         []ArchiveEntry // записи архива
+	TotalSize       int64          // суммарный заявленный распакованный размер
+	CompressedSize  int64          // размер файла архива
+	Problems        []string       // проблемы уровня всего архива
+	RejectedEntries int            // количество записей с проблемами
+}
+
+// Safe сообщает, пройдёт ли архив проверки распаковки
+func (r *ArchiveReport) Safe() bool {
+	return r.RejectedEntries == 0 && len(r.Problems) == 0
+}
+
+// InspectArchive показывает содержимое архива и помечает записи,
+// которые будут отклонены проверками распаковки. Ничего не пишет на диск
+func InspectArchive(path string) (*ArchiveReport, error) {
+	safePath, err := ResolvePath(path)
+	if err != nil {
+		return nil, err
+	}
+	format, err := DetectArchiveFormat(safePath)
+	if err != nil {
+		return nil, err
+	}
+
+	fileMutex.RLock()
+	defer fileMutex.RUnlock()
+
+	info, err := os.Stat(safePath)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ArchiveReport{Format: format, CompressedSize: info.Size()}
+	switch format {
+	case FormatZip:
+		err = inspectZip(safePath, report)
+	case FormatTar, FormatTarGz:
+		err = inspectTar(safePath, report)
+	default:
+		err = inspectGzip(safePath, report)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, e := range report.Entries {
+		if len(e.Problems) > 0 {
+			report.RejectedEntries++
+		}
+	}
+	if len(report.Entries) > archiveLimits.MaxEntries {
+		report.Problems = append(report.Problems,
+			fmt.Sprintf("количество записей %d превышает лимит %d", len(report.Entries), archiveLimits.MaxEntries))
+	}
+	if report.TotalSize > archiveLimits.MaxSize {
+		report.Problems = append(report.Problems,
+			fmt.Sprintf("суммарный размер %d байт превышает лимит %d байт", report.TotalSize, archiveLimits.MaxSize))
+	}
+	return report, nil
+}
+
+// inspectZip читает центральный каталог ZIP без распаковки данных
+func inspectZip(safePath string, report *ArchiveReport) error {
+	r, err := zip.OpenReader(safePath)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	for _, f := range r.File {
+		entry := ArchiveEntry{
+			Name:           f.Name,
+			Type:           "file",
+			Size:           int64(f.UncompressedSize64),
+			CompressedSize: int64(f.CompressedSize64),
+			Ratio:          compressionRatio(f.UncompressedSize64, f.CompressedSize64),
+			Mode:           f.Mode(),
+			Modified:       f.Modified,
+		}
+		if f.FileInfo().IsDir() {
+			entry.Type = "dir"
+		} else if f.Mode()&os.ModeSymlink != 0 {
+			entry.Type = "symlink"
+		}
+		entry.Encrypted = isEncryptedEntry(f)
+
+		if problem := ratioProblem(entry.Size, entry.CompressedSize); problem != "" {
+			entry.Problems = append(entry.Problems, problem)
+		}
+		if _, err := safeJoin(inspectDest, f.Name); err != nil {
+			entry.Problems = append(entry.Problems, "путь выходит за пределы папки назначения (Zip Slip)")
+		}
+		if depth := entryDepth(f.Name); depth > archiveLimits.MaxDepth {
+			entry.Problems = append(entry.Problems, fmt.Sprintf("глубина вложенности %d превышает %d", depth, archiveLimits.MaxDepth))
+		}
+
+		report.TotalSize += entry.Size
+		if report.TotalSize > archiveLimits.MaxSize {
+			entry.Problems = append(entry.Problems, "на этой записи превышается лимит общего размера")
+		}
+		report.Entries = append(report.Entries, entry)
+	}
+	return nil
+}
+
+// inspectTar читает заголовки TAR (данные записей пропускаются потоково)
+func inspectTar(safePath string, report *ArchiveReport) error {
+	file, err := os.Open(safePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	tr, closeFn, err := openTarStream(file)
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+
+	symlinks := make(map[string]bool)
+	sizes := make(map[string]int64)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// Ошибка потока (например, gzip-бомба) — архив будет отклонён целиком
+			report.Problems = append(report.Problems, err.Error())
+			break
+		}
+		if header.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+
+		entry := ArchiveEntry{
+			Name:       header.Name,
+			Size:       header.Size,
+			Mode:       os.FileMode(header.Mode).Perm(),
+			Modified:   header.ModTime,
+			LinkTarget: header.Linkname,
+		}
+
+		cleanName := filepath.Clean(header.Name)
+		if cleanName != "." {
+			if _, err := safeJoin(inspectDest, header.Name); err != nil {
+				entry.Problems = append(entry.Problems, "путь выходит за пределы папки назначения")
+			}
+			if depth := entryDepth(header.Name); depth > archiveLimits.MaxDepth {
+				entry.Problems = append(entry.Problems, fmt.Sprintf("глубина вложенности %d превышает %d", depth, archiveLimits.MaxDepth))
+			}
+		}
+		// Запись через ранее объявленную символическую ссылку
+		for dir := filepath.Dir(cleanName); dir != "." && dir != string(os.PathSeparator); dir = filepath.Dir(dir) {
+			if symlinks[dir] {
+				entry.Problems = append(entry.Problems, "запись через символическую ссылку "+dir)
+				break
+			}
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			entry.Type = "dir"
+		case tar.TypeReg, tar.TypeRegA:
+			entry.Type = "file"
+			sizes[cleanName] = header.Size
+		case tar.TypeSymlink:
+			entry.Type = "symlink"
+			symlinks[cleanName] = true
+			if err := checkSymlinkTarget(header.Name, header.Linkname); err != nil {
+				entry.Problems = append(entry.Problems, "символическая ссылка выходит за пределы папки назначения")
+			}
+		case tar.TypeLink:
+			entry.Type = "hardlink"
+			if _, err := safeJoin(inspectDest, header.Linkname); err != nil {
+				entry.Problems = append(entry.Problems, "жёсткая ссылка выходит за пределы папки назначения")
+			}
+			// Жёсткая ссылка распаковывается копией, поэтому учитывается в размере
+			entry.Size = sizes[filepath.Clean(header.Linkname)]
+		case tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+			entry.Type = "device"
+			entry.Problems = append(entry.Problems, "устройства и FIFO запрещены")
+		default:
+			entry.Type = "other"
+			entry.Problems = append(entry.Problems, fmt.Sprintf("неподдерживаемый тип записи %q", header.Typeflag))
+		}
+
+		report.TotalSize += entry.Size
+		if report.TotalSize > archiveLimits.MaxSize {
+			entry.Problems = append(entry.Problems, "на этой записи превышается лимит общего размера")
+		}
+		report.Entries = append(report.Entries, entry)
+	}
+
+	if report.Format == FormatTarGz {
+		if problem := ratioProblem(report.TotalSize, report.CompressedSize); problem != "" {
+			report.Problems = append(report.Problems, "gzip: "+problem)
+		}
+	}
+	return nil
+}
+
+// inspectGzip читает заголовок gzip и заявленный размер из трейлера (ISIZE)
+func inspectGzip(safePath string, report *ArchiveReport) error {
+	file, err := os.Open(safePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	name := gz.Name
+	if name == "" || filepath.Base(name) != name {
+		name = strings.TrimSuffix(filepath.Base(safePath), filepath.Ext(safePath))
+	}
+
+	// Последние 4 байта — размер исходных данных по модулю 2^32 (может быть подделан)
+	var size uint32
+	if report.CompressedSize >= 4 {
+		trailer := make([]byte, 4)
+		if _, err := file.ReadAt(trailer, report.CompressedSize-4); err == nil {
+			size = binary.LittleEndian.Uint32(trailer)
+		}
+	}
+
+	entry := ArchiveEntry{
+		Name:           name,
+		Type:           "file",
+		Size:           int64(size),
+		CompressedSize: report.CompressedSize,
+		Ratio:          compressionRatio(uint64(size), uint64(report.CompressedSize)),
+		Mode:           0644,
+		Modified:       gz.ModTime,
+	}
+	if problem := ratioProblem(entry.Size, entry.CompressedSize); problem != "" {
+		entry.Problems = append(entry.Problems, problem)
+	}
+	report.TotalSize = entry.Size
+	report.Entries = append(report.Entries, entry)
+	return nil
+}
@@ -0,0 +1,499 @@
+package fs
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Редактирование JSON документов без перепечатывания: операции по JSON Pointer,
+// JSON Patch (RFC 6902) и JSON Merge Patch (RFC 7396). Документ читается с
+// сохранением порядка ключей, изменяется в памяти и записывается через WriteJSON
+// только если все операции выполнены успешно
+
+// orderedObject — объект JSON с сохранением порядка ключей
+type orderedObject struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func newOrderedObject() *orderedObject {
+	return &orderedObject{values: make(map[string]interface{})}
+}
+
+func (o *orderedObject) get(key string) (interface{}, bool) {
+	v, ok := o.values[key]
+	return v, ok
+}
+
+// set заменяет значение на прежнем месте или добавляет ключ в конец
+func (o *orderedObject) set(key string, value interface{}) {
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = value
+}
+
+func (o *orderedObject) remove(key string) {
+	if _, ok := o.values[key]; !ok {
+		return
+	}
+	delete(o.values, key)
+	for i, k := range o.keys {
+		if k == key {
+			o.keys = append(o.keys[:i], o.keys[i+1:]...)
+			break
+		}
+	}
+}
+
+// MarshalJSON записывает ключи в исходном порядке
+func (o *orderedObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	buf.WriteByte('{')
+	for i, k := range o.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		if err := encoder.Encode(k); err != nil {
+			return nil, err
+		}
+		buf.WriteByte(':')
+		if err := encoder.Encode(o.values[k]); err != nil {
+			return nil, err
+		}
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// parseOrderedJSON разбирает документ с сохранением порядка ключей и теми же
+// лимитами, что ParseJSON
+func parseOrderedJSON(content string) (interface{}, error) {
+	return decodeJSON(content, true)
+}
+
+// plainJSON преобразует упорядоченные объекты в map для сравнения и проверки
+func plainJSON(v interface{}) interface{} {
+	switch t := v.(type) {
+	case *orderedObject:
+		out := make(map[string]interface{}, len(t.keys))
+		for _, k := range t.keys {
+			out[k] = plainJSON(t.values[k])
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(t))
+		for i, item := range t {
+			out[i] = plainJSON(item)
+		}
+		return out
+	}
+	return v
+}
+
+// cloneJSON создаёт глубокую копию значения (для операции copy)
+func cloneJSON(v interface{}) interface{} {
+	switch t := v.(type) {
+	case *orderedObject:
+		out := newOrderedObject()
+		for _, k := range t.keys {
+			out.set(k, cloneJSON(t.values[k]))
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(t))
+		for i, item := range t {
+			out[i] = cloneJSON(item)
+		}
+		return out
+	}
+	return v
+}
+
+// containerOp изменяет контейнер (объект или массив) по последнему токену указателя
+// и возвращает новый контейнер (массив мог быть пересоздан)
+type containerOp func(container interface{}, token string) (interface{}, error)
+
+// mutateAt применяет op к родителю значения, на которое указывает pointer
+func mutateAt(doc interface{}, pointer string, op containerOp) (interface{}, error) {
+	tokens, err := splitPointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, errors.New("операция над корнем документа не поддерживается")
+	}
+	return mutateTokens(doc, tokens, pointer, op)
+}
+
+func mutateTokens(current interface{}, tokens []string, pointer string, op containerOp) (interface{}, error) {
+	if len(tokens) == 1 {
+		out, err := op(current, tokens[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", pointer, err)
+		}
+		return out, nil
+	}
+	switch c := current.(type) {
+	case *orderedObject:
+		child, ok := c.get(tokens[0])
+		if !ok {
+			return nil, fmt.Errorf("%s: ключ %q не найден", pointer, tokens[0])
+		}
+		updated, err := mutateTokens(child, tokens[1:], pointer, op)
+		if err != nil {
+			return nil, err
+		}
+		c.set(tokens[0], updated)
+		return c, nil
+	case []interface{}:
+		i, err := arrayIndex(tokens[0], len(c))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", pointer, err)
+		}
+		updated, err := mutateTokens(c[i], tokens[1:], pointer, op)
+		if err != nil {
+			return nil, err
+		}
+		c[i] = updated
+		return c, nil
+	default:
+		return nil, fmt.Errorf("%s: путь проходит через скалярное значение", pointer)
+	}
+}
+
+// addOp — операция add (RFC 6902): в объекте добавляет или заменяет ключ,
+// в массиве вставляет элемент перед индексом ("-" — в конец)
+func addOp(value interface{}) containerOp {
+	return func(container interface{}, token string) (interface{}, error) {
+		switch c := container.(type) {
+		case *orderedObject:
+			c.set(token, value)
+			return c, nil
+		case []interface{}:
+			i := len(c)
+			if token != "-" {
+				var err error
+				if i, err = arrayIndex(token, len(c)+1); err != nil {
+					return nil, err
+				}
+			}
+			c = append(c, nil)
+			copy(c[i+1:], c[i:])
+			c[i] = value
+			return c, nil
+		default:
+			return nil, errors.New("родитель не является объектом или массивом")
+		}
+	}
+}
+
+// setOp заменяет существующее значение или добавляет ключ объекта;
+// в массиве заменяет элемент по индексу, "-" добавляет в конец
+func setOp(value interface{}) containerOp {
+	return func(container interface{}, token string) (interface{}, error) {
+		if arr, ok := container.([]interface{}); ok && token != "-" {
+			i, err := arrayIndex(token, len(arr))
+			if err != nil {
+				return nil, err
+			}
+			arr[i] = value
+			return arr, nil
+		}
+		return addOp(value)(container, token)
+	}
+}
+
+// replaceOp — операция replace: значение должно существовать
+func replaceOp(value interface{}) containerOp {
+	return func(container interface{}, token string) (interface{}, error) {
+		switch c := container.(type) {
+		case *orderedObject:
+			if _, exists := c.get(token); !exists {
+				return nil, fmt.Errorf("ключ %q не найден", token)
+			}
+		case []interface{}:
+			if token == "-" {
+				return nil, errors.New("\"-\" недопустим для replace")
+			}
+		}
+		return setOp(value)(container, token)
+	}
+}
+
+// removeOp — операция remove; removed получает удалённое значение
+func removeOp(removed *interface{}) containerOp {
+	return func(container interface{}, token string) (interface{}, error) {
+		switch c := container.(type) {
+		case *orderedObject:
+			v, ok := c.get(token)
+			if !ok {
+				return nil, fmt.Errorf("ключ %q не найден", token)
+			}
+			*removed = v
+			c.remove(token)
+			return c, nil
+		case []interface{}:
+			i, err := arrayIndex(token, len(c))
+			if err != nil {
+				return nil, err
+			}
+			*removed = c[i]
+			return append(c[:i], c[i+1:]...), nil
+		default:
+			return nil, errors.New("родитель не является объектом или массивом")
+		}
+	}
+}
+
+// jsonPatchOp — операция JSON Patch (RFC 6902)
+type jsonPatchOp struct {
+	Op    string
+	Path  string
+	From  string
+	Value interface{}
+	// hasValue отличает "value": null от отсутствующего value
+	hasValue bool
+}
+
+// parseJSONPatch разбирает документ JSON Patch — массив операций
+func parseJSONPatch(content string) ([]jsonPatchOp, error) {
+	doc, err := parseOrderedJSON(content)
+	if err != nil {
+		return nil, err
+	}
+	list, ok := doc.([]interface{})
+	if !ok {
+		return nil, errors.New("JSON Patch должен быть массивом операций")
+	}
+	ops := make([]jsonPatchOp, len(list))
+	for i, raw := range list {
+		obj, ok := raw.(*orderedObject)
+		if !ok {
+			return nil, fmt.Errorf("операция %d: ожидался объект", i)
+		}
+		op := &ops[i]
+		for _, field := range []struct {
+			name   string
+			target *string
+		}{{"op", &op.Op}, {"path", &op.Path}, {"from", &op.From}} {
+			if v, ok := obj.get(field.name); ok {
+				s, isString := v.(string)
+				if !isString {
+					return nil, fmt.Errorf("операция %d: поле %s должно быть строкой", i, field.name)
+				}
+				*field.target = s
+			}
+		}
+		if _, ok := obj.get("path"); !ok {
+			return nil, fmt.Errorf("операция %d: отсутствует path", i)
+		}
+		op.Value, op.hasValue = obj.get("value")
+		switch op.Op {
+		case "add", "replace", "test":
+			if !op.hasValue {
+				return nil, fmt.Errorf("операция %d (%s): отсутствует value", i, op.Op)
+			}
+		case "move", "copy":
+			if _, ok := obj.get("from"); !ok {
+				return nil, fmt.Errorf("операция %d (%s): отсутствует from", i, op.Op)
+			}
+		case "remove":
+		default:
+			return nil, fmt.Errorf("операция %d: неизвестная операция %q", i, op.Op)
+		}
+	}
+	return ops, nil
+}
+
+// applyJSONPatch применяет операции по порядку; при ошибке документ не записывается
+func applyJSONPatch(doc interface{}, ops []jsonPatchOp) (interface{}, error) {
+	var err error
+	for i, op := range ops {
+		doc, err = applyPatchOp(doc, op)
+		if err != nil {
+			return nil, fmt.Errorf("операция %d (%s): %w", i, op.Op, err)
+		}
+	}
+	return doc, nil
+}
+
+func applyPatchOp(doc interface{}, op jsonPatchOp) (interface{}, error) {
+	// Операции над корнем ("") заменяют или проверяют документ целиком
+	if op.Path == "" {
+		switch op.Op {
+		case "add", "replace":
+			return cloneJSON(op.Value), nil
+		case "test":
+			return doc, testValue(doc, op.Path, op.Value)
+		case "copy", "move":
+			v, err := resolvePointer(doc, op.From)
+			return cloneJSON(v), err
+		default:
+			return nil, errors.New("нельзя удалить корень документа")
+		}
+	}
+
+	switch op.Op {
+	case "add":
+		return mutateAt(doc, op.Path, addOp(cloneJSON(op.Value)))
+	case "replace":
+		return mutateAt(doc, op.Path, replaceOp(cloneJSON(op.Value)))
+	case "remove":
+		var removed interface{}
+		return mutateAt(doc, op.Path, removeOp(&removed))
+	case "test":
+		v, err := resolvePointer(doc, op.Path)
+		if err != nil {
+			return nil, err
+		}
+		return doc, testValue(v, op.Path, op.Value)
+	case "copy":
+		v, err := resolvePointer(doc, op.From)
+		if err != nil {
+			return nil, err
+		}
+		return mutateAt(doc, op.Path, addOp(cloneJSON(v)))
+	default: // move
+		if op.From == op.Path {
+			return doc, nil
+		}
+		if strings.HasPrefix(op.Path, op.From+"/") {
+			return nil, errors.New("нельзя переместить значение внутрь самого себя")
+		}
+		var removed interface{}
+		doc, err := mutateAt(doc, op.From, removeOp(&removed))
+		if err != nil {
+			return nil, err
+		}
+		return mutateAt(doc, op.Path, addOp(removed))
+	}
+}
+
+func testValue(actual interface{}, pointer string, expected interface{}) error {
+	if !jsonEqual(plainJSON(actual), plainJSON(expected)) {
+		return fmt.Errorf("%s: значение %s не равно ожидаемому %s", pointer, compactJSON(actual), compactJSON(expected))
+	}
+	return nil
+}
+
+// mergePatch применяет JSON Merge Patch (RFC 7396): null удаляет ключ,
+// объекты объединяются рекурсивно, остальные значения заменяются целиком
+func mergePatch(target, patch interface{}) interface{} {
+	p, ok := patch.(*orderedObject)
+	if !ok {
+		return cloneJSON(patch)
+	}
+	t, ok := target.(*orderedObject)
+	if !ok {
+		t = newOrderedObject()
+	}
+	for _, k := range p.keys {
+		v := p.values[k]
+		if v == nil {
+			t.remove(k)
+			continue
+		}
+		current, _ := t.get(k)
+		t.set(k, mergePatch(current, v))
+	}
+	return t
+}
+
+// editJSON читает документ с сохранением порядка ключей, изменяет и записывает
+// его через WriteFileIfMatch (атомарно, с проверкой схемы и версии)
+func editJSON(path string, edit func(doc interface{}) (interface{}, error)) error {
+	safePath, err := ResolvePath(path)
+	if err != nil {
+		return err
+	}
+	content, err := readStructuredFile(safePath)
+	if err != nil {
+		return err
+	}
+	doc, err := parseOrderedJSON(content)
+	if err != nil {
+		return err
+	}
+	doc, err = edit(doc)
+	if err != nil {
+		return err
+	}
+	out, err := encodeJSON(doc)
+	if err != nil {
+		return err
+	}
+	// Файл мог измениться, пока документ редактировался: чужие правки не затираем
+	return WriteFileIfMatch(path, out, ContentVersion(content))
+}
+
+// parseJSONValue разбирает значение, введённое для операции редактирования
+func parseJSONValue(value string) (interface{}, error) {
+	v, err := parseOrderedJSON(value)
+	if err != nil {
+		return nil, fmt.Errorf("значение должно быть JSON (строки — в кавычках): %w", err)
+	}
+	return v, nil
+}
+
+// SetJSONValue устанавливает значение по JSON Pointer: заменяет существующее,
+// добавляет ключ объекта или элемент в конец массива ("/items/-")
+func SetJSONValue(path, pointer, value string) error {
+	v, err := parseJSONValue(value)
+	if err != nil {
+		return err
+	}
+	return editJSON(path, func(doc interface{}) (interface{}, error) {
+		if pointer == "" {
+			return v, nil
+		}
+		return mutateAt(doc, pointer, setOp(v))
+	})
+}
+
+// InsertJSONValue вставляет значение по JSON Pointer (операция add из RFC 6902):
+// в массиве элементы после индекса сдвигаются
+func InsertJSONValue(path, pointer, value string) error {
+	v, err := parseJSONValue(value)
+	if err != nil {
+		return err
+	}
+	return editJSON(path, func(doc interface{}) (interface{}, error) {
+		return applyPatchOp(doc, jsonPatchOp{Op: "add", Path: pointer, Value: v, hasValue: true})
+	})
+}
+
+// DeleteJSONValue удаляет значение по JSON Pointer
+func DeleteJSONValue(path, pointer string) error {
+	return editJSON(path, func(doc interface{}) (interface{}, error) {
+		return applyPatchOp(doc, jsonPatchOp{Op: "remove", Path: pointer})
+	})
+}
+
+// ApplyJSONPatch применяет документ JSON Patch (RFC 6902). Операции выполняются
+// по порядку; если хотя бы одна не выполнена, файл не изменяется
+func ApplyJSONPatch(path, patch string) error {
+	ops, err := parseJSONPatch(patch)
+	if err != nil {
+		return err
+	}
+	return editJSON(path, func(doc interface{}) (interface{}, error) {
+		return applyJSONPatch(doc, ops)
+	})
+}
+
+// ApplyMergePatch применяет документ JSON Merge Patch (RFC 7396)
+func ApplyMergePatch(path, patch string) error {
+	p, err := parseOrderedJSON(patch)
+	if err != nil {
+		return err
+	}
+	return editJSON(path, func(doc interface{}) (interface{}, error) {
+		return mergePatch(doc, p), nil
+	})
+}
@@ -0,0 +1,219 @@
+package fs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	MaxJSONDepth        = 64      // Максимальная вложенность объектов и массивов
+	MaxJSONTokens       = 1000000 // Максимальное количество значений и ключей в документе
+	MaxJSONStringLength = 1 << 20 // Максимальная длина строки или ключа (байт)
+	MaxJSONNumberLength = 100     // Максимальная длина записи числа (символов)
+)
+
+// ErrJSONLimit — документ превышает лимиты разбора JSON
+var ErrJSONLimit = errors.New("превышен лимит JSON")
+
+// JSONLimits — лимиты разбора JSON документов
+// Нулевое значение числового поля означает значение по умолчанию
+type JSONLimits struct {
+	MaxDepth            int  // вложенность объектов и массивов
+	MaxTokens           int  // количество значений и ключей
+	MaxStringLength     int  // длина строки или ключа (байт)
+	MaxNumberLength     int  // длина записи числа (символов)
+	RejectDuplicateKeys bool // повторяющийся ключ в объекте — ошибка, а не «последний побеждает»
+}
+
+// jsonLimits — действующие лимиты (устанавливаются в InitFS из конфигурации)
+var jsonLimits = DefaultJSONLimits()
+
+// DefaultJSONLimits возвращает лимиты разбора JSON по умолчанию
+func DefaultJSONLimits() JSONLimits {
+	return JSONLimits{
+		MaxDepth:        MaxJSONDepth,
+		MaxTokens:       MaxJSONTokens,
+		MaxStringLength: MaxJSONStringLength,
+		MaxNumberLength: MaxJSONNumberLength,
+	}
+}
+
+// SetJSONLimits устанавливает лимиты разбора JSON; нулевые поля заменяются значениями по умолчанию
+func SetJSONLimits(limits JSONLimits) {
+	defaults := DefaultJSONLimits()
+	if limits.MaxDepth <= 0 {
+		limits.MaxDepth = defaults.MaxDepth
+	}
+	if limits.MaxTokens <= 0 {
+		limits.MaxTokens = defaults.MaxTokens
+	}
+	if limits.MaxStringLength <= 0 {
+		limits.MaxStringLength = defaults.MaxStringLength
+	}
+	if limits.MaxNumberLength <= 0 {
+		limits.MaxNumberLength = defaults.MaxNumberLength
+	}
+	jsonLimits = limits
+}
+
+// CurrentJSONLimits возвращает действующие лимиты разбора JSON
+func CurrentJSONLimits() JSONLimits {
+	return jsonLimits
+}
+
+// jsonDecoder разбирает документ потоком токенов и проверяет лимиты до того,
+// как значение попадёт в память: глубокая вложенность отклоняется на первой
+// лишней скобке, а не после рекурсивного разбора всего документа
+type jsonDecoder struct {
+	content string
+	dec     *json.Decoder
+	limits  JSONLimits
+	ordered bool
+	tokens  int
+}
+
+// decodeJSON разбирает документ с учётом лимитов; ordered — объекты
+// разбираются в *orderedObject с сохранением порядка ключей, иначе в map
+func decodeJSON(content string, ordered bool) (interface{}, error) {
+	d := &jsonDecoder{
+		content: content,
+		dec:     json.NewDecoder(strings.NewReader(content)),
+		limits:  jsonLimits,
+		ordered: ordered,
+	}
+	d.dec.UseNumber()
+
+	data, err := d.value(0)
+	if err == io.EOF {
+		return nil, errors.New("пустой JSON документ")
+	}
+	if err != nil {
+		return nil, d.wrap(err)
+	}
+	if _, err := d.dec.Token(); err != io.EOF {
+		return nil, jsonError(content, d.dec.InputOffset(), errors.New("лишние данные после JSON документа"))
+	}
+	return data, nil
+}
+
+// wrap добавляет к ошибке строку и столбец
+func (d *jsonDecoder) wrap(err error) error {
+	var syntax *json.SyntaxError
+	var parseErr *ParseError
+	switch {
+	case errors.As(err, &parseErr):
+		return err
+	case errors.As(err, &syntax):
+		return jsonError(d.content, syntax.Offset, err)
+	case err == io.EOF || err == io.ErrUnexpectedEOF:
+		return jsonError(d.content, int64(len(d.content)), errors.New("неожиданный конец документа"))
+	}
+	return jsonError(d.content, d.dec.InputOffset(), err)
+}
+
+func (d *jsonDecoder) limitError(format string, args ...interface{}) error {
+	return jsonError(d.content, d.dec.InputOffset(), fmt.Errorf("%w: "+format, append([]interface{}{ErrJSONLimit}, args...)...))
+}
+
+// next читает токен и учитывает его в лимите количества
+func (d *jsonDecoder) next() (json.Token, error) {
+	tok, err := d.dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if d.tokens++; d.tokens > d.limits.MaxTokens {
+		return nil, d.limitError("больше %d значений", d.limits.MaxTokens)
+	}
+	switch t := tok.(type) {
+	case string:
+		if len(t) > d.limits.MaxStringLength {
+			return nil, d.limitError("строка длиннее %d байт", d.limits.MaxStringLength)
+		}
+	case json.Number:
+		if len(t) > d.limits.MaxNumberLength {
+			return nil, d.limitError("число длиннее %d символов", d.limits.MaxNumberLength)
+		}
+		// Число должно помещаться в float64: 1e400 превратилось бы в бесконечность
+		if _, err := strconv.ParseFloat(string(t), 64); err != nil {
+			return nil, d.limitError("число %s вне допустимого диапазона", t)
+		}
+	}
+	return tok, nil
+}
+
+// value читает значение; depth — вложенность контейнера, в котором оно находится
+func (d *jsonDecoder) value(depth int) (interface{}, error) {
+	tok, err := d.next()
+	if err != nil {
+		if err == io.EOF && depth > 0 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	delim, isDelim := tok.(json.Delim)
+	if !isDelim {
+		return tok, nil
+	}
+	if depth+1 > d.limits.MaxDepth {
+		return nil, d.limitError("вложенность больше %d", d.limits.MaxDepth)
+	}
+
+	if delim == '[' {
+		arr := []interface{}{}
+		for d.dec.More() {
+			item, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, item)
+		}
+		_, err := d.dec.Token() // ]
+		return arr, err
+	}
+
+	var obj *orderedObject
+	var plain map[string]interface{}
+	if d.ordered {
+		obj = newOrderedObject()
+	} else {
+		plain = make(map[string]interface{})
+	}
+	for d.dec.More() {
+		keyTok, err := d.next()
+		if err != nil {
+			return nil, err
+		}
+		key := keyTok.(string)
+		if d.limits.RejectDuplicateKeys {
+			duplicate := false
+			if d.ordered {
+				_, duplicate = obj.get(key)
+			} else {
+				_, duplicate = plain[key]
+			}
+			if duplicate {
+				return nil, jsonError(d.content, d.dec.InputOffset(), fmt.Errorf("ключ %q повторяется", key))
+			}
+		}
+		item, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if d.ordered {
+			obj.set(key, item)
+		} else {
+			plain[key] = item
+		}
+	}
+	if _, err := d.dec.Token(); err != nil { // }
+		return nil, err
+	}
+	if d.ordered {
+		return obj, nil
+	}
+	return plain, nil
+}
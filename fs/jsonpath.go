@@ -0,0 +1,649 @@
+package fs
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MaxQueryResults — максимальное количество совпадений запроса JSONPath/XPath
+const MaxQueryResults = 10000
+
+var errTooManyMatches = fmt.Errorf("запрос вернул больше %d совпадений, уточните выражение", MaxQueryResults)
+
+// JSONMatch — значение, найденное выражением JSONPath
+type JSONMatch struct {
+	Path  string      // нормализованный путь: $['store']['book'][0]
+	Value interface{} // найденное значение
+}
+
+// QueryJSON читает JSON файл и вычисляет выражение JSONPath
+func QueryJSON(path, expr string) ([]JSONMatch, error) {
+	query, err := ParseJSONPath(expr)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ReadJSON(path)
+	if err != nil {
+		return nil, err
+	}
+	return query.Evaluate(data)
+}
+
+// JSONPath — разобранное выражение. Поддерживается подмножество RFC 9535:
+//
+//	$               корень документа
+//	.name ['name']  поле объекта (несколько через запятую: ['a','b'])
+//	[0] [-1] [0,2]  элементы массива (отрицательный индекс — с конца)
+//	[1:3] [::2]     срез массива
+//	.* [*]          все дочерние значения
+//	..name ..*      рекурсивный спуск
+//	[?(@.price < 10 && @.tags)]  фильтр: сравнения ==, !=, <, <=, >, >= и проверка наличия,
+//	                             объединение через && и ||
+type JSONPath struct {
+	segments []jsonPathSegment
+}
+
+type jsonPathSegment struct {
+	recursive bool
+	wildcard  bool
+	names     []string
+	indexes   []int
+	slice     *jsonSlice
+	filter    jsonFilter
+}
+
+type jsonSlice struct {
+	start, end, step *int
+}
+
+// jsonFilter — условие фильтра ([?...]) для одного дочернего значения
+type jsonFilter func(value interface{}) bool
+
+// ParseJSONPath разбирает выражение JSONPath
+func ParseJSONPath(expr string) (*JSONPath, error) {
+	p := &jsonPathParser{src: strings.TrimSpace(expr)}
+	if !strings.HasPrefix(p.src, "$") {
+		return nil, errors.New("выражение JSONPath должно начинаться с $")
+	}
+	p.pos = 1
+	segments, err := p.segments(false)
+	if err != nil {
+		return nil, fmt.Errorf("JSONPath %q, позиция %d: %w", expr, p.pos+1, err)
+	}
+	if p.pos < len(p.src) {
+		return nil, fmt.Errorf("JSONPath %q, позиция %d: неожиданный символ %q", expr, p.pos+1, p.src[p.pos])
+	}
+	return &JSONPath{segments: segments}, nil
+}
+
+// parseJSONFilter разбирает отдельное условие фильтра в синтаксисе JSONPath,
+// например @.level == 'error' && @.status >= 500
+func parseJSONFilter(expr string) (jsonFilter, error) {
+	p := &jsonPathParser{src: strings.TrimSpace(expr)}
+	f, err := p.or()
+	if err == nil {
+		if p.skipSpaces(); p.pos < len(p.src) {
+			err = fmt.Errorf("неожиданный символ %q", p.src[p.pos])
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("фильтр %q, позиция %d: %w", expr, p.pos+1, err)
+	}
+	return f, nil
+}
+
+// Evaluate применяет выражение к документу
+func (q *JSONPath) Evaluate(data interface{}) ([]JSONMatch, error) {
+	current := []JSONMatch{{Path: "$", Value: data}}
+	for _, seg := range q.segments {
+		var next []JSONMatch
+		for _, m := range current {
+			targets := []JSONMatch{m}
+			if seg.recursive {
+				targets = descendants(m, nil)
+			}
+			for _, t := range targets {
+				next = seg.apply(t, next)
+				if len(next) > MaxQueryResults {
+					return nil, errTooManyMatches
+				}
+			}
+		}
+		current = next
+	}
+	return current, nil
+}
+
+// descendants возвращает значение и все вложенные в него значения (в порядке обхода)
+func descendants(m JSONMatch, out []JSONMatch) []JSONMatch {
+	out = append(out, m)
+	for _, child := range children(m) {
+		out = descendants(child, out)
+	}
+	return out
+}
+
+// children возвращает дочерние значения объекта (по алфавиту ключей) или массива
+func children(m JSONMatch) []JSONMatch {
+	switch v := m.Value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		out := make([]JSONMatch, len(keys))
+		for i, k := range keys {
+			out[i] = JSONMatch{Path: m.Path + "[" + quoteJSONPathName(k) + "]", Value: v[k]}
+		}
+		return out
+	case []interface{}:
+		out := make([]JSONMatch, len(v))
+		for i, item := range v {
+			out[i] = JSONMatch{Path: m.Path + "[" + strconv.Itoa(i) + "]", Value: item}
+		}
+		return out
+	}
+	return nil
+}
+
+func (seg jsonPathSegment) apply(m JSONMatch, out []JSONMatch) []JSONMatch {
+	switch {
+	case seg.wildcard:
+		return append(out, children(m)...)
+	case seg.filter != nil:
+		for _, child := range children(m) {
+			if seg.filter(child.Value) {
+				out = append(out, child)
+			}
+		}
+		return out
+	case len(seg.names) > 0:
+		obj, ok := m.Value.(map[string]interface{})
+		if !ok {
+			return out
+		}
+		for _, name := range seg.names {
+			if v, ok := obj[name]; ok {
+				out = append(out, JSONMatch{Path: m.Path + "[" + quoteJSONPathName(name) + "]", Value: v})
+			}
+		}
+		return out
+	}
+
+	arr, ok := m.Value.([]interface{})
+	if !ok {
+		return out
+	}
+	add := func(i int) {
+		out = append(out, JSONMatch{Path: m.Path + "[" + strconv.Itoa(i) + "]", Value: arr[i]})
+	}
+	if seg.slice != nil {
+		for _, i := range seg.slice.indexes(len(arr)) {
+			add(i)
+		}
+		return out
+	}
+	for _, i := range seg.indexes {
+		if i < 0 {
+			i += len(arr)
+		}
+		if i >= 0 && i < len(arr) {
+			add(i)
+		}
+	}
+	return out
+}
+
+// indexes возвращает индексы среза для массива длины n (как срезы в Python)
+func (s *jsonSlice) indexes(n int) []int {
+	step := 1
+	if s.step != nil {
+		step = *s.step
+	}
+	if step == 0 {
+		return nil
+	}
+	norm := func(p *int, def int) int {
+		if p == nil {
+			return def
+		}
+		i := *p
+		if i < 0 {
+			i += n
+		}
+		return i
+	}
+	var out []int
+	if step > 0 {
+		start, end := clampIndex(norm(s.start, 0), 0, n), clampIndex(norm(s.end, n), 0, n)
+		for i := start; i < end; i += step {
+			out = append(out, i)
+		}
+	} else {
+		start, end := clampIndex(norm(s.start, n-1), -1, n-1), clampIndex(norm(s.end, -n-1), -1, n-1)
+		for i := start; i > end; i += step {
+			out = append(out, i)
+		}
+	}
+	return out
+}
+
+func clampIndex(i, lo, hi int) int {
+	if i < lo {
+		return lo
+	}
+	if i > hi {
+		return hi
+	}
+	return i
+}
+
+// quoteJSONPathName записывает имя поля в нормализованном пути: 'name'
+func quoteJSONPathName(name string) string {
+	name = strings.ReplaceAll(name, `\`, `\\`)
+	return "'" + strings.ReplaceAll(name, "'", `\'`) + "'"
+}
+
+type jsonPathParser struct {
+	src string
+	pos int
+}
+
+func (p *jsonPathParser) peek() byte {
+	if p.pos < len(p.src) {
+		return p.src[p.pos]
+	}
+	return 0
+}
+
+func (p *jsonPathParser) skipSpaces() {
+	for p.pos < len(p.src) && p.src[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+// segments разбирает последовательность сегментов; в фильтре (relative) она
+// заканчивается на первом символе, не начинающем сегмент
+func (p *jsonPathParser) segments(relative bool) ([]jsonPathSegment, error) {
+	var out []jsonPathSegment
+	for p.pos < len(p.src) {
+		var seg jsonPathSegment
+		switch p.peek() {
+		case '.':
+			p.pos++
+			if p.peek() == '.' {
+				p.pos++
+				seg.recursive = true
+			}
+			if p.peek() == '[' {
+				if !seg.recursive {
+					return nil, errors.New("после . ожидалось имя поля")
+				}
+				if err := p.bracket(&seg); err != nil {
+					return nil, err
+				}
+			} else if p.peek() == '*' {
+				p.pos++
+				seg.wildcard = true
+			} else {
+				name := p.name()
+				if name == "" {
+					return nil, errors.New("ожидалось имя поля")
+				}
+				seg.names = []string{name}
+			}
+		case '[':
+			if err := p.bracket(&seg); err != nil {
+				return nil, err
+			}
+		default:
+			if relative {
+				return out, nil
+			}
+			return nil, fmt.Errorf("неожиданный символ %q", p.peek())
+		}
+		out = append(out, seg)
+	}
+	return out, nil
+}
+
+// name читает имя поля после точки
+func (p *jsonPathParser) name() string {
+	start := p.pos
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		if c == '.' || c == '[' || c == ' ' || c == ')' || c == '=' || c == '!' || c == '<' || c == '>' || c == '&' || c == '|' {
+			break
+		}
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+// bracket разбирает селектор в квадратных скобках
+func (p *jsonPathParser) bracket(seg *jsonPathSegment) error {
+	p.pos++ // [
+	p.skipSpaces()
+	switch c := p.peek(); {
+	case c == '*':
+		p.pos++
+		seg.wildcard = true
+	case c == '?':
+		p.pos++
+		filter, err := p.filter()
+		if err != nil {
+			return err
+		}
+		seg.filter = filter
+	case c == '\'' || c == '"':
+		for {
+			name, err := p.quoted()
+			if err != nil {
+				return err
+			}
+			seg.names = append(seg.names, name)
+			p.skipSpaces()
+			if p.peek() != ',' {
+				break
+			}
+			p.pos++
+			p.skipSpaces()
+		}
+	default:
+		if err := p.indexOrSlice(seg); err != nil {
+			return err
+		}
+	}
+	p.skipSpaces()
+	if p.peek() != ']' {
+		return errors.New("ожидалась ]")
+	}
+	p.pos++
+	return nil
+}
+
+func (p *jsonPathParser) quoted() (string, error) {
+	quote := p.peek()
+	if quote != '\'' && quote != '"' {
+		return "", errors.New("ожидалась строка в кавычках")
+	}
+	p.pos++
+	var sb strings.Builder
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		switch {
+		case c == '\\' && p.pos+1 < len(p.src):
+			sb.WriteByte(p.src[p.pos+1])
+			p.pos += 2
+		case c == quote:
+			p.pos++
+			return sb.String(), nil
+		default:
+			sb.WriteByte(c)
+			p.pos++
+		}
+	}
+	return "", errors.New("незакрытая строка")
+}
+
+// integer читает целое число (возможно, со знаком); ok=false — числа нет
+func (p *jsonPathParser) integer() (int, bool, error) {
+	start := p.pos
+	if p.peek() == '-' {
+		p.pos++
+	}
+	for p.pos < len(p.src) && p.src[p.pos] >= '0' && p.src[p.pos] <= '9' {
+		p.pos++
+	}
+	if p.pos == start {
+		return 0, false, nil
+	}
+	n, err := strconv.Atoi(p.src[start:p.pos])
+	if err != nil {
+		return 0, false, fmt.Errorf("недопустимое число %q", p.src[start:p.pos])
+	}
+	return n, true, nil
+}
+
+func (p *jsonPathParser) indexOrSlice(seg *jsonPathSegment) error {
+	first, ok, err := p.integer()
+	if err != nil {
+		return err
+	}
+	p.skipSpaces()
+	if p.peek() == ':' {
+		slice := &jsonSlice{}
+		if ok {
+			slice.start = &first
+		}
+		for _, field := range []**int{&slice.end, &slice.step} {
+			if p.peek() != ':' {
+				break
+			}
+			p.pos++
+			p.skipSpaces()
+			n, ok, err := p.integer()
+			if err != nil {
+				return err
+			}
+			if ok {
+				v := n
+				*field = &v
+			}
+			p.skipSpaces()
+		}
+		seg.slice = slice
+		return nil
+	}
+	if !ok {
+		return errors.New("ожидался индекс, срез, *, имя в кавычках или фильтр")
+	}
+	seg.indexes = append(seg.indexes, first)
+	for p.peek() == ',' {
+		p.pos++
+		p.skipSpaces()
+		n, ok, err := p.integer()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errors.New("ожидался индекс")
+		}
+		seg.indexes = append(seg.indexes, n)
+		p.skipSpaces()
+	}
+	return nil
+}
+
+// filter разбирает условие фильтра: ?(...) или ?... до закрывающей ]
+func (p *jsonPathParser) filter() (jsonFilter, error) {
+	p.skipSpaces()
+	parens := p.peek() == '('
+	if parens {
+		p.pos++
+	}
+	f, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpaces()
+	if parens {
+		if p.peek() != ')' {
+			return nil, errors.New("ожидалась )")
+		}
+		p.pos++
+	}
+	return f, nil
+}
+
+func (p *jsonPathParser) or() (jsonFilter, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		p.skipSpaces()
+		if !strings.HasPrefix(p.src[p.pos:], "||") {
+			return left, nil
+		}
+		p.pos += 2
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(v interface{}) bool { return l(v) || right(v) }
+	}
+}
+
+func (p *jsonPathParser) and() (jsonFilter, error) {
+	left, err := p.comparison()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		p.skipSpaces()
+		if !strings.HasPrefix(p.src[p.pos:], "&&") {
+			return left, nil
+		}
+		p.pos += 2
+		right, err := p.comparison()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(v interface{}) bool { return l(v) && right(v) }
+	}
+}
+
+// comparison разбирает «@путь оператор литерал» или «@путь» (проверка наличия)
+func (p *jsonPathParser) comparison() (jsonFilter, error) {
+	p.skipSpaces()
+	if p.peek() == '(' {
+		p.pos++
+		f, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpaces()
+		if p.peek() != ')' {
+			return nil, errors.New("ожидалась )")
+		}
+		p.pos++
+		return f, nil
+	}
+	if p.peek() != '@' {
+		return nil, errors.New("условие фильтра должно начинаться с @")
+	}
+	p.pos++
+	segments, err := p.segments(true)
+	if err != nil {
+		return nil, err
+	}
+	operand := &JSONPath{segments: segments}
+	resolve := func(v interface{}) (interface{}, bool) {
+		matches, err := operand.Evaluate(v)
+		if err != nil || len(matches) != 1 {
+			return nil, false
+		}
+		return matches[0].Value, true
+	}
+
+	p.skipSpaces()
+	op := ""
+	for _, candidate := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if strings.HasPrefix(p.src[p.pos:], candidate) {
+			op = candidate
+			break
+		}
+	}
+	if op == "" {
+		return func(v interface{}) bool {
+			_, ok := resolve(v)
+			return ok
+		}, nil
+	}
+	p.pos += len(op)
+	p.skipSpaces()
+	literal, err := p.literal()
+	if err != nil {
+		return nil, err
+	}
+	return func(v interface{}) bool {
+		actual, ok := resolve(v)
+		if !ok {
+			return op == "!="
+		}
+		return compareJSON(actual, literal, op)
+	}, nil
+}
+
+// literal читает строку, число, true, false или null
+func (p *jsonPathParser) literal() (interface{}, error) {
+	switch c := p.peek(); {
+	case c == '\'' || c == '"':
+		return p.quoted()
+	case strings.HasPrefix(p.src[p.pos:], "true"):
+		p.pos += 4
+		return true, nil
+	case strings.HasPrefix(p.src[p.pos:], "false"):
+		p.pos += 5
+		return false, nil
+	case strings.HasPrefix(p.src[p.pos:], "null"):
+		p.pos += 4
+		return nil, nil
+	}
+	start := p.pos
+	for p.pos < len(p.src) && strings.IndexByte("+-0123456789.eE", p.src[p.pos]) >= 0 {
+		p.pos++
+	}
+	n, err := strconv.ParseFloat(p.src[start:p.pos], 64)
+	if err != nil {
+		return nil, errors.New("ожидалось значение: строка, число, true, false или null")
+	}
+	return n, nil
+}
+
+// compareJSON сравнивает значения; < и > определены только для чисел и строк одного типа
+func compareJSON(a, b interface{}, op string) bool {
+	switch op {
+	case "==":
+		return jsonEqual(a, b)
+	case "!=":
+		return !jsonEqual(a, b)
+	}
+	var cmp int
+	if x, ok := toFloat(a); ok {
+		y, ok := toFloat(b)
+		if !ok {
+			return false
+		}
+		switch {
+		case x < y:
+			cmp = -1
+		case x > y:
+			cmp = 1
+		}
+	} else {
+		x, ok1 := a.(string)
+		y, ok2 := b.(string)
+		if !ok1 || !ok2 {
+			return false
+		}
+		cmp = strings.Compare(x, y)
+	}
+	switch op {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	default:
+		return cmp >= 0
+	}
+}
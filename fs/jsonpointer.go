@@ -0,0 +1,84 @@
+package fs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// JSON Pointer (RFC 6901): "" — весь документ, "/a/0" — элемент 0 массива в ключе "a".
+// В токенах "~" записывается как "~0", "/" — как "~1"
+
+// appendPointer добавляет к указателю ключ объекта или индекс массива
+func appendPointer(pointer, token string) string {
+	token = strings.ReplaceAll(token, "~", "~0")
+	token = strings.ReplaceAll(token, "/", "~1")
+	return pointer + "/" + token
+}
+
+// splitPointer разбирает указатель на токены
+func splitPointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("JSON Pointer %q должен начинаться с /", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, t := range tokens {
+		if strings.Contains(strings.ReplaceAll(strings.ReplaceAll(t, "~0", ""), "~1", ""), "~") {
+			return nil, fmt.Errorf("JSON Pointer %q: недопустимая escape-последовательность", pointer)
+		}
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(t, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// arrayIndex разбирает токен указателя как индекс массива длины n
+func arrayIndex(token string, n int) (int, error) {
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("недопустимый индекс массива %q", token)
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 {
+		return 0, fmt.Errorf("недопустимый индекс массива %q", token)
+	}
+	if i >= n {
+		return 0, fmt.Errorf("индекс %d вне массива длины %d", i, n)
+	}
+	return i, nil
+}
+
+// resolvePointer возвращает значение по указателю (документ из map или с порядком ключей)
+func resolvePointer(doc interface{}, pointer string) (interface{}, error) {
+	tokens, err := splitPointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+	current := doc
+	for _, t := range tokens {
+		switch v := current.(type) {
+		case *orderedObject:
+			next, ok := v.get(t)
+			if !ok {
+				return nil, fmt.Errorf("%s: ключ %q не найден", pointer, t)
+			}
+			current = next
+		case map[string]interface{}:
+			next, ok := v[t]
+			if !ok {
+				return nil, fmt.Errorf("%s: ключ %q не найден", pointer, t)
+			}
+			current = next
+		case []interface{}:
+			i, err := arrayIndex(t, len(v))
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", pointer, err)
+			}
+			current = v[i]
+		default:
+			return nil, fmt.Errorf("%s: путь проходит через скалярное значение", pointer)
+		}
+	}
+	return current, nil
+}
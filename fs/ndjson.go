@@ -0,0 +1,303 @@
+package fs
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// JSON Lines (NDJSON): одна JSON запись на строку. Файл читается потоком по
+// строкам, поэтому в памяти одновременно находится только одна запись, а
+// ошибка в строке не мешает обработать остальные
+
+const (
+	MaxNDJSONLineLength = 1 << 20 // Максимальная длина одной записи (байт)
+	MaxNDJSONErrors     = 100     // Сколько ошибок строк сохраняется в отчёте
+	// MaxNDJSONFileSize — лимит размера журнала при дописывании. Журнал не
+	// читается целиком, поэтому он больше MaxFileSize обычных файлов
+	MaxNDJSONFileSize = 1 << 30
+)
+
+// ndjsonExtensions — расширения файлов JSON Lines
+var ndjsonExtensions = []string{".ndjson", ".jsonl"}
+
+// isNDJSONPath проверяет, что файл — JSON Lines (по расширению)
+func isNDJSONPath(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, e := range ndjsonExtensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// NDJSONOptions — параметры чтения JSON Lines
+type NDJSONOptions struct {
+	Filter string   // условие JSONPath: @.level == 'error' && @.status >= 500
+	Fields []string // выбираемые поля: имена верхнего уровня или JSON Pointer (/user/id)
+	Limit  int      // остановиться после стольких подходящих записей (0 — без ограничения)
+}
+
+// NDJSONRecord — запись файла JSON Lines
+type NDJSONRecord struct {
+	Line  int
+	Value interface{}
+}
+
+// NDJSONStats — итоги чтения JSON Lines
+type NDJSONStats struct {
+	Lines      int           // прочитано строк
+	Records    int           // корректных записей
+	Matched    int           // записей, прошедших фильтр
+	ErrorCount int           // строк с ошибками
+	Errors     []*ParseError // первые MaxNDJSONErrors ошибок
+	Partial    bool          // чтение остановлено по Limit до конца файла
+}
+
+func (s *NDJSONStats) addError(line int, err error) {
+	s.ErrorCount++
+	if len(s.Errors) < MaxNDJSONErrors {
+		s.Errors = append(s.Errors, ndjsonLineError(line, err))
+	}
+}
+
+// ndjsonLineError переносит ошибку разбора записи на строку файла
+func ndjsonLineError(line int, err error) *ParseError {
+	parseErr := &ParseError{Line: line, Column: 1, Err: err}
+	var inner *ParseError
+	if errors.As(err, &inner) {
+		parseErr.Column, parseErr.Err = inner.Column, inner.Err
+	}
+	return parseErr
+}
+
+// ndjsonField — выбираемое поле записи
+type ndjsonField struct {
+	name    string
+	pointer string
+}
+
+func parseNDJSONFields(fields []string) ([]ndjsonField, error) {
+	var out []ndjsonField
+	for _, f := range fields {
+		f = strings.TrimSpace(f)
+		switch {
+		case f == "":
+			continue
+		case strings.HasPrefix(f, "/"):
+			if _, err := splitPointer(f); err != nil {
+				return nil, err
+			}
+			out = append(out, ndjsonField{name: f, pointer: f})
+		default:
+			out = append(out, ndjsonField{name: f, pointer: appendPointer("", f)})
+		}
+	}
+	return out, nil
+}
+
+// ScanNDJSON читает файл JSON Lines по одной записи и вызывает fn для каждой
+// записи, прошедшей фильтр (fn == nil — только подсчёт). Пустые строки
+// пропускаются, некорректные строки попадают в отчёт и не прерывают чтение.
+// Ошибка fn останавливает чтение
+func ScanNDJSON(path string, opts NDJSONOptions, fn func(NDJSONRecord) error) (*NDJSONStats, error) {
+	var filter jsonFilter
+	if strings.TrimSpace(opts.Filter) != "" {
+		var err error
+		if filter, err = parseJSONFilter(opts.Filter); err != nil {
+			return nil, err
+		}
+	}
+	fields, err := parseNDJSONFields(opts.Fields)
+	if err != nil {
+		return nil, err
+	}
+	safePath, err := ResolvePath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	fileMutex.RLock()
+	defer fileMutex.RUnlock()
+
+	file, err := os.Open(safePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	stats := &NDJSONStats{}
+	r := bufio.NewReader(file)
+	for lineNo := 1; ; lineNo++ {
+		line, tooLong, err := readNDJSONLine(r, MaxNDJSONLineLength)
+		if err == io.EOF {
+			return stats, nil
+		}
+		if err != nil {
+			return stats, err
+		}
+		stats.Lines++
+		if tooLong {
+			stats.addError(lineNo, fmt.Errorf("запись длиннее %d байт", MaxNDJSONLineLength))
+			continue
+		}
+		text := strings.TrimSpace(string(line))
+		if text == "" {
+			continue
+		}
+		value, err := parseOrderedJSON(text)
+		if err != nil {
+			stats.addError(lineNo, err)
+			continue
+		}
+		stats.Records++
+		if filter != nil && !filter(plainJSON(value)) {
+			continue
+		}
+		stats.Matched++
+
+		if fn != nil {
+			if len(fields) > 0 {
+				value = projectNDJSON(value, fields)
+			}
+			if err := fn(NDJSONRecord{Line: lineNo, Value: value}); err != nil {
+				return stats, err
+			}
+		}
+		if opts.Limit > 0 && stats.Matched >= opts.Limit {
+			_, err := r.Peek(1)
+			stats.Partial = err == nil
+			return stats, nil
+		}
+	}
+}
+
+// readNDJSONLine читает строку целиком без перевода строки. Строка длиннее
+// limit дочитывается до конца и отбрасывается (tooLong), чтение продолжается
+// со следующей строки
+func readNDJSONLine(r *bufio.Reader, limit int) (line []byte, tooLong bool, err error) {
+	for {
+		chunk, isPrefix, err := r.ReadLine()
+		if err != nil {
+			return nil, false, err
+		}
+		if !tooLong {
+			if len(line)+len(chunk) > limit {
+				tooLong, line = true, nil
+			} else {
+				line = append(line, chunk...)
+			}
+		}
+		if !isPrefix {
+			return line, tooLong, nil
+		}
+	}
+}
+
+// projectNDJSON оставляет в записи только выбранные поля; отсутствующие поля пропускаются
+func projectNDJSON(value interface{}, fields []ndjsonField) interface{} {
+	out := newOrderedObject()
+	for _, f := range fields {
+		if v, err := resolvePointer(value, f.pointer); err == nil {
+			out.set(f.name, v)
+		}
+	}
+	return out
+}
+
+// AppendNDJSONRecord проверяет запись (корректный JSON в пределах лимитов и,
+// если для файла включена схема, соответствие схеме) и дописывает её одной
+// строкой в конец файла JSON Lines, создавая файл при необходимости. Запись
+// хранится в компактном виде, поэтому переводы строк внутри неё не могут
+// разбить файл. Уже записанные строки не перечитываются: размер журнала
+// ограничен MaxNDJSONFileSize, а не MaxFileSize
+func AppendNDJSONRecord(path, record string) error {
+	value, err := parseOrderedJSON(record)
+	if err != nil {
+		return err
+	}
+	line := compactJSON(value)
+	if len(line) > MaxNDJSONLineLength {
+		return fmt.Errorf("запись длиннее %d байт", MaxNDJSONLineLength)
+	}
+
+	safePath, err := ResolvePath(path)
+	if err != nil {
+		return err
+	}
+	if err := checkRecordSchema(safePath, line); err != nil {
+		return err
+	}
+
+	fileMutex.Lock()
+	err = appendNDJSONLine(safePath, line)
+	fileMutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	indexFile(safePath)
+	return nil
+}
+
+// appendNDJSONLine дописывает строку в журнал; вызывается под блокировкой fileMutex
+func appendNDJSONLine(safePath, line string) error {
+	file, err := os.OpenFile(safePath, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s — директория", relPath(safePath))
+	}
+	// Если последняя строка не завершена переводом строки, новая запись не
+	// должна склеиться с ней
+	if info.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err := file.ReadAt(last, info.Size()-1); err != nil {
+			return err
+		}
+		if last[0] != '\n' {
+			line = "\n" + line
+		}
+	}
+	if info.Size()+int64(len(line))+1 > MaxNDJSONFileSize {
+		return fmt.Errorf("итоговый размер журнала превысит максимально допустимый (%d MB)", MaxNDJSONFileSize>>20)
+	}
+	_, err = file.WriteString(line + "\n")
+	return err
+}
+
+// validateNDJSONRecords проверяет каждую запись JSON Lines по схеме; нарушения
+// помечаются номером строки
+func validateNDJSONRecords(content string, schema interface{}) ([]SchemaViolation, error) {
+	var violations []SchemaViolation
+	for i, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		data, err := ParseJSON(line)
+		if err != nil {
+			return nil, ndjsonLineError(i+1, err)
+		}
+		found, err := ValidateSchema(data, schema)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range found {
+			v.Message = fmt.Sprintf("строка %d: %s", i+1, v.Message)
+			violations = append(violations, v)
+		}
+	}
+	return violations, nil
+}
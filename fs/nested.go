@@ -0,0 +1,281 @@
+package fs
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// nestedSeparator разделяет уровни вложенности в пути находки: "outer.zip!/inner.zip!/bomb.bin"
+const nestedSeparator = "!/"
+
+// NestedFinding — опасная запись, найденная на любом уровне вложенности
+type NestedFinding struct {
+	Path    string // полный путь через все уровни архивов
+	Problem string // описание проблемы
+}
+
+// NestedScanReport — результат рекурсивной проверки архива
+type NestedScanReport struct {
+	Archives   int             // проверено архивов (включая исходный)
+	Entries    int             // записей на всех уровнях
+	MaxNesting int             // достигнутая глубина вложенности архивов
+	TotalSize  int64           // итоговый размер после распаковки всех уровней (без самих вложенных архивов)
+	BytesRead  int64           // всего распаковано байт при проверке (включая вложенные архивы)
+	Findings   []NestedFinding // опасные записи
+	Truncated  bool            // проверка остановлена из-за исчерпания бюджета
+}
+
+// Safe сообщает, что на всех уровнях не найдено опасных записей
+func (r *NestedScanReport) Safe() bool {
+	return len(r.Findings) == 0 && !r.Truncated
+}
+
+var (
+	// errScanBudget — исчерпан общий бюджет проверки (байты или записи)
+	errScanBudget = errors.New("бюджет проверки исчерпан")
+	// errEntryUnreadable — запись не прочитана до конца (уже отмечена находкой)
+	errEntryUnreadable = errors.New("запись не прочитана")
+)
+
+// nestedScanner рекурсивно просматривает архивы в памяти с общими лимитами
+type nestedScanner struct {
+	limits   ArchiveLimits
+	password string
+	report   *NestedScanReport
+}
+
+// ScanNested рекурсивно проверяет архив и вложенные в него архивы, не записывая
+// ничего на диск. Вложенные архивы читаются в память; байты, записи и глубина
+// вложенности ограничены общими лимитами (ArchiveLimits). password используется
+// для зашифрованных записей ZIP (пусто — такие записи отмечаются как непроверенные)
+func ScanNested(path, password string) (*NestedScanReport, error) {
+	safePath, err := ResolvePath(path)
+	if err != nil {
+		return nil, err
+	}
+	format, err := DetectArchiveFormat(safePath)
+	if err != nil {
+		return nil, err
+	}
+
+	fileMutex.RLock()
+	defer fileMutex.RUnlock()
+
+	file, err := os.Open(safePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &nestedScanner{limits: archiveLimits, password: password, report: &NestedScanReport{}}
+	if err := s.scan(relPath(safePath), format, file, info.Size(), 0); err != nil {
+		if !errors.Is(err, errScanBudget) {
+			return nil, err
+		}
+		s.report.Truncated = true
+	}
+	return s.report, nil
+}
+
+// scan проверяет один архив; ошибки чтения вложенных архивов становятся находками
+func (s *nestedScanner) scan(label, format string, ra io.ReaderAt, size int64, depth int) error {
+	s.report.Archives++
+	if depth > s.report.MaxNesting {
+		s.report.MaxNesting = depth
+	}
+
+	switch format {
+	case FormatZip:
+		return s.scanZip(label, ra, size, depth)
+	case FormatTar, FormatTarGz:
+		return s.scanTar(label, ra, size, depth)
+	default:
+		return s.scanGzip(label, ra, size, depth)
+	}
+}
+
+func (s *nestedScanner) scanZip(label string, ra io.ReaderAt, size int64, depth int) error {
+	r, err := zip.NewReader(ra, size)
+	if err != nil {
+		return s.fail(label, depth, fmt.Sprintf("архив повреждён: %v", err))
+	}
+	for _, f := range r.File {
+		if err := s.countEntry(label, f.Name); err != nil {
+			return err
+		}
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		rc, err := openZipEntry(f, s.password)
+		if err != nil {
+			s.addFinding(label, f.Name, "содержимое не проверено: "+err.Error())
+			continue
+		}
+		err = s.content(label, f.Name, &ratioReader{r: rc, compressedSize: int64(f.CompressedSize64)}, depth)
+		rc.Close()
+		// Записи ZIP независимы: после ошибки одной проверяем остальные
+		if err != nil && !errors.Is(err, errEntryUnreadable) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *nestedScanner) scanTar(label string, ra io.ReaderAt, size int64, depth int) error {
+	br := bufio.NewReader(io.NewSectionReader(ra, 0, size))
+	var stream io.Reader = br
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return s.fail(label, depth, fmt.Sprintf("архив повреждён: %v", err))
+		}
+		defer gz.Close()
+		stream = &ratioReader{r: gz, compressedSize: size}
+	}
+	tr := tar.NewReader(stream)
+
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			// Ошибка потока (например, gzip-бомба) — дальше поток не читается
+			s.report.Findings = append(s.report.Findings, NestedFinding{Path: label, Problem: err.Error()})
+			if errors.Is(err, errTooLarge) {
+				return errScanBudget
+			}
+			return nil
+		}
+		if header.Typeflag == tar.TypeXGlobalHeader || filepath.Clean(header.Name) == "." {
+			continue
+		}
+		if err := s.countEntry(label, header.Name); err != nil {
+			return err
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+		case tar.TypeReg, tar.TypeRegA:
+			if err := s.content(label, header.Name, tr, depth); err != nil {
+				// После ошибки чтения записи поток tar дальше не читается
+				if errors.Is(err, errEntryUnreadable) {
+					return nil
+				}
+				return err
+			}
+		case tar.TypeSymlink:
+			if err := checkSymlinkTarget(header.Name, header.Linkname); err != nil {
+				s.addFinding(label, header.Name, "символическая ссылка выходит за пределы папки назначения")
+			}
+		case tar.TypeLink:
+			if _, err := safeJoin(inspectDest, header.Linkname); err != nil {
+				s.addFinding(label, header.Name, "жёсткая ссылка выходит за пределы папки назначения")
+			}
+		default:
+			s.addFinding(label, header.Name, fmt.Sprintf("недопустимый тип записи %q", header.Typeflag))
+		}
+	}
+}
+
+func (s *nestedScanner) scanGzip(label string, ra io.ReaderAt, size int64, depth int) error {
+	gz, err := gzip.NewReader(io.NewSectionReader(ra, 0, size))
+	if err != nil {
+		return s.fail(label, depth, fmt.Sprintf("архив повреждён: %v", err))
+	}
+	defer gz.Close()
+
+	// Имя содержимого — имя архива без .gz (внутреннему имени из заголовка не доверяем)
+	base := label
+	if i := strings.LastIndex(base, nestedSeparator); i >= 0 {
+		base = base[i+len(nestedSeparator):]
+	}
+	name := strings.TrimSuffix(filepath.Base(base), filepath.Ext(base))
+	if err := s.countEntry(label, name); err != nil {
+		return err
+	}
+	if err := s.content(label, name, &ratioReader{r: gz, compressedSize: size}, depth); !errors.Is(err, errEntryUnreadable) {
+		return err
+	}
+	return nil
+}
+
+// countEntry учитывает запись в общем бюджете и проверяет её имя
+func (s *nestedScanner) countEntry(label, name string) error {
+	s.report.Entries++
+	if s.report.Entries > s.limits.MaxEntries {
+		s.addFinding(label, name, fmt.Sprintf("превышен лимит записей на всех уровнях (%d)", s.limits.MaxEntries))
+		return errScanBudget
+	}
+	if _, err := safeJoin(inspectDest, name); err != nil {
+		s.addFinding(label, name, "путь выходит за пределы папки назначения (Zip Slip)")
+	}
+	if depth := entryDepth(name); depth > s.limits.MaxDepth {
+		s.addFinding(label, name, fmt.Sprintf("глубина вложенности пути %d превышает %d", depth, s.limits.MaxDepth))
+	}
+	return nil
+}
+
+// content читает содержимое записи: вложенный архив — в память для рекурсивной
+// проверки, остальное — в никуда, считая фактические байты
+func (s *nestedScanner) content(label, name string, r io.Reader, depth int) error {
+	remaining := s.limits.MaxSize - s.report.BytesRead
+	format, formatErr := DetectArchiveFormat(name)
+
+	if formatErr != nil || depth+1 > s.limits.MaxNesting {
+		n, err := copyLimited(io.Discard, r, remaining)
+		s.report.BytesRead += n
+		s.report.TotalSize += n
+		if formatErr == nil {
+			s.addFinding(label, name, fmt.Sprintf("вложенность архивов превышает лимит (%d), содержимое не проверено", s.limits.MaxNesting))
+		}
+		return s.readError(label, name, err)
+	}
+
+	var buf bytes.Buffer
+	n, err := copyLimited(&buf, r, remaining)
+	s.report.BytesRead += n
+	if err != nil {
+		return s.readError(label, name, err)
+	}
+	nested := label + nestedSeparator + name
+	return s.scan(nested, format, bytes.NewReader(buf.Bytes()), int64(buf.Len()), depth+1)
+}
+
+// readError превращает ошибку чтения в находку; исчерпание бюджета останавливает проверку
+func (s *nestedScanner) readError(label, name string, err error) error {
+	if err == nil {
+		return nil
+	}
+	s.addFinding(label, name, err.Error())
+	if errors.Is(err, errTooLarge) {
+		return errScanBudget
+	}
+	return errEntryUnreadable
+}
+
+// fail записывает ошибку открытия архива; для исходного архива она возвращается вызывающему
+func (s *nestedScanner) fail(label string, depth int, problem string) error {
+	if depth == 0 {
+		return errors.New(problem)
+	}
+	s.report.Findings = append(s.report.Findings, NestedFinding{Path: label, Problem: problem})
+	return nil
+}
+
+func (s *nestedScanner) addFinding(label, name, problem string) {
+	s.report.Findings = append(s.report.Findings, NestedFinding{Path: label + nestedSeparator + name, Problem: problem})
+}
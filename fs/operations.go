@@ -4,6 +4,7 @@ import (
 	"errors"
 	"io"
 	"os"
+	"path/filepath"
 	"sync"
 )
 
@@ -78,8 +79,14 @@ func ReadFile(path string) (string, error) {
 	return string(content), nil
 }
 
-// WriteFile записывает содержимое в файл
+// WriteFile атомарно записывает содержимое в файл: при сбое остаётся прежняя версия
 func WriteFile(path string, content string) error {
+	return writeFile(path, content, nil)
+}
+
+// writeFile записывает файл; если version задана, запись выполняется только
+// при совпадении текущей версии файла (проверка и запись под одной блокировкой)
+func writeFile(path, content string, version *string) error {
 	// Проверка максимального размера файла (защита от переполнения)
 	if len(content) > MaxFileSize {
 		return errors.New("размер файла превышает максимально допустимый (10 MB)")
@@ -89,11 +96,128 @@ func WriteFile(path string, content string) error {
 	if err != nil {
 		return err
 	}
+	// Файлы с обязательной схемой (см. SchemaRegistryFile) записываются только корректными
+	if err := checkSchemaOnWrite(safePath, content); err != nil {
+		return err
+	}
 
 	fileMutex.Lock()
-	defer fileMutex.Unlock()
+	if version != nil {
+		if err := checkVersion(safePath, *version); err != nil {
+			fileMutex.Unlock()
+			return err
+		}
+	}
+	err = atomicWriteFile(safePath, []byte(content))
+	fileMutex.Unlock()
+	if err != nil {
+		return err
+	}
 
-	return os.WriteFile(safePath, []byte(content), 0644)
+	indexContent(safePath, content)
+	return nil
+}
+
+// atomicWriteFile пишет данные во временный файл в той же папке и подменяет им
+// целевой файл. Права существующего файла сохраняются, новый получает 0644
+func atomicWriteFile(safePath string, data []byte) error {
+	tmpPath, err := stageFile(safePath, data)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, safePath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+// stageFile записывает данные во временный файл рядом с safePath и возвращает
+// его путь; подмена целевого файла — os.Rename, отказ — os.Remove
+func stageFile(safePath string, data []byte) (string, error) {
+	perm := os.FileMode(0644)
+	if info, err := os.Stat(safePath); err == nil {
+		if info.IsDir() {
+			return "", errors.New("по указанному пути находится папка")
+		}
+		perm = info.Mode().Perm()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(safePath), ".write-*")
+	if err != nil {
+		return "", err
+	}
+	tmpPath := tmp.Name()
+	staged := false
+	defer func() {
+		if !staged {
+			tmp.Close()
+			os.Remove(tmpPath)
+		}
+	}()
+
+	if _, err := tmp.Write(data); err != nil {
+		return "", err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		return "", err
+	}
+	if err := tmp.Sync(); err != nil {
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	staged = true
+	return tmpPath, nil
+}
+
+// replaceViaTemp создаёт файл safePath через временный файл в той же папке:
+// write заполняет временный файл, и только после успешной записи он подменяет
+// safePath. При ошибке существующий файл остаётся прежним. Права существующего
+// файла сохраняются, новый получает 0644
+func replaceViaTemp(safePath string, write func(tmp *os.File) error) error {
+	perm := os.FileMode(0644)
+	if info, err := os.Stat(safePath); err == nil {
+		if info.IsDir() {
+			return errors.New("по указанному пути находится папка")
+		}
+		perm = info.Mode().Perm()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(safePath), ".write-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	committed := false
+	defer func() {
+		if !committed {
+			tmp.Close()
+			os.Remove(tmpPath)
+		}
+	}()
+
+	if err := write(tmp); err != nil {
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	fileMutex.Lock()
+	err = os.Rename(tmpPath, safePath)
+	fileMutex.Unlock()
+	if err != nil {
+		return err
+	}
+	committed = true
+	return nil
 }
 
 // DeleteFile удаляет файл
@@ -104,9 +228,14 @@ func DeleteFile(path string) error {
 	}
 
 	fileMutex.Lock()
-	defer fileMutex.Unlock()
+	err = os.Remove(safePath)
+	fileMutex.Unlock()
+	if err != nil {
+		return err
+	}
 
-	return os.Remove(safePath)
+	removeFromIndex(safePath)
+	return nil
 }
 
 // CopyFile копирует файл из src в dst
@@ -128,6 +257,9 @@ func CopyFile(src, dst string) error {
 	if srcInfo.Size() > int64(MaxFileSize) {
 		return errors.New("размер исходного файла превышает максимально допустимый (10 MB)")
 	}
+	if err := checkSchemaFromFile(safeDst, safeSrc, ""); err != nil {
+		return err
+	}
 
 	fileMutex.RLock()
 	srcFile, err := os.Open(safeSrc)
@@ -143,10 +275,18 @@ func CopyFile(src, dst string) error {
 	if err != nil {
 		return err
 	}
-	defer dstFile.Close()
 
 	_, err = io.Copy(dstFile, srcFile)
-	return err
+	// Закрываем до индексации: indexFile перечитывает файл с диска
+	if closeErr := dstFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	indexFile(safeDst)
+	return nil
 }
 
 // MoveFile перемещает (переименовывает) файл из src в dst
@@ -160,10 +300,20 @@ func MoveFile(src, dst string) error {
 		return err
 	}
 
+	if err := checkSchemaFromFile(safeDst, safeSrc, ""); err != nil {
+		return err
+	}
+
 	fileMutex.Lock()
-	defer fileMutex.Unlock()
+	err = os.Rename(safeSrc, safeDst)
+	fileMutex.Unlock()
+	if err != nil {
+		return err
+	}
 
-	return os.Rename(safeSrc, safeDst)
+	removeFromIndex(safeSrc)
+	indexFile(safeDst)
+	return nil
 }
 
 // AppendFile добавляет содержимое в конец существующего файла
@@ -184,16 +334,23 @@ func AppendFile(path string, content string) error {
 	if info.Size()+int64(len(content)) > int64(MaxFileSize) {
 		return errors.New("итоговый размер файла превысит максимально допустимый (10 MB)")
 	}
+	if err := checkSchemaFromFile(safePath, safePath, content); err != nil {
+		return err
+	}
 
 	fileMutex.Lock()
-	defer fileMutex.Unlock()
-
 	file, err := os.OpenFile(safePath, os.O_APPEND|os.O_WRONLY, 0644)
 	if err != nil {
+		fileMutex.Unlock()
 		return err
 	}
-	defer file.Close()
-
 	_, err = file.WriteString(content)
-	return err
+	file.Close()
+	fileMutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	indexFile(safePath)
+	return nil
 }
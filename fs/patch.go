@@ -0,0 +1,496 @@
+package fs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Применение unified diff к файлам sandbox. Блоки ищутся сначала на указанной
+// строке, затем со смещением; если контекст не совпадает, допускается fuzz —
+// отбрасывание крайних строк контекста. Патч применяется целиком или не
+// применяется вовсе: файлы записываются только когда подошли все блоки
+
+const (
+	DefaultPatchFuzz = 2 // Сколько крайних строк контекста можно не совпасть по умолчанию
+	devNull          = "/dev/null"
+)
+
+// HunkResult — где применён блок патча
+type HunkResult struct {
+	File   string
+	Hunk   int // номер блока в файле (с 1)
+	Line   int // строка исходного файла, с которой применён блок
+	Offset int // смещение относительно строки из заголовка блока
+	Fuzz   int // сколько строк контекста отброшено с каждого края
+}
+
+func (h HunkResult) String() string {
+	s := fmt.Sprintf("%s: блок %d применён на строке %d", h.File, h.Hunk, h.Line)
+	if h.Offset != 0 {
+		s += fmt.Sprintf(" (смещение %+d)", h.Offset)
+	}
+	if h.Fuzz > 0 {
+		s += fmt.Sprintf(" (fuzz %d)", h.Fuzz)
+	}
+	return s
+}
+
+// PatchResult — итог применения патча
+type PatchResult struct {
+	Created, Modified, Deleted []string
+	Hunks                      []HunkResult
+}
+
+type patchLine struct {
+	op   byte
+	text string // с переводом строки, если он есть в файле
+}
+
+type patchHunk struct {
+	oldStart, oldCount int
+	newStart, newCount int
+	lines              []patchLine
+}
+
+type filePatch struct {
+	oldPath, newPath string
+	hunks            []patchHunk
+}
+
+var hunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// parsePatch разбирает unified diff; строки вне блоков (diff --git, index...) пропускаются
+func parsePatch(text string) ([]*filePatch, error) {
+	lines := splitLines(text)
+	var files []*filePatch
+	var current *filePatch
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], "\r\n")
+		switch {
+		case strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ "):
+			current = &filePatch{
+				oldPath: patchHeaderPath(line[4:]),
+				newPath: patchHeaderPath(strings.TrimRight(lines[i+1], "\r\n")[4:]),
+			}
+			files = append(files, current)
+			i++
+		case strings.HasPrefix(line, "@@"):
+			if current == nil {
+				return nil, &ParseError{Line: i + 1, Column: 1, Err: errors.New("блок до заголовка файла (---/+++)")}
+			}
+			hunk, next, err := parseHunk(lines, i)
+			if err != nil {
+				return nil, err
+			}
+			current.hunks = append(current.hunks, hunk)
+			i = next - 1
+		}
+	}
+	if len(files) == 0 {
+		return nil, errors.New("в патче нет изменений файлов")
+	}
+	for _, f := range files {
+		if len(f.hunks) == 0 {
+			return nil, fmt.Errorf("%s: в патче нет блоков изменений", f.newPath)
+		}
+	}
+	stripGitPrefixes(files)
+	return files, nil
+}
+
+// parseHunk разбирает блок с заголовком в строке start; возвращает номер строки после блока
+func parseHunk(lines []string, start int) (patchHunk, int, error) {
+	m := hunkHeader.FindStringSubmatch(lines[start])
+	if m == nil {
+		return patchHunk{}, 0, &ParseError{Line: start + 1, Column: 1, Err: errors.New("некорректный заголовок блока")}
+	}
+	number := func(s string) int {
+		if s == "" {
+			return 1
+		}
+		n, _ := strconv.Atoi(s)
+		return n
+	}
+	h := patchHunk{oldStart: number(m[1]), oldCount: number(m[2]), newStart: number(m[3]), newCount: number(m[4])}
+
+	oldLeft, newLeft := h.oldCount, h.newCount
+	i := start + 1
+	for ; i < len(lines) && (oldLeft > 0 || newLeft > 0); i++ {
+		line := lines[i]
+		op := byte(editEqual)
+		if line != "\n" && line != "\r\n" { // пустая строка контекста, у которой редактор срезал пробел
+			op, line = line[0], line[1:]
+		}
+		switch op {
+		case editEqual:
+			oldLeft--
+			newLeft--
+		case editDelete:
+			oldLeft--
+		case editInsert:
+			newLeft--
+		case '\\':
+			continue
+		default:
+			return h, 0, &ParseError{Line: i + 1, Column: 1, Err: fmt.Errorf("неожиданная строка в блоке: %q", strings.TrimRight(lines[i], "\r\n"))}
+		}
+		if oldLeft < 0 || newLeft < 0 {
+			return h, 0, &ParseError{Line: i + 1, Column: 1, Err: errors.New("строк в блоке больше, чем указано в заголовке")}
+		}
+		h.lines = append(h.lines, patchLine{op: op, text: line})
+		// "\ No newline at end of file" относится к предыдущей строке
+		if i+1 < len(lines) && strings.HasPrefix(lines[i+1], "\\") {
+			h.lines[len(h.lines)-1].text = strings.TrimSuffix(line, "\n")
+			i++
+		}
+	}
+	if oldLeft > 0 || newLeft > 0 {
+		return h, 0, &ParseError{Line: i, Column: 1, Err: errors.New("блок обрывается раньше, чем указано в заголовке")}
+	}
+	return h, i, nil
+}
+
+// patchHeaderPath извлекает путь из строки ---/+++ (после пути может идти дата через табуляцию)
+func patchHeaderPath(header string) string {
+	if i := strings.IndexByte(header, '\t'); i >= 0 {
+		header = header[:i]
+	}
+	header = strings.TrimSpace(header)
+	if unquoted, err := strconv.Unquote(header); err == nil && strings.HasPrefix(header, `"`) {
+		header = unquoted
+	}
+	return header
+}
+
+// stripGitPrefixes убирает префиксы a/ и b/, если они есть во всех заголовках (формат git diff)
+func stripGitPrefixes(files []*filePatch) {
+	for _, f := range files {
+		if (f.oldPath != devNull && !strings.HasPrefix(f.oldPath, "a/")) ||
+			(f.newPath != devNull && !strings.HasPrefix(f.newPath, "b/")) {
+			return
+		}
+	}
+	for _, f := range files {
+		if f.oldPath != devNull {
+			f.oldPath = f.oldPath[2:]
+		}
+		if f.newPath != devNull {
+			f.newPath = f.newPath[2:]
+		}
+	}
+}
+
+// patchTarget проверяет путь из патча: пути указываются относительно корня
+// sandbox, абсолютные пути и выход через ".." отклоняются до ResolvePath
+func patchTarget(name string) (string, error) {
+	clean := path.Clean(strings.ReplaceAll(name, "\\", "/"))
+	if path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") || strings.Contains(name, "\x00") {
+		return "", fmt.Errorf("доступ запрещён: патч затрагивает путь вне sandbox: %q", name)
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			return "", fmt.Errorf("доступ запрещён: патч затрагивает путь вне sandbox: %q", name)
+		}
+	}
+	return ResolvePath(clean)
+}
+
+// patchedFile — новое содержимое файла до записи
+type patchedFile struct {
+	safePath string
+	lines    []string
+	exists   bool   // файл существовал до патча
+	original string // содержимое до патча — для отката
+	version  string // версия файла при чтении: запись не затрёт чужие изменения
+	deleted  bool
+}
+
+// ApplyPatch применяет unified diff. target — файл, к которому применяется
+// патч с одним файлом (пусто — пути берутся из заголовков патча относительно
+// корня sandbox). maxFuzz — сколько крайних строк контекста допускается не
+// совпасть. При любой ошибке ни один файл не изменяется
+func ApplyPatch(patch, target string, maxFuzz int) (*PatchResult, error) {
+	files, err := parsePatch(patch)
+	if err != nil {
+		return nil, err
+	}
+	if target != "" && len(files) != 1 {
+		return nil, fmt.Errorf("патч изменяет %d файлов, целевой файл можно указать только для одного", len(files))
+	}
+
+	var order []*patchedFile
+	byPath := make(map[string]*patchedFile)
+	result := &PatchResult{}
+	for _, f := range files {
+		name := f.newPath
+		if name == devNull {
+			name = f.oldPath
+		}
+		if target != "" {
+			name = target
+		}
+		if name == devNull {
+			return nil, errors.New("в патче не указан файл")
+		}
+		safePath, err := patchTarget(name)
+		if err != nil {
+			return nil, err
+		}
+
+		pf, ok := byPath[safePath]
+		if !ok {
+			if pf, err = loadPatchedFile(safePath); err != nil {
+				return nil, err
+			}
+			byPath[safePath] = pf
+			order = append(order, pf)
+		}
+		switch {
+		case f.oldPath == devNull && target == "" && (pf.exists || ok):
+			return nil, fmt.Errorf("%s: файл уже существует", relPath(safePath))
+		case f.oldPath != devNull && !pf.exists && !ok:
+			return nil, fmt.Errorf("%s: файл не найден", relPath(safePath))
+		}
+
+		lines, hunks, err := applyHunks(pf.lines, f.hunks, maxFuzz)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", relPath(safePath), err)
+		}
+		for i := range hunks {
+			hunks[i].File = relPath(safePath)
+		}
+		result.Hunks = append(result.Hunks, hunks...)
+		pf.lines = lines
+		pf.deleted = f.newPath == devNull && target == ""
+		if pf.deleted && len(lines) > 0 {
+			return nil, fmt.Errorf("%s: после удаления всех строк файл не пуст — патч не соответствует файлу", relPath(safePath))
+		}
+	}
+
+	// Проверяем итоговое содержимое всех файлов до первой записи
+	for _, pf := range order {
+		if pf.deleted {
+			continue
+		}
+		content := strings.Join(pf.lines, "")
+		if len(content) > MaxFileSize {
+			return nil, fmt.Errorf("%s: размер файла превысит максимально допустимый (10 MB)", relPath(pf.safePath))
+		}
+		if err := checkSchemaOnWrite(pf.safePath, content); err != nil {
+			return nil, fmt.Errorf("%s: %w", relPath(pf.safePath), err)
+		}
+	}
+	if err := commitPatch(order); err != nil {
+		return nil, err
+	}
+	for _, pf := range order {
+		name := relPath(pf.safePath)
+		switch {
+		case pf.deleted:
+			if pf.exists {
+				removeFromIndex(pf.safePath)
+			}
+			result.Deleted = append(result.Deleted, name)
+		default:
+			indexContent(pf.safePath, strings.Join(pf.lines, ""))
+			if pf.exists {
+				result.Modified = append(result.Modified, name)
+			} else {
+				result.Created = append(result.Created, name)
+			}
+		}
+	}
+	return result, nil
+}
+
+// commitPatch записывает результат патча под одной блокировкой: сначала
+// проверяются версии всех файлов (включая удаляемые) и готовятся временные
+// файлы, затем они подменяют целевые. Если подмена не удалась, уже изменённые
+// файлы возвращаются к исходному содержимому
+func commitPatch(order []*patchedFile) error {
+	fileMutex.Lock()
+	defer fileMutex.Unlock()
+
+	for _, pf := range order {
+		if err := checkVersion(pf.safePath, pf.version); err != nil {
+			return err
+		}
+	}
+
+	staged := make(map[*patchedFile]string)
+	defer func() {
+		for _, tmpPath := range staged {
+			os.Remove(tmpPath)
+		}
+	}()
+	for _, pf := range order {
+		if pf.deleted {
+			continue
+		}
+		tmpPath, err := stageFile(pf.safePath, []byte(strings.Join(pf.lines, "")))
+		if err != nil {
+			return fmt.Errorf("%s: %w", relPath(pf.safePath), err)
+		}
+		staged[pf] = tmpPath
+	}
+
+	var done []*patchedFile
+	for _, pf := range order {
+		var err error
+		switch {
+		case !pf.deleted:
+			if err = os.Rename(staged[pf], pf.safePath); err == nil {
+				delete(staged, pf)
+			}
+		case pf.exists:
+			err = os.Remove(pf.safePath)
+		}
+		if err != nil {
+			err = fmt.Errorf("%s: %w", relPath(pf.safePath), err)
+			if rbErr := rollbackPatch(done); rbErr != nil {
+				return fmt.Errorf("%w; откат не завершён: %v", err, rbErr)
+			}
+			return err
+		}
+		done = append(done, pf)
+	}
+	return nil
+}
+
+// rollbackPatch возвращает файлы к содержимому до патча; вызывается под блокировкой fileMutex
+func rollbackPatch(done []*patchedFile) error {
+	var errs []error
+	for i := len(done) - 1; i >= 0; i-- {
+		pf := done[i]
+		var err error
+		switch {
+		case pf.exists:
+			err = atomicWriteFile(pf.safePath, []byte(pf.original))
+		case !pf.deleted:
+			err = os.Remove(pf.safePath)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", relPath(pf.safePath), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func loadPatchedFile(safePath string) (*patchedFile, error) {
+	pf := &patchedFile{safePath: safePath}
+	info, err := os.Stat(safePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return pf, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("%s — директория", relPath(safePath))
+	}
+	content, err := readStructuredFile(safePath)
+	if err != nil {
+		return nil, err
+	}
+	if isBinaryText(content) {
+		return nil, errors.New(relPath(safePath) + ": патч к двоичному файлу не применяется")
+	}
+	pf.exists = true
+	pf.original = content
+	pf.version = ContentVersion(content)
+	pf.lines = splitLines(content)
+	return pf, nil
+}
+
+// applyHunks применяет блоки по порядку. Блок ищется ближе всего к строке
+// из заголовка (с учётом смещения предыдущих блоков) и не раньше конца
+// предыдущего блока
+func applyHunks(lines []string, hunks []patchHunk, maxFuzz int) ([]string, []HunkResult, error) {
+	var out []string
+	var results []HunkResult
+	pos, offset := 0, 0
+	for n, h := range hunks {
+		var oldLines, newLines []string
+		for _, l := range h.lines {
+			if l.op != editInsert {
+				oldLines = append(oldLines, l.text)
+			}
+			if l.op != editDelete {
+				newLines = append(newLines, l.text)
+			}
+		}
+		leading, trailing := contextEdges(h.lines)
+
+		applied := false
+		for fuzz := 0; fuzz <= maxFuzz && !applied; fuzz++ {
+			lead, trail := min(fuzz, leading), min(fuzz, trailing)
+			if fuzz > 0 && lead == 0 && trail == 0 {
+				break // отбрасывать больше нечего
+			}
+			pattern := oldLines[lead : len(oldLines)-trail]
+			stated := h.oldStart - 1 + lead
+			if h.oldCount == 0 {
+				stated = h.oldStart // пустой диапазон указывает на строку перед вставкой
+			}
+			at, ok := findLines(lines, pattern, stated+offset, pos)
+			if !ok {
+				continue
+			}
+			out = append(out, lines[pos:at]...)
+			out = append(out, newLines[lead:len(newLines)-trail]...)
+			pos = at + len(pattern)
+			offset = at - stated
+			results = append(results, HunkResult{Hunk: n + 1, Line: at + 1 - lead, Offset: offset, Fuzz: fuzz})
+			applied = true
+		}
+		if !applied {
+			return nil, nil, fmt.Errorf("блок %d (строка %d) не совпадает с содержимым файла", n+1, h.oldStart)
+		}
+	}
+	return append(out, lines[pos:]...), results, nil
+}
+
+// contextEdges считает строки контекста в начале и в конце блока
+func contextEdges(lines []patchLine) (leading, trailing int) {
+	for leading < len(lines) && lines[leading].op == editEqual {
+		leading++
+	}
+	if leading == len(lines) {
+		return leading, 0
+	}
+	for trailing < len(lines) && lines[len(lines)-1-trailing].op == editEqual {
+		trailing++
+	}
+	return leading, trailing
+}
+
+// findLines ищет pattern в lines начиная с позиции, ближайшей к want, но не раньше from
+func findLines(lines, pattern []string, want, from int) (int, bool) {
+	last := len(lines) - len(pattern)
+	if last < from {
+		return 0, false
+	}
+	want = max(min(want, last), from)
+	for delta := 0; want-delta >= from || want+delta <= last; delta++ {
+		for _, at := range []int{want - delta, want + delta} {
+			if at >= from && at <= last && linesMatch(lines[at:at+len(pattern)], pattern) {
+				return at, true
+			}
+		}
+	}
+	return 0, false
+}
+
+func linesMatch(a, b []string) bool {
+	for i := range b {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -3,6 +3,7 @@ package fs
 import (
 	"errors"
 	"net/url"
+	"os"
 	"path/filepath"
 	"secure-fm/config"
 	"strings"
@@ -23,6 +24,21 @@ func InitFS(cfg *config.Config) {
 	if err == nil {
 		BaseDir = abs
 	}
+
+	SetArchiveLimits(ArchiveLimits{
+		MaxSize:    cfg.ArchiveMaxSize,
+		MaxRatio:   cfg.ArchiveMaxRatio,
+		MaxEntries: cfg.ArchiveMaxEntries,
+		MaxDepth:   cfg.ArchiveMaxDepth,
+		MaxNesting: cfg.ArchiveMaxNesting,
+	})
+	SetJSONLimits(JSONLimits{
+		MaxDepth:            cfg.JSONMaxDepth,
+		MaxTokens:           cfg.JSONMaxTokens,
+		MaxStringLength:     cfg.JSONMaxStringLength,
+		MaxNumberLength:     cfg.JSONMaxNumberLength,
+		RejectDuplicateKeys: cfg.JSONRejectDuplicateKeys,
+	})
 }
 
 // ResolvePath проверяет и преобразует пользовательский путь в безопасный
@@ -61,3 +77,36 @@ func ResolvePath(userPath string) (string, error) {
 
 	return cleanedFullPath, nil
 }
+
+// checkNoSymlinks проверяет, что ни один компонент пути внутри sandbox (от
+// BaseDir до safePath включительно) не является символической ссылкой.
+// ResolvePath проверяет только текст пути, а ссылка в середине пути ведёт
+// за пределы sandbox
+func checkNoSymlinks(safePath string) error {
+	rel, err := filepath.Rel(BaseDir, safePath)
+	if err != nil || rel == "." {
+		return err
+	}
+	current := BaseDir
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		current = filepath.Join(current, part)
+		info, err := os.Lstat(current)
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return errors.New("доступ запрещён: путь проходит через символическую ссылку")
+		}
+	}
+	return nil
+}
+
+// relPath преобразует безопасный абсолютный путь обратно в путь относительно sandbox
+// Используется для вывода пользователю (без раскрытия реального расположения sandbox)
+func relPath(safePath string) string {
+	rel, err := filepath.Rel(BaseDir, safePath)
+	if err != nil {
+		return filepath.Base(safePath)
+	}
+	return filepath.ToSlash(rel)
+}
@@ -0,0 +1,657 @@
+package fs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// SchemaRegistryFile — файл в корне sandbox, связывающий JSON файлы со схемами:
+//
+//	{"schemas": [{"files": "config/*.json", "schema": "schemas/config.json", "enforce": true}]}
+//
+// files — glob-шаблон пути относительно sandbox (как в исключениях архивов),
+// schema — путь к JSON Schema, enforce — проверять документ при каждой записи
+const SchemaRegistryFile = ".schemas.json"
+
+// maxSchemaRefDepth — предел вложенных переходов по $ref (защита от циклических ссылок)
+const maxSchemaRefDepth = 64
+
+// SchemaMapping — связь glob-шаблона файлов со схемой
+type SchemaMapping struct {
+	Files   string `json:"files"`
+	Schema  string `json:"schema"`
+	Enforce bool   `json:"enforce"`
+}
+
+type schemaRegistry struct {
+	Schemas []SchemaMapping `json:"schemas"`
+}
+
+// SchemaViolation — нарушение схемы в конкретном месте документа
+type SchemaViolation struct {
+	Pointer string // JSON Pointer на значение в документе ("" — весь документ)
+	Message string
+}
+
+func (v SchemaViolation) String() string {
+	return "#" + v.Pointer + ": " + v.Message
+}
+
+// SchemaError — документ не соответствует схеме
+type SchemaError struct {
+	Schema     string
+	Violations []SchemaViolation
+}
+
+func (e *SchemaError) Error() string {
+	parts := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		parts[i] = v.String()
+	}
+	return fmt.Sprintf("документ не соответствует схеме %s: %s", e.Schema, strings.Join(parts, "; "))
+}
+
+// SchemaFor возвращает схему, связанную с файлом в реестре (nil — схемы нет)
+func SchemaFor(path string) (*SchemaMapping, error) {
+	safePath, err := ResolvePath(path)
+	if err != nil {
+		return nil, err
+	}
+	return schemaForPath(safePath)
+}
+
+func schemaForPath(safePath string) (*SchemaMapping, error) {
+	registry, err := loadSchemaRegistry()
+	if err != nil || registry == nil {
+		return nil, err
+	}
+	rel := relPath(safePath)
+	for i := range registry.Schemas {
+		if matchEntry(rel, []string{registry.Schemas[i].Files}) {
+			return &registry.Schemas[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// loadSchemaRegistry читает реестр схем; nil без ошибки — реестра нет
+func loadSchemaRegistry() (*schemaRegistry, error) {
+	safePath, err := ResolvePath(SchemaRegistryFile)
+	if err != nil {
+		return nil, err
+	}
+	content, err := readStructuredFile(safePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseSchemaRegistry(content)
+}
+
+func parseSchemaRegistry(content string) (*schemaRegistry, error) {
+	var registry schemaRegistry
+	decoder := json.NewDecoder(strings.NewReader(content))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&registry); err != nil {
+		return nil, fmt.Errorf("реестр схем %s повреждён: %v", SchemaRegistryFile, err)
+	}
+	for _, m := range registry.Schemas {
+		if m.Files == "" || m.Schema == "" {
+			return nil, fmt.Errorf("реестр схем %s: у записи должны быть заданы files и schema", SchemaRegistryFile)
+		}
+		if err := validatePatterns([]string{m.Files}); err != nil {
+			return nil, fmt.Errorf("реестр схем %s: %v", SchemaRegistryFile, err)
+		}
+	}
+	return &registry, nil
+}
+
+// readStructuredFile читает документ целиком с проверкой размера
+func readStructuredFile(safePath string) (string, error) {
+	fileMutex.RLock()
+	defer fileMutex.RUnlock()
+
+	info, err := os.Stat(safePath)
+	if err != nil {
+		return "", err
+	}
+	if info.Size() > MaxFileSize {
+		return "", fmt.Errorf("файл слишком большой для разбора: %d байт (лимит %d)", info.Size(), MaxFileSize)
+	}
+	content, err := os.ReadFile(safePath)
+	return string(content), err
+}
+
+// loadSchema читает и разбирает файл схемы
+func loadSchema(path string) (interface{}, error) {
+	safePath, err := ResolvePath(path)
+	if err != nil {
+		return nil, err
+	}
+	content, err := readStructuredFile(safePath)
+	if err != nil {
+		return nil, fmt.Errorf("схема %s: %w", path, err)
+	}
+	schema, err := ParseJSON(content)
+	if err != nil {
+		return nil, fmt.Errorf("схема %s: %w", path, err)
+	}
+	return schema, nil
+}
+
+// ValidateJSONFile читает JSON файл и проверяет его по схеме из реестра.
+// Возвращает путь схемы (пусто — схема не назначена) и все нарушения
+func ValidateJSONFile(path string) (string, []SchemaViolation, error) {
+	data, err := ReadJSON(path)
+	if err != nil {
+		return "", nil, err
+	}
+	return ValidateAgainstRegistry(path, data)
+}
+
+// ValidateAgainstRegistry проверяет уже прочитанный документ по схеме, назначенной его пути
+func ValidateAgainstRegistry(path string, data interface{}) (string, []SchemaViolation, error) {
+	mapping, err := SchemaFor(path)
+	if err != nil || mapping == nil {
+		return "", nil, err
+	}
+	schema, err := loadSchema(mapping.Schema)
+	if err != nil {
+		return mapping.Schema, nil, err
+	}
+	violations, err := ValidateSchema(data, schema)
+	return mapping.Schema, violations, err
+}
+
+// checkSchemaOnWrite проверяет записываемое содержимое, если для пути включена
+// обязательная проверка. Повреждённый реестр блокирует запись (проверка не
+// обходится молча), поэтому сам реестр можно записать всегда, но только корректным
+func checkSchemaOnWrite(safePath, content string) error {
+	if relPath(safePath) == SchemaRegistryFile {
+		_, err := parseSchemaRegistry(content)
+		return err
+	}
+	mapping, err := schemaForPath(safePath)
+	if err != nil || mapping == nil || !mapping.Enforce {
+		return err
+	}
+	schema, err := loadSchema(mapping.Schema)
+	if err != nil {
+		return err
+	}
+	var violations []SchemaViolation
+	if isNDJSONPath(safePath) {
+		// В JSON Lines по схеме проверяется каждая запись
+		violations, err = validateNDJSONRecords(content, schema)
+	} else {
+		var data interface{}
+		if data, err = ParseJSON(content); err == nil {
+			violations, err = ValidateSchema(data, schema)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("файл проверяется по схеме %s: %w", mapping.Schema, err)
+	}
+	if len(violations) > 0 {
+		return &SchemaError{Schema: mapping.Schema, Violations: violations}
+	}
+	return nil
+}
+
+// checkRecordSchema проверяет по схеме только дописываемую запись JSON Lines:
+// записи, уже находящиеся в файле, проверены при их добавлении
+func checkRecordSchema(safePath, line string) error {
+	mapping, err := schemaForPath(safePath)
+	if err != nil || mapping == nil || !mapping.Enforce {
+		return err
+	}
+	schema, err := loadSchema(mapping.Schema)
+	if err != nil {
+		return err
+	}
+	data, err := ParseJSON(line)
+	if err != nil {
+		return err
+	}
+	violations, err := ValidateSchema(data, schema)
+	if err != nil {
+		return fmt.Errorf("файл проверяется по схеме %s: %w", mapping.Schema, err)
+	}
+	if len(violations) > 0 {
+		return &SchemaError{Schema: mapping.Schema, Violations: violations}
+	}
+	return nil
+}
+
+// checkSchemaFromFile проверяет итоговое содержимое при копировании, переносе или
+// дописывании в путь с обязательной схемой: содержимое source плюс suffix
+func checkSchemaFromFile(target, source, suffix string) error {
+	if relPath(target) != SchemaRegistryFile {
+		mapping, err := schemaForPath(target)
+		if err != nil || mapping == nil || !mapping.Enforce {
+			return err
+		}
+	}
+	content, err := readStructuredFile(source)
+	if err != nil {
+		return err
+	}
+	return checkSchemaOnWrite(target, content+suffix)
+}
+
+// ValidateSchema проверяет документ по JSON Schema (подмножество draft 2020-12):
+// type, enum, const, properties, patternProperties, additionalProperties, required,
+// minProperties/maxProperties, prefixItems, items, minItems/maxItems, uniqueItems,
+// minLength/maxLength, pattern, minimum/maximum, exclusiveMinimum/exclusiveMaximum,
+// multipleOf, allOf/anyOf/oneOf/not, $ref на "#" и "#/$defs/...".
+// Остальные ключевые слова (format, title, description...) игнорируются.
+// Ошибка возвращается только для некорректной схемы
+func ValidateSchema(data, schema interface{}) ([]SchemaViolation, error) {
+	v := &schemaValidator{root: schema}
+	violations := v.validate(data, schema, "", 0)
+	return violations, v.err
+}
+
+type schemaValidator struct {
+	root interface{}
+	err  error // первая ошибка в самой схеме
+}
+
+func (v *schemaValidator) schemaError(format string, args ...interface{}) []SchemaViolation {
+	if v.err == nil {
+		v.err = fmt.Errorf("некорректная схема: "+format, args...)
+	}
+	return nil
+}
+
+func (v *schemaValidator) validate(data, schema interface{}, pointer string, refDepth int) []SchemaViolation {
+	var out []SchemaViolation
+	add := func(format string, args ...interface{}) {
+		out = append(out, SchemaViolation{Pointer: pointer, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if allowed, ok := schema.(bool); ok {
+		if !allowed {
+			add("значение запрещено схемой")
+		}
+		return out
+	}
+	s, ok := schema.(map[string]interface{})
+	if !ok {
+		return v.schemaError("схема должна быть объектом или true/false")
+	}
+
+	if ref, ok := s["$ref"]; ok {
+		target, err := v.resolveRef(ref)
+		if err != nil {
+			return v.schemaError("%v", err)
+		}
+		if refDepth >= maxSchemaRefDepth {
+			return v.schemaError("слишком глубокая цепочка $ref (возможна циклическая ссылка)")
+		}
+		out = append(out, v.validate(data, target, pointer, refDepth+1)...)
+	}
+
+	if t, ok := s["type"]; ok {
+		if !v.matchesType(data, t) {
+			add("ожидался тип %s, получен %s", typeList(t), jsonType(data))
+		}
+	}
+	if enum, ok := s["enum"]; ok {
+		values, isArray := enum.([]interface{})
+		if !isArray {
+			return v.schemaError("enum должен быть массивом")
+		}
+		found := false
+		for _, e := range values {
+			if jsonEqual(data, e) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			add("значение не входит в список допустимых: %s", compactJSON(enum))
+		}
+	}
+	if c, ok := s["const"]; ok && !jsonEqual(data, c) {
+		add("значение должно быть равно %s", compactJSON(c))
+	}
+
+	switch d := data.(type) {
+	case map[string]interface{}:
+		out = append(out, v.validateObject(d, s, pointer, refDepth)...)
+	case []interface{}:
+		out = append(out, v.validateArray(d, s, pointer, refDepth)...)
+	case string:
+		length := utf8.RuneCountInString(d)
+		if n, ok := v.intKeyword(s, "minLength"); ok && length < n {
+			add("строка короче %d символов", n)
+		}
+		if n, ok := v.intKeyword(s, "maxLength"); ok && length > n {
+			add("строка длиннее %d символов", n)
+		}
+		if p, ok := s["pattern"]; ok {
+			// RE2 из regexp работает за линейное время — ReDoS через схему невозможен
+			ps, isString := p.(string)
+			re, err := regexp.Compile(ps)
+			if !isString || err != nil {
+				return v.schemaError("pattern %v не является регулярным выражением", p)
+			}
+			if !re.MatchString(d) {
+				add("строка не соответствует шаблону %s", ps)
+			}
+		}
+	default:
+		if n, isNumber := toFloat(data); isNumber {
+			out = append(out, v.validateNumber(n, s, pointer)...)
+		}
+	}
+
+	for _, key := range []string{"allOf", "anyOf", "oneOf"} {
+		raw, ok := s[key]
+		if !ok {
+			continue
+		}
+		subs, isArray := raw.([]interface{})
+		if !isArray || len(subs) == 0 {
+			return v.schemaError("%s должен быть непустым массивом", key)
+		}
+		passed := 0
+		var failed []SchemaViolation
+		for _, sub := range subs {
+			res := v.validate(data, sub, pointer, refDepth)
+			if len(res) == 0 {
+				passed++
+			} else {
+				failed = append(failed, res...)
+			}
+		}
+		switch {
+		case key == "allOf":
+			out = append(out, failed...)
+		case key == "anyOf" && passed == 0:
+			add("значение не соответствует ни одной из схем anyOf")
+		case key == "oneOf" && passed != 1:
+			add("значение должно соответствовать ровно одной схеме oneOf (соответствует %d)", passed)
+		}
+	}
+	if not, ok := s["not"]; ok && len(v.validate(data, not, pointer, refDepth)) == 0 {
+		add("значение не должно соответствовать схеме not")
+	}
+	return out
+}
+
+func (v *schemaValidator) validateObject(d map[string]interface{}, s map[string]interface{}, pointer string, refDepth int) []SchemaViolation {
+	var out []SchemaViolation
+	add := func(format string, args ...interface{}) {
+		out = append(out, SchemaViolation{Pointer: pointer, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if raw, ok := s["required"]; ok {
+		required, isArray := raw.([]interface{})
+		if !isArray {
+			return v.schemaError("required должен быть массивом")
+		}
+		for _, r := range required {
+			name, _ := r.(string)
+			if _, present := d[name]; !present {
+				add("отсутствует обязательное поле %q", name)
+			}
+		}
+	}
+	if n, ok := v.intKeyword(s, "minProperties"); ok && len(d) < n {
+		add("полей меньше %d", n)
+	}
+	if n, ok := v.intKeyword(s, "maxProperties"); ok && len(d) > n {
+		add("полей больше %d", n)
+	}
+
+	properties, _ := s["properties"].(map[string]interface{})
+	patternProperties, _ := s["patternProperties"].(map[string]interface{})
+	additional, hasAdditional := s["additionalProperties"]
+
+	// Ключи по порядку — нарушения выводятся в постоянном порядке
+	keys := make([]string, 0, len(d))
+	for k := range d {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		child := appendPointer(pointer, k)
+		matched := false
+		if sub, ok := properties[k]; ok {
+			matched = true
+			out = append(out, v.validate(d[k], sub, child, refDepth)...)
+		}
+		for p, sub := range patternProperties {
+			re, err := regexp.Compile(p)
+			if err != nil {
+				return v.schemaError("patternProperties: %q не является регулярным выражением", p)
+			}
+			if re.MatchString(k) {
+				matched = true
+				out = append(out, v.validate(d[k], sub, child, refDepth)...)
+			}
+		}
+		if !matched && hasAdditional {
+			if allowed, isBool := additional.(bool); isBool && !allowed {
+				out = append(out, SchemaViolation{Pointer: child, Message: "поле не разрешено схемой"})
+			} else {
+				out = append(out, v.validate(d[k], additional, child, refDepth)...)
+			}
+		}
+	}
+	return out
+}
+
+func (v *schemaValidator) validateArray(d []interface{}, s map[string]interface{}, pointer string, refDepth int) []SchemaViolation {
+	var out []SchemaViolation
+	add := func(format string, args ...interface{}) {
+		out = append(out, SchemaViolation{Pointer: pointer, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if n, ok := v.intKeyword(s, "minItems"); ok && len(d) < n {
+		add("элементов меньше %d", n)
+	}
+	if n, ok := v.intKeyword(s, "maxItems"); ok && len(d) > n {
+		add("элементов больше %d", n)
+	}
+	if unique, _ := s["uniqueItems"].(bool); unique {
+	outer:
+		for i := range d {
+			for j := 0; j < i; j++ {
+				if jsonEqual(d[i], d[j]) {
+					add("элементы %d и %d совпадают", j, i)
+					break outer
+				}
+			}
+		}
+	}
+
+	prefix, _ := s["prefixItems"].([]interface{})
+	items, hasItems := s["items"]
+	for i, item := range d {
+		child := appendPointer(pointer, strconv.Itoa(i))
+		switch {
+		case i < len(prefix):
+			out = append(out, v.validate(item, prefix[i], child, refDepth)...)
+		case hasItems:
+			out = append(out, v.validate(item, items, child, refDepth)...)
+		}
+	}
+	return out
+}
+
+func (v *schemaValidator) validateNumber(n float64, s map[string]interface{}, pointer string) []SchemaViolation {
+	var out []SchemaViolation
+	check := func(key string, fails func(limit float64) bool, message string) {
+		raw, ok := s[key]
+		if !ok {
+			return
+		}
+		limit, isNumber := toFloat(raw)
+		if !isNumber {
+			v.schemaError("%s должен быть числом", key)
+			return
+		}
+		if fails(limit) {
+			out = append(out, SchemaViolation{Pointer: pointer, Message: fmt.Sprintf(message, compactJSON(raw))})
+		}
+	}
+	check("minimum", func(l float64) bool { return n < l }, "значение меньше %s")
+	check("maximum", func(l float64) bool { return n > l }, "значение больше %s")
+	check("exclusiveMinimum", func(l float64) bool { return n <= l }, "значение должно быть больше %s")
+	check("exclusiveMaximum", func(l float64) bool { return n >= l }, "значение должно быть меньше %s")
+	check("multipleOf", func(l float64) bool {
+		if l <= 0 {
+			v.schemaError("multipleOf должен быть больше 0")
+			return false
+		}
+		q := n / l
+		return math.Abs(q-math.Round(q)) > 1e-9
+	}, "значение не кратно %s")
+	return out
+}
+
+// resolveRef находит схему по ссылке "#" или "#/$defs/..." внутри той же схемы
+func (v *schemaValidator) resolveRef(ref interface{}) (interface{}, error) {
+	s, ok := ref.(string)
+	if !ok || !strings.HasPrefix(s, "#") {
+		return nil, fmt.Errorf("поддерживаются только локальные $ref (\"#...\"), получено %v", ref)
+	}
+	target, err := resolvePointer(v.root, s[1:])
+	if err != nil {
+		return nil, fmt.Errorf("$ref %s: %v", s, err)
+	}
+	return target, nil
+}
+
+func (v *schemaValidator) intKeyword(s map[string]interface{}, key string) (int, bool) {
+	raw, ok := s[key]
+	if !ok {
+		return 0, false
+	}
+	n, isNumber := toFloat(raw)
+	if !isNumber || n < 0 || n != math.Trunc(n) {
+		v.schemaError("%s должен быть неотрицательным целым числом", key)
+		return 0, false
+	}
+	return int(n), true
+}
+
+func (v *schemaValidator) matchesType(data interface{}, t interface{}) bool {
+	switch tt := t.(type) {
+	case string:
+		actual := jsonType(data)
+		return actual == tt || (tt == "number" && actual == "integer")
+	case []interface{}:
+		for _, one := range tt {
+			if v.matchesType(data, one) {
+				return true
+			}
+		}
+		return false
+	default:
+		v.schemaError("type должен быть строкой или массивом строк")
+		return true
+	}
+}
+
+// jsonType возвращает тип значения в терминах JSON Schema (целые числа — integer)
+func jsonType(data interface{}) string {
+	switch d := data.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		if n, ok := toFloat(d); ok && n == math.Trunc(n) && !math.IsInf(n, 0) {
+			return "integer"
+		}
+		return "number"
+	}
+}
+
+func typeList(t interface{}) string {
+	if list, ok := t.([]interface{}); ok {
+		parts := make([]string, len(list))
+		for i, p := range list {
+			parts[i] = fmt.Sprint(p)
+		}
+		return strings.Join(parts, " или ")
+	}
+	return fmt.Sprint(t)
+}
+
+// toFloat приводит число JSON (float64 или json.Number) к float64
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// jsonEqual сравнивает значения JSON; числа сравниваются по значению (1 == 1.0)
+func jsonEqual(a, b interface{}) bool {
+	if x, ok := toFloat(a); ok {
+		y, ok := toFloat(b)
+		return ok && x == y
+	}
+	switch x := a.(type) {
+	case map[string]interface{}:
+		y, ok := b.(map[string]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for k, xv := range x {
+			yv, present := y[k]
+			if !present || !jsonEqual(xv, yv) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		y, ok := b.([]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !jsonEqual(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return a == b
+	}
+}
+
+// compactJSON возвращает значение в виде однострочного JSON для сообщений
+func compactJSON(v interface{}) string {
+	out, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(out)
+}
@@ -0,0 +1,227 @@
+package fs
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MaxSearchResults — максимальное число совпадений, которое хранится в памяти
+// Защита от DoS при поиске по огромному дереву каталогов
+const MaxSearchResults = 10000
+
+// Типы объектов для фильтра поиска
+const (
+	SearchTypeAny  = ""
+	SearchTypeFile = "file"
+	SearchTypeDir  = "dir"
+)
+
+// SearchOptions задаёт фильтры поиска (пустые поля не учитываются)
+type SearchOptions struct {
+	NameGlob       string    // шаблон имени (*.txt, report_??.json)
+	NameRegex      string    // регулярное выражение для имени
+	MinSize        int64     // минимальный размер в байтах (0 — без ограничения)
+	MaxSize        int64     // максимальный размер в байтах (0 — без ограничения)
+	ModifiedAfter  time.Time // изменён не раньше
+	ModifiedBefore time.Time // изменён не позже
+	Type           string    // SearchTypeAny, SearchTypeFile или SearchTypeDir
+	Extensions     []string  // допустимые расширения (".txt", "json")
+	Offset         int       // сколько результатов пропустить (постраничный вывод)
+	Limit          int       // размер страницы (0 — все результаты)
+}
+
+// SearchResult описывает найденный файл или директорию
+type SearchResult struct {
+	Path    string    // путь относительно корня sandbox
+	Size    int64     // размер в байтах
+	ModTime time.Time // время последнего изменения
+	IsDir   bool      // является ли директорией
+}
+
+// SearchPage — страница результатов поиска
+type SearchPage struct {
+	Results   []SearchResult // результаты текущей страницы
+	Total     int            // общее число совпадений
+	Truncated bool           // поиск остановлен по лимиту MaxSearchResults
+}
+
+// Search рекурсивно ищет файлы в директории root с учётом фильтров
+// Символические ссылки пропускаются, поэтому обход не выходит за пределы sandbox
+func Search(root string, opts SearchOptions) (*SearchPage, error) {
+	safeRoot, err := ResolvePath(root)
+	if err != nil {
+		return nil, err
+	}
+
+	var nameRegex *regexp.Regexp
+	if opts.NameRegex != "" {
+		nameRegex, err = regexp.Compile(opts.NameRegex)
+		if err != nil {
+			return nil, errors.New("некорректное регулярное выражение: " + err.Error())
+		}
+	}
+	if opts.NameGlob != "" {
+		// Проверяем синтаксис шаблона заранее, а не на каждом файле
+		if _, err := filepath.Match(opts.NameGlob, ""); err != nil {
+			return nil, errors.New("некорректный шаблон имени: " + err.Error())
+		}
+	}
+	if opts.Type != SearchTypeAny && opts.Type != SearchTypeFile && opts.Type != SearchTypeDir {
+		return nil, errors.New("неизвестный тип объекта: " + opts.Type)
+	}
+	extensions := normalizeExtensions(opts.Extensions)
+
+	fileMutex.RLock()
+	defer fileMutex.RUnlock()
+
+	// Символической ссылкой может быть не только сам корень, но и любая
+	// родительская директория: тогда обход ушёл бы за пределы sandbox
+	if err := checkNoSymlinks(safeRoot); err != nil {
+		return nil, err
+	}
+	rootInfo, err := os.Lstat(safeRoot)
+	if err != nil {
+		return nil, err
+	}
+	if !rootInfo.IsDir() {
+		return nil, errors.New("путь не является директорией")
+	}
+
+	page := &SearchPage{}
+	var matches []SearchResult
+
+	err = filepath.WalkDir(safeRoot, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Недоступные поддиректории пропускаем, корень — ошибка
+			if path == safeRoot {
+				return err
+			}
+			return nil
+		}
+		if path == safeRoot {
+			return nil
+		}
+		// Защита: символические ссылки не открываем и не выдаём в результатах
+		if d.Type()&os.ModeSymlink != 0 {
+			return nil
+		}
+		if d.IsDir() && isExtractStage(d.Name()) {
+			return filepath.SkipDir
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if !matchSearch(info, opts, nameRegex, extensions) {
+			return nil
+		}
+
+		if len(matches) >= MaxSearchResults {
+			page.Truncated = true
+			return filepath.SkipAll
+		}
+		page.Total++
+		matches = append(matches, SearchResult{
+			Path:    relPath(path),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+			IsDir:   info.IsDir(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Path < matches[j].Path })
+
+	start := opts.Offset
+	if start < 0 {
+		start = 0
+	}
+	if start > len(matches) {
+		start = len(matches)
+	}
+	end := len(matches)
+	if opts.Limit > 0 && start+opts.Limit < end {
+		end = start + opts.Limit
+	}
+	page.Results = matches[start:end]
+	return page, nil
+}
+
+// matchSearch проверяет, удовлетворяет ли объект всем фильтрам
+func matchSearch(info os.FileInfo, opts SearchOptions, nameRegex *regexp.Regexp, extensions []string) bool {
+	name := info.Name()
+
+	switch opts.Type {
+	case SearchTypeFile:
+		if info.IsDir() {
+			return false
+		}
+	case SearchTypeDir:
+		if !info.IsDir() {
+			return false
+		}
+	}
+	if opts.NameGlob != "" {
+		if ok, _ := filepath.Match(opts.NameGlob, name); !ok {
+			return false
+		}
+	}
+	if nameRegex != nil && !nameRegex.MatchString(name) {
+		return false
+	}
+	if len(extensions) > 0 {
+		ext := strings.ToLower(filepath.Ext(name))
+		found := false
+		for _, e := range extensions {
+			if e == ext {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	// Фильтры размера применяются только к файлам
+	if !info.IsDir() {
+		if opts.MinSize > 0 && info.Size() < opts.MinSize {
+			return false
+		}
+		if opts.MaxSize > 0 && info.Size() > opts.MaxSize {
+			return false
+		}
+	}
+	if !opts.ModifiedAfter.IsZero() && info.ModTime().Before(opts.ModifiedAfter) {
+		return false
+	}
+	if !opts.ModifiedBefore.IsZero() && info.ModTime().After(opts.ModifiedBefore) {
+		return false
+	}
+	return true
+}
+
+// normalizeExtensions приводит расширения к виду ".ext" в нижнем регистре
+func normalizeExtensions(exts []string) []string {
+	var result []string
+	for _, e := range exts {
+		e = strings.ToLower(strings.TrimSpace(e))
+		if e == "" {
+			continue
+		}
+		if !strings.HasPrefix(e, ".") {
+			e = "." + e
+		}
+		result = append(result, e)
+	}
+	return result
+}
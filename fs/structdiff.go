@@ -0,0 +1,229 @@
+package fs
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Структурное сравнение документов: оба файла читаются в общую модель данных
+// (JSON, XML, YAML, TOML...), поэтому форматирование, отступы и порядок ключей
+// объектов не влияют на результат. Различия выводятся текстом или как
+// JSON Patch (RFC 6902), превращающий первый документ во второй
+
+// maxArrayDiffCells — предел размера таблицы LCS при сравнении массивов;
+// для больших массивов элементы сравниваются попарно по индексам
+const maxArrayDiffCells = 1000000
+
+// Операции изменений (совпадают с операциями JSON Patch)
+const (
+	DiffAdd     = "add"
+	DiffRemove  = "remove"
+	DiffReplace = "replace"
+)
+
+// DiffChange — различие в одном месте документа. Индексы массивов в Path
+// указаны для документа, к которому применены все предыдущие изменения,
+// как в JSON Patch
+type DiffChange struct {
+	Op   string
+	Path string
+	Old  interface{} // значение в первом документе (remove, replace)
+	New  interface{} // значение во втором документе (add, replace)
+}
+
+func (c DiffChange) String() string {
+	switch c.Op {
+	case DiffAdd:
+		return fmt.Sprintf("+ %s: %s", pointerLabel(c.Path), compactJSON(c.New))
+	case DiffRemove:
+		return fmt.Sprintf("- %s: %s", pointerLabel(c.Path), compactJSON(c.Old))
+	}
+	return fmt.Sprintf("~ %s: %s → %s", pointerLabel(c.Path), compactJSON(c.Old), compactJSON(c.New))
+}
+
+// DiffFiles сравнивает два файла структурированных данных (формат определяется
+// по расширению, форматы могут различаться)
+func DiffFiles(pathA, pathB string) ([]DiffChange, error) {
+	a, err := readDataFile(pathA)
+	if err != nil {
+		return nil, err
+	}
+	b, err := readDataFile(pathB)
+	if err != nil {
+		return nil, err
+	}
+	return DiffData(a, b), nil
+}
+
+// readDataFile читает файл в общую модель данных. Потери при чтении не важны
+// для сравнения: оба документа читаются по одним правилам
+func readDataFile(path string) (interface{}, error) {
+	format, err := FormatForPath(path)
+	if err != nil {
+		return nil, err
+	}
+	safePath, err := ResolvePath(path)
+	if err != nil {
+		return nil, err
+	}
+	content, err := readStructuredFile(safePath)
+	if err != nil {
+		return nil, err
+	}
+	data, _, err := format.Decode(content)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", relPath(safePath), err)
+	}
+	return data, nil
+}
+
+// DiffData сравнивает два значения общей модели данных
+func DiffData(a, b interface{}) []DiffChange {
+	d := &dataDiff{}
+	d.value("", a, b)
+	return d.changes
+}
+
+type dataDiff struct {
+	changes []DiffChange
+}
+
+func (d *dataDiff) add(op, path string, oldValue, newValue interface{}) {
+	d.changes = append(d.changes, DiffChange{Op: op, Path: path, Old: oldValue, New: newValue})
+}
+
+func (d *dataDiff) value(path string, a, b interface{}) {
+	if diffEqual(a, b) {
+		return
+	}
+	switch x := a.(type) {
+	case *orderedObject:
+		if y, ok := b.(*orderedObject); ok {
+			d.object(path, x, y)
+			return
+		}
+	case []interface{}:
+		if y, ok := b.([]interface{}); ok {
+			d.array(path, x, y)
+			return
+		}
+	}
+	d.add(DiffReplace, path, a, b)
+}
+
+// object сравнивает объекты по ключам: сначала удалённые и изменённые ключи
+// в порядке первого документа, затем добавленные в порядке второго
+func (d *dataDiff) object(path string, a, b *orderedObject) {
+	for _, k := range a.keys {
+		if bv, ok := b.get(k); ok {
+			d.value(appendPointer(path, k), a.values[k], bv)
+		} else {
+			d.add(DiffRemove, appendPointer(path, k), a.values[k], nil)
+		}
+	}
+	for _, k := range b.keys {
+		if _, ok := a.get(k); !ok {
+			d.add(DiffAdd, appendPointer(path, k), nil, b.values[k])
+		}
+	}
+}
+
+// array сравнивает массивы: совпадающие элементы находятся через наибольшую
+// общую подпоследовательность, элементы между ними сравниваются попарно, а
+// лишние удаляются или добавляются. Так вставка в начало массива даёт одно
+// добавление, а не замену всех элементов
+func (d *dataDiff) array(path string, a, b []interface{}) {
+	anchors := commonElements(a, b)
+	anchors = append(anchors, [2]int{len(a), len(b)})
+
+	index, i, j := 0, 0, 0
+	for _, anchor := range anchors {
+		gapA, gapB := anchor[0]-i, anchor[1]-j
+		paired := min(gapA, gapB)
+		for k := 0; k < paired; k++ {
+			d.value(appendPointer(path, fmt.Sprint(index)), a[i+k], b[j+k])
+			index++
+		}
+		for k := paired; k < gapA; k++ {
+			d.add(DiffRemove, appendPointer(path, fmt.Sprint(index)), a[i+k], nil)
+		}
+		for k := paired; k < gapB; k++ {
+			d.add(DiffAdd, appendPointer(path, fmt.Sprint(index)), nil, b[j+k])
+			index++
+		}
+		index++ // совпадающий элемент
+		i, j = anchor[0]+1, anchor[1]+1
+	}
+}
+
+// commonElements возвращает пары индексов совпадающих элементов (LCS)
+func commonElements(a, b []interface{}) [][2]int {
+	n, m := len(a), len(b)
+	if n == 0 || m == 0 || n*m > maxArrayDiffCells {
+		return nil
+	}
+	plainA, plainB := plainJSON(a).([]interface{}), plainJSON(b).([]interface{})
+	equal := func(i, j int) bool { return jsonEqual(plainA[i], plainB[j]) }
+
+	// lcs[i][j] — длина LCS для a[i:] и b[j:]
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if equal(i, j) {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	var pairs [][2]int
+	for i, j := 0, 0; i < n && j < m; {
+		switch {
+		case equal(i, j):
+			pairs = append(pairs, [2]int{i, j})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	return pairs
+}
+
+// diffEqual сравнивает значения без учёта порядка ключей и записи чисел (1.0 == 1)
+func diffEqual(a, b interface{}) bool {
+	return jsonEqual(plainJSON(a), plainJSON(b))
+}
+
+// FormatDiff выводит различия текстом: + добавлено, - удалено, ~ изменено
+func FormatDiff(changes []DiffChange) string {
+	if len(changes) == 0 {
+		return "Документы совпадают\n"
+	}
+	var b strings.Builder
+	for _, c := range changes {
+		b.WriteString(c.String())
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// DiffPatch возвращает различия как JSON Patch (RFC 6902)
+func DiffPatch(changes []DiffChange) (string, error) {
+	ops := make([]interface{}, 0, len(changes))
+	for _, c := range changes {
+		op := newOrderedObject()
+		op.set("op", c.Op)
+		op.set("path", c.Path)
+		if c.Op != DiffRemove {
+			op.set("value", c.New)
+		}
+		ops = append(ops, op)
+	}
+	return encodeJSON(ops)
+}
@@ -1,56 +1,88 @@
 package fs
 
 import (
+	"bytes"
 	"encoding/json"
 	"encoding/xml"
-	"os"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
 )
 
 // DataContainer — универсальный контейнер для JSON/XML данных
 type DataContainer map[string]interface{}
 
-// ReadJSON читает и десериализует JSON файл
+// ParseError — ошибка разбора JSON/XML документа с позицией во входных данных
+type ParseError struct {
+	Line   int
+	Column int
+	Err    error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("строка %d, столбец %d: %v", e.Line, e.Column, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// ReadJSON читает и десериализует JSON файл с учётом лимитов разбора
 // Go's json decoder безопасен от выполнения произвольного кода
 func ReadJSON(path string) (interface{}, error) {
 	safePath, err := ResolvePath(path)
 	if err != nil {
 		return nil, err
 	}
-
-	fileMutex.RLock()
-	defer fileMutex.RUnlock()
-
-	file, err := os.Open(safePath)
+	content, err := readStructuredFile(safePath)
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
+	return ParseJSON(content)
+}
 
-	var data interface{}
-	decoder := json.NewDecoder(file)
-	err = decoder.Decode(&data)
-	return data, err
+// ParseJSON разбирает и проверяет JSON документ с учётом лимитов (вложенность,
+// количество значений, длина строк и чисел). Числа сохраняются без потери
+// точности (json.Number), данные после документа считаются ошибкой
+func ParseJSON(content string) (interface{}, error) {
+	return decodeJSON(content, false)
 }
 
-// WriteJSON сериализует данные и записывает в JSON файл
-func WriteJSON(path string, data interface{}) error {
-	safePath, err := ResolvePath(path)
-	if err != nil {
-		return err
+// jsonError переводит смещение в байтах в номер строки и столбца
+func jsonError(content string, offset int64, err error) error {
+	if offset > int64(len(content)) {
+		offset = int64(len(content))
 	}
+	before := content[:offset]
+	line := strings.Count(before, "\n") + 1
+	column := utf8.RuneCountInString(before[strings.LastIndex(before, "\n")+1:])
+	if column == 0 {
+		column = 1
+	}
+	return &ParseError{Line: line, Column: column, Err: err}
+}
 
-	fileMutex.Lock()
-	defer fileMutex.Unlock()
-
-	file, err := os.Create(safePath)
+// WriteJSON сериализует данные и записывает в JSON файл
+func WriteJSON(path string, data interface{}) error {
+	content, err := encodeJSON(data)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
+	// WriteFile проверяет размер и обновляет индекс содержимого
+	return WriteFile(path, content)
+}
 
-	encoder := json.NewEncoder(file)
+// encodeJSON сериализует данные в канонический вид с отступами
+func encodeJSON(data interface{}) (string, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
 	encoder.SetIndent("", "  ") // Красивое форматирование с отступами
-	return encoder.Encode(data)
+	if err := encoder.Encode(data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
 }
 
 // XMLData — простая структура для демонстрации работы с XML
@@ -59,45 +91,174 @@ type XMLData struct {
 	Content string   `xml:"content"`
 }
 
-// ReadXML читает и десериализует XML файл
+// ReadXML читает XML файл в структуру XMLData. Разбор выполняется через
+// ReadXMLTree, поэтому DOCTYPE, сущности и превышение лимитов отклоняются
 func ReadXML(path string) (*XMLData, error) {
-	safePath, err := ResolvePath(path)
+	root, err := ReadXMLTree(path)
 	if err != nil {
 		return nil, err
 	}
-
-	fileMutex.RLock()
-	defer fileMutex.RUnlock()
-
-	file, err := os.Open(safePath)
-	if err != nil {
-		return nil, err
+	if root.Name.Local != "root" {
+		return nil, fmt.Errorf("ожидался корневой элемент <root>, получен <%s>", root.Name.Local)
 	}
-	defer file.Close()
 
-	var data XMLData
-	decoder := xml.NewDecoder(file)
-	err = decoder.Decode(&data)
-	return &data, err
+	data := &XMLData{XMLName: root.Name}
+	if content := root.Child("content"); content != nil {
+		data.Content = content.Text
+	}
+	return data, nil
 }
 
 // WriteXML сериализует данные и записывает в XML файл
 func WriteXML(path string, data *XMLData) error {
-	safePath, err := ResolvePath(path)
-	if err != nil {
+	var buf bytes.Buffer
+	encoder := xml.NewEncoder(&buf)
+	encoder.Indent("", "  ") // Красивое форматирование с отступами
+	if err := encoder.Encode(data); err != nil {
 		return err
 	}
+	// WriteFile пишет атомарно, проверяет размер и схему и обновляет индекс содержимого
+	return WriteFile(path, buf.String())
+}
+
+// maxDataDepth — максимальная вложенность данных при разборе YAML и TOML
+const maxDataDepth = 64
 
-	fileMutex.Lock()
-	defer fileMutex.Unlock()
+// DataFormat — формат структурированных данных в реестре форматов. Все форматы
+// читают данные в общую модель: объекты с сохранением порядка ключей, массивы,
+// строки, числа (json.Number), логические значения и null
+type DataFormat struct {
+	Name       string
+	Extensions []string
+	// Decode разбирает документ; losses — что не удалось перенести в модель без изменений
+	Decode func(content string) (data interface{}, losses []string, err error)
+	// Encode записывает данные; losses — что изменилось или пропало при записи,
+	// ошибка — данные невозможно представить в формате
+	Encode func(data interface{}) (content string, losses []string, err error)
+}
+
+// dataFormats — реестр поддерживаемых форматов
+var dataFormats = []*DataFormat{
+	{Name: "JSON", Extensions: []string{".json"}, Decode: decodeJSONData, Encode: encodeJSONData},
+	{Name: "XML", Extensions: []string{".xml"}, Decode: decodeXMLData, Encode: encodeXMLData},
+	{Name: "YAML", Extensions: []string{".yaml", ".yml"}, Decode: decodeYAML, Encode: encodeYAML},
+	{Name: "CSV", Extensions: []string{".csv"}, Decode: csvDecoder(','), Encode: csvEncoder(',')},
+	{Name: "TSV", Extensions: []string{".tsv"}, Decode: csvDecoder('\t'), Encode: csvEncoder('\t')},
+	{Name: "TOML", Extensions: []string{".toml"}, Decode: decodeTOML, Encode: encodeTOML},
+}
 
-	file, err := os.Create(safePath)
+// DataFormats возвращает форматы реестра
+func DataFormats() []*DataFormat {
+	return dataFormats
+}
+
+// FormatForPath определяет формат по расширению файла
+func FormatForPath(path string) (*DataFormat, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, f := range dataFormats {
+		for _, e := range f.Extensions {
+			if e == ext {
+				return f, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("неизвестный формат данных %q (поддерживаются json, xml, yaml, csv, tsv, toml)", ext)
+}
+
+// LossyConversionError — преобразование изменит или потеряет часть данных
+type LossyConversionError struct {
+	From, To string
+	Losses   []string
+}
+
+func (e *LossyConversionError) Error() string {
+	return fmt.Sprintf("преобразование %s → %s с потерями: %s", e.From, e.To, strings.Join(e.Losses, "; "))
+}
+
+// ConvertFile преобразует файл между форматами по расширениям src и dst.
+// Если часть данных будет изменена или потеряна, без allowLossy возвращается
+// *LossyConversionError и файл не записывается. Возвращает список потерь
+func ConvertFile(src, dst string, allowLossy bool) ([]string, error) {
+	from, err := FormatForPath(src)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	to, err := FormatForPath(dst)
+	if err != nil {
+		return nil, err
+	}
+	safeSrc, err := ResolvePath(src)
+	if err != nil {
+		return nil, err
+	}
+	content, err := readStructuredFile(safeSrc)
+	if err != nil {
+		return nil, err
 	}
-	defer file.Close()
 
-	encoder := xml.NewEncoder(file)
-	encoder.Indent("", "  ") // Красивое форматирование с отступами
-	return encoder.Encode(data)
+	data, losses, err := from.Decode(content)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", from.Name, err)
+	}
+	out, encodeLosses, err := to.Encode(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", to.Name, err)
+	}
+	losses = append(losses, encodeLosses...)
+	if len(losses) > 0 && !allowLossy {
+		return losses, &LossyConversionError{From: from.Name, To: to.Name, Losses: losses}
+	}
+	return losses, WriteFile(dst, out)
+}
+
+func decodeJSONData(content string) (interface{}, []string, error) {
+	data, err := parseOrderedJSON(content)
+	return data, nil, err
+}
+
+func encodeJSONData(data interface{}) (string, []string, error) {
+	out, err := encodeJSON(data)
+	return out, nil, err
+}
+
+// lossSet собирает сообщения о потерях без повторов, сохраняя порядок
+type lossSet struct {
+	seen   map[string]bool
+	losses []string
+}
+
+func (l *lossSet) add(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	if l.seen == nil {
+		l.seen = make(map[string]bool)
+	}
+	if !l.seen[msg] {
+		l.seen[msg] = true
+		l.losses = append(l.losses, msg)
+	}
+}
+
+// scalarText возвращает скалярное значение модели в виде текста
+func scalarText(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case bool:
+		if t {
+			return "true"
+		}
+		return "false"
+	default:
+		return fmt.Sprint(t)
+	}
+}
+
+// pointerLabel возвращает JSON Pointer для сообщений (корень — "/")
+func pointerLabel(pointer string) string {
+	if pointer == "" {
+		return "/"
+	}
+	return pointer
 }
@@ -0,0 +1,457 @@
+package fs
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CreateTar создаёт TAR (или TAR.GZ при compress=true) архив из файла или директории
+func CreateTar(source, target string, compress bool) error {
+	return CreateTarFromSources([]string{source}, target, compress)
+}
+
+// CreateTarFromSources создаёт TAR/TAR.GZ архив из нескольких файлов и директорий
+func CreateTarFromSources(sources []string, target string, compress bool) error {
+	safeSources, safeTarget, err := resolveSources(sources, target)
+	if err != nil {
+		return err
+	}
+
+	// Архив пишется во временный файл: ошибка в источниках не уничтожает
+	// уже существующий файл safeTarget
+	return replaceViaTemp(safeTarget, func(out *os.File) error {
+		return createTar(safeSources, safeTarget, out, compress)
+	})
+}
+
+// createTar записывает TAR-поток (при compress — через gzip) в out
+func createTar(safeSources []string, safeTarget string, out *os.File, compress bool) error {
+	var w io.Writer = out
+	var gz *gzip.Writer
+	if compress {
+		gz = gzip.NewWriter(out)
+		w = gz
+	}
+	tw := tar.NewWriter(w)
+
+	// Ни прежний архив, ни временный файл нового не попадают в архив
+	skip := map[string]bool{safeTarget: true, out.Name(): true}
+	seen := make(map[string]bool)
+	for _, safeSource := range safeSources {
+		if err := addToTar(tw, safeSource, skip, seen); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if gz != nil {
+		return gz.Close()
+	}
+	return nil
+}
+
+// addToTar добавляет в архив файл или директорию (рекурсивно)
+func addToTar(tw *tar.Writer, safeSource string, skip, seen map[string]bool) error {
+	info, err := os.Stat(safeSource)
+	if err != nil {
+		return err
+	}
+
+	baseDir := filepath.Base(safeSource)
+	return filepath.Walk(safeSource, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		// Символические ссылки, специальные файлы и сам создаваемый архив пропускаем
+		if (!fi.Mode().IsRegular() && !fi.IsDir()) || skip[path] {
+			return nil
+		}
+
+		header, err := tar.FileInfoHeader(fi, "")
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			header.Name = filepath.ToSlash(filepath.Join(baseDir, strings.TrimPrefix(path, safeSource)))
+		} else {
+			header.Name = fi.Name()
+		}
+		if fi.IsDir() {
+			header.Name += "/"
+		}
+		if seen[header.Name] {
+			return fmt.Errorf("повторяющееся имя в архиве: %s", header.Name)
+		}
+		seen[header.Name] = true
+		// Не раскрываем владельца файлов на хосте
+		header.Uid, header.Gid, header.Uname, header.Gname = 0, 0, "", ""
+
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if fi.IsDir() {
+			return nil
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = io.Copy(tw, file)
+		return err
+	})
+}
+
+// ExtractTar распаковывает TAR или TAR.GZ архив с защитой от бомб и path traversal
+// Символические ссылки допускаются только относительные и без "..",
+// жёсткие ссылки — только на уже распакованные файлы, устройства запрещены
+func ExtractTar(src, dest string) error {
+	return ExtractTarWithOptions(src, dest, ExtractOptions{})
+}
+
+// ExtractTarWithOptions распаковывает TAR/TAR.GZ архив (целиком или выборочно по шаблонам)
+func ExtractTarWithOptions(src, dest string, opts ExtractOptions) error {
+	if err := validatePatterns(opts.Patterns); err != nil {
+		return err
+	}
+	safeSrc, err := ResolvePath(src)
+	if err != nil {
+		return err
+	}
+	safeDest, err := ResolvePath(dest)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(safeSrc)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	tr, closeFn, err := openTarStream(file)
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+
+	budget := newExtractBudget()
+	extracted, err := extractStaged(safeDest, opts.Overwrite, func(stage string) error {
+		return extractTarEntries(tr, stage, opts, budget)
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, path := range extracted {
+		indexFile(path)
+	}
+	return nil
+}
+
+// extractTarEntries распаковывает выбранные записи tar-потока в папку stage
+func extractTarEntries(tr *tar.Reader, stage string, opts ExtractOptions, budget *extractBudget) error {
+	selected := 0
+	dirs := &dirTimes{}
+
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if header.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+		// Запись "./" (корень архива) соответствует самой папке назначения
+		if header.Typeflag == tar.TypeDir && filepath.Clean(header.Name) == "." {
+			continue
+		}
+
+		if !matchEntry(header.Name, opts.Patterns) {
+			continue
+		}
+		selected++
+
+		// Лимиты количества записей и глубины вложенности
+		if err := budget.checkEntry(header.Name); err != nil {
+			return err
+		}
+
+		// Защита от path traversal внутри архива
+		fpath, err := safeJoin(stage, header.Name)
+		if err != nil {
+			return err
+		}
+		if err := checkNoSymlinkParents(stage, fpath); err != nil {
+			return err
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(fpath, 0755); err != nil {
+				return err
+			}
+			if err := restoreMetadata(fpath, os.FileMode(header.Mode), true, header.ModTime); err != nil {
+				return err
+			}
+			dirs.add(fpath, header.ModTime)
+
+		case tar.TypeReg, tar.TypeRegA:
+			if _, err := budget.writeEntry(fpath, tr, safePerm(os.FileMode(header.Mode), false)); err != nil {
+				return err
+			}
+			if err := restoreMetadata(fpath, os.FileMode(header.Mode), false, header.ModTime); err != nil {
+				return err
+			}
+
+		case tar.TypeSymlink:
+			if err := checkSymlinkTarget(header.Name, header.Linkname); err != nil {
+				return err
+			}
+			if err := os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
+				return err
+			}
+			if err := os.Symlink(header.Linkname, fpath); err != nil {
+				return err
+			}
+
+		case tar.TypeLink:
+			// Жёсткая ссылка копируется как обычный файл, чтобы не связывать inode
+			target, err := safeJoin(stage, header.Linkname)
+			if err != nil {
+				return fmt.Errorf("жёсткая ссылка %s указывает за пределы папки назначения", header.Name)
+			}
+			if err := checkNoSymlinkParents(stage, target); err != nil {
+				return err
+			}
+			targetInfo, err := os.Lstat(target)
+			if err != nil || !targetInfo.Mode().IsRegular() {
+				return fmt.Errorf("жёсткая ссылка %s указывает на отсутствующий файл %s", header.Name, header.Linkname)
+			}
+			linked, err := os.Open(target)
+			if err != nil {
+				return err
+			}
+			_, err = budget.writeEntry(fpath, linked, targetInfo.Mode().Perm())
+			linked.Close()
+			if err != nil {
+				return err
+			}
+			if err := restoreMetadata(fpath, targetInfo.Mode(), false, header.ModTime); err != nil {
+				return err
+			}
+
+		default:
+			// Устройства, FIFO и прочие специальные файлы запрещены
+			return fmt.Errorf("недопустимый тип записи в архиве: %s", header.Name)
+		}
+	}
+
+	if selected == 0 && len(opts.Patterns) > 0 {
+		return errors.New("ни одна запись архива не соответствует шаблонам")
+	}
+	dirs.apply()
+	return nil
+}
+
+// openTarStream открывает tar-поток, автоматически распознавая сжатие gzip по сигнатуре
+func openTarStream(file *os.File) (*tar.Reader, func(), error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	br := bufio.NewReader(file)
+	magic, _ := br.Peek(2)
+	if len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, nil, err
+		}
+		rr := &ratioReader{r: gz, compressedSize: info.Size()}
+		return tar.NewReader(rr), func() { gz.Close() }, nil
+	}
+	return tar.NewReader(br), func() {}, nil
+}
+
+// writeFileLimited создаёт файл и записывает в него не более limit байт
+func writeFileLimited(fpath string, r io.Reader, limit int64, perm os.FileMode) (int64, error) {
+	if perm == 0 {
+		perm = 0644
+	}
+	out, err := os.OpenFile(fpath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return 0, err
+	}
+	n, err := copyLimited(out, r, limit)
+	closeErr := out.Close()
+	if err != nil {
+		os.Remove(fpath)
+		return n, err
+	}
+	return n, closeErr
+}
+
+// checkSymlinkTarget разрешает только относительные ссылки, не поднимающиеся выше своей папки
+// Ссылки с ".." могут выйти за пределы назначения через цепочку других ссылок
+func checkSymlinkTarget(name, target string) error {
+	if target == "" || filepath.IsAbs(target) || strings.HasPrefix(target, "/") || strings.HasPrefix(target, "\\") {
+		return fmt.Errorf("недопустимая символическая ссылка %s -> %s", name, target)
+	}
+	for _, part := range strings.FieldsFunc(target, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if part == ".." {
+			return fmt.Errorf("недопустимая символическая ссылка %s -> %s", name, target)
+		}
+	}
+	return nil
+}
+
+// checkNoSymlinkParents проверяет, что ни один компонент пути между dest и fpath
+// не является символической ссылкой (запись через ссылку может выйти за пределы dest)
+func checkNoSymlinkParents(dest, fpath string) error {
+	rel, err := filepath.Rel(dest, fpath)
+	if err != nil {
+		return err
+	}
+	current := dest
+	for _, part := range strings.Split(rel, string(os.PathSeparator)) {
+		current = filepath.Join(current, part)
+		info, err := os.Lstat(current)
+		if err != nil {
+			// Компонент ещё не существует — дальше проверять нечего
+			return nil
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			shown, _ := filepath.Rel(dest, current)
+			return fmt.Errorf("запись через символическую ссылку запрещена: %s", filepath.ToSlash(shown))
+		}
+	}
+	return nil
+}
+
+// Gzip сжимает одиночный файл в формат gzip
+func Gzip(source, target string) error {
+	safeSource, err := ResolvePath(source)
+	if err != nil {
+		return err
+	}
+	safeTarget, err := ResolvePath(target)
+	if err != nil {
+		return err
+	}
+
+	info, err := os.Stat(safeSource)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return errors.New("gzip сжимает только одиночные файлы (для папок используйте .tar.gz)")
+	}
+
+	in, err := os.Open(safeSource)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(safeTarget)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	gz := gzip.NewWriter(out)
+	gz.Name = info.Name()
+	gz.ModTime = info.ModTime()
+	if _, err := io.Copy(gz, in); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// Gunzip распаковывает одиночный gzip-файл в target с защитой от бомб
+func Gunzip(src, target string) error {
+	safeSrc, err := ResolvePath(src)
+	if err != nil {
+		return err
+	}
+	safeTarget, err := ResolvePath(target)
+	if err != nil {
+		return err
+	}
+
+	if err := gunzipTo(safeSrc, safeTarget); err != nil {
+		return err
+	}
+	indexFile(safeTarget)
+	return nil
+}
+
+// gunzipStaged распаковывает gzip-файл в папку dest под именем name
+// через временную папку, применяя политику перезаписи
+func gunzipStaged(src, dest, name string, policy OverwritePolicy) error {
+	safeSrc, err := ResolvePath(src)
+	if err != nil {
+		return err
+	}
+	safeDest, err := ResolvePath(dest)
+	if err != nil {
+		return err
+	}
+
+	extracted, err := extractStaged(safeDest, policy, func(stage string) error {
+		fpath, err := safeJoin(stage, name)
+		if err != nil {
+			return err
+		}
+		return gunzipTo(safeSrc, fpath)
+	})
+	if err != nil {
+		return err
+	}
+	for _, path := range extracted {
+		indexFile(path)
+	}
+	return nil
+}
+
+// gunzipTo распаковывает gzip-поток в файл, проверяя размер и степень сжатия
+func gunzipTo(safeSrc, safeTarget string) error {
+	in, err := os.Open(safeSrc)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	gz, err := gzip.NewReader(in)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	if err := os.MkdirAll(filepath.Dir(safeTarget), 0755); err != nil {
+		return err
+	}
+	rr := &ratioReader{r: gz, compressedSize: info.Size()}
+	_, err = writeFileLimited(safeTarget, rr, archiveLimits.MaxSize, 0644)
+	return err
+}
@@ -0,0 +1,308 @@
+package fs
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Построчное сравнение текстовых файлов алгоритмом Майерса (вариант с
+// линейной памятью: поиск средней «змейки» и рекурсия по половинам) и вывод
+// в формате unified diff
+
+const (
+	DefaultDiffContext = 3   // Строк контекста вокруг изменений по умолчанию
+	MaxDiffContext     = 100 // Максимальный контекст
+
+	// maxDiffCost — предел шагов поиска; если файлы различаются слишком сильно,
+	// оставшиеся фрагменты считаются заменёнными целиком (diff остаётся
+	// корректным, но не минимальным)
+	maxDiffCost = 50000000
+)
+
+// Операции редакционного предписания (префиксы строк unified diff)
+const (
+	editEqual  = ' '
+	editDelete = '-'
+	editInsert = '+'
+)
+
+// noNewlineMarker — пометка unified diff о строке без перевода строки в конце файла
+const noNewlineMarker = `\ No newline at end of file`
+
+// lineEdit — операция над строкой; a и b — номера строк (с 0) первого и
+// второго текста в момент операции
+type lineEdit struct {
+	op   byte
+	a, b int
+}
+
+// splitLines разбивает текст на строки, сохраняя переводы строк: последняя
+// строка без "\n" отличается от той же строки с ним
+func splitLines(text string) []string {
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// isBinaryText — нулевой байт означает двоичные данные, которые не сравниваются построчно
+func isBinaryText(text string) bool {
+	return strings.IndexByte(text, 0) >= 0
+}
+
+// lineDiff строит кратчайшее редакционное предписание; строки заменены
+// номерами, чтобы сравнение не зависело от длины строк
+type lineDiff struct {
+	edits []lineEdit
+	a, b  int // текущие номера строк первого и второго текста
+	cost  int // оставшийся запас шагов
+}
+
+func diffLines(a, b []string) []lineEdit {
+	ids := make(map[string]int)
+	intern := func(lines []string) []int {
+		out := make([]int, len(lines))
+		for i, l := range lines {
+			id, ok := ids[l]
+			if !ok {
+				id = len(ids)
+				ids[l] = id
+			}
+			out[i] = id
+		}
+		return out
+	}
+	d := &lineDiff{cost: maxDiffCost}
+	d.diff(intern(a), intern(b))
+	return d.edits
+}
+
+func (d *lineDiff) emit(op byte, n int) {
+	for ; n > 0; n-- {
+		d.edits = append(d.edits, lineEdit{op: op, a: d.a, b: d.b})
+		if op != editInsert {
+			d.a++
+		}
+		if op != editDelete {
+			d.b++
+		}
+	}
+}
+
+func (d *lineDiff) diff(a, b []int) {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	d.emit(editEqual, prefix)
+	a, b = a[prefix:], b[prefix:]
+	suffix := 0
+	for suffix < len(a) && suffix < len(b) && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	a, b = a[:len(a)-suffix], b[:len(b)-suffix]
+
+	switch {
+	case len(a) == 0:
+		d.emit(editInsert, len(b))
+	case len(b) == 0:
+		d.emit(editDelete, len(a))
+	default:
+		if x, y, ok := d.bisect(a, b); ok {
+			d.diff(a[:x], b[:y])
+			d.diff(a[x:], b[y:])
+		} else {
+			d.emit(editDelete, len(a))
+			d.emit(editInsert, len(b))
+		}
+	}
+	d.emit(editEqual, suffix)
+}
+
+// bisect ищет точку, через которую проходит кратчайший путь редактирования,
+// встречными проходами от начала и от конца. ok == false — запас шагов исчерпан
+func (d *lineDiff) bisect(a, b []int) (x, y int, ok bool) {
+	n, m := len(a), len(b)
+	maxD := (n + m + 1) / 2
+	offset := maxD
+	size := 2*maxD + 2
+	forward := make([]int, size)  // forward[offset+k] — дальний x на диагонали k
+	backward := make([]int, size) // то же для прохода с конца
+	for i := range forward {
+		forward[i], backward[i] = -1, -1
+	}
+	forward[offset+1], backward[offset+1] = 0, 0
+	delta := n - m
+	front := delta%2 != 0 // при нечётной разности пути встречаются в прямом проходе
+
+	k1start, k1end, k2start, k2end := 0, 0, 0, 0
+	for step := 0; step < maxD; step++ {
+		if d.cost -= 2*step + 1; d.cost < 0 {
+			return 0, 0, false
+		}
+		for k1 := -step + k1start; k1 <= step-k1end; k1 += 2 {
+			i := offset + k1
+			var x1 int
+			if k1 == -step || (k1 != step && forward[i-1] < forward[i+1]) {
+				x1 = forward[i+1]
+			} else {
+				x1 = forward[i-1] + 1
+			}
+			y1 := x1 - k1
+			for x1 < n && y1 < m && a[x1] == b[y1] {
+				x1++
+				y1++
+			}
+			forward[i] = x1
+			switch {
+			case x1 > n:
+				k1end += 2
+			case y1 > m:
+				k1start += 2
+			case front:
+				j := offset + delta - k1
+				if j >= 0 && j < size && backward[j] != -1 && x1 >= n-backward[j] {
+					return x1, y1, true
+				}
+			}
+		}
+		for k2 := -step + k2start; k2 <= step-k2end; k2 += 2 {
+			i := offset + k2
+			var x2 int
+			if k2 == -step || (k2 != step && backward[i-1] < backward[i+1]) {
+				x2 = backward[i+1]
+			} else {
+				x2 = backward[i-1] + 1
+			}
+			y2 := x2 - k2
+			for x2 < n && y2 < m && a[n-x2-1] == b[m-y2-1] {
+				x2++
+				y2++
+			}
+			backward[i] = x2
+			switch {
+			case x2 > n:
+				k2end += 2
+			case y2 > m:
+				k2start += 2
+			case !front:
+				j := offset + delta - k2
+				if j >= 0 && j < size && forward[j] != -1 {
+					x1 := forward[j]
+					if x1 >= n-x2 {
+						return x1, offset + x1 - j, true
+					}
+				}
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// DiffText сравнивает два текста и возвращает unified diff с context строками
+// контекста (приводится к диапазону 0..MaxDiffContext); пустая строка — тексты совпадают
+func DiffText(nameA, nameB, a, b string, context int) string {
+	context = max(0, min(context, MaxDiffContext))
+	linesA, linesB := splitLines(a), splitLines(b)
+	edits := diffLines(linesA, linesB)
+
+	var out strings.Builder
+	for start := 0; start < len(edits); {
+		// Начало следующего изменения
+		for start < len(edits) && edits[start].op == editEqual {
+			start++
+		}
+		if start == len(edits) {
+			break
+		}
+		// Изменения, разделённые не более чем 2*context общими строками, идут в один блок
+		end := start
+		for i := start; i < len(edits); i++ {
+			if edits[i].op != editEqual {
+				end = i + 1
+			} else if i-end >= 2*context {
+				break
+			}
+		}
+		from, to := max(start-context, 0), min(end+context, len(edits))
+		if out.Len() == 0 {
+			fmt.Fprintf(&out, "--- %s\n+++ %s\n", nameA, nameB)
+		}
+		writeHunk(&out, edits[from:to], linesA, linesB)
+		start = to
+	}
+	return out.String()
+}
+
+func writeHunk(out *strings.Builder, edits []lineEdit, linesA, linesB []string) {
+	countA, countB := 0, 0
+	for _, e := range edits {
+		if e.op != editInsert {
+			countA++
+		}
+		if e.op != editDelete {
+			countB++
+		}
+	}
+	fmt.Fprintf(out, "@@ -%s +%s @@\n", hunkRange(edits[0].a, countA), hunkRange(edits[0].b, countB))
+	for _, e := range edits {
+		var line string
+		if e.op == editInsert {
+			line = linesB[e.b]
+		} else {
+			line = linesA[e.a]
+		}
+		out.WriteByte(e.op)
+		out.WriteString(line)
+		if !strings.HasSuffix(line, "\n") {
+			out.WriteString("\n" + noNewlineMarker + "\n")
+		}
+	}
+}
+
+// hunkRange записывает диапазон строк блока: пустой диапазон указывает на
+// строку перед ним, длина 1 не пишется
+func hunkRange(start, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", start)
+	case 1:
+		return fmt.Sprint(start + 1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// UnifiedDiff сравнивает два текстовых файла sandbox. Пути в заголовках
+// указаны относительно корня sandbox с префиксами a/ и b/, поэтому результат
+// можно применить через ApplyPatch
+func UnifiedDiff(pathA, pathB string, context int) (string, error) {
+	if context < 0 || context > MaxDiffContext {
+		return "", fmt.Errorf("контекст должен быть от 0 до %d строк", MaxDiffContext)
+	}
+	a, nameA, err := readTextForDiff(pathA)
+	if err != nil {
+		return "", err
+	}
+	b, nameB, err := readTextForDiff(pathB)
+	if err != nil {
+		return "", err
+	}
+	return DiffText("a/"+nameA, "b/"+nameB, a, b, context), nil
+}
+
+func readTextForDiff(path string) (content, name string, err error) {
+	safePath, err := ResolvePath(path)
+	if err != nil {
+		return "", "", err
+	}
+	content, err = readStructuredFile(safePath)
+	if err != nil {
+		return "", "", err
+	}
+	if isBinaryText(content) {
+		return "", "", errors.New(relPath(safePath) + ": двоичный файл не сравнивается построчно")
+	}
+	return content, relPath(safePath), nil
+}
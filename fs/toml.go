@@ -0,0 +1,674 @@
+package fs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// TOML 1.0: таблицы [a.b], массивы таблиц [[a]], составные и строковые ключи,
+// все виды строк, целые (включая 0x/0o/0b), дробные, логические значения,
+// многострочные массивы и встроенные таблицы. В общей модели нет типа даты,
+// поэтому даты и время читаются как строки
+
+var (
+	tomlBareKey  = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+	tomlDateTime = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2}([Tt ]\d{2}:\d{2}(:\d{2}(\.\d+)?)?([Zz]|[+-]\d{2}:\d{2})?)?|\d{2}:\d{2}(:\d{2}(\.\d+)?)?)$`)
+	tomlDecimal  = regexp.MustCompile(`^[+-]?(0|[1-9](_?[0-9])*)$`)
+	tomlFloat    = regexp.MustCompile(`^[+-]?(0|[1-9](_?[0-9])*)(\.[0-9](_?[0-9])*)?([eE][+-]?[0-9](_?[0-9])*)?$`)
+)
+
+type tomlParser struct {
+	s      string
+	i      int
+	losses *lossSet
+	// explicit — таблицы, уже объявленные заголовком [a.b]; arrays — массивы
+	// таблиц [[a]]; inline — встроенные таблицы, которые нельзя дополнять.
+	// Пути таблиц внутри массива таблиц включают номер элемента
+	explicit map[string]bool
+	arrays   map[string]bool
+	inline   map[*orderedObject]bool
+}
+
+// decodeTOML разбирает TOML документ в общую модель данных
+func decodeTOML(content string) (interface{}, []string, error) {
+	p := &tomlParser{
+		s:        strings.TrimPrefix(content, "\ufeff"),
+		losses:   &lossSet{},
+		explicit: make(map[string]bool),
+		arrays:   make(map[string]bool),
+		inline:   make(map[*orderedObject]bool),
+	}
+	root := newOrderedObject()
+	current, currentPath := root, ""
+	for {
+		p.skipBlank(true)
+		if p.i >= len(p.s) {
+			return root, p.losses.losses, nil
+		}
+		var err error
+		if p.s[p.i] == '[' {
+			current, currentPath, err = p.parseHeader(root)
+		} else {
+			err = p.parseKeyValue(current, currentPath)
+		}
+		if err == nil {
+			err = p.endOfLine()
+		}
+		if err != nil {
+			return nil, nil, p.wrap(err)
+		}
+	}
+}
+
+// wrap добавляет к ошибке строку и столбец текущей позиции
+func (p *tomlParser) wrap(err error) error {
+	var parseErr *ParseError
+	if errors.As(err, &parseErr) {
+		return err
+	}
+	pos := p.i
+	if pos > len(p.s) {
+		pos = len(p.s)
+	}
+	line := strings.Count(p.s[:pos], "\n") + 1
+	col := utf8.RuneCountInString(p.s[strings.LastIndex(p.s[:pos], "\n")+1:pos]) + 1
+	return &ParseError{Line: line, Column: col, Err: err}
+}
+
+// skipBlank пропускает пробелы и комментарии, а при newlines — и переводы строк
+func (p *tomlParser) skipBlank(newlines bool) {
+	for p.i < len(p.s) {
+		switch c := p.s[p.i]; {
+		case c == ' ' || c == '\t':
+			p.i++
+		case c == '#':
+			for p.i < len(p.s) && p.s[p.i] != '\n' {
+				p.i++
+			}
+		case newlines && (c == '\n' || c == '\r'):
+			p.i++
+		default:
+			return
+		}
+	}
+}
+
+// endOfLine проверяет, что после выражения нет ничего, кроме комментария
+func (p *tomlParser) endOfLine() error {
+	p.skipBlank(false)
+	if p.i < len(p.s) && p.s[p.i] != '\n' && !strings.HasPrefix(p.s[p.i:], "\r\n") {
+		return fmt.Errorf("ожидался конец строки, получено %q", p.s[p.i])
+	}
+	return nil
+}
+
+// parseHeader разбирает заголовок [table] или [[array]] и возвращает таблицу,
+// в которую попадут следующие пары ключ-значение
+func (p *tomlParser) parseHeader(root *orderedObject) (*orderedObject, string, error) {
+	isArray := strings.HasPrefix(p.s[p.i:], "[[")
+	if isArray {
+		p.i += 2
+	} else {
+		p.i++
+	}
+	p.skipBlank(false)
+	keys, err := p.parseKey()
+	if err != nil {
+		return nil, "", err
+	}
+	closing := "]"
+	if isArray {
+		closing = "]]"
+	}
+	p.skipBlank(false)
+	if !strings.HasPrefix(p.s[p.i:], closing) {
+		return nil, "", fmt.Errorf("заголовок таблицы должен заканчиваться %q", closing)
+	}
+	p.i += len(closing)
+
+	table, path, err := p.descend(root, "", keys[:len(keys)-1])
+	if err != nil {
+		return nil, "", err
+	}
+	last := keys[len(keys)-1]
+	path = appendPointer(path, last)
+	existing, present := table.get(last)
+
+	if isArray {
+		if !present {
+			p.arrays[path] = true
+			existing = []interface{}{}
+		} else if !p.arrays[path] {
+			return nil, "", fmt.Errorf("ключ %q уже определён и не является массивом таблиц", strings.Join(keys, "."))
+		}
+		items := existing.([]interface{})
+		obj := newOrderedObject()
+		table.set(last, append(items, obj))
+		return obj, fmt.Sprintf("%s/%d", path, len(items)), nil
+	}
+
+	if p.explicit[path] {
+		return nil, "", fmt.Errorf("таблица [%s] объявлена повторно", strings.Join(keys, "."))
+	}
+	p.explicit[path] = true
+	if !present {
+		obj := newOrderedObject()
+		table.set(last, obj)
+		return obj, path, nil
+	}
+	obj, ok := existing.(*orderedObject)
+	if !ok || p.inline[obj] {
+		return nil, "", fmt.Errorf("ключ %q уже определён и не является таблицей", strings.Join(keys, "."))
+	}
+	return obj, path, nil
+}
+
+// descend проходит по ключам от table, создавая недостающие таблицы; в массиве
+// таблиц выбирается последний элемент
+func (p *tomlParser) descend(table *orderedObject, path string, keys []string) (*orderedObject, string, error) {
+	for _, k := range keys {
+		path = appendPointer(path, k)
+		value, present := table.get(k)
+		switch t := value.(type) {
+		case *orderedObject:
+			if p.inline[t] {
+				return nil, "", fmt.Errorf("встроенную таблицу %q нельзя дополнять", k)
+			}
+			table = t
+		case []interface{}:
+			if !p.arrays[path] || len(t) == 0 {
+				return nil, "", fmt.Errorf("ключ %q — массив значений, а не таблица", k)
+			}
+			path = fmt.Sprintf("%s/%d", path, len(t)-1)
+			table = t[len(t)-1].(*orderedObject)
+		default:
+			if present {
+				return nil, "", fmt.Errorf("ключ %q уже содержит значение", k)
+			}
+			obj := newOrderedObject()
+			table.set(k, obj)
+			table = obj
+		}
+	}
+	return table, path, nil
+}
+
+// parseKeyValue разбирает пару «ключ = значение» в таблицу table
+func (p *tomlParser) parseKeyValue(table *orderedObject, path string) error {
+	keys, err := p.parseKey()
+	if err != nil {
+		return err
+	}
+	p.skipBlank(false)
+	if p.i >= len(p.s) || p.s[p.i] != '=' {
+		return errors.New("после ключа ожидался знак «=»")
+	}
+	p.i++
+	p.skipBlank(false)
+	value, err := p.parseValue(0)
+	if err != nil {
+		return err
+	}
+	table, _, err = p.descend(table, path, keys[:len(keys)-1])
+	if err != nil {
+		return err
+	}
+	last := keys[len(keys)-1]
+	if _, dup := table.get(last); dup {
+		return fmt.Errorf("ключ %q повторяется", strings.Join(keys, "."))
+	}
+	table.set(last, value)
+	return nil
+}
+
+// parseKey разбирает составной ключ a."b c".d
+func (p *tomlParser) parseKey() ([]string, error) {
+	var keys []string
+	for {
+		p.skipBlank(false)
+		if p.i >= len(p.s) {
+			return nil, errors.New("ожидался ключ")
+		}
+		var key string
+		switch p.s[p.i] {
+		case '"', '\'':
+			if strings.HasPrefix(p.s[p.i:], `"""`) || strings.HasPrefix(p.s[p.i:], "'''") {
+				return nil, errors.New("многострочная строка не может быть ключом")
+			}
+			s, err := p.parseString()
+			if err != nil {
+				return nil, err
+			}
+			key = s
+		default:
+			start := p.i
+			for p.i < len(p.s) && tomlBareKey.MatchString(p.s[p.i:p.i+1]) {
+				p.i++
+			}
+			if start == p.i {
+				return nil, fmt.Errorf("недопустимый символ в ключе: %q", p.s[p.i])
+			}
+			key = p.s[start:p.i]
+		}
+		keys = append(keys, key)
+		if len(keys) > maxDataDepth {
+			return nil, fmt.Errorf("превышена максимальная вложенность (%d)", maxDataDepth)
+		}
+		p.skipBlank(false)
+		if p.i >= len(p.s) || p.s[p.i] != '.' {
+			return keys, nil
+		}
+		p.i++
+	}
+}
+
+// parseValue разбирает значение: строку, число, логическое значение, дату,
+// массив или встроенную таблицу
+func (p *tomlParser) parseValue(depth int) (interface{}, error) {
+	if depth > maxDataDepth {
+		return nil, fmt.Errorf("превышена максимальная вложенность (%d)", maxDataDepth)
+	}
+	if p.i >= len(p.s) {
+		return nil, errors.New("ожидалось значение")
+	}
+	switch c := p.s[p.i]; {
+	case c == '"' || c == '\'':
+		return p.parseString()
+	case c == '[':
+		return p.parseArray(depth)
+	case c == '{':
+		return p.parseInlineTable(depth)
+	case strings.HasPrefix(p.s[p.i:], "true"):
+		p.i += 4
+		return true, nil
+	case strings.HasPrefix(p.s[p.i:], "false"):
+		p.i += 5
+		return false, nil
+	}
+
+	start := p.i
+	for p.i < len(p.s) && strings.ContainsRune("0123456789abcdefABCDEFxoinTtZz_+-.:", rune(p.s[p.i])) {
+		p.i++
+	}
+	// Дата и время могут быть разделены пробелом: 1979-05-27 07:32:00
+	if p.i-start == 10 && p.i+1 < len(p.s) && p.s[p.i] == ' ' && p.s[p.i+1] >= '0' && p.s[p.i+1] <= '9' {
+		p.i++
+		for p.i < len(p.s) && strings.ContainsRune("0123456789Zz+-.:", rune(p.s[p.i])) {
+			p.i++
+		}
+	}
+	token := p.s[start:p.i]
+	if token == "" {
+		return nil, fmt.Errorf("неожиданный символ %q", p.s[p.i])
+	}
+	value, err := p.tomlScalar(token)
+	if err != nil {
+		p.i = start
+	}
+	return value, err
+}
+
+// tomlScalar определяет тип числа, даты или специального значения
+func (p *tomlParser) tomlScalar(token string) (interface{}, error) {
+	switch {
+	case tomlDateTime.MatchString(token):
+		p.losses.add("даты и время TOML сохранены как строки")
+		return token, nil
+	case strings.TrimLeft(token, "+-") == "inf" || strings.TrimLeft(token, "+-") == "nan":
+		p.losses.add("значения inf и nan не представимы в JSON и сохранены как строки")
+		return token, nil
+	case len(token) > 2 && token[0] == '0' && strings.ContainsRune("xob", rune(token[1])):
+		base := map[byte]int{'x': 16, 'o': 8, 'b': 2}[token[1]]
+		digits := token[2:]
+		if strings.HasPrefix(digits, "_") || strings.HasSuffix(digits, "_") || strings.Contains(digits, "__") {
+			return nil, fmt.Errorf("неверное число %q", token)
+		}
+		n, err := strconv.ParseUint(strings.ReplaceAll(digits, "_", ""), base, 64)
+		if err != nil {
+			return nil, fmt.Errorf("неверное число %q", token)
+		}
+		return json.Number(strconv.FormatUint(n, 10)), nil
+	case tomlDecimal.MatchString(token), tomlFloat.MatchString(token):
+		number := strings.TrimPrefix(strings.ReplaceAll(token, "_", ""), "+")
+		if !json.Valid([]byte(number)) {
+			return nil, fmt.Errorf("неверное число %q", token)
+		}
+		return json.Number(number), nil
+	}
+	return nil, fmt.Errorf("неверное значение %q", token)
+}
+
+// parseArray разбирает массив; допускаются переводы строк, комментарии и
+// завершающая запятая
+func (p *tomlParser) parseArray(depth int) (interface{}, error) {
+	p.i++
+	items := []interface{}{}
+	for {
+		p.skipBlank(true)
+		if p.i < len(p.s) && p.s[p.i] == ']' {
+			p.i++
+			return items, nil
+		}
+		item, err := p.parseValue(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+		p.skipBlank(true)
+		if p.i < len(p.s) && p.s[p.i] == ',' {
+			p.i++
+			continue
+		}
+		if p.i >= len(p.s) || p.s[p.i] != ']' {
+			return nil, errors.New("ожидалась «,» или «]» в массиве")
+		}
+	}
+}
+
+// parseInlineTable разбирает встроенную таблицу { a = 1, b.c = 2 } в одну строку
+func (p *tomlParser) parseInlineTable(depth int) (interface{}, error) {
+	p.i++
+	obj := newOrderedObject()
+	p.inline[obj] = true
+	p.skipBlank(false)
+	if p.i < len(p.s) && p.s[p.i] == '}' {
+		p.i++
+		return obj, nil
+	}
+	for {
+		keys, err := p.parseKey()
+		if err != nil {
+			return nil, err
+		}
+		p.skipBlank(false)
+		if p.i >= len(p.s) || p.s[p.i] != '=' {
+			return nil, errors.New("после ключа ожидался знак «=»")
+		}
+		p.i++
+		p.skipBlank(false)
+		value, err := p.parseValue(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		table := obj
+		for _, k := range keys[:len(keys)-1] {
+			next, present := table.get(k)
+			sub, isTable := next.(*orderedObject)
+			if !present {
+				sub, isTable = newOrderedObject(), true
+				table.set(k, sub)
+			}
+			if !isTable {
+				return nil, fmt.Errorf("ключ %q уже содержит значение", k)
+			}
+			table = sub
+		}
+		last := keys[len(keys)-1]
+		if _, dup := table.get(last); dup {
+			return nil, fmt.Errorf("ключ %q повторяется", strings.Join(keys, "."))
+		}
+		table.set(last, value)
+
+		p.skipBlank(false)
+		if p.i < len(p.s) && p.s[p.i] == '}' {
+			p.i++
+			return obj, nil
+		}
+		if p.i >= len(p.s) || p.s[p.i] != ',' {
+			return nil, errors.New("ожидалась «,» или «}» во встроенной таблице")
+		}
+		p.i++
+	}
+}
+
+// parseString разбирает базовую "..." или литеральную '...' строку, в том числе многострочную
+func (p *tomlParser) parseString() (string, error) {
+	quote := p.s[p.i]
+	multiline := strings.HasPrefix(p.s[p.i:], strings.Repeat(string(quote), 3))
+	if multiline {
+		p.i += 3
+		// Перевод строки сразу после открывающих кавычек не входит в строку
+		if strings.HasPrefix(p.s[p.i:], "\r\n") {
+			p.i += 2
+		} else if p.i < len(p.s) && p.s[p.i] == '\n' {
+			p.i++
+		}
+	} else {
+		p.i++
+	}
+
+	var b strings.Builder
+	for p.i < len(p.s) {
+		c := p.s[p.i]
+		switch {
+		case multiline && strings.HasPrefix(p.s[p.i:], strings.Repeat(string(quote), 3)):
+			p.i += 3
+			// До двух кавычек сразу перед закрывающими входят в строку: """a"""""
+			for extra := 0; extra < 2 && p.i < len(p.s) && p.s[p.i] == quote; extra++ {
+				b.WriteByte(quote)
+				p.i++
+			}
+			return b.String(), nil
+		case !multiline && c == quote:
+			p.i++
+			return b.String(), nil
+		case c == '\n' && !multiline:
+			return "", errors.New("строка не закрыта до конца строки")
+		case c == '\\' && quote == '"':
+			if err := p.unescape(&b, multiline); err != nil {
+				return "", err
+			}
+		case c < 0x20 && c != '\t' && c != '\n' && c != '\r' || c == 0x7f:
+			return "", fmt.Errorf("управляющий символ 0x%02x в строке", c)
+		default:
+			b.WriteByte(c)
+			p.i++
+		}
+	}
+	return "", errors.New("строка не закрыта")
+}
+
+// unescape декодирует escape-последовательность базовой строки
+func (p *tomlParser) unescape(b *strings.Builder, multiline bool) error {
+	p.i++
+	if p.i >= len(p.s) {
+		return errors.New("незавершённая escape-последовательность")
+	}
+	c := p.s[p.i]
+	if multiline && (c == ' ' || c == '\t' || c == '\n' || c == '\r') {
+		// «\» в конце строки убирает перевод строки и пробелы в начале следующей
+		rest := strings.TrimLeft(p.s[p.i:], " \t")
+		if !strings.HasPrefix(rest, "\n") && !strings.HasPrefix(rest, "\r\n") {
+			return errors.New("после «\\» в конце строки допустимы только пробелы")
+		}
+		p.i = len(p.s) - len(strings.TrimLeft(rest, " \t\r\n"))
+		return nil
+	}
+	simple := map[byte]byte{'b': '\b', 't': '\t', 'n': '\n', 'f': '\f', 'r': '\r', 'e': 0x1b, '"': '"', '\\': '\\'}
+	if r, ok := simple[c]; ok {
+		b.WriteByte(r)
+		p.i++
+		return nil
+	}
+	width := map[byte]int{'u': 4, 'U': 8}[c]
+	if width == 0 || p.i+1+width > len(p.s) {
+		return fmt.Errorf("неверная escape-последовательность \\%c", c)
+	}
+	code, err := strconv.ParseUint(p.s[p.i+1:p.i+1+width], 16, 32)
+	if err != nil || !utf8.ValidRune(rune(code)) {
+		return fmt.Errorf("неверная escape-последовательность \\%s", p.s[p.i:p.i+1+width])
+	}
+	b.WriteRune(rune(code))
+	p.i += 1 + width
+	return nil
+}
+
+// encodeTOML записывает объект как TOML: сначала пары ключ-значение таблицы,
+// затем вложенные таблицы [a.b] и массивы таблиц [[a]]
+func encodeTOML(data interface{}) (string, []string, error) {
+	root, ok := data.(*orderedObject)
+	if !ok {
+		return "", nil, errors.New("корнем TOML документа может быть только объект")
+	}
+	losses := &lossSet{}
+	var b strings.Builder
+	if err := writeTOMLTable(&b, root, "", "", 0, losses); err != nil {
+		return "", nil, err
+	}
+	return strings.TrimPrefix(b.String(), "\n"), losses.losses, nil
+}
+
+// writeTOMLTable пишет содержимое таблицы; header — полное имя таблицы a.b
+func writeTOMLTable(b *strings.Builder, obj *orderedObject, header, pointer string, depth int, losses *lossSet) error {
+	if depth > maxDataDepth {
+		return fmt.Errorf("превышена максимальная вложенность (%d)", maxDataDepth)
+	}
+	for _, k := range obj.keys {
+		v := obj.values[k]
+		if v == nil {
+			losses.add("null не представим в TOML, ключ пропущен (%s)", appendPointer(pointer, k))
+			continue
+		}
+		if isTOMLSection(v) {
+			continue
+		}
+		value, err := tomlValue(v, appendPointer(pointer, k), depth+1, losses)
+		if err != nil {
+			return err
+		}
+		b.WriteString(tomlKey(k) + " = " + value + "\n")
+	}
+
+	for _, k := range obj.keys {
+		v := obj.values[k]
+		if !isTOMLSection(v) {
+			continue
+		}
+		name := tomlKey(k)
+		if header != "" {
+			name = header + "." + name
+		}
+		childPointer := appendPointer(pointer, k)
+		if sub, isObject := v.(*orderedObject); isObject {
+			b.WriteString("\n[" + name + "]\n")
+			if err := writeTOMLTable(b, sub, name, childPointer, depth+1, losses); err != nil {
+				return err
+			}
+			continue
+		}
+		for i, item := range v.([]interface{}) {
+			b.WriteString("\n[[" + name + "]]\n")
+			itemPointer := appendPointer(childPointer, strconv.Itoa(i))
+			if err := writeTOMLTable(b, item.(*orderedObject), name, itemPointer, depth+1, losses); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// isTOMLSection — значение записывается отдельной секцией: таблица или
+// непустой массив, все элементы которого — таблицы
+func isTOMLSection(v interface{}) bool {
+	switch t := v.(type) {
+	case *orderedObject:
+		return true
+	case []interface{}:
+		if len(t) == 0 {
+			return false
+		}
+		for _, item := range t {
+			if _, isObject := item.(*orderedObject); !isObject {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// tomlValue записывает значение в строку: скаляр, массив или встроенную таблицу
+func tomlValue(v interface{}, pointer string, depth int, losses *lossSet) (string, error) {
+	if depth > maxDataDepth {
+		return "", fmt.Errorf("превышена максимальная вложенность (%d)", maxDataDepth)
+	}
+	switch t := v.(type) {
+	case string:
+		return tomlString(t), nil
+	case bool, json.Number, float64:
+		return scalarText(t), nil
+	case []interface{}:
+		parts := make([]string, 0, len(t))
+		for i, item := range t {
+			if item == nil {
+				losses.add("null не представим в TOML, элемент массива пропущен (%s)", appendPointer(pointer, strconv.Itoa(i)))
+				continue
+			}
+			s, err := tomlValue(item, appendPointer(pointer, strconv.Itoa(i)), depth+1, losses)
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, s)
+		}
+		return "[" + strings.Join(parts, ", ") + "]", nil
+	case *orderedObject:
+		parts := make([]string, 0, len(t.keys))
+		for _, k := range t.keys {
+			if t.values[k] == nil {
+				losses.add("null не представим в TOML, ключ пропущен (%s)", appendPointer(pointer, k))
+				continue
+			}
+			s, err := tomlValue(t.values[k], appendPointer(pointer, k), depth+1, losses)
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, tomlKey(k)+" = "+s)
+		}
+		if len(parts) == 0 {
+			return "{}", nil
+		}
+		return "{ " + strings.Join(parts, ", ") + " }", nil
+	}
+	return "", fmt.Errorf("%s: тип %T не поддерживается", pointerLabel(pointer), v)
+}
+
+// tomlKey записывает ключ без кавычек, если он состоит из допустимых символов
+func tomlKey(k string) string {
+	if tomlBareKey.MatchString(k) {
+		return k
+	}
+	return tomlString(k)
+}
+
+// tomlString записывает базовую строку TOML с экранированием
+func tomlString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&b, `\u%04X`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
@@ -0,0 +1,275 @@
+package fs
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Статусы проверки записи архива
+const (
+	VerifyOK        = "ok"
+	VerifyCorrupt   = "corrupt"
+	VerifyTruncated = "truncated"
+	VerifyOversized = "oversized"
+	// VerifyEncrypted — запись зашифрована; без пароля её целостность не проверить
+	VerifyEncrypted = "encrypted"
+)
+
+// Итоговые статусы проверки архива (VerifyReport.Status)
+const (
+	// VerifyIncomplete — ошибок не найдено, но часть записей не проверена
+	VerifyIncomplete = "incomplete"
+	VerifyFailed     = "failed"
+)
+
+// EntryVerification — результат проверки одной записи архива
+type EntryVerification struct {
+	Name     string // имя записи
+	Declared int64  // размер из заголовка (-1 — неизвестен)
+	Actual   int64  // фактически прочитано байт
+	Status   string // VerifyOK, VerifyCorrupt, VerifyTruncated, VerifyOversized, VerifyEncrypted
+	Detail   string // описание проблемы
+}
+
+// VerifyReport — итог проверки целостности архива
+type VerifyReport struct {
+	Format      string              // формат архива
+	ArchiveSize int64               // размер файла архива
+	Entries     []EntryVerification // проверенные записи
+	Failed      int                 // количество записей с ошибками
+	Unverified  int                 // записи, содержимое которых не проверено (зашифрованы)
+	TotalSize   int64               // фактический распакованный размер
+	Problems    []string            // ошибки уровня архива (обрезанный поток, лимиты)
+}
+
+// OK сообщает, что архив полностью читается и укладывается в лимиты, а все
+// записи проверены
+func (r *VerifyReport) OK() bool {
+	return r.Status() == VerifyOK
+}
+
+// Status возвращает итог проверки: VerifyOK, VerifyIncomplete или VerifyFailed
+func (r *VerifyReport) Status() string {
+	switch {
+	case r.Failed > 0 || len(r.Problems) > 0:
+		return VerifyFailed
+	case r.Unverified > 0:
+		return VerifyIncomplete
+	}
+	return VerifyOK
+}
+
+// Summary возвращает краткое описание результата для журнала и метаданных
+func (r *VerifyReport) Summary() string {
+	switch r.Status() {
+	case VerifyOK:
+		return fmt.Sprintf("%d записей, %d байт — целостность подтверждена", len(r.Entries), r.TotalSize)
+	case VerifyIncomplete:
+		return fmt.Sprintf("проверка неполная: %d из %d записей зашифрованы и не проверены, в остальных ошибок нет",
+			r.Unverified, len(r.Entries))
+	}
+	return fmt.Sprintf("%d из %d записей повреждены, ошибок архива: %d", r.Failed, len(r.Entries), len(r.Problems))
+}
+
+// VerifyArchive потоково читает все записи архива, проверяя CRC32, заявленные
+// размеры и лимиты распаковки. На диск ничего не записывается
+func VerifyArchive(path string) (*VerifyReport, error) {
+	safePath, err := ResolvePath(path)
+	if err != nil {
+		return nil, err
+	}
+	format, err := DetectArchiveFormat(safePath)
+	if err != nil {
+		return nil, err
+	}
+
+	fileMutex.RLock()
+	defer fileMutex.RUnlock()
+
+	info, err := os.Stat(safePath)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &VerifyReport{Format: format, ArchiveSize: info.Size()}
+	switch format {
+	case FormatZip:
+		err = verifyZip(safePath, report)
+	case FormatTar, FormatTarGz:
+		err = verifyTar(safePath, report)
+	default:
+		err = verifyGzip(safePath, report)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, e := range report.Entries {
+		switch e.Status {
+		case VerifyOK:
+		case VerifyEncrypted:
+			report.Unverified++
+		default:
+			report.Failed++
+		}
+	}
+	return report, nil
+}
+
+// classifyReadError сопоставляет ошибку чтения со статусом проверки
+func classifyReadError(err error) (string, string) {
+	switch {
+	case errors.Is(err, zip.ErrChecksum), errors.Is(err, gzip.ErrChecksum):
+		return VerifyCorrupt, "контрольная сумма CRC32 не совпадает"
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return VerifyTruncated, "данные обрезаны"
+	case errors.Is(err, errTooLarge), errors.Is(err, errRatioTooHigh):
+		return VerifyOversized, err.Error()
+	default:
+		return VerifyCorrupt, err.Error()
+	}
+}
+
+// verifyZip проверяет каждую запись ZIP, в том числе CRC32 (проверяется zip.Reader при чтении)
+func verifyZip(safePath string, report *VerifyReport) error {
+	r, err := zip.OpenReader(safePath)
+	if err != nil {
+		return fmt.Errorf("архив повреждён: %v", err)
+	}
+	defer r.Close()
+
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		entry := EntryVerification{Name: f.Name, Declared: int64(f.UncompressedSize64), Status: VerifyOK}
+		if isEncryptedEntry(f) {
+			entry.Status, entry.Detail = VerifyEncrypted, "запись зашифрована, содержимое не проверялось"
+			report.Entries = append(report.Entries, entry)
+			continue
+		}
+
+		if report.TotalSize >= archiveLimits.MaxSize {
+			report.Problems = append(report.Problems, "превышен лимит размера распакованных данных, проверка остановлена")
+			break
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			entry.Status, entry.Detail = classifyReadError(err)
+			report.Entries = append(report.Entries, entry)
+			continue
+		}
+		entry.Actual, err = copyLimited(io.Discard, rc, archiveLimits.MaxSize-report.TotalSize)
+		rc.Close()
+		report.TotalSize += entry.Actual
+
+		if err != nil {
+			entry.Status, entry.Detail = classifyReadError(err)
+		} else if entry.Actual != entry.Declared {
+			entry.Status = VerifyCorrupt
+			entry.Detail = fmt.Sprintf("заявлено %d байт, фактически %d", entry.Declared, entry.Actual)
+		} else if problem := ratioProblem(entry.Actual, int64(f.CompressedSize64)); problem != "" {
+			entry.Status, entry.Detail = VerifyOversized, problem
+		}
+		report.Entries = append(report.Entries, entry)
+	}
+	return nil
+}
+
+// verifyTar проверяет заголовки TAR и, для TAR.GZ, CRC32 и длину gzip-потока
+func verifyTar(safePath string, report *VerifyReport) error {
+	file, err := os.Open(safePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	var stream io.Reader = bufio.NewReader(file)
+	if report.Format == FormatTarGz {
+		gz, err := gzip.NewReader(stream)
+		if err != nil {
+			return fmt.Errorf("архив повреждён: %v", err)
+		}
+		defer gz.Close()
+		stream = &ratioReader{r: gz, compressedSize: info.Size()}
+	}
+	tr := tar.NewReader(stream)
+
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			_, detail := classifyReadError(err)
+			report.Problems = append(report.Problems, "ошибка чтения заголовка: "+detail)
+			return nil
+		}
+		if header.Typeflag != tar.TypeReg && header.Typeflag != tar.TypeRegA {
+			continue
+		}
+
+		entry := EntryVerification{Name: header.Name, Declared: header.Size, Status: VerifyOK}
+		entry.Actual, err = copyLimited(io.Discard, tr, archiveLimits.MaxSize-report.TotalSize)
+		report.TotalSize += entry.Actual
+		if err != nil {
+			entry.Status, entry.Detail = classifyReadError(err)
+			report.Entries = append(report.Entries, entry)
+			// После ошибки потока дальнейшие записи прочитать нельзя
+			report.Problems = append(report.Problems, "проверка остановлена на "+header.Name)
+			return nil
+		}
+		report.Entries = append(report.Entries, entry)
+	}
+
+	// Дочитываем хвост gzip-потока: CRC32 и длина проверяются только в конце
+	if _, err := io.Copy(io.Discard, stream); err != nil {
+		_, detail := classifyReadError(err)
+		report.Problems = append(report.Problems, "gzip-поток: "+detail)
+	}
+	return nil
+}
+
+// verifyGzip распаковывает одиночный gzip-файл в пустоту, проверяя CRC32 и ISIZE
+func verifyGzip(safePath string, report *VerifyReport) error {
+	file, err := os.Open(safePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	gz, err := gzip.NewReader(bufio.NewReader(file))
+	if err != nil {
+		return fmt.Errorf("архив повреждён: %v", err)
+	}
+	defer gz.Close()
+
+	name := gz.Name
+	if name == "" {
+		name = info.Name()
+	}
+	entry := EntryVerification{Name: name, Declared: -1, Status: VerifyOK}
+	rr := &ratioReader{r: gz, compressedSize: info.Size()}
+	entry.Actual, err = copyLimited(io.Discard, rr, archiveLimits.MaxSize)
+	report.TotalSize = entry.Actual
+	if err != nil {
+		entry.Status, entry.Detail = classifyReadError(err)
+	}
+	report.Entries = append(report.Entries, entry)
+	return nil
+}
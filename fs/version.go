@@ -0,0 +1,103 @@
+package fs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Версии содержимого для оптимистичной блокировки: чтение возвращает версию
+// файла (хэш содержимого, как ETag в HTTP), а условная запись выполняется,
+// только если файл с тех пор не изменился. Так изменения, сделанные другим
+// пользователем между чтением и записью, не перезаписываются молча
+
+// ErrVersionConflict — файл изменён после чтения; проверяется через errors.Is
+var ErrVersionConflict = errors.New("конфликт версий файла")
+
+// VersionConflictError — версия файла не совпала с ожидаемой
+type VersionConflictError struct {
+	Path     string
+	Expected string // "" — файл не должен был существовать
+	Actual   string // "" — файл удалён
+}
+
+func (e *VersionConflictError) Error() string {
+	switch {
+	case e.Actual == "":
+		return fmt.Sprintf("файл %s удалён после чтения: запись отменена", e.Path)
+	case e.Expected == "":
+		return fmt.Sprintf("файл %s уже создан другим пользователем: запись отменена", e.Path)
+	}
+	return fmt.Sprintf("файл %s изменён другим пользователем после чтения (версия %s, ожидалась %s): запись отменена, перечитайте файл",
+		e.Path, shortVersion(e.Actual), shortVersion(e.Expected))
+}
+
+func (e *VersionConflictError) Is(target error) bool {
+	return target == ErrVersionConflict
+}
+
+// ContentVersion возвращает версию содержимого (SHA-256, 128 бит в hex)
+func ContentVersion(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:16])
+}
+
+func shortVersion(version string) string {
+	if len(version) > 8 {
+		return version[:8]
+	}
+	return version
+}
+
+// ReadFileVersion читает текстовый файл вместе с версией его содержимого
+func ReadFileVersion(path string) (content, version string, err error) {
+	content, err = ReadFile(path)
+	if err != nil {
+		return "", "", err
+	}
+	return content, ContentVersion(content), nil
+}
+
+// FileVersion возвращает текущую версию файла ("" — файла нет)
+func FileVersion(path string) (string, error) {
+	safePath, err := ResolvePath(path)
+	if err != nil {
+		return "", err
+	}
+	fileMutex.RLock()
+	defer fileMutex.RUnlock()
+	return currentVersion(safePath)
+}
+
+// currentVersion вычисляет версию файла; вызывается под блокировкой fileMutex
+func currentVersion(safePath string) (string, error) {
+	data, err := os.ReadFile(safePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return ContentVersion(string(data)), nil
+}
+
+// checkVersion сравнивает версию файла с ожидаемой; вызывается под блокировкой fileMutex
+func checkVersion(safePath, expected string) error {
+	actual, err := currentVersion(safePath)
+	if err != nil {
+		return err
+	}
+	if actual != expected {
+		return &VersionConflictError{Path: relPath(safePath), Expected: expected, Actual: actual}
+	}
+	return nil
+}
+
+// WriteFileIfMatch атомарно записывает файл, только если его текущая версия
+// равна version (пустая версия — файл не должен существовать). Иначе
+// возвращает *VersionConflictError и файл не изменяется
+func WriteFileIfMatch(path, content, version string) error {
+	return writeFile(path, content, &version)
+}
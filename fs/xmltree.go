@@ -0,0 +1,800 @@
+package fs
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Лимиты разбора XML: защищают от «бомб» из глубокой вложенности и огромного
+// количества элементов или атрибутов
+const (
+	MaxXMLDepth      = 64     // максимальная вложенность элементов
+	MaxXMLElements   = 100000 // максимальное количество элементов в документе
+	MaxXMLAttributes = 256    // максимальное количество атрибутов одного элемента
+)
+
+// errXMLDirective — документ содержит DOCTYPE или объявление сущности
+var errXMLDirective = errors.New("объявления DOCTYPE и ENTITY запрещены (защита от XXE и Billion Laughs)")
+
+// xmlNamespaceURI — зарезервированное пространство имён префикса xml (xml:lang, xml:space)
+const xmlNamespaceURI = "http://www.w3.org/XML/1998/namespace"
+
+// xmlnsSpace — пространство имён, в котором encoding/xml возвращает атрибуты xmlns:prefix
+const xmlnsSpace = "xmlns"
+
+// Виды узлов содержимого элемента (XMLContent.Kind)
+const (
+	XMLText     = "text"
+	XMLElement  = "element"
+	XMLComment  = "comment"
+	XMLProcInst = "pi"
+)
+
+// XMLContent — узел содержимого элемента: текст, дочерний элемент, комментарий
+// или инструкция обработки
+type XMLContent struct {
+	Kind    string
+	Data    string   // текст как в документе, текст комментария или данные инструкции
+	Target  string   // цель инструкции обработки (<?target data?>)
+	Element *XMLNode // дочерний элемент (Kind == XMLElement)
+}
+
+// XMLNode — элемент XML документа
+type XMLNode struct {
+	Name       xml.Name          // имя элемента; Space — URI пространства имён
+	Attrs      []xml.Attr        // атрибуты без объявлений пространств имён
+	Namespaces map[string]string // объявленные в элементе пространства имён: префикс ("" — по умолчанию) -> URI
+	Text       string            // текст элемента без пробельных отступов (с xml:space="preserve" — как есть)
+	Children   []*XMLNode        // дочерние элементы по порядку
+
+	// Content — всё содержимое элемента по порядку; заполняется при разборе,
+	// чтобы запись не теряла смешанный текст и комментарии. Text и Children —
+	// его упрощённое представление для запросов и преобразований. У элементов,
+	// построенных из данных, Content пуст и запись использует Text и Children
+	Content []XMLContent
+	// Prolog и Epilog — комментарии и инструкции обработки до и после корневого элемента
+	Prolog, Epilog []XMLContent
+}
+
+// Child возвращает первый дочерний элемент с указанным локальным именем
+func (n *XMLNode) Child(local string) *XMLNode {
+	for _, c := range n.Children {
+		if c.Name.Local == local {
+			return c
+		}
+	}
+	return nil
+}
+
+// Attr возвращает значение атрибута по локальному имени
+func (n *XMLNode) Attr(local string) (string, bool) {
+	for _, a := range n.Attrs {
+		if a.Name.Local == local {
+			return a.Value, true
+		}
+	}
+	return "", false
+}
+
+// ReadXMLTree читает XML файл в виде дерева элементов
+func ReadXMLTree(path string) (*XMLNode, error) {
+	safePath, err := ResolvePath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	fileMutex.RLock()
+	defer fileMutex.RUnlock()
+
+	file, err := os.Open(safePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() > MaxFileSize {
+		return nil, fmt.Errorf("файл слишком большой для разбора: %d байт (лимит %d)", info.Size(), MaxFileSize)
+	}
+	return ParseXML(file)
+}
+
+// ParseXML разбирает XML документ в дерево. DOCTYPE и объявления сущностей
+// отклоняются, глубина, количество элементов и атрибутов ограничены
+func ParseXML(r io.Reader) (*XMLNode, error) {
+	decoder := xml.NewDecoder(r)
+	decoder.Strict = true
+
+	fail := func(err error) (*XMLNode, error) {
+		line, col := decoder.InputPos()
+		return nil, &ParseError{Line: line, Column: col, Err: err}
+	}
+
+	var root *XMLNode
+	var stack []*XMLNode
+	var preserve []bool            // действует ли xml:space="preserve" в элементе
+	var scopes []map[string]string // видимые объявления пространств имён: URI -> префикс
+	var prolog, epilog []XMLContent
+	elements := 0
+
+	// add добавляет узел в содержимое текущего элемента или в пролог/эпилог документа
+	add := func(c XMLContent) {
+		switch {
+		case len(stack) > 0:
+			parent := stack[len(stack)-1]
+			parent.Content = append(parent.Content, c)
+		case root == nil:
+			prolog = append(prolog, c)
+		default:
+			epilog = append(epilog, c)
+		}
+	}
+
+	for {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var syntax *xml.SyntaxError
+			if errors.As(err, &syntax) {
+				_, col := decoder.InputPos()
+				return nil, &ParseError{Line: syntax.Line, Column: col, Err: errors.New(syntax.Msg)}
+			}
+			return fail(err)
+		}
+
+		switch t := tok.(type) {
+		case xml.Directive:
+			return fail(errXMLDirective)
+		case xml.StartElement:
+			if root != nil && len(stack) == 0 {
+				return fail(errors.New("в документе больше одного корневого элемента"))
+			}
+			elements++
+			if elements > MaxXMLElements {
+				return fail(fmt.Errorf("слишком много элементов (лимит %d)", MaxXMLElements))
+			}
+			if len(stack)+1 > MaxXMLDepth {
+				return fail(fmt.Errorf("слишком глубокая вложенность элементов (лимит %d)", MaxXMLDepth))
+			}
+			if len(t.Attr) > MaxXMLAttributes {
+				return fail(fmt.Errorf("у элемента %s слишком много атрибутов: %d (лимит %d)", t.Name.Local, len(t.Attr), MaxXMLAttributes))
+			}
+
+			node := &XMLNode{Name: t.Name}
+			for _, a := range t.Attr {
+				switch {
+				case a.Name.Space == xmlnsSpace:
+					node.declare(a.Name.Local, a.Value)
+				case a.Name.Space == "" && a.Name.Local == xmlnsSpace:
+					node.declare("", a.Value)
+				default:
+					node.Attrs = append(node.Attrs, a)
+				}
+			}
+			// Префиксы без объявления encoding/xml оставляет как есть — такой документ
+			// нельзя записать обратно, поэтому он отклоняется
+			outer := map[string]string{xmlNamespaceURI: "xml"}
+			if len(scopes) > 0 {
+				outer = scopes[len(scopes)-1]
+			}
+			scope := node.scope(outer)
+			if err := checkNamespace(t.Name, scope); err != nil {
+				return fail(err)
+			}
+			for _, a := range node.Attrs {
+				if err := checkNamespace(a.Name, scope); err != nil {
+					return fail(err)
+				}
+			}
+			scopes = append(scopes, scope)
+
+			// xml:space наследуется вложенными элементами
+			keep := len(preserve) > 0 && preserve[len(preserve)-1]
+			if space, ok := node.xmlSpace(); ok {
+				keep = space == "preserve"
+			}
+			preserve = append(preserve, keep)
+
+			if len(stack) == 0 {
+				root = node
+			} else {
+				parent := stack[len(stack)-1]
+				parent.Children = append(parent.Children, node)
+				add(XMLContent{Kind: XMLElement, Element: node})
+			}
+			stack = append(stack, node)
+		case xml.EndElement:
+			node := stack[len(stack)-1]
+			node.Text = node.rawText()
+			if !preserve[len(preserve)-1] {
+				node.Text = strings.TrimSpace(node.Text)
+			}
+			stack = stack[:len(stack)-1]
+			preserve = preserve[:len(preserve)-1]
+			scopes = scopes[:len(scopes)-1]
+		case xml.CharData:
+			if len(stack) == 0 {
+				if len(strings.TrimSpace(string(t))) > 0 {
+					return fail(errors.New("текст вне корневого элемента"))
+				}
+				continue
+			}
+			// Секции CDATA приходят отдельными токенами — соседний текст объединяется
+			parent := stack[len(stack)-1]
+			if last := len(parent.Content) - 1; last >= 0 && parent.Content[last].Kind == XMLText {
+				parent.Content[last].Data += string(t)
+			} else {
+				add(XMLContent{Kind: XMLText, Data: string(t)})
+			}
+		case xml.Comment:
+			add(XMLContent{Kind: XMLComment, Data: string(t)})
+		case xml.ProcInst:
+			// Объявление <?xml ...?> записывается заново при сохранении
+			if t.Target != "xml" {
+				add(XMLContent{Kind: XMLProcInst, Target: t.Target, Data: string(t.Inst)})
+			}
+		}
+	}
+
+	if root == nil {
+		return nil, errors.New("документ не содержит корневого элемента")
+	}
+	root.Prolog, root.Epilog = prolog, epilog
+	return root, nil
+}
+
+// xmlSpace возвращает значение атрибута xml:space элемента
+func (n *XMLNode) xmlSpace() (string, bool) {
+	for _, a := range n.Attrs {
+		if a.Name.Space == xmlNamespaceURI && a.Name.Local == "space" {
+			return a.Value, true
+		}
+	}
+	return "", false
+}
+
+// rawText возвращает весь текст элемента (без дочерних элементов) как в документе
+func (n *XMLNode) rawText() string {
+	var sb strings.Builder
+	for _, c := range n.Content {
+		if c.Kind == XMLText {
+			sb.WriteString(c.Data)
+		}
+	}
+	return sb.String()
+}
+
+// content возвращает содержимое элемента по порядку; для элементов,
+// построенных из данных, — текст и затем дочерние элементы
+func (n *XMLNode) content() []XMLContent {
+	if n.Content != nil {
+		return n.Content
+	}
+	var items []XMLContent
+	if n.Text != "" {
+		items = append(items, XMLContent{Kind: XMLText, Data: n.Text})
+	}
+	for _, c := range n.Children {
+		items = append(items, XMLContent{Kind: XMLElement, Element: c})
+	}
+	return items
+}
+
+// mixedContent сообщает, что текст элемента чередуется с другими узлами:
+// такое содержимое записывается без отступов, иначе изменится текст
+func mixedContent(items []XMLContent) bool {
+	hasText, hasOther := false, false
+	for _, c := range items {
+		if c.Kind == XMLText {
+			hasText = hasText || strings.TrimSpace(c.Data) != ""
+		} else {
+			hasOther = true
+		}
+	}
+	return hasText && hasOther
+}
+
+func (n *XMLNode) declare(prefix, uri string) {
+	if n.Namespaces == nil {
+		n.Namespaces = make(map[string]string)
+	}
+	n.Namespaces[prefix] = uri
+}
+
+// checkNamespace проверяет, что пространство имён объявлено в документе
+func checkNamespace(name xml.Name, scope map[string]string) error {
+	if name.Space == "" {
+		return nil
+	}
+	if _, ok := scope[name.Space]; !ok {
+		return fmt.Errorf("префикс пространства имён %s не объявлен", name.Space)
+	}
+	return nil
+}
+
+// scope дополняет видимые объявления (URI -> префикс) объявлениями элемента
+func (n *XMLNode) scope(outer map[string]string) map[string]string {
+	if len(n.Namespaces) == 0 {
+		return outer
+	}
+	inner := make(map[string]string, len(outer)+len(n.Namespaces))
+	for uri, p := range outer {
+		inner[uri] = p
+	}
+	for p, uri := range n.Namespaces {
+		inner[uri] = p
+	}
+	return inner
+}
+
+// namespacePrefixes возвращает префиксы объявлений элемента в постоянном порядке
+func (n *XMLNode) namespacePrefixes() []string {
+	prefixes := make([]string, 0, len(n.Namespaces))
+	for p := range n.Namespaces {
+		prefixes = append(prefixes, p)
+	}
+	sort.Strings(prefixes)
+	return prefixes
+}
+
+// FormatXMLTree возвращает дерево элементов в виде псевдографики:
+//
+//	catalog
+//	└── book @id="1"
+//	    ├── title: Go
+//	    └── price: 10
+//
+// Имена с пространствами имён выводятся с префиксами из объявлений документа
+func FormatXMLTree(root *XMLNode) string {
+	var sb strings.Builder
+	writeXMLNode(&sb, root, "", "", map[string]string{xmlNamespaceURI: "xml"})
+	return sb.String()
+}
+
+func writeXMLNode(sb *strings.Builder, n *XMLNode, prefix, childPrefix string, scope map[string]string) {
+	scope = n.scope(scope)
+
+	sb.WriteString(prefix)
+	sb.WriteString(qualifiedName(n.Name, scope))
+	for _, a := range n.Attrs {
+		fmt.Fprintf(sb, " @%s=%q", qualifiedName(a.Name, scope), a.Value)
+	}
+	for _, p := range n.namespacePrefixes() {
+		if p == "" {
+			fmt.Fprintf(sb, " [xmlns=%s]", n.Namespaces[p])
+		} else {
+			fmt.Fprintf(sb, " [xmlns:%s=%s]", p, n.Namespaces[p])
+		}
+	}
+	if n.Text != "" {
+		sb.WriteString(": ")
+		sb.WriteString(strings.Join(strings.Fields(n.Text), " "))
+	}
+	sb.WriteString("\n")
+
+	for i, c := range n.Children {
+		if i == len(n.Children)-1 {
+			writeXMLNode(sb, c, childPrefix+"└── ", childPrefix+"    ", scope)
+		} else {
+			writeXMLNode(sb, c, childPrefix+"├── ", childPrefix+"│   ", scope)
+		}
+	}
+}
+
+// qualifiedName возвращает имя с префиксом пространства имён (или {URI}, если префикс неизвестен)
+func qualifiedName(name xml.Name, scope map[string]string) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	p, ok := scope[name.Space]
+	switch {
+	case !ok:
+		return "{" + name.Space + "}" + name.Local
+	case p == "":
+		return name.Local
+	default:
+		return p + ":" + name.Local
+	}
+}
+
+// FormatXML возвращает документ в каноническом виде: объявление XML, отступы
+// в два пробела, пустые элементы в краткой форме. Префиксы пространств имён
+// сохраняются из объявлений документа. Отступы добавляются только там, где
+// пробелы незначимы: смешанный текст, xml:space="preserve" и текст элементов
+// без дочерних узлов записываются как есть; комментарии и инструкции
+// обработки сохраняются
+func FormatXML(root *XMLNode) string {
+	var sb strings.Builder
+	sb.WriteString(xml.Header)
+	for _, c := range root.Prolog {
+		writeXMLContent(&sb, c, "", nil, true)
+		sb.WriteString("\n")
+	}
+	sb.WriteString(FormatXMLFragment(root))
+	for _, c := range root.Epilog {
+		writeXMLContent(&sb, c, "", nil, true)
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// FormatXMLFragment возвращает элемент в каноническом виде без объявления XML
+func FormatXMLFragment(n *XMLNode) string {
+	var sb strings.Builder
+	writeXMLElement(&sb, n, "", map[string]string{xmlNamespaceURI: "xml"}, false)
+	sb.WriteString("\n")
+	return sb.String()
+}
+
+// WriteXMLTree записывает дерево элементов в XML файл в каноническом виде
+func WriteXMLTree(path string, root *XMLNode) error {
+	// WriteFile проверяет размер и обновляет индекс содержимого
+	return WriteFile(path, FormatXML(root))
+}
+
+// writeXMLElement записывает элемент без перевода строки в конце. inline —
+// элемент находится внутри смешанного содержимого и отступы добавлять нельзя
+func writeXMLElement(sb *strings.Builder, n *XMLNode, indent string, scope map[string]string, inline bool) {
+	scope = n.scope(scope)
+	name := qualifiedName(n.Name, scope)
+
+	sb.WriteString("<" + name)
+	for _, p := range n.namespacePrefixes() {
+		if p == "" {
+			sb.WriteString(` xmlns="`)
+		} else {
+			sb.WriteString(` xmlns:` + p + `="`)
+		}
+		xml.EscapeText(sb, []byte(n.Namespaces[p]))
+		sb.WriteString(`"`)
+	}
+	for _, a := range n.Attrs {
+		sb.WriteString(" " + qualifiedName(a.Name, scope) + `="`)
+		xml.EscapeText(sb, []byte(a.Value))
+		sb.WriteString(`"`)
+	}
+
+	items := n.content()
+	if len(items) == 0 {
+		sb.WriteString("/>")
+		return
+	}
+	sb.WriteString(">")
+
+	space, _ := n.xmlSpace()
+	textOnly := true
+	for _, c := range items {
+		textOnly = textOnly && c.Kind == XMLText
+	}
+	if inline || textOnly || space == "preserve" || mixedContent(items) {
+		for _, c := range items {
+			writeXMLContent(sb, c, "", scope, true)
+		}
+	} else {
+		// Содержимое без значимого текста: пробельный текст заменяется отступами
+		for _, c := range items {
+			if c.Kind == XMLText {
+				continue
+			}
+			sb.WriteString("\n" + indent + "  ")
+			writeXMLContent(sb, c, indent+"  ", scope, false)
+		}
+		sb.WriteString("\n" + indent)
+	}
+	sb.WriteString("</" + name + ">")
+}
+
+// writeXMLContent записывает узел содержимого элемента
+func writeXMLContent(sb *strings.Builder, c XMLContent, indent string, scope map[string]string, inline bool) {
+	switch c.Kind {
+	case XMLText:
+		escapeXMLText(sb, c.Data)
+	case XMLElement:
+		writeXMLElement(sb, c.Element, indent, scope, inline)
+	case XMLComment:
+		sb.WriteString("<!--" + c.Data + "-->")
+	case XMLProcInst:
+		sb.WriteString("<?" + c.Target)
+		if c.Data != "" {
+			sb.WriteString(" " + c.Data)
+		}
+		sb.WriteString("?>")
+	}
+}
+
+// escapeXMLText экранирует текст элемента. В отличие от xml.EscapeText
+// переводы строк и табуляция остаются как есть; \r экранируется, иначе
+// разбор заменит "\r\n" на "\n"
+func escapeXMLText(sb *strings.Builder, text string) {
+	for _, r := range text {
+		switch r {
+		case '&':
+			sb.WriteString("&amp;")
+		case '<':
+			sb.WriteString("&lt;")
+		case '>':
+			sb.WriteString("&gt;")
+		case '\r':
+			sb.WriteString("&#xD;")
+		default:
+			sb.WriteRune(r)
+		}
+	}
+}
+
+// Преобразование XML в общую модель данных и обратно (см. DataFormat):
+// атрибуты — ключи "@имя", объявления пространств имён — "@xmlns" и "@xmlns:префикс",
+// текст рядом с дочерними элементами — "#text", повторяющиеся элементы — массив.
+// Элемент только с текстом становится строкой
+
+const (
+	xmlAttrPrefix = "@"
+	xmlTextKey    = "#text"
+	// xmlWrapperRoot и xmlArrayItem — имена элементов, добавляемых при записи данных,
+	// которые не являются объектом с единственным ключом
+	xmlWrapperRoot = "root"
+	xmlArrayItem   = "item"
+)
+
+func decodeXMLData(content string) (interface{}, []string, error) {
+	root, err := ParseXML(strings.NewReader(content))
+	if err != nil {
+		return nil, nil, err
+	}
+	losses := &lossSet{}
+	scope := map[string]string{xmlNamespaceURI: "xml"}
+	doc := newOrderedObject()
+	scope = root.scope(scope)
+	xmlMarkupLosses(root.Prolog, losses)
+	xmlMarkupLosses(root.Epilog, losses)
+	doc.set(qualifiedName(root.Name, scope), xmlNodeData(root, scope, losses))
+	return doc, losses.losses, nil
+}
+
+// xmlMarkupLosses отмечает комментарии и инструкции обработки: в модели данных им нет места
+func xmlMarkupLosses(items []XMLContent, losses *lossSet) {
+	for _, c := range items {
+		switch c.Kind {
+		case XMLComment:
+			losses.add("комментарии XML не сохраняются")
+		case XMLProcInst:
+			losses.add("инструкции обработки XML (<?%s ...?>) не сохраняются", c.Target)
+		}
+	}
+}
+
+func xmlNodeData(n *XMLNode, scope map[string]string, losses *lossSet) interface{} {
+	xmlMarkupLosses(n.Content, losses)
+	if raw := n.rawText(); raw != n.Text && strings.TrimSpace(raw) != "" {
+		losses.add("пробелы в начале и конце текста элементов обрезаны")
+	}
+	if len(n.Attrs) == 0 && len(n.Namespaces) == 0 && len(n.Children) == 0 {
+		return n.Text
+	}
+	obj := newOrderedObject()
+	for _, p := range n.namespacePrefixes() {
+		key := xmlAttrPrefix + "xmlns"
+		if p != "" {
+			key += ":" + p
+		}
+		obj.set(key, n.Namespaces[p])
+	}
+	for _, a := range n.Attrs {
+		obj.set(xmlAttrPrefix+qualifiedName(a.Name, scope), a.Value)
+	}
+
+	last := ""
+	for _, c := range n.Children {
+		childScope := c.scope(scope)
+		name := qualifiedName(c.Name, childScope)
+		value := xmlNodeData(c, childScope, losses)
+		existing, ok := obj.get(name)
+		switch {
+		case !ok:
+			obj.set(name, value)
+		case name != last:
+			losses.add("порядок чередующихся элементов <%s> не сохраняется: одноимённые элементы объединены в массив", name)
+			fallthrough
+		default:
+			// Значение элемента — строка или объект, поэтому массив означает повтор
+			if arr, isArray := existing.([]interface{}); isArray {
+				obj.set(name, append(arr, value))
+			} else {
+				obj.set(name, []interface{}{existing, value})
+			}
+		}
+		last = name
+	}
+	if n.Text != "" {
+		if len(n.Children) > 0 {
+			losses.add("положение смешанного текста среди элементов не сохраняется (ключ %s)", xmlTextKey)
+		}
+		obj.set(xmlTextKey, n.Text)
+	}
+	return obj
+}
+
+func encodeXMLData(data interface{}) (string, []string, error) {
+	losses := &lossSet{}
+	var root *XMLNode
+	var err error
+	scope := map[string]bool{"xml": true}
+
+	obj, isObject := data.(*orderedObject)
+	if isObject && len(obj.keys) == 1 && !strings.HasPrefix(obj.keys[0], xmlAttrPrefix) && obj.keys[0] != xmlTextKey {
+		if _, isArray := obj.values[obj.keys[0]].([]interface{}); !isArray {
+			root, err = dataToXMLNode(obj.keys[0], obj.values[obj.keys[0]], appendPointer("", obj.keys[0]), 1, scope, losses)
+			if err != nil {
+				return "", nil, err
+			}
+			return FormatXML(root), losses.losses, nil
+		}
+	}
+
+	// XML требует единственный корневой элемент — данные оборачиваются в <root>
+	losses.add("добавлен корневой элемент <%s>", xmlWrapperRoot)
+	root, err = dataToXMLNode(xmlWrapperRoot, data, "", 1, scope, losses)
+	if err != nil {
+		return "", nil, err
+	}
+	return FormatXML(root), losses.losses, nil
+}
+
+// dataToXMLNode строит элемент name из значения модели. declared — префиксы,
+// объявленные выше по дереву; необъявленный префикс сделал бы документ некорректным
+func dataToXMLNode(name string, value interface{}, pointer string, depth int, declared map[string]bool, losses *lossSet) (*XMLNode, error) {
+	if depth > MaxXMLDepth {
+		return nil, fmt.Errorf("%s: слишком глубокая вложенность (лимит %d)", pointerLabel(pointer), MaxXMLDepth)
+	}
+	n := &XMLNode{Name: xml.Name{Local: name}}
+
+	switch v := value.(type) {
+	case *orderedObject:
+		// Сначала объявления пространств имён: они действуют на имя самого элемента
+		for _, k := range v.keys {
+			if k != xmlAttrPrefix+"xmlns" && !strings.HasPrefix(k, xmlAttrPrefix+"xmlns:") {
+				continue
+			}
+			uri, ok := v.values[k].(string)
+			if !ok {
+				return nil, fmt.Errorf("%s: объявление пространства имён должно быть строкой", appendPointer(pointer, k))
+			}
+			n.declare(strings.TrimPrefix(strings.TrimPrefix(k, xmlAttrPrefix+"xmlns"), ":"), uri)
+		}
+		if len(n.Namespaces) > 0 {
+			inner := make(map[string]bool, len(declared)+len(n.Namespaces))
+			for p := range declared {
+				inner[p] = true
+			}
+			for p := range n.Namespaces {
+				inner[p] = true
+			}
+			declared = inner
+		}
+
+		for _, k := range v.keys {
+			child := v.values[k]
+			childPointer := appendPointer(pointer, k)
+			switch {
+			case k == xmlAttrPrefix+"xmlns" || strings.HasPrefix(k, xmlAttrPrefix+"xmlns:"):
+			case strings.HasPrefix(k, xmlAttrPrefix):
+				attr := strings.TrimPrefix(k, xmlAttrPrefix)
+				if err := checkXMLName(attr, childPointer, declared); err != nil {
+					return nil, err
+				}
+				text, err := xmlScalar(child, childPointer, losses)
+				if err != nil {
+					return nil, err
+				}
+				n.Attrs = append(n.Attrs, xml.Attr{Name: xml.Name{Local: attr}, Value: text})
+			case k == xmlTextKey:
+				text, err := xmlScalar(child, childPointer, losses)
+				if err != nil {
+					return nil, err
+				}
+				n.Text = text
+			default:
+				items := []interface{}{child}
+				if arr, isArray := child.([]interface{}); isArray {
+					items = arr
+					switch len(arr) {
+					case 0:
+						losses.add("пустые массивы не представимы в XML и пропущены (%s)", childPointer)
+					case 1:
+						losses.add("массив из одного элемента записан как одиночный элемент и при чтении станет значением (%s)", childPointer)
+					}
+				}
+				for i, item := range items {
+					itemPointer := childPointer
+					if _, isArray := child.([]interface{}); isArray {
+						itemPointer = appendPointer(childPointer, fmt.Sprint(i))
+					}
+					c, err := dataToXMLNode(k, item, itemPointer, depth+1, declared, losses)
+					if err != nil {
+						return nil, err
+					}
+					n.Children = append(n.Children, c)
+				}
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			c, err := dataToXMLNode(xmlArrayItem, item, appendPointer(pointer, fmt.Sprint(i)), depth+1, declared, losses)
+			if err != nil {
+				return nil, err
+			}
+			n.Children = append(n.Children, c)
+		}
+		if pointer != "" {
+			losses.add("вложенные массивы записаны как элементы <%s>", xmlArrayItem)
+		}
+	default:
+		text, err := xmlScalar(v, pointer, losses)
+		if err != nil {
+			return nil, err
+		}
+		n.Text = text
+	}
+
+	if err := checkXMLName(name, pointer, declared); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// xmlScalar возвращает текст скалярного значения; типы в XML не сохраняются
+func xmlScalar(v interface{}, pointer string, losses *lossSet) (string, error) {
+	switch v.(type) {
+	case *orderedObject, []interface{}:
+		return "", fmt.Errorf("%s: атрибут или текст должен быть скалярным значением", pointerLabel(pointer))
+	case string:
+	case nil:
+		losses.add("null записан как пустой элемент или атрибут")
+	default:
+		losses.add("числа и логические значения записаны как текст (тип не сохраняется)")
+	}
+	return scalarText(v), nil
+}
+
+// checkXMLName проверяет, что строка может быть именем элемента или атрибута XML
+func checkXMLName(name, pointer string, declared map[string]bool) error {
+	local := name
+	if i := strings.IndexByte(name, ':'); i >= 0 {
+		prefix := name[:i]
+		local = name[i+1:]
+		if !declared[prefix] {
+			return fmt.Errorf("%s: префикс пространства имён %q не объявлен (добавьте ключ \"@xmlns:%s\")", pointerLabel(pointer), prefix, prefix)
+		}
+		if !isXMLName(prefix) {
+			return fmt.Errorf("%s: %q не может быть именем XML", pointerLabel(pointer), name)
+		}
+	}
+	if !isXMLName(local) {
+		return fmt.Errorf("%s: %q не может быть именем XML", pointerLabel(pointer), name)
+	}
+	return nil
+}
+
+// isXMLName проверяет имя без префикса: буква или _ в начале, далее буквы, цифры, _ - .
+func isXMLName(name string) bool {
+	for i, r := range name {
+		switch {
+		case unicode.IsLetter(r) || r == '_':
+		case i > 0 && (unicode.IsDigit(r) || r == '-' || r == '.'):
+		default:
+			return false
+		}
+	}
+	return name != ""
+}
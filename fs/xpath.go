@@ -0,0 +1,430 @@
+package fs
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// XMLMatch — результат выражения XPath: элемент, атрибут или текст
+type XMLMatch struct {
+	Path  string   // путь к найденному узлу: /catalog[1]/book[2]/@id
+	Node  *XMLNode // найденный элемент (nil для атрибута и текста)
+	Value string   // значение атрибута или текст
+}
+
+// QueryXML читает XML файл и вычисляет выражение XPath
+func QueryXML(path, expr string) ([]XMLMatch, error) {
+	query, err := ParseXPath(expr)
+	if err != nil {
+		return nil, err
+	}
+	root, err := ReadXMLTree(path)
+	if err != nil {
+		return nil, err
+	}
+	return query.Evaluate(root)
+}
+
+// XPath — разобранное выражение. Поддерживается подмножество XPath 1.0:
+//
+//	/a/b        дочерние элементы по шагам от корня
+//	//b  a//b   элементы на любой глубине
+//	*           любой элемент
+//	@id  @*     атрибуты (только последним шагом)
+//	text()      текст элемента (только последним шагом)
+//	[2] [last()]                    позиция среди найденных на шаге
+//	[@id] [@id='1'] [@id!='1']      наличие или значение атрибута
+//	[title] [title='Go'] [text()='Go']  наличие или текст дочернего элемента
+//
+// Имя без префикса совпадает с элементом из любого пространства имён,
+// имя с префиксом (c:book) — только с элементом с тем же префиксом в документе
+type XPath struct {
+	steps []xpathStep
+}
+
+type xpathStep struct {
+	descendant bool   // шаг после //
+	kind       string // "element", "attr" или "text"
+	name       string // имя или *
+	predicates []xpathPredicate
+}
+
+// xpathPredicate фильтрует найденные на шаге элементы; pos и size — позиция (с 1) и количество
+type xpathPredicate func(n *XMLNode, scope map[string]string, pos, size int) bool
+
+// xpathItem — найденный элемент вместе с путём и видимыми объявлениями пространств имён
+type xpathItem struct {
+	node     *XMLNode
+	path     string
+	scope    map[string]string // URI -> префикс
+	inherits map[string]string // объявления предков: префикс -> URI
+}
+
+// ParseXPath разбирает выражение XPath
+func ParseXPath(expr string) (*XPath, error) {
+	src := strings.TrimSpace(expr)
+	if !strings.HasPrefix(src, "/") {
+		return nil, errors.New("выражение XPath должно начинаться с / или //")
+	}
+	var steps []xpathStep
+	pos := 0
+	for pos < len(src) {
+		var step xpathStep
+		if strings.HasPrefix(src[pos:], "//") {
+			step.descendant = true
+			pos += 2
+		} else if src[pos] == '/' {
+			pos++
+		} else {
+			return nil, fmt.Errorf("XPath %q, позиция %d: ожидался /", expr, pos+1)
+		}
+		end := xpathStepEnd(src, pos)
+		if err := step.parse(src[pos:end]); err != nil {
+			return nil, fmt.Errorf("XPath %q, позиция %d: %w", expr, pos+1, err)
+		}
+		if len(steps) > 0 && steps[len(steps)-1].kind != "element" {
+			return nil, fmt.Errorf("XPath %q: атрибут и text() могут быть только последним шагом", expr)
+		}
+		steps = append(steps, step)
+		pos = end
+	}
+	return &XPath{steps: steps}, nil
+}
+
+// xpathStepEnd находит конец шага: следующий / вне скобок и кавычек
+func xpathStepEnd(src string, pos int) int {
+	depth := 0
+	var quote byte
+	for i := pos; i < len(src); i++ {
+		c := src[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+		case c == '/' && depth == 0:
+			return i
+		}
+	}
+	return len(src)
+}
+
+func (s *xpathStep) parse(text string) error {
+	name := text
+	if i := strings.IndexByte(text, '['); i >= 0 {
+		name = text[:i]
+		rest := text[i:]
+		for rest != "" {
+			if rest[0] != '[' {
+				return fmt.Errorf("ожидалась [ в %q", rest)
+			}
+			closing := matchingBracket(rest)
+			if closing < 0 {
+				return errors.New("незакрытая [")
+			}
+			pred, err := parseXPathPredicate(strings.TrimSpace(rest[1:closing]))
+			if err != nil {
+				return err
+			}
+			s.predicates = append(s.predicates, pred)
+			rest = rest[closing+1:]
+		}
+	}
+	name = strings.TrimSpace(name)
+	switch {
+	case name == "":
+		return errors.New("пустой шаг")
+	case name == "text()":
+		s.kind = "text"
+	case strings.HasPrefix(name, "@"):
+		s.kind, s.name = "attr", name[1:]
+	case name == "." || name == ".." || strings.ContainsAny(name, "()") || strings.Contains(name, "::"):
+		return fmt.Errorf("неподдерживаемый шаг %q", name)
+	default:
+		s.kind, s.name = "element", name
+	}
+	if s.name == "" && s.kind == "attr" {
+		return errors.New("ожидалось имя атрибута")
+	}
+	if s.kind != "element" && len(s.predicates) > 0 {
+		return errors.New("условия допустимы только для элементов")
+	}
+	return nil
+}
+
+// matchingBracket возвращает позицию ], закрывающей [ в начале строки
+func matchingBracket(s string) int {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func parseXPathPredicate(text string) (xpathPredicate, error) {
+	if text == "last()" {
+		return func(_ *XMLNode, _ map[string]string, pos, size int) bool { return pos == size }, nil
+	}
+	if n, err := strconv.Atoi(text); err == nil {
+		if n < 1 {
+			return nil, fmt.Errorf("позиция [%d] должна быть не меньше 1", n)
+		}
+		return func(_ *XMLNode, _ map[string]string, pos, _ int) bool { return pos == n }, nil
+	}
+
+	// Первый = стоит до значения в кавычках, поэтому ищется без учёта кавычек
+	operand, op, literal := text, "", ""
+	if i := strings.IndexByte(text, '='); i >= 0 {
+		operand, op = text[:i], "="
+		if i > 0 && text[i-1] == '!' {
+			operand, op = text[:i-1], "!="
+		}
+		operand = strings.TrimSpace(operand)
+		value := strings.TrimSpace(text[i+1:])
+		if len(value) < 2 || (value[0] != '\'' && value[0] != '"') || value[len(value)-1] != value[0] {
+			return nil, fmt.Errorf("значение в условии [%s] должно быть в кавычках", text)
+		}
+		literal = value[1 : len(value)-1]
+	}
+	if operand == "" {
+		return nil, fmt.Errorf("пустое условие [%s]", text)
+	}
+
+	// values возвращает значения операнда для элемента: атрибут, текст или тексты дочерних элементов
+	var values func(n *XMLNode, scope map[string]string) []string
+	switch {
+	case operand == "text()":
+		values = func(n *XMLNode, _ map[string]string) []string { return []string{n.Text} }
+	case strings.HasPrefix(operand, "@"):
+		name := operand[1:]
+		values = func(n *XMLNode, scope map[string]string) []string {
+			var out []string
+			for _, a := range n.Attrs {
+				if xpathNameMatches(name, a.Name.Local, qualifiedName(a.Name, scope)) {
+					out = append(out, a.Value)
+				}
+			}
+			return out
+		}
+	default:
+		if strings.ContainsAny(operand, "()[]/@ ") {
+			return nil, fmt.Errorf("неподдерживаемое условие [%s]", text)
+		}
+		values = func(n *XMLNode, scope map[string]string) []string {
+			var out []string
+			for _, c := range n.Children {
+				if xpathNameMatches(operand, c.Name.Local, qualifiedName(c.Name, c.scope(scope))) {
+					out = append(out, c.Text)
+				}
+			}
+			return out
+		}
+	}
+
+	return func(n *XMLNode, scope map[string]string, _, _ int) bool {
+		found := values(n, scope)
+		switch op {
+		case "":
+			return len(found) > 0
+		case "=":
+			for _, v := range found {
+				if v == literal {
+					return true
+				}
+			}
+			return false
+		default:
+			for _, v := range found {
+				if v != literal {
+					return true
+				}
+			}
+			return false
+		}
+	}, nil
+}
+
+// xpathNameMatches сравнивает шаг с именем: * — любое, без префикса — по локальному имени
+func xpathNameMatches(step, local, qualified string) bool {
+	if step == "*" {
+		return true
+	}
+	if strings.Contains(step, ":") {
+		return step == qualified
+	}
+	return step == local
+}
+
+// Evaluate применяет выражение к документу
+func (q *XPath) Evaluate(root *XMLNode) ([]XMLMatch, error) {
+	// Виртуальный узел документа: его единственный дочерний элемент — корень
+	doc := &XMLNode{Children: []*XMLNode{root}}
+	current := []xpathItem{{node: doc, scope: map[string]string{xmlNamespaceURI: "xml"}}}
+
+	for i, step := range q.steps {
+		last := i == len(q.steps)-1
+		if step.descendant && step.kind != "element" {
+			// //@id и //text() — по всем элементам документа
+			var all []xpathItem
+			for _, item := range current {
+				all = appendDescendants(all, item, true)
+			}
+			current = all
+		}
+
+		switch step.kind {
+		case "attr", "text":
+			if !last {
+				return nil, errors.New("атрибут и text() могут быть только последним шагом")
+			}
+			var out []XMLMatch
+			for _, item := range current {
+				if item.node == doc {
+					continue
+				}
+				if step.kind == "text" {
+					if item.node.Text != "" {
+						out = append(out, XMLMatch{Path: item.path + "/text()", Value: item.node.Text})
+					}
+					continue
+				}
+				for _, a := range item.node.Attrs {
+					qn := qualifiedName(a.Name, item.scope)
+					if xpathNameMatches(step.name, a.Name.Local, qn) {
+						out = append(out, XMLMatch{Path: item.path + "/@" + qn, Value: a.Value})
+					}
+				}
+				if len(out) > MaxQueryResults {
+					return nil, errTooManyMatches
+				}
+			}
+			return out, nil
+		}
+
+		// Условия применяются к элементам одного родителя: //b[1] — первый b у каждого родителя
+		var next []xpathItem
+		seen := make(map[*XMLNode]bool)
+		for _, item := range current {
+			parents := []xpathItem{item}
+			if step.descendant {
+				parents = appendDescendants(nil, item, true)
+			}
+			for _, parent := range parents {
+				var matched []xpathItem
+				for _, c := range childItems(parent) {
+					if xpathNameMatches(step.name, c.node.Name.Local, qualifiedName(c.node.Name, c.scope)) {
+						matched = append(matched, c)
+					}
+				}
+				for _, pred := range step.predicates {
+					var kept []xpathItem
+					for pos, m := range matched {
+						if pred(m.node, m.scope, pos+1, len(matched)) {
+							kept = append(kept, m)
+						}
+					}
+					matched = kept
+				}
+				for _, m := range matched {
+					if !seen[m.node] {
+						seen[m.node] = true
+						next = append(next, m)
+					}
+				}
+			}
+			if len(next) > MaxQueryResults {
+				return nil, errTooManyMatches
+			}
+		}
+		current = next
+	}
+
+	out := make([]XMLMatch, 0, len(current))
+	for _, item := range current {
+		if item.node == doc {
+			continue
+		}
+		out = append(out, XMLMatch{Path: item.path, Node: item.fragment()})
+	}
+	return out, nil
+}
+
+// childItems возвращает дочерние элементы с путями вида name[n]
+func childItems(parent xpathItem) []xpathItem {
+	counts := make(map[string]int)
+	out := make([]xpathItem, 0, len(parent.node.Children))
+	inherits := parent.inherits
+	if len(parent.node.Namespaces) > 0 {
+		inherits = make(map[string]string, len(parent.inherits)+len(parent.node.Namespaces))
+		for p, uri := range parent.inherits {
+			inherits[p] = uri
+		}
+		for p, uri := range parent.node.Namespaces {
+			inherits[p] = uri
+		}
+	}
+	for _, c := range parent.node.Children {
+		scope := c.scope(parent.scope)
+		name := qualifiedName(c.Name, scope)
+		counts[name]++
+		out = append(out, xpathItem{
+			node:     c,
+			path:     fmt.Sprintf("%s/%s[%d]", parent.path, name, counts[name]),
+			scope:    scope,
+			inherits: inherits,
+		})
+	}
+	return out
+}
+
+// appendDescendants добавляет все элементы под item (и сам item, если self) в порядке документа
+func appendDescendants(out []xpathItem, item xpathItem, self bool) []xpathItem {
+	if self {
+		out = append(out, item)
+	}
+	for _, c := range childItems(item) {
+		out = appendDescendants(out, c, true)
+	}
+	return out
+}
+
+// fragment возвращает копию элемента с объявлениями пространств имён предков,
+// чтобы найденный фрагмент оставался корректным XML
+func (item xpathItem) fragment() *XMLNode {
+	if len(item.inherits) == 0 {
+		return item.node
+	}
+	n := *item.node
+	n.Namespaces = make(map[string]string, len(item.inherits)+len(item.node.Namespaces))
+	for p, uri := range item.inherits {
+		n.Namespaces[p] = uri
+	}
+	for p, uri := range item.node.Namespaces {
+		n.Namespaces[p] = uri
+	}
+	return &n
+}
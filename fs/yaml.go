@@ -0,0 +1,790 @@
+package fs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Поддерживается подмножество YAML 1.2, достаточное для конфигураций и данных:
+// блочные отображения и последовательности, скаляры без кавычек и в кавычках,
+// блочные скаляры | и >, однострочные коллекции [..] и {..}, комментарии.
+// Якоря, ссылки и теги отклоняются: ссылки позволяют построить экспоненциально
+// растущий документ (Billion Laughs), а теги — создавать произвольные типы
+
+var (
+	errYAMLAnchor = errors.New("якоря (&), ссылки (*) и теги (!) не поддерживаются")
+	// errYAMLUnclosed — строка закончилась внутри [..] или {..}
+	errYAMLUnclosed = errors.New("незакрытая flow-коллекция (многострочные [..] и {..} не поддерживаются)")
+
+	yamlIntPattern   = regexp.MustCompile(`^[-+]?[0-9]+$`)
+	yamlFloatPattern = regexp.MustCompile(`^[-+]?(\.[0-9]+|[0-9]+(\.[0-9]*)?)([eE][-+]?[0-9]+)?$`)
+)
+
+type yamlParser struct {
+	lines  []string
+	pos    int
+	losses *lossSet
+}
+
+// decodeYAML разбирает YAML документ в общую модель данных
+func decodeYAML(content string) (interface{}, []string, error) {
+	content = strings.ReplaceAll(strings.TrimPrefix(content, "\ufeff"), "\r\n", "\n")
+	content = strings.TrimSuffix(content, "\n")
+	p := &yamlParser{lines: strings.Split(content, "\n"), losses: &lossSet{}}
+	if err := p.skipDirectives(); err != nil {
+		return nil, nil, err
+	}
+
+	var root interface{}
+	indent, _, ok, err := p.peek()
+	if err != nil {
+		return nil, nil, err
+	}
+	if ok {
+		if root, err = p.parseBlock(indent, -1, 0); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// После документа допускаются только пустые строки, комментарии и маркер «...»
+	for ; p.pos < len(p.lines); p.pos++ {
+		text := strings.TrimSpace(stripYAMLComment(p.lines[p.pos]))
+		switch {
+		case text == "" || text == "...":
+		case text == "---" || strings.HasPrefix(text, "--- "):
+			return nil, nil, p.errorf(p.pos, 0, "несколько документов в одном файле не поддерживаются")
+		default:
+			return nil, nil, p.errorf(p.pos, 0, "неожиданная строка %q (проверьте отступы)", text)
+		}
+	}
+	return root, p.losses.losses, nil
+}
+
+func (p *yamlParser) errorf(line, col int, format string, args ...interface{}) error {
+	return &ParseError{Line: line + 1, Column: col + 1, Err: fmt.Errorf(format, args...)}
+}
+
+// skipDirectives пропускает директиву %YAML и маркер начала документа
+func (p *yamlParser) skipDirectives() error {
+	for ; p.pos < len(p.lines); p.pos++ {
+		line := p.lines[p.pos]
+		text := strings.TrimSpace(stripYAMLComment(line))
+		switch {
+		case text == "":
+		case strings.HasPrefix(line, "%YAML"):
+		case strings.HasPrefix(line, "%"):
+			return p.errorf(p.pos, 0, "директива %q не поддерживается", text)
+		case text == "---":
+			p.pos++
+			return nil
+		case strings.HasPrefix(line, "--- "):
+			// Значение в строке маркера («--- |») разбирается как корень документа
+			p.lines[p.pos] = "    " + line[4:]
+			return nil
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+// peek пропускает пустые строки и комментарии и возвращает отступ и текст
+// следующей строки без комментария; ok == false в конце документа
+func (p *yamlParser) peek() (indent int, text string, ok bool, err error) {
+	for ; p.pos < len(p.lines); p.pos++ {
+		line := p.lines[p.pos]
+		indent = len(line) - len(strings.TrimLeft(line, " "))
+		rest := line[indent:]
+		if strings.HasPrefix(rest, "\t") {
+			trimmed := strings.TrimLeft(rest, " \t")
+			if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+				continue
+			}
+			return 0, "", false, p.errorf(p.pos, indent, "табуляция в отступе недопустима")
+		}
+		text = stripYAMLComment(rest)
+		if text == "" {
+			continue
+		}
+		if indent == 0 && (text == "---" || text == "..." || strings.HasPrefix(text, "--- ")) {
+			return 0, "", false, nil
+		}
+		return indent, text, true, nil
+	}
+	return 0, "", false, nil
+}
+
+// parseBlock разбирает узел, начинающийся в текущей строке с отступом indent;
+// parent — отступ владеющей коллекции (для блочных скаляров)
+func (p *yamlParser) parseBlock(indent, parent, depth int) (interface{}, error) {
+	if depth > maxDataDepth {
+		return nil, p.errorf(p.pos, indent, "превышена максимальная вложенность (%d)", maxDataDepth)
+	}
+	_, text, _, _ := p.peek()
+	if isYAMLSeqItem(text) {
+		return p.parseSequence(indent, depth)
+	}
+	if _, _, isKey, err := splitYAMLKey(text); err != nil {
+		return nil, p.errorf(p.pos, indent, "%v", err)
+	} else if isKey {
+		return p.parseMapping(indent, depth)
+	}
+	line := p.pos
+	p.pos++
+	return p.parseValue(text, line, indent, parent, depth)
+}
+
+// parseMapping разбирает блочное отображение с отступом indent
+func (p *yamlParser) parseMapping(indent, depth int) (interface{}, error) {
+	obj := newOrderedObject()
+	for {
+		lineIndent, text, ok, err := p.peek()
+		if err != nil {
+			return nil, err
+		}
+		if !ok || lineIndent < indent {
+			return obj, nil
+		}
+		if lineIndent > indent {
+			return nil, p.errorf(p.pos, lineIndent, "неожиданный отступ")
+		}
+		key, rest, isKey, err := splitYAMLKey(text)
+		if err != nil {
+			return nil, p.errorf(p.pos, indent, "%v", err)
+		}
+		if !isKey {
+			return nil, p.errorf(p.pos, indent, "ожидалась пара «ключ: значение», получено %q", text)
+		}
+		if _, dup := obj.get(key); dup {
+			return nil, p.errorf(p.pos, indent, "ключ %q повторяется", key)
+		}
+		line := p.pos
+		p.pos++
+
+		var value interface{}
+		if rest == "" {
+			// Значение на следующих строках: вложенный блок или последовательность
+			// на том же отступе («key:\n- a»); иначе null
+			nextIndent, next, ok, err := p.peek()
+			if err != nil {
+				return nil, err
+			}
+			switch {
+			case ok && nextIndent > indent:
+				value, err = p.parseBlock(nextIndent, indent, depth+1)
+			case ok && nextIndent == indent && isYAMLSeqItem(next):
+				value, err = p.parseSequence(indent, depth+1)
+			}
+			if err != nil {
+				return nil, err
+			}
+		} else if value, err = p.parseValue(rest, line, indent, indent, depth+1); err != nil {
+			return nil, err
+		}
+		obj.set(key, value)
+	}
+}
+
+// parseSequence разбирает блочную последовательность «- элемент» с отступом indent
+func (p *yamlParser) parseSequence(indent, depth int) (interface{}, error) {
+	items := []interface{}{}
+	for {
+		lineIndent, text, ok, err := p.peek()
+		if err != nil {
+			return nil, err
+		}
+		if !ok || lineIndent < indent || (lineIndent == indent && !isYAMLSeqItem(text)) {
+			return items, nil
+		}
+		if lineIndent > indent {
+			return nil, p.errorf(p.pos, lineIndent, "неожиданный отступ")
+		}
+
+		var item interface{}
+		rest := strings.TrimLeft(text[1:], " ")
+		if rest == "" {
+			p.pos++
+			nextIndent, _, ok, err := p.peek()
+			if err != nil {
+				return nil, err
+			}
+			if ok && nextIndent > indent {
+				if item, err = p.parseBlock(nextIndent, indent, depth+1); err != nil {
+					return nil, err
+				}
+			}
+		} else {
+			// Компактная запись («- key: v», «- - a»): элемент разбирается как блок,
+			// начинающийся в колонке после «- »
+			col := indent + len(text) - len(rest)
+			p.lines[p.pos] = strings.Repeat(" ", col) + rest
+			if item, err = p.parseBlock(col, indent, depth+1); err != nil {
+				return nil, err
+			}
+		}
+		items = append(items, item)
+	}
+}
+
+// parseValue разбирает значение в строке line: блочный скаляр, коллекцию [..]
+// или {..}, строку в кавычках или скаляр без кавычек
+func (p *yamlParser) parseValue(text string, line, col, parent, depth int) (interface{}, error) {
+	switch text[0] {
+	case '|', '>':
+		return p.parseBlockScalar(text, line, col, parent)
+	case '[', '{':
+		f := &yamlFlow{s: text}
+		v, err := f.value(depth)
+		if err == nil && f.skipSpaces() < len(f.s) {
+			err = fmt.Errorf("лишние символы после коллекции: %q", f.s[f.i:])
+		}
+		if errors.Is(err, errYAMLUnclosed) {
+			// Позиция — конец строки, где коллекция должна была закрыться
+			return nil, p.errorf(line, col+len(f.s), "%v", err)
+		}
+		if err != nil {
+			return nil, p.errorf(line, col, "%v", err)
+		}
+		if f.special {
+			p.losses.add("значения .inf и .nan не представимы в JSON и сохранены как строки")
+		}
+		return v, nil
+	case '"', '\'':
+		s, end, err := parseYAMLQuoted(text)
+		if err == nil && strings.TrimSpace(text[end:]) != "" {
+			err = fmt.Errorf("лишние символы после строки: %q", text[end:])
+		}
+		if err != nil {
+			return nil, p.errorf(line, col, "%v", err)
+		}
+		return s, nil
+	case '&', '*', '!':
+		return nil, p.errorf(line, col, "%v", errYAMLAnchor)
+	case '%', '@', '`':
+		return nil, p.errorf(line, col, "символ %q зарезервирован и не может начинать значение", text[0])
+	}
+	if strings.Contains(text, ": ") {
+		return nil, p.errorf(line, col, "вложенное отображение должно начинаться с новой строки: %q", text)
+	}
+	v, special := resolveYAMLPlain(text)
+	if special {
+		p.losses.add("значения .inf и .nan не представимы в JSON и сохранены как строки")
+	}
+	return v, nil
+}
+
+// parseBlockScalar читает блочный скаляр: | сохраняет переводы строк, >
+// склеивает строки через пробел; индикаторы - и + управляют завершающими переводами
+func (p *yamlParser) parseBlockScalar(header string, line, col, parent int) (interface{}, error) {
+	folded := header[0] == '>'
+	chomp := byte(0)
+	contentIndent := -1
+	for _, c := range []byte(header[1:]) {
+		switch {
+		case (c == '-' || c == '+') && chomp == 0:
+			chomp = c
+		case c >= '1' && c <= '9' && contentIndent < 0:
+			contentIndent = max(parent, 0) + int(c-'0')
+		default:
+			return nil, p.errorf(line, col, "неверный заголовок блочного скаляра %q", header)
+		}
+	}
+
+	var body []string
+	for ; p.pos < len(p.lines); p.pos++ {
+		raw := p.lines[p.pos]
+		spaces := len(raw) - len(strings.TrimLeft(raw, " "))
+		if strings.TrimSpace(raw) == "" {
+			body = append(body, "")
+			continue
+		}
+		if spaces <= parent {
+			break
+		}
+		if contentIndent < 0 {
+			contentIndent = spaces
+		}
+		if spaces < contentIndent {
+			break
+		}
+		body = append(body, raw[contentIndent:])
+	}
+
+	// Завершающие пустые строки не входят в текст и учитываются только при «+»
+	trailing := 0
+	for len(body) > 0 && body[len(body)-1] == "" {
+		body = body[:len(body)-1]
+		trailing++
+	}
+	// Пустые строки, прочитанные после скаляра, возвращаются разбору
+	// (в них может начинаться следующий документ)
+	if chomp != '+' {
+		p.pos -= trailing
+	}
+
+	var text string
+	if folded {
+		text = foldYAMLLines(body)
+	} else {
+		text = strings.Join(body, "\n")
+	}
+	switch {
+	case chomp == '-' || len(body) == 0 && chomp != '+':
+	case chomp == '+':
+		if len(body) > 0 {
+			text += "\n"
+		}
+		text += strings.Repeat("\n", trailing)
+	default:
+		text += "\n"
+	}
+	return text, nil
+}
+
+// foldYAMLLines склеивает строки блочного скаляра > по правилам YAML:
+// соседние строки — через пробел, пустая строка — перевод строки, строки
+// с дополнительным отступом сохраняются как есть
+func foldYAMLLines(lines []string) string {
+	var b strings.Builder
+	breaks := 0
+	prev := ""
+	started := false
+	for _, l := range lines {
+		if l == "" {
+			breaks++
+			continue
+		}
+		moreIndented := func(s string) bool { return s[0] == ' ' || s[0] == '\t' }
+		switch {
+		case !started || breaks > 0:
+			b.WriteString(strings.Repeat("\n", breaks))
+		case moreIndented(l) || moreIndented(prev):
+			b.WriteByte('\n')
+		default:
+			b.WriteByte(' ')
+		}
+		b.WriteString(l)
+		breaks = 0
+		prev = l
+		started = true
+	}
+	return b.String()
+}
+
+// yamlFlow — разбор однострочной коллекции [..] или {..}
+type yamlFlow struct {
+	s       string
+	i       int
+	special bool
+}
+
+func (f *yamlFlow) skipSpaces() int {
+	for f.i < len(f.s) && f.s[f.i] == ' ' {
+		f.i++
+	}
+	return f.i
+}
+
+func (f *yamlFlow) value(depth int) (interface{}, error) {
+	if depth > maxDataDepth {
+		return nil, fmt.Errorf("превышена максимальная вложенность (%d)", maxDataDepth)
+	}
+	if f.skipSpaces() >= len(f.s) {
+		return nil, errYAMLUnclosed
+	}
+	switch f.s[f.i] {
+	case '[':
+		f.i++
+		items := []interface{}{}
+		for {
+			if f.skipSpaces() < len(f.s) && f.s[f.i] == ']' {
+				f.i++
+				return items, nil
+			}
+			item, err := f.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+			if err := f.separator(']'); err != nil {
+				return nil, err
+			}
+		}
+	case '{':
+		f.i++
+		obj := newOrderedObject()
+		for {
+			if f.skipSpaces() < len(f.s) && f.s[f.i] == '}' {
+				f.i++
+				return obj, nil
+			}
+			key, err := f.key()
+			if err != nil {
+				return nil, err
+			}
+			if _, dup := obj.get(key); dup {
+				return nil, fmt.Errorf("ключ %q повторяется", key)
+			}
+			var value interface{}
+			if f.skipSpaces() < len(f.s) && f.s[f.i] == ':' {
+				f.i++
+				if f.skipSpaces() < len(f.s) && f.s[f.i] != ',' && f.s[f.i] != '}' {
+					if value, err = f.value(depth + 1); err != nil {
+						return nil, err
+					}
+				}
+			}
+			obj.set(key, value)
+			if err := f.separator('}'); err != nil {
+				return nil, err
+			}
+		}
+	case '"', '\'':
+		s, end, err := parseYAMLQuoted(f.s[f.i:])
+		f.i += end
+		return s, err
+	case '&', '*', '!':
+		return nil, errYAMLAnchor
+	}
+	text := f.plain(",]}")
+	if text == "" {
+		return nil, fmt.Errorf("ожидалось значение в позиции %d", f.i+1)
+	}
+	v, special := resolveYAMLPlain(text)
+	f.special = f.special || special
+	return v, nil
+}
+
+// separator пропускает «,» между элементами или проверяет закрывающую скобку
+func (f *yamlFlow) separator(closing byte) error {
+	if f.skipSpaces() < len(f.s) {
+		switch f.s[f.i] {
+		case ',':
+			f.i++
+			return nil
+		case closing:
+			return nil
+		}
+	}
+	return fmt.Errorf("ожидалась «,» или «%c» в позиции %d", closing, f.i+1)
+}
+
+func (f *yamlFlow) key() (string, error) {
+	if f.skipSpaces() >= len(f.s) {
+		return "", errYAMLUnclosed
+	}
+	if f.s[f.i] == '"' || f.s[f.i] == '\'' {
+		s, end, err := parseYAMLQuoted(f.s[f.i:])
+		f.i += end
+		return s, err
+	}
+	if strings.ContainsRune("&*!", rune(f.s[f.i])) {
+		return "", errYAMLAnchor
+	}
+	key := f.plain(",:}")
+	if key == "" {
+		return "", fmt.Errorf("ожидался ключ в позиции %d", f.i+1)
+	}
+	return key, nil
+}
+
+// plain читает скаляр без кавычек до одного из символов stop
+func (f *yamlFlow) plain(stop string) string {
+	start := f.i
+	for f.i < len(f.s) && !strings.ContainsRune(stop, rune(f.s[f.i])) {
+		f.i++
+	}
+	return strings.TrimSpace(f.s[start:f.i])
+}
+
+// isYAMLSeqItem проверяет, что строка — элемент блочной последовательности
+func isYAMLSeqItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// splitYAMLKey делит строку «ключ: значение»; ok == false, если строка не пара
+func splitYAMLKey(text string) (key, rest string, ok bool, err error) {
+	if text == "?" || strings.HasPrefix(text, "? ") {
+		return "", "", false, errors.New("явные ключи «? » не поддерживаются")
+	}
+	switch text[0] {
+	case '[', '{', '|', '>':
+		return "", "", false, nil
+	case '"', '\'':
+		s, end, err := parseYAMLQuoted(text)
+		if err != nil {
+			return "", "", false, nil
+		}
+		after := strings.TrimLeft(text[end:], " ")
+		if after == ":" || strings.HasPrefix(after, ": ") {
+			return s, strings.TrimSpace(after[1:]), true, nil
+		}
+		return "", "", false, nil
+	}
+	for i := 0; i < len(text); i++ {
+		if text[i] == ':' && (i+1 == len(text) || text[i+1] == ' ') {
+			key = strings.TrimRight(text[:i], " ")
+			if key == "" {
+				return "", "", false, nil
+			}
+			if strings.ContainsRune("&*!", rune(key[0])) {
+				return "", "", false, errYAMLAnchor
+			}
+			return key, strings.TrimSpace(text[i+1:]), true, nil
+		}
+	}
+	return "", "", false, nil
+}
+
+// stripYAMLComment удаляет комментарий «#» вне строк в кавычках
+func stripYAMLComment(s string) string {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if quote != 0 {
+			switch {
+			case quote == '"' && c == '\\':
+				i++
+			case quote == '\'' && c == '\'' && i+1 < len(s) && s[i+1] == '\'':
+				i++
+			case c == quote:
+				quote = 0
+			}
+			continue
+		}
+		atStart := i == 0 || strings.ContainsRune(" \t[{,", rune(s[i-1]))
+		switch {
+		case c == '#' && (i == 0 || s[i-1] == ' ' || s[i-1] == '\t'):
+			return strings.TrimRight(s[:i], " \t")
+		case (c == '"' || c == '\'') && atStart:
+			quote = c
+		}
+	}
+	return strings.TrimRight(s, " \t")
+}
+
+// parseYAMLQuoted разбирает строку в одинарных или двойных кавычках в начале s;
+// end — позиция после закрывающей кавычки
+func parseYAMLQuoted(s string) (value string, end int, err error) {
+	quote := s[0]
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == quote && quote == '\'' && i+1 < len(s) && s[i+1] == '\'':
+			b.WriteByte('\'')
+			i++
+		case c == quote:
+			return b.String(), i + 1, nil
+		case c == '\\' && quote == '"':
+			n, err := unescapeYAML(&b, s[i+1:])
+			if err != nil {
+				return "", 0, err
+			}
+			i += n
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", 0, errors.New("строка в кавычках не закрыта (многострочные строки в кавычках не поддерживаются)")
+}
+
+// yamlEscapes — односимвольные escape-последовательности строк в двойных кавычках
+var yamlEscapes = map[byte]string{
+	'0': "\x00", 'a': "\a", 'b': "\b", 't': "\t", '\t': "\t", 'n': "\n", 'v': "\v",
+	'f': "\f", 'r': "\r", 'e': "\x1b", ' ': " ", '"': "\"", '/': "/", '\\': "\\",
+	'N': "\u0085", '_': "\u00a0", 'L': "\u2028", 'P': "\u2029",
+}
+
+// unescapeYAML декодирует escape-последовательность после «\»; возвращает
+// количество прочитанных байтов
+func unescapeYAML(b *strings.Builder, s string) (int, error) {
+	if s == "" {
+		return 0, errors.New("незавершённая escape-последовательность")
+	}
+	if r, ok := yamlEscapes[s[0]]; ok {
+		b.WriteString(r)
+		return 1, nil
+	}
+	width := map[byte]int{'x': 2, 'u': 4, 'U': 8}[s[0]]
+	if width == 0 || len(s) < 1+width {
+		return 0, fmt.Errorf("неверная escape-последовательность \\%c", s[0])
+	}
+	code, err := strconv.ParseUint(s[1:1+width], 16, 32)
+	if err != nil || !utf8.ValidRune(rune(code)) {
+		return 0, fmt.Errorf("неверная escape-последовательность \\%s", s[:1+width])
+	}
+	b.WriteRune(rune(code))
+	return 1 + width, nil
+}
+
+// resolveYAMLPlain определяет тип скаляра без кавычек по core-схеме YAML 1.2.
+// special — значение .inf/.nan, которое нельзя представить числом JSON
+func resolveYAMLPlain(s string) (value interface{}, special bool) {
+	switch s {
+	case "~", "null", "Null", "NULL":
+		return nil, false
+	case "true", "True", "TRUE":
+		return true, false
+	case "false", "False", "FALSE":
+		return false, false
+	}
+	switch strings.ToLower(strings.TrimLeft(s, "+-")) {
+	case ".inf", ".nan":
+		return s, true
+	}
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0o") {
+		base := map[byte]int{'x': 16, 'o': 8}[s[1]]
+		if n, err := strconv.ParseUint(s[2:], base, 64); err == nil {
+			return json.Number(strconv.FormatUint(n, 10)), false
+		}
+		return s, false
+	}
+	if yamlIntPattern.MatchString(s) {
+		sign := ""
+		digits := strings.TrimLeft(s, "+")
+		if strings.HasPrefix(digits, "-") {
+			sign, digits = "-", digits[1:]
+		}
+		if digits = strings.TrimLeft(digits, "0"); digits == "" {
+			return json.Number("0"), false
+		}
+		return json.Number(sign + digits), false
+	}
+	if yamlFloatPattern.MatchString(s) {
+		if json.Valid([]byte(s)) {
+			return json.Number(s), false
+		}
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return json.Number(strconv.FormatFloat(f, 'g', -1, 64)), false
+		}
+	}
+	return s, false
+}
+
+// encodeYAML записывает данные в блочном стиле YAML
+func encodeYAML(data interface{}) (string, []string, error) {
+	var b strings.Builder
+	if err := writeYAMLNode(&b, data, 0, 0); err != nil {
+		return "", nil, err
+	}
+	return b.String(), nil, nil
+}
+
+// writeYAMLNode пишет значение с новой строки с отступом indent
+func writeYAMLNode(b *strings.Builder, v interface{}, indent, depth int) error {
+	if depth > maxDataDepth {
+		return fmt.Errorf("превышена максимальная вложенность (%d)", maxDataDepth)
+	}
+	pad := strings.Repeat(" ", indent)
+	switch t := v.(type) {
+	case *orderedObject:
+		if len(t.keys) == 0 {
+			b.WriteString(pad + "{}\n")
+			return nil
+		}
+		for _, k := range t.keys {
+			b.WriteString(pad + yamlString(k) + ":")
+			if err := writeYAMLValue(b, t.values[k], indent, depth+1); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		if len(t) == 0 {
+			b.WriteString(pad + "[]\n")
+			return nil
+		}
+		for _, item := range t {
+			if isYAMLInline(item) {
+				b.WriteString(pad + "-")
+				if err := writeYAMLValue(b, item, indent, depth+1); err != nil {
+					return err
+				}
+				continue
+			}
+			// Вложенная коллекция начинается в строке элемента: «- key: v»
+			var nested strings.Builder
+			if err := writeYAMLNode(&nested, item, indent+2, depth+1); err != nil {
+				return err
+			}
+			b.WriteString(pad + "- " + nested.String()[indent+2:])
+		}
+	default:
+		s, err := yamlScalar(v)
+		if err != nil {
+			return err
+		}
+		b.WriteString(pad + s + "\n")
+	}
+	return nil
+}
+
+// writeYAMLValue пишет значение после «ключ:» или «-»
+func writeYAMLValue(b *strings.Builder, v interface{}, indent, depth int) error {
+	if !isYAMLInline(v) {
+		b.WriteString("\n")
+		return writeYAMLNode(b, v, indent+2, depth)
+	}
+	var s string
+	switch t := v.(type) {
+	case *orderedObject:
+		s = "{}"
+	case []interface{}:
+		s = "[]"
+	default:
+		var err error
+		if s, err = yamlScalar(t); err != nil {
+			return err
+		}
+	}
+	b.WriteString(" " + s + "\n")
+	return nil
+}
+
+// isYAMLInline — значение пишется в той же строке: скаляр или пустая коллекция
+func isYAMLInline(v interface{}) bool {
+	switch t := v.(type) {
+	case *orderedObject:
+		return len(t.keys) == 0
+	case []interface{}:
+		return len(t) == 0
+	}
+	return true
+}
+
+func yamlScalar(v interface{}) (string, error) {
+	switch t := v.(type) {
+	case nil:
+		return "null", nil
+	case string:
+		return yamlString(t), nil
+	case bool, json.Number, float64:
+		return scalarText(t), nil
+	}
+	return "", fmt.Errorf("тип %T не поддерживается", v)
+}
+
+// yamlString записывает строку без кавычек, если её нельзя спутать с другим
+// типом или синтаксисом YAML, иначе — в двойных кавычках
+func yamlString(s string) string {
+	if s == "" || strings.ContainsRune("-?:,[]{}#&*!|>'\"%@` ", rune(s[0])) ||
+		strings.HasSuffix(s, " ") || strings.HasSuffix(s, ":") ||
+		strings.Contains(s, ": ") || strings.Contains(s, " #") {
+		return strconv.Quote(s)
+	}
+	if v, special := resolveYAMLPlain(s); special || v != s {
+		return strconv.Quote(s)
+	}
+	for _, r := range s {
+		if !unicode.IsPrint(r) {
+			return strconv.Quote(s)
+		}
+	}
+	return s
+}
@@ -0,0 +1,426 @@
+package fs
+
+import (
+	"archive/zip"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// Шифрование ZIP по спецификации WinZip AE-2 (AES-256):
+// данные записи = соль (16 байт) + проверочное значение пароля (2 байта)
+// + зашифрованные AES-CTR сжатые данные + HMAC-SHA1 (10 байт)
+const (
+	// MinArchivePasswordLength — минимальная длина пароля архива
+	MinArchivePasswordLength = 8
+
+	zipMethodAES        = 99     // метод сжатия «AES» в заголовке записи
+	zipFlagEncrypted    = 0x1    // бит «зашифровано» в General Purpose Flags
+	aesExtraID          = 0x9901 // идентификатор дополнительного поля AES
+	extTimeExtraID      = 0x5455 // расширенная метка времени (Unix)
+	zipVersionAES       = 51     // версия формата, необходимая для AES
+	aesVendorVersionAE1 = 1
+	aesVendorVersionAE2 = 2
+	aesStrength256      = 3
+	aesPBKDF2Iterations = 1000
+	aesVerifierLen      = 2
+	aesMACLen           = 10
+)
+
+var (
+	// ErrPasswordRequired — архив содержит зашифрованные записи, а пароль не указан
+	ErrPasswordRequired = errors.New("архив зашифрован: требуется пароль")
+	// ErrWrongPassword — проверочное значение пароля не совпадает
+	ErrWrongPassword = errors.New("неверный пароль архива")
+	// errAuthFailed — код аутентификации HMAC не совпадает (данные изменены или повреждены)
+	errAuthFailed = errors.New("код аутентификации записи не совпадает: данные повреждены или изменены")
+)
+
+// aesParams — параметры из дополнительного поля 0x9901
+type aesParams struct {
+	version  uint16 // 1 — AE-1 (CRC32 сохраняется), 2 — AE-2 (CRC32 = 0)
+	strength byte   // 1 — AES-128, 2 — AES-192, 3 — AES-256
+	method   uint16 // фактический метод сжатия (0 — Store, 8 — Deflate)
+}
+
+// keyLen возвращает длину ключа AES в байтах (соль — вдвое короче)
+func (p aesParams) keyLen() int {
+	return 8 + 8*int(p.strength)
+}
+
+// isEncryptedEntry сообщает, зашифрована ли запись ZIP
+func isEncryptedEntry(f *zip.File) bool {
+	return f.Flags&zipFlagEncrypted != 0
+}
+
+// IsEncryptedZip сообщает, есть ли в ZIP-архиве зашифрованные записи
+func IsEncryptedZip(path string) (bool, error) {
+	safePath, err := ResolvePath(path)
+	if err != nil {
+		return false, err
+	}
+	r, err := zip.OpenReader(safePath)
+	if err != nil {
+		return false, err
+	}
+	defer r.Close()
+	for _, f := range r.File {
+		if isEncryptedEntry(f) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// validateArchivePassword проверяет пароль для создания зашифрованного архива
+func validateArchivePassword(password string) error {
+	if len(password) < MinArchivePasswordLength {
+		return fmt.Errorf("пароль архива должен содержать минимум %d символов", MinArchivePasswordLength)
+	}
+	return nil
+}
+
+// parseAESExtra ищет дополнительное поле AES среди полей заголовка
+func parseAESExtra(extra []byte) (aesParams, bool) {
+	for len(extra) >= 4 {
+		id := binary.LittleEndian.Uint16(extra[0:2])
+		size := int(binary.LittleEndian.Uint16(extra[2:4]))
+		if len(extra) < 4+size {
+			break
+		}
+		field := extra[4 : 4+size]
+		if id == aesExtraID && size >= 7 && field[2] == 'A' && field[3] == 'E' {
+			return aesParams{
+				version:  binary.LittleEndian.Uint16(field[0:2]),
+				strength: field[4],
+				method:   binary.LittleEndian.Uint16(field[5:7]),
+			}, true
+		}
+		extra = extra[4+size:]
+	}
+	return aesParams{}, false
+}
+
+// aesExtraField формирует дополнительное поле AE-2 для AES-256
+func aesExtraField(method uint16) []byte {
+	field := make([]byte, 11)
+	binary.LittleEndian.PutUint16(field[0:2], aesExtraID)
+	binary.LittleEndian.PutUint16(field[2:4], 7)
+	binary.LittleEndian.PutUint16(field[4:6], aesVendorVersionAE2)
+	field[6], field[7] = 'A', 'E'
+	field[8] = aesStrength256
+	binary.LittleEndian.PutUint16(field[9:11], method)
+	return field
+}
+
+// deriveAESKeys получает ключ шифрования, ключ HMAC и проверочное значение (PBKDF2-HMAC-SHA1)
+func deriveAESKeys(password string, salt []byte, keyLen int) (encKey, macKey, verifier []byte) {
+	derived := pbkdf2.Key([]byte(password), salt, aesPBKDF2Iterations, 2*keyLen+aesVerifierLen, sha1.New)
+	return derived[:keyLen], derived[keyLen : 2*keyLen], derived[2*keyLen:]
+}
+
+// winZipCTR — AES-CTR со счётчиком little-endian, начинающимся с 1
+// (стандартный cipher.NewCTR увеличивает счётчик как big-endian и несовместим с WinZip)
+type winZipCTR struct {
+	block   cipher.Block
+	counter [aes.BlockSize]byte
+	stream  [aes.BlockSize]byte
+	pos     int
+}
+
+func newWinZipCTR(block cipher.Block) *winZipCTR {
+	return &winZipCTR{block: block, pos: aes.BlockSize}
+}
+
+func (c *winZipCTR) XORKeyStream(dst, src []byte) {
+	for i := range src {
+		if c.pos == aes.BlockSize {
+			for j := range c.counter {
+				c.counter[j]++
+				if c.counter[j] != 0 {
+					break
+				}
+			}
+			c.block.Encrypt(c.stream[:], c.counter[:])
+			c.pos = 0
+		}
+		dst[i] = src[i] ^ c.stream[c.pos]
+		c.pos++
+	}
+}
+
+// writeEncryptedEntry сжимает и шифрует файл, записывая его в архив как запись AE-2
+// Размер шифротекста нужен до заголовка, поэтому данные сначала пишутся во временный файл
+func writeEncryptedEntry(archive *zip.Writer, header *zip.FileHeader, src io.Reader, password, tmpDir string) error {
+	method := header.Method
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	encKey, macKey, verifier := deriveAESKeys(password, salt, 32)
+	block, err := aes.NewCipher(encKey)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(tmpDir, ".zipaes-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	mac := hmac.New(sha1.New, macKey)
+	enc := &encryptWriter{w: tmp, ctr: newWinZipCTR(block), mac: mac}
+	var plainSize int64
+	if method == zip.Store {
+		plainSize, err = io.Copy(enc, src)
+	} else {
+		var fw *flate.Writer
+		fw, err = flate.NewWriter(enc, flate.DefaultCompression)
+		if err != nil {
+			return err
+		}
+		plainSize, err = io.Copy(fw, src)
+		if err == nil {
+			err = fw.Close()
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	header.Method = zipMethodAES
+	header.Flags |= zipFlagEncrypted
+	header.CRC32 = 0 // AE-2: целостность обеспечивает HMAC
+	header.CreatorVersion = header.CreatorVersion&0xff00 | zipVersionAES
+	header.ReaderVersion = zipVersionAES
+	header.Extra = append(header.Extra, aesExtraField(method)...)
+	setRawModTime(header)
+	header.UncompressedSize64 = uint64(plainSize)
+	header.CompressedSize64 = uint64(len(salt) + len(verifier) + int(enc.n) + aesMACLen)
+
+	writer, err := archive.CreateRaw(header)
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(append(salt, verifier...)); err != nil {
+		return err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := io.Copy(writer, tmp); err != nil {
+		return err
+	}
+	_, err = writer.Write(mac.Sum(nil)[:aesMACLen])
+	return err
+}
+
+// setRawModTime заполняет время записи так, как это делает CreateHeader
+// (CreateRaw пишет заголовок как есть): время MS-DOS и расширенная метка 0x5455 в UTC
+func setRawModTime(header *zip.FileHeader) {
+	if header.Modified.IsZero() {
+		return
+	}
+	t := header.Modified.UTC()
+	if t.Year() < 1980 {
+		t = zipEpoch
+	}
+	header.ModifiedDate = uint16(t.Day() + int(t.Month())<<5 + (t.Year()-1980)<<9)
+	header.ModifiedTime = uint16(t.Second()/2 + t.Minute()<<5 + t.Hour()<<11)
+
+	field := make([]byte, 9)
+	binary.LittleEndian.PutUint16(field[0:2], extTimeExtraID)
+	binary.LittleEndian.PutUint16(field[2:4], 5)
+	field[4] = 1 // присутствует только время изменения
+	binary.LittleEndian.PutUint32(field[5:9], uint32(t.Unix()))
+	header.Extra = append(header.Extra, field...)
+}
+
+// encryptWriter шифрует поток и считает HMAC по шифротексту
+type encryptWriter struct {
+	w   io.Writer
+	ctr *winZipCTR
+	mac hash.Hash
+	n   int64
+}
+
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	buf := make([]byte, len(p))
+	e.ctr.XORKeyStream(buf, p)
+	e.mac.Write(buf)
+	n, err := e.w.Write(buf)
+	e.n += int64(n)
+	return n, err
+}
+
+// openZipEntry открывает запись ZIP для чтения; зашифрованные записи AE-1/AE-2
+// расшифровываются паролем. Лимиты распаковки применяются вызывающим кодом
+func openZipEntry(f *zip.File, password string) (io.ReadCloser, error) {
+	if !isEncryptedEntry(f) {
+		return f.Open()
+	}
+	if password == "" {
+		return nil, ErrPasswordRequired
+	}
+	params, ok := parseAESExtra(f.Extra)
+	if !ok || f.Method != zipMethodAES {
+		return nil, fmt.Errorf("%s: поддерживается только шифрование AES (WinZip AE-1/AE-2)", f.Name)
+	}
+	if params.strength < 1 || params.strength > 3 {
+		return nil, fmt.Errorf("%s: неизвестная длина ключа AES", f.Name)
+	}
+
+	keyLen := params.keyLen()
+	saltLen := keyLen / 2
+	overhead := uint64(saltLen + aesVerifierLen + aesMACLen)
+	if f.CompressedSize64 < overhead {
+		return nil, fmt.Errorf("%s: %w", f.Name, io.ErrUnexpectedEOF)
+	}
+
+	raw, err := f.OpenRaw()
+	if err != nil {
+		return nil, err
+	}
+	head := make([]byte, saltLen+aesVerifierLen)
+	if _, err := io.ReadFull(raw, head); err != nil {
+		return nil, err
+	}
+	encKey, macKey, verifier := deriveAESKeys(password, head[:saltLen], keyLen)
+	if subtle.ConstantTimeCompare(verifier, head[saltLen:]) != 1 {
+		return nil, ErrWrongPassword
+	}
+	block, err := aes.NewCipher(encKey)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := &decryptReader{
+		r:    io.LimitReader(raw, int64(f.CompressedSize64-overhead)),
+		tail: raw,
+		ctr:  newWinZipCTR(block),
+		mac:  hmac.New(sha1.New, macKey),
+	}
+	var plain io.ReadCloser
+	switch params.method {
+	case zip.Store:
+		plain = io.NopCloser(dec)
+	case zip.Deflate:
+		plain = flate.NewReader(dec)
+	default:
+		return nil, fmt.Errorf("%s: %w", f.Name, zip.ErrAlgorithm)
+	}
+
+	entry := &aesEntryReader{plain: plain, dec: dec, declared: f.UncompressedSize64}
+	if params.version == aesVendorVersionAE1 {
+		entry.crc = crc32.NewIEEE()
+		entry.wantCRC = f.CRC32
+	}
+	return entry, nil
+}
+
+// decryptReader расшифровывает данные записи, считая HMAC по шифротексту;
+// после данных читает и сверяет код аутентификации
+type decryptReader struct {
+	r        io.Reader
+	tail     io.Reader
+	ctr      *winZipCTR
+	mac      hash.Hash
+	verified bool
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	n, err := d.r.Read(p)
+	if n > 0 {
+		d.mac.Write(p[:n])
+		d.ctr.XORKeyStream(p[:n], p[:n])
+	}
+	if err == io.EOF {
+		if verr := d.verify(); verr != nil {
+			return n, verr
+		}
+	}
+	return n, err
+}
+
+// verify сверяет HMAC (однократно, после чтения всех данных)
+func (d *decryptReader) verify() error {
+	if d.verified {
+		return nil
+	}
+	expected := make([]byte, aesMACLen)
+	if _, err := io.ReadFull(d.tail, expected); err != nil {
+		return io.ErrUnexpectedEOF
+	}
+	if !hmac.Equal(expected, d.mac.Sum(nil)[:aesMACLen]) {
+		return errAuthFailed
+	}
+	d.verified = true
+	return nil
+}
+
+// aesEntryReader отдаёт распакованные данные и по их окончании проверяет HMAC,
+// заявленный размер и (для AE-1) CRC32
+type aesEntryReader struct {
+	plain    io.ReadCloser
+	dec      *decryptReader
+	declared uint64
+	read     uint64
+	crc      hash.Hash32
+	wantCRC  uint32
+}
+
+func (e *aesEntryReader) Read(p []byte) (int, error) {
+	n, err := e.plain.Read(p)
+	e.read += uint64(n)
+	if e.crc != nil {
+		e.crc.Write(p[:n])
+	}
+	if e.read > e.declared {
+		return n, zip.ErrFormat
+	}
+	if err != nil && err != io.EOF {
+		// Ошибка распаковки после подмены шифротекста — сообщаем о нарушении аутентичности
+		if _, derr := io.Copy(io.Discard, e.dec); errors.Is(derr, errAuthFailed) {
+			return n, errAuthFailed
+		}
+		return n, err
+	}
+	if err == nil {
+		return n, nil
+	}
+
+	// Deflate может остановиться раньше конца шифротекста — дочитываем его для проверки HMAC
+	if _, derr := io.Copy(io.Discard, e.dec); derr != nil {
+		return n, derr
+	}
+	if verr := e.dec.verify(); verr != nil {
+		return n, verr
+	}
+	if e.read != e.declared {
+		return n, zip.ErrFormat
+	}
+	if e.crc != nil && e.crc.Sum32() != e.wantCRC {
+		return n, zip.ErrChecksum
+	}
+	return n, io.EOF
+}
+
+func (e *aesEntryReader) Close() error {
+	return e.plain.Close()
+}
@@ -1,16 +1,21 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"secure-fm/auth"
 	"secure-fm/config"
 	"secure-fm/db"
+	"secure-fm/editor"
 	"secure-fm/fs"
 	"secure-fm/utils"
 )
@@ -59,6 +64,7 @@ func main() {
 
 	db.InitDB(cfg)
 	fs.InitFS(cfg)
+	fs.SetIndexer(db.ContentIndex{})
 
 	// Создаём экземпляр приложения с инкапсулированным состоянием
 	app := NewApp(cfg)
@@ -244,13 +250,29 @@ func (app *App) mainMenu() {
 	fmt.Println("   8. Удалить файл")
 	fmt.Println("   9. Копировать файл")
 	fmt.Println("  10. Переместить файл")
+	fmt.Println("  31. Сравнить файлы (diff)  32. Применить патч")
+	fmt.Println("  33. Перекодировать файл / переводы строк")
 	fmt.Println("────────────────────────────────────────")
-	fmt.Println("ДАННЫЕ (JSON/XML)")
+	fmt.Println("ДАННЫЕ (JSON/XML/CSV)")
 	fmt.Println("  11. Создать JSON    12. Прочитать JSON")
 	fmt.Println("  13. Создать XML     14. Прочитать XML")
+	fmt.Println("  24. Проверить JSON по схеме")
+	fmt.Println("  25. Запрос JSONPath / XPath")
+	fmt.Println("  26. Изменить JSON (Pointer / Patch)")
+	fmt.Println("  27. Преобразовать формат (JSON/XML/YAML/CSV/TOML)")
+	fmt.Println("  28. Таблица CSV/TSV (просмотр и запросы)")
+	fmt.Println("  29. Журналы JSON Lines (фильтр, подсчёт, добавление)")
+	fmt.Println("  30. Сравнить JSON/XML документы (по структуре)")
 	fmt.Println("────────────────────────────────────────")
 	fmt.Println("АРХИВЫ")
-	fmt.Println("  15. Создать ZIP     16. Распаковать ZIP")
+	fmt.Println("  15. Создать архив   16. Распаковать архив")
+	fmt.Println("  20. Просмотр архива 21. Изменить ZIP")
+	fmt.Println("  22. Проверить целостность архива")
+	fmt.Println("  23. Проверить вложенные архивы")
+	fmt.Println("────────────────────────────────────────")
+	fmt.Println("ПОИСК")
+	fmt.Println("  17. Поиск файлов    18. Поиск по содержимому")
+	fmt.Println("  19. Перестроить индекс")
 	fmt.Println("────────────────────────────────────────")
 	fmt.Println("   0. Выход (Logout)")
 
@@ -345,104 +367,21 @@ func (app *App) mainMenu() {
 		fmt.Println("   Пример: test.txt, docs/readme.md")
 		inputPath := utils.ReadLine("File path: ")
 		path := app.resolveCwd(inputPath)
-		content, err := fs.ReadFile(path)
+		encoding := utils.ReadLine("Кодировка (Enter — определить автоматически): ")
+		text, err := fs.ReadText(path, encoding)
 		if err != nil {
 			fmt.Println("Error:", err)
 		} else {
-			fmt.Println("Content:\n", content)
+			fmt.Println("Версия:", text.Version)
+			fmt.Println("Кодировка:", describeEncoding(text))
+			fmt.Println("Content:\n", text.Content)
 		}
 		db.LogOperation("read_file", 0, app.currentUser.ID)
 
 	case "7": // Редактировать файл
 		fmt.Println("\nРедактирование файла")
 		inputPath := utils.ReadLine("File path: ")
-		path := app.resolveCwd(inputPath)
-		currentContent, err := fs.ReadFile(path)
-		if err != nil {
-			fmt.Println("Error reading file:", err)
-			return
-		}
-
-		// Разбиваем на строки
-		lines := strings.Split(currentContent, "\n")
-
-		fmt.Println("\n────────────────────────────────")
-		fmt.Println("Содержимое файла (по строкам):")
-		fmt.Println("────────────────────────────────")
-		for i, line := range lines {
-			fmt.Printf("  %d: %s\n", i+1, line)
-		}
-		fmt.Println("────────────────────────────────")
-
-		fmt.Println("\nВыберите действие:")
-		fmt.Println("1. Редактировать строку")
-		fmt.Println("2. Добавить строку в конец")
-		fmt.Println("3. Удалить строку")
-		fmt.Println("4. Перезаписать всё")
-		fmt.Println("0. Отмена")
-		action := utils.ReadLine("Действие: ")
-
-		switch action {
-		case "1": // Редактировать строку
-			lineNumStr := utils.ReadLine("Номер строки для редактирования: ")
-			lineNum := 0
-			fmt.Sscanf(lineNumStr, "%d", &lineNum)
-			if lineNum < 1 || lineNum > len(lines) {
-				fmt.Println("Неверный номер строки")
-				return
-			}
-			fmt.Printf("Текущее значение: %s\n", lines[lineNum-1])
-			newLine := utils.ReadLine("Новое значение: ")
-			lines[lineNum-1] = newLine
-			newContent := strings.Join(lines, "\n")
-			err = fs.WriteFile(path, newContent)
-			if err != nil {
-				fmt.Println("Error:", err)
-			} else {
-				fmt.Println("OK. Строка изменена")
-				db.LogOperation("edit_file", 0, app.currentUser.ID)
-			}
-		case "2": // Добавить строку
-			newLine := utils.ReadLine("Новая строка: ")
-			err = fs.AppendFile(path, "\n"+newLine)
-			if err != nil {
-				fmt.Println("Error:", err)
-			} else {
-				fmt.Println("OK. Строка добавлена")
-				db.LogOperation("edit_file", 0, app.currentUser.ID)
-			}
-		case "3": // Удалить строку
-			lineNumStr := utils.ReadLine("Номер строки для удаления: ")
-			lineNum := 0
-			fmt.Sscanf(lineNumStr, "%d", &lineNum)
-			if lineNum < 1 || lineNum > len(lines) {
-				fmt.Println("Неверный номер строки")
-				return
-			}
-			lines = append(lines[:lineNum-1], lines[lineNum:]...)
-			newContent := strings.Join(lines, "\n")
-			err = fs.WriteFile(path, newContent)
-			if err != nil {
-				fmt.Println("Error:", err)
-			} else {
-				fmt.Println("OK. Строка удалена")
-				db.LogOperation("edit_file", 0, app.currentUser.ID)
-			}
-		case "4": // Перезаписать всё
-			fmt.Println("Введите новое содержимое:")
-			newContent := utils.ReadLine("Content: ")
-			err = fs.WriteFile(path, newContent)
-			if err != nil {
-				fmt.Println("Error:", err)
-			} else {
-				fmt.Println("OK. Файл перезаписан")
-				db.LogOperation("edit_file", 0, app.currentUser.ID)
-			}
-		case "0":
-			fmt.Println("Отменено")
-		default:
-			fmt.Println("Неверное действие")
-		}
+		app.editFile(app.resolveCwd(inputPath))
 
 	case "8": // Удалить файл
 		fmt.Println("\nУдаление файла")
@@ -491,20 +430,32 @@ func (app *App) mainMenu() {
 			db.LogOperation("move_file", 0, app.currentUser.ID)
 		}
 
-	// ==================== ДАННЫЕ (JSON/XML) ====================
+	case "31": // Сравнить файлы
+		app.diffFiles()
+
+	case "32": // Применить патч
+		app.applyPatch()
+
+	case "33": // Кодировка и переводы строк
+		app.recodeFile()
+
+	// ==================== ДАННЫЕ (JSON/XML/CSV) ====================
 	case "11": // Создать JSON
 		fmt.Println("\nЗапись JSON файла")
-		fmt.Println("   Введите любой валидный JSON")
+		fmt.Println("   Введите любой валидный JSON, можно в несколько строк")
 		fmt.Println("   Пример: {\"name\": \"John\", \"age\": 25}")
 		inputPath := utils.ReadLine("File path: ")
 		path := app.resolveCwd(inputPath)
-		fmt.Println("   Введите JSON:")
-		jsonContent := utils.ReadLine("JSON: ")
-		err := fs.WriteFile(path, jsonContent)
+		jsonContent := utils.ReadMultiline("   Введите JSON")
+		data, err := fs.ParseJSON(jsonContent)
 		if err != nil {
+			fmt.Println("Error: некорректный JSON:", err)
+			break
+		}
+		if err := fs.WriteJSON(path, data); err != nil {
 			fmt.Println("Error:", err)
 		} else {
-			fmt.Println("OK. JSON файл создан")
+			fmt.Println("OK. JSON файл создан (сохранён с форматированием)")
 			db.LogOperation("write_json", 0, app.currentUser.ID)
 		}
 
@@ -518,22 +469,32 @@ func (app *App) mainMenu() {
 			fmt.Println("Error:", err)
 		} else {
 			fmt.Printf("Data: %+v\n", data)
+			// Если файлу назначена схема, сразу показываем нарушения
+			schema, violations, err := fs.ValidateAgainstRegistry(path, data)
+			if err != nil {
+				fmt.Println("Error: проверка по схеме:", err)
+			} else if schema != "" {
+				printSchemaViolations(schema, violations)
+			}
 		}
 		db.LogOperation("read_json", 0, app.currentUser.ID)
 
 	case "13": // Создать XML
 		fmt.Println("\nЗапись XML файла")
-		fmt.Println("   Введите любой валидный XML")
+		fmt.Println("   Введите любой валидный XML, можно в несколько строк (DOCTYPE запрещён)")
 		fmt.Println("   Пример: <user><name>John</name></user>")
 		inputPath := utils.ReadLine("File path: ")
 		path := app.resolveCwd(inputPath)
-		fmt.Println("   Введите XML:")
-		xmlContent := utils.ReadLine("XML: ")
-		err := fs.WriteFile(path, xmlContent)
+		xmlContent := utils.ReadMultiline("   Введите XML")
+		root, err := fs.ParseXML(strings.NewReader(xmlContent))
 		if err != nil {
+			fmt.Println("Error: некорректный XML:", err)
+			break
+		}
+		if err := fs.WriteXMLTree(path, root); err != nil {
 			fmt.Println("Error:", err)
 		} else {
-			fmt.Println("OK. XML файл создан")
+			fmt.Println("OK. XML файл создан (сохранён с форматированием)")
 			db.LogOperation("write_xml", 0, app.currentUser.ID)
 		}
 
@@ -542,45 +503,161 @@ func (app *App) mainMenu() {
 		fmt.Println("   Пример: data.xml, config/settings.xml")
 		inputPath := utils.ReadLine("File path: ")
 		path := app.resolveCwd(inputPath)
-		data, err := fs.ReadXML(path)
+		root, err := fs.ReadXMLTree(path)
 		if err != nil {
 			fmt.Println("Error:", err)
 		} else {
-			fmt.Printf("Data: %+v\n", data)
+			fmt.Print(fs.FormatXMLTree(root))
 		}
 		db.LogOperation("read_xml", 0, app.currentUser.ID)
 
 	// ==================== АРХИВЫ ====================
-	case "15": // Создать ZIP
-		fmt.Println("\nСоздание ZIP архива")
-		fmt.Println("   Шаг 1: укажите ЧТО архивировать (файл или папку)")
-		fmt.Println("   Шаг 2: укажите ИМЯ архива (например: archive.zip)")
+	case "15": // Создать архив
+		fmt.Println("\nСоздание архива")
+		fmt.Println("   Шаг 1: укажите ЧТО архивировать (файлы или папки через запятую)")
+		fmt.Println("   Шаг 2: укажите ИМЯ архива — формат определяется по расширению")
+		fmt.Println("   Пример: docs, notes.txt -> archive.zip, backup.tar, logs.tar.gz, notes.txt.gz (только файл)")
 		srcInput := utils.ReadLine("Что архивировать: ")
-		dstInput := utils.ReadLine("Имя архива (.zip): ")
-		src := app.resolveCwd(srcInput)
+		dstInput := utils.ReadLine("Имя архива: ")
+		var sources []string
+		for _, s := range splitList(srcInput) {
+			sources = append(sources, app.resolveCwd(s))
+		}
 		dst := app.resolveCwd(dstInput)
-		err := fs.CreateZip(src, dst)
+		format, err := fs.DetectArchiveFormat(dst)
+		if err == nil && format == fs.FormatZip {
+			// Для ZIP доступны исключения и воспроизводимый режим
+			opts := fs.ZipOptions{
+				Exclude:       splitList(utils.ReadLine("Исключить (шаблоны через запятую, Enter = ничего): ")),
+				Deterministic: strings.EqualFold(utils.ReadLine("Воспроизводимый архив (фиксированные время и права)? [y/N]: "), "y"),
+			}
+			opts.Password, err = readNewArchivePassword()
+			if err == nil {
+				err = fs.CreateZipWithOptions(sources, dst, opts)
+			}
+		} else if err == nil {
+			err = fs.CreateArchive(sources, dst)
+		}
 		if err != nil {
 			fmt.Println("Error:", err)
 		} else {
-			fmt.Println("OK. Zip created")
-			db.LogOperation("create_zip", 0, app.currentUser.ID)
+			fmt.Println("OK. Archive created")
+			db.LogOperation("create_"+archiveOpSuffix(format), 0, app.currentUser.ID)
 		}
 
-	case "16": // Распаковать ZIP
-		fmt.Println("\nРаспаковка ZIP архива")
-		fmt.Println("   Шаг 1: укажите ZIP файл")
+	case "16": // Распаковать архив
+		fmt.Println("\nРаспаковка архива (.zip, .tar, .tar.gz, .tgz, .gz)")
+		fmt.Println("   Шаг 1: укажите файл архива")
 		fmt.Println("   Шаг 2: укажите ПАПКУ для распаковки")
-		srcInput := utils.ReadLine("ZIP файл: ")
+		fmt.Println("   Шаг 3: при необходимости укажите шаблоны записей (*.txt, docs/, reports/*.json)")
+		fmt.Println("   Шаг 4: выберите, что делать с уже существующими файлами")
+		fmt.Println("   Архив переносится в папку только целиком: при ошибке ничего не изменится")
+		srcInput := utils.ReadLine("Архив: ")
 		dstInput := utils.ReadLine("Папка назначения: ")
+		patterns := splitList(utils.ReadLine("Шаблоны (через запятую, Enter = все): "))
+		policy, err := parseOverwritePolicy(utils.ReadLine("Существующие файлы [n = отменить, s = пропустить, r = заменить; Enter = n]: "))
 		src := app.resolveCwd(srcInput)
 		dst := app.resolveCwd(dstInput)
-		err := fs.Unzip(src, dst)
+		var format string
+		if err == nil {
+			format, err = fs.DetectArchiveFormat(src)
+		}
+		opts := fs.ExtractOptions{Patterns: patterns, Overwrite: policy}
+		if err == nil && format == fs.FormatZip {
+			// Пароль запрашивается, только если в архиве есть зашифрованные записи
+			if encrypted, encErr := fs.IsEncryptedZip(src); encErr == nil && encrypted {
+				opts.Password = utils.ReadLine("Пароль архива: ")
+			}
+		}
+		if err == nil {
+			// Предварительная проверка всех уровней вложенности до записи на диск
+			if report, scanErr := fs.ScanNested(src, opts.Password); scanErr == nil && !report.Safe() {
+				printNestedReport(report)
+				if !strings.EqualFold(utils.ReadLine("Распаковать несмотря на предупреждения? [y/N]: "), "y") {
+					fmt.Println("Распаковка отменена")
+					break
+				}
+			}
+			err = fs.ExtractArchive(src, dst, opts)
+		}
 		if err != nil {
 			fmt.Println("Error:", err)
 		} else {
-			fmt.Println("OK. Zip extracted")
-			db.LogOperation("extract_zip", 0, app.currentUser.ID)
+			fmt.Println("OK. Archive extracted")
+			db.LogOperation("extract_"+archiveOpSuffix(format), 0, app.currentUser.ID)
+		}
+
+	case "20": // Просмотр архива
+		app.inspectArchive()
+
+	case "21": // Изменить ZIP
+		app.updateZip()
+
+	case "22": // Проверить целостность архива
+		app.verifyArchive()
+
+	case "23": // Проверить вложенные архивы
+		app.scanNested()
+
+	case "24": // Проверить JSON по схеме
+		app.validateJSON()
+
+	case "25": // Запрос JSONPath / XPath
+		app.queryStructured()
+
+	case "26": // Изменить JSON
+		app.editJSON()
+
+	case "27": // Преобразовать формат
+		app.convertFormat()
+
+	case "28": // Таблица CSV/TSV
+		app.viewCSV()
+
+	case "29": // JSON Lines
+		app.ndjsonLog()
+
+	case "30": // Структурное сравнение
+		app.diffStructured()
+
+	// ==================== ПОИСК ====================
+	case "17": // Поиск файлов
+		app.searchFiles()
+
+	case "18": // Поиск по содержимому
+		fmt.Println("\nПолнотекстовый поиск по текстовым, JSON, XML файлам и ZIP-архивам")
+		fmt.Println("   Пример: отчёт, \"точная фраза\", ошибка -warning, json OR xml")
+		query := utils.ReadLine("Запрос: ")
+		if query == "" {
+			fmt.Println("Пустой запрос")
+			return
+		}
+		hits, err := db.SearchContent(query, 20)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		if len(hits) == 0 {
+			fmt.Println("   Ничего не найдено")
+		}
+		for i, h := range hits {
+			location := "/" + h.Path
+			if h.Entry != "" {
+				location += " → " + h.Entry
+			}
+			fmt.Printf("\n%2d. %s (rank %.3f)\n", i+1, location, h.Rank)
+			fmt.Printf("    %s\n", strings.ReplaceAll(h.Snippet, "\n", " "))
+		}
+		db.LogOperation("search_content", 0, app.currentUser.ID)
+
+	case "19": // Перестроить индекс
+		fmt.Println("\nПолная переиндексация содержимого sandbox...")
+		count, err := fs.ReindexAll()
+		if err != nil {
+			fmt.Println("Error:", err)
+		} else {
+			fmt.Printf("OK. Проиндексировано файлов: %d\n", count)
+			db.LogOperation("reindex", 0, app.currentUser.ID)
 		}
 
 	// ==================== ВЫХОД ====================
@@ -592,3 +669,900 @@ func (app *App) mainMenu() {
 		fmt.Println("Invalid option")
 	}
 }
+
+// searchFiles запрашивает фильтры поиска и выводит результаты постранично
+func (app *App) searchFiles() {
+	fmt.Println("\nПоиск файлов в текущей директории и поддиректориях")
+	fmt.Println("   Пустое значение — фильтр не используется")
+	fmt.Println("   Пример: *.txt, report_??.json")
+
+	var opts fs.SearchOptions
+	var err error
+
+	opts.NameGlob = utils.ReadLine("Имя (glob): ")
+	opts.NameRegex = utils.ReadLine("Имя (regex): ")
+	if opts.MinSize, err = parseSize(utils.ReadLine("Мин. размер (напр. 10K, 2M): ")); err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	if opts.MaxSize, err = parseSize(utils.ReadLine("Макс. размер: ")); err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	if opts.ModifiedAfter, err = parseDate(utils.ReadLine("Изменён после (YYYY-MM-DD): ")); err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	before, err := parseDate(utils.ReadLine("Изменён до (YYYY-MM-DD): "))
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	if !before.IsZero() {
+		// Включаем весь указанный день
+		opts.ModifiedBefore = before.Add(24*time.Hour - time.Nanosecond)
+	}
+	opts.Type = strings.ToLower(utils.ReadLine("Тип (file/dir, пусто = все): "))
+	opts.Extensions = splitList(utils.ReadLine("Расширения (через запятую): "))
+
+	opts.Limit = 20
+	for {
+		page, err := fs.Search(app.currentDir, opts)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+
+		if page.Total == 0 {
+			fmt.Println("   Ничего не найдено")
+			break
+		}
+		fmt.Printf("\nНайдено: %d (показаны %d-%d)\n", page.Total, opts.Offset+1, opts.Offset+len(page.Results))
+		if page.Truncated {
+			fmt.Printf("   Внимание: выведены первые %d совпадений, уточните фильтры\n", fs.MaxSearchResults)
+		}
+		for _, r := range page.Results {
+			if r.IsDir {
+				fmt.Printf("   📁 /%s/\n", r.Path)
+			} else {
+				fmt.Printf("   📄 /%s \t %d bytes \t %s\n", r.Path, r.Size, r.ModTime.Format("2006-01-02 15:04"))
+			}
+		}
+
+		hasNext := opts.Offset+len(page.Results) < page.Total && opts.Offset+len(page.Results) < fs.MaxSearchResults
+		if !hasNext && opts.Offset == 0 {
+			break
+		}
+		nav := utils.ReadLine("n — следующая, p — предыдущая, Enter — выход: ")
+		if nav == "n" && hasNext {
+			opts.Offset += opts.Limit
+		} else if nav == "p" && opts.Offset > 0 {
+			opts.Offset -= opts.Limit
+		} else {
+			break
+		}
+	}
+	db.LogOperation("search", 0, app.currentUser.ID)
+}
+
+// inspectArchive выводит содержимое архива без распаковки и помечает опасные записи
+func (app *App) inspectArchive() {
+	fmt.Println("\nПросмотр архива без распаковки (.zip, .tar, .tar.gz, .tgz, .gz)")
+	fmt.Println("   Записи, которые будут отклонены при распаковке, помечены ⚠")
+	inputPath := utils.ReadLine("Архив: ")
+	path := app.resolveCwd(inputPath)
+	report, err := fs.InspectArchive(path)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+
+	fmt.Printf("\nФормат: %s | Записей: %d | Архив: %d bytes | Распакованный размер: %d bytes\n",
+		report.Format, len(report.Entries), report.CompressedSize, report.TotalSize)
+	fmt.Printf("%-10s %12s %12s %8s %-10s %-16s %s\n", "Тип", "Размер", "Сжато", "Сжатие", "Права", "Изменён", "Имя")
+	for _, e := range report.Entries {
+		ratio := "-"
+		if e.Ratio > 0 {
+			ratio = fmt.Sprintf("%.1f:1", e.Ratio)
+		}
+		compressed := "-"
+		if e.CompressedSize > 0 {
+			compressed = strconv.FormatInt(e.CompressedSize, 10)
+		}
+		modified := "-"
+		if !e.Modified.IsZero() {
+			modified = e.Modified.Format("2006-01-02 15:04")
+		}
+		name := e.Name
+		if e.LinkTarget != "" {
+			name += " -> " + e.LinkTarget
+		}
+		if e.Encrypted {
+			name += " 🔒"
+		}
+		fmt.Printf("%-10s %12d %12s %8s %-10s %-16s %s\n", e.Type, e.Size, compressed, ratio, e.Mode.Perm(), modified, name)
+		for _, p := range e.Problems {
+			fmt.Printf("           ⚠ %s\n", p)
+		}
+	}
+	for _, p := range report.Problems {
+		fmt.Printf("⚠ %s\n", p)
+	}
+	if report.Safe() {
+		fmt.Println("\nOK. Архив пройдёт проверки распаковки")
+	} else {
+		fmt.Printf("\nВнимание: распаковка будет отклонена (проблемных записей: %d)\n", report.RejectedEntries)
+	}
+	db.LogOperation("inspect_archive", 0, app.currentUser.ID)
+}
+
+// updateZip добавляет, заменяет и удаляет записи существующего ZIP-архива
+func (app *App) updateZip() {
+	fmt.Println("\nИзменение ZIP архива (архив перезаписывается атомарно)")
+	inputPath := utils.ReadLine("ZIP файл: ")
+	path := app.resolveCwd(inputPath)
+
+	update := fs.ZipUpdate{Add: make(map[string]string)}
+	fmt.Println("   Добавление/замена: укажите файл и имя записи в архиве")
+	fmt.Println("   Пример: report.txt -> docs/report.txt (пустой файл — закончить)")
+	for {
+		source := utils.ReadLine("Файл для добавления: ")
+		if source == "" {
+			break
+		}
+		entry := utils.ReadLine("Имя в архиве [" + filepath.Base(source) + "]: ")
+		if entry == "" {
+			entry = filepath.Base(source)
+		}
+		update.Add[entry] = app.resolveCwd(source)
+	}
+	fmt.Println("   Удаление: шаблоны записей (old/*.log, draft.txt, tmp/)")
+	update.Remove = splitList(utils.ReadLine("Удалить (через запятую, Enter = ничего): "))
+
+	if len(update.Add) == 0 && len(update.Remove) == 0 {
+		fmt.Println("Изменений нет")
+		return
+	}
+
+	result, err := fs.UpdateZip(path, update)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	fmt.Printf("OK. Добавлено: %d, заменено: %d, удалено: %d\n", result.Added, result.Replaced, result.Removed)
+	db.LogOperation("update_zip", 0, app.currentUser.ID)
+}
+
+// verifyArchive проверяет читаемость всех записей архива и сохраняет результат в метаданных
+func (app *App) verifyArchive() {
+	fmt.Println("\nПроверка целостности архива (CRC32, размеры, лимиты распаковки)")
+	fmt.Println("   Пример: backup.zip, logs.tar.gz")
+	inputPath := utils.ReadLine("Архив: ")
+	path := app.resolveCwd(inputPath)
+	report, err := fs.VerifyArchive(path)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+
+	for _, e := range report.Entries {
+		mark := "✔"
+		if e.Status == fs.VerifyEncrypted {
+			mark = "🔒"
+		} else if e.Status != fs.VerifyOK {
+			mark = "✘"
+		}
+		fmt.Printf("   %s %-10s %12d bytes  %s\n", mark, e.Status, e.Actual, e.Name)
+		if e.Detail != "" {
+			fmt.Printf("        %s\n", e.Detail)
+		}
+	}
+	for _, p := range report.Problems {
+		fmt.Printf("   ⚠ %s\n", p)
+	}
+	switch report.Status() {
+	case fs.VerifyOK:
+		fmt.Println("OK.", report.Summary())
+	case fs.VerifyIncomplete:
+		fmt.Println("Внимание:", report.Summary())
+	default:
+		fmt.Println("Архив повреждён:", report.Summary())
+	}
+
+	id, err := db.RecordVerification(filepath.Base(path), report.ArchiveSize, path, app.currentUser.ID, report.Status(), report.Summary())
+	if err != nil {
+		fmt.Println("Не удалось сохранить результат проверки:", err)
+	}
+	db.LogOperation("verify_archive", id, app.currentUser.ID)
+}
+
+// splitList разбивает ввод через запятую, отбрасывая пустые элементы
+func splitList(input string) []string {
+	var items []string
+	for _, item := range strings.Split(input, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// readNewArchivePassword запрашивает пароль для шифрования архива (Enter — без шифрования)
+func readNewArchivePassword() (string, error) {
+	password := utils.ReadLine("Пароль для шифрования AES-256 (Enter = без шифрования): ")
+	if password == "" {
+		return "", nil
+	}
+	if len(password) < fs.MinArchivePasswordLength {
+		return "", fmt.Errorf("пароль архива должен содержать минимум %d символов", fs.MinArchivePasswordLength)
+	}
+	if utils.ReadLine("Повторите пароль: ") != password {
+		return "", fmt.Errorf("пароли не совпадают")
+	}
+	return password, nil
+}
+
+// parseOverwritePolicy разбирает выбор политики перезаписи при распаковке
+func parseOverwritePolicy(input string) (fs.OverwritePolicy, error) {
+	switch strings.ToLower(strings.TrimSpace(input)) {
+	case "", "n":
+		return fs.OverwriteNever, nil
+	case "s":
+		return fs.OverwriteSkip, nil
+	case "r":
+		return fs.OverwriteReplace, nil
+	}
+	return fs.OverwriteNever, fmt.Errorf("неизвестный вариант: %s", input)
+}
+
+// archiveOpSuffix возвращает суффикс типа операции для журнала аудита (create_zip, extract_tar_gz)
+func archiveOpSuffix(format string) string {
+	return strings.ReplaceAll(format, ".", "_")
+}
+
+// parseSize разбирает размер вида "512", "10K", "2M", "1G" (пустая строка — 0)
+func parseSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if s == "" {
+		return 0, nil
+	}
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(s, "K"):
+		multiplier = 1024
+	case strings.HasSuffix(s, "M"):
+		multiplier = 1024 * 1024
+	case strings.HasSuffix(s, "G"):
+		multiplier = 1024 * 1024 * 1024
+	}
+	if multiplier > 1 {
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("некорректный размер: %s", s)
+	}
+	return n * multiplier, nil
+}
+
+// parseDate разбирает дату в формате YYYY-MM-DD (пустая строка — нулевое время)
+func parseDate(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", s, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("некорректная дата: %s (ожидается YYYY-MM-DD)", s)
+	}
+	return t, nil
+}
+
+// scanNested рекурсивно проверяет архив и вложенные в него архивы без распаковки
+func (app *App) validateJSON() {
+	fmt.Println("\nПроверка JSON по схеме (JSON Schema 2020-12, основные ключевые слова)")
+	fmt.Printf("   Схемы назначаются файлам в %s в корне sandbox, например:\n", fs.SchemaRegistryFile)
+	fmt.Println(`   {"schemas": [{"files": "config/*.json", "schema": "schemas/config.json", "enforce": true}]}`)
+	fmt.Println("   enforce: true — файлы, не прошедшие проверку, не записываются")
+	inputPath := utils.ReadLine("JSON файл: ")
+	path := app.resolveCwd(inputPath)
+
+	schema, violations, err := fs.ValidateJSONFile(path)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	if schema == "" {
+		fmt.Printf("Файлу не назначена схема в %s\n", fs.SchemaRegistryFile)
+		return
+	}
+	printSchemaViolations(schema, violations)
+	db.LogOperation("validate_json", 0, app.currentUser.ID)
+}
+
+// printSchemaViolations выводит результат проверки документа по схеме
+func printSchemaViolations(schema string, violations []fs.SchemaViolation) {
+	if len(violations) == 0 {
+		fmt.Printf("OK. Документ соответствует схеме %s\n", schema)
+		return
+	}
+	fmt.Printf("⚠ Нарушений схемы %s: %d\n", schema, len(violations))
+	for _, v := range violations {
+		fmt.Printf("   %s\n", v)
+	}
+}
+
+func (app *App) editJSON() {
+	fmt.Println("\nИзменение JSON документа (порядок ключей сохраняется, запись атомарная)")
+	fmt.Println("   Путь задаётся JSON Pointer: /server/port, /hosts/0, /hosts/- (конец массива)")
+	fmt.Println("   1. Установить значение   2. Вставить значение   3. Удалить значение")
+	fmt.Println("   4. JSON Patch (RFC 6902) 5. JSON Merge Patch (RFC 7396)")
+	action := utils.ReadLine("Действие: ")
+	inputPath := utils.ReadLine("JSON файл: ")
+	path := app.resolveCwd(inputPath)
+
+	var err error
+	switch action {
+	case "1", "2":
+		pointer := utils.ReadLine("JSON Pointer: ")
+		fmt.Println("   Значение в формате JSON: 8080, \"text\", true, {\"a\": 1}")
+		value := utils.ReadLine("Значение: ")
+		if action == "1" {
+			err = fs.SetJSONValue(path, pointer, value)
+		} else {
+			err = fs.InsertJSONValue(path, pointer, value)
+		}
+	case "3":
+		err = fs.DeleteJSONValue(path, utils.ReadLine("JSON Pointer: "))
+	case "4":
+		fmt.Println(`   Пример: [{"op": "replace", "path": "/port", "value": 8080}, {"op": "remove", "path": "/debug"}]`)
+		err = fs.ApplyJSONPatch(path, utils.ReadMultiline("   Введите JSON Patch"))
+	case "5":
+		fmt.Println(`   Пример: {"port": 8080, "debug": null} — null удаляет ключ`)
+		err = fs.ApplyMergePatch(path, utils.ReadMultiline("   Введите Merge Patch"))
+	default:
+		fmt.Println("Invalid option")
+		return
+	}
+
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	fmt.Println("OK. Документ изменён")
+	db.LogOperation("edit_json", 0, app.currentUser.ID)
+}
+
+func (app *App) convertFormat() {
+	fmt.Println("\nПреобразование структурированных данных (формат определяется по расширению)")
+	fmt.Println("   Пример: data.json → data.yaml, table.csv → table.json, config.toml → config.json")
+	src := app.resolveCwd(utils.ReadLine("Исходный файл: "))
+	dst := app.resolveCwd(utils.ReadLine("Новый файл: "))
+
+	losses, err := fs.ConvertFile(src, dst, false)
+	var lossy *fs.LossyConversionError
+	if errors.As(err, &lossy) {
+		fmt.Printf("Преобразование %s → %s изменит данные:\n", lossy.From, lossy.To)
+		for _, l := range lossy.Losses {
+			fmt.Println("   -", l)
+		}
+		if !strings.EqualFold(utils.ReadLine("Всё равно преобразовать? [y/N]: "), "y") {
+			fmt.Println("Отменено")
+			return
+		}
+		losses, err = fs.ConvertFile(src, dst, true)
+	}
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	if len(losses) > 0 {
+		fmt.Printf("OK. Файл записан, потерь: %d\n", len(losses))
+	} else {
+		fmt.Println("OK. Файл записан без потерь")
+	}
+	db.LogOperation("convert", 0, app.currentUser.ID)
+}
+
+// csvPageSize — сколько строк таблицы выводится на одной странице
+const csvPageSize = 20
+
+// delimiterNames — названия разделителей CSV для вывода
+var delimiterNames = map[rune]string{',': "запятая", ';': "точка с запятой", '\t': "табуляция", '|': "вертикальная черта"}
+
+func (app *App) viewCSV() {
+	fmt.Println("\nПросмотр таблицы CSV/TSV (кодировка и разделитель определяются автоматически)")
+	inputPath := utils.ReadLine("Файл: ")
+	path := app.resolveCwd(inputPath)
+	table, err := fs.ReadCSV(path)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	fmt.Printf("Колонок: %d, строк: %d, разделитель: %s, кодировка: %s\n",
+		len(table.Header), len(table.Rows), delimiterNames[table.Delimiter], table.Encoding)
+	fmt.Println("   Колонки:", strings.Join(table.Header, ", "))
+	fmt.Println("   Запрос (пусто — вся таблица), например:")
+	fmt.Println("   SELECT name, age WHERE age >= 18 AND city = 'Москва' ORDER BY age DESC LIMIT 10")
+	fmt.Println("   SELECT city, COUNT(*), AVG(salary) GROUP BY city ORDER BY count(*) DESC")
+	if query := utils.ReadLine("Запрос: "); query != "" {
+		if table, err = table.Query(query); err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+	}
+	db.LogOperation("view_csv", 0, app.currentUser.ID)
+
+	if len(table.Rows) == 0 {
+		fmt.Print(fs.FormatTable(table, 0, 0))
+		fmt.Println("Нет строк")
+		return
+	}
+	pages := (len(table.Rows) + csvPageSize - 1) / csvPageSize
+	for page := 0; ; {
+		from := page * csvPageSize
+		fmt.Println()
+		fmt.Print(fs.FormatTable(table, from, from+csvPageSize))
+		fmt.Printf("Строки %d–%d из %d, страница %d из %d\n",
+			from+1, min(from+csvPageSize, len(table.Rows)), len(table.Rows), page+1, pages)
+		if pages == 1 {
+			return
+		}
+		switch input := utils.ReadLine("Enter — далее, p — назад, номер — страница, q — выход: "); {
+		case input == "q":
+			return
+		case input == "p":
+			page = max(page-1, 0)
+		case input == "":
+			if page++; page == pages {
+				return
+			}
+		default:
+			n, err := strconv.Atoi(input)
+			if err != nil || n < 1 || n > pages {
+				fmt.Println("Нет такой страницы")
+				continue
+			}
+			page = n - 1
+		}
+	}
+}
+
+func (app *App) ndjsonLog() {
+	fmt.Println("\nЖурналы JSON Lines (.jsonl, .ndjson): файл читается по строкам, не целиком")
+	fmt.Println("   1. Показать записи   2. Подсчитать записи   3. Добавить запись")
+	action := utils.ReadLine("Действие: ")
+	path := app.resolveCwd(utils.ReadLine("Файл: "))
+
+	if action == "3" {
+		fmt.Println(`   Пример: {"level": "info", "msg": "запуск"}`)
+		fmt.Printf("   Проверяется только новая запись; размер журнала — до %d MB\n", fs.MaxNDJSONFileSize>>20)
+		if err := fs.AppendNDJSONRecord(path, utils.ReadMultiline("   Введите запись (JSON)")); err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		fmt.Println("OK. Запись добавлена")
+		db.LogOperation("ndjson_append", 0, app.currentUser.ID)
+		return
+	}
+	if action != "1" && action != "2" {
+		fmt.Println("Invalid option")
+		return
+	}
+
+	var opts fs.NDJSONOptions
+	fmt.Println("   Фильтр (пусто — все записи): @.level == 'error' && @.status >= 500")
+	opts.Filter = utils.ReadLine("Фильтр: ")
+	var show func(fs.NDJSONRecord) error
+	if action == "1" {
+		if fields := utils.ReadLine("Поля через запятую (пусто — все, /a/b — JSON Pointer): "); fields != "" {
+			opts.Fields = strings.Split(fields, ",")
+		}
+		opts.Limit = maxPrintedMatches
+		show = func(rec fs.NDJSONRecord) error {
+			value, err := json.Marshal(rec.Value)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%6d: %s\n", rec.Line, value)
+			return nil
+		}
+	}
+
+	stats, err := fs.ScanNDJSON(path, opts, show)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	fmt.Printf("\nСтрок: %d, записей: %d, подходят: %d, ошибок: %d\n",
+		stats.Lines, stats.Records, stats.Matched, stats.ErrorCount)
+	if stats.Partial {
+		fmt.Printf("   Показаны первые %d подходящих записей\n", opts.Limit)
+	}
+	for _, e := range stats.Errors {
+		fmt.Println("   -", e)
+	}
+	if stats.ErrorCount > len(stats.Errors) {
+		fmt.Printf("   ... и ещё %d\n", stats.ErrorCount-len(stats.Errors))
+	}
+	db.LogOperation("ndjson_scan", 0, app.currentUser.ID)
+}
+
+func (app *App) diffStructured() {
+	fmt.Println("\nСтруктурное сравнение документов (JSON, XML, YAML, TOML, CSV)")
+	fmt.Println("   Форматирование и порядок ключей не учитываются, 1.0 и 1 — одно число")
+	pathA := app.resolveCwd(utils.ReadLine("Первый файл: "))
+	pathB := app.resolveCwd(utils.ReadLine("Второй файл: "))
+	fmt.Println("   1. Текст (+ добавлено, - удалено, ~ изменено)   2. JSON Patch (RFC 6902)")
+	output := utils.ReadLine("Вывод: ")
+
+	changes, err := fs.DiffFiles(pathA, pathB)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	switch output {
+	case "1", "":
+		fmt.Println()
+		fmt.Print(fs.FormatDiff(changes))
+	case "2":
+		patch, err := fs.DiffPatch(changes)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		fmt.Println()
+		fmt.Print(patch)
+	default:
+		fmt.Println("Invalid option")
+		return
+	}
+	fmt.Printf("Различий: %d\n", len(changes))
+	db.LogOperation("diff_structured", 0, app.currentUser.ID)
+}
+
+// editFile открывает файл в полноэкранном редакторе; если ввод не терминал,
+// используется построчный редактор
+func (app *App) editFile(path string) {
+	saved, err := editor.Edit(path, utils.Input())
+	if errors.Is(err, editor.ErrNoTerminal) {
+		app.lineEditor(path)
+		return
+	}
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	if saved {
+		fmt.Println("OK. Файл сохранён")
+		db.LogOperation("edit_file", 0, app.currentUser.ID)
+	} else {
+		fmt.Println("Файл не изменён")
+	}
+}
+
+// lineEditor — построчное редактирование (без полноэкранного режима)
+func (app *App) lineEditor(path string) {
+	// Версия файла при чтении: если за время редактирования файл изменят,
+	// запись будет отклонена, а не затрёт чужие правки
+	currentContent, version, err := fs.ReadFileVersion(path)
+	if err != nil {
+		fmt.Println("Error reading file:", err)
+		return
+	}
+
+	// Разбиваем на строки
+	lines := strings.Split(currentContent, "\n")
+
+	fmt.Println("\n────────────────────────────────")
+	fmt.Println("Содержимое файла (по строкам):")
+	fmt.Println("────────────────────────────────")
+	for i, line := range lines {
+		fmt.Printf("  %d: %s\n", i+1, line)
+	}
+	fmt.Println("────────────────────────────────")
+
+	fmt.Println("\nВыберите действие:")
+	fmt.Println("1. Редактировать строку")
+	fmt.Println("2. Добавить строку в конец")
+	fmt.Println("3. Удалить строку")
+	fmt.Println("4. Перезаписать всё")
+	fmt.Println("0. Отмена")
+	action := utils.ReadLine("Действие: ")
+
+	switch action {
+	case "1": // Редактировать строку
+		lineNumStr := utils.ReadLine("Номер строки для редактирования: ")
+		lineNum := 0
+		fmt.Sscanf(lineNumStr, "%d", &lineNum)
+		if lineNum < 1 || lineNum > len(lines) {
+			fmt.Println("Неверный номер строки")
+			return
+		}
+		fmt.Printf("Текущее значение: %s\n", lines[lineNum-1])
+		newLine := utils.ReadLine("Новое значение: ")
+		lines[lineNum-1] = newLine
+		newContent := strings.Join(lines, "\n")
+		err = fs.WriteFileIfMatch(path, newContent, version)
+		if err != nil {
+			fmt.Println("Error:", err)
+		} else {
+			fmt.Println("OK. Строка изменена")
+			printChanges(path, currentContent, newContent)
+			db.LogOperation("edit_file", 0, app.currentUser.ID)
+		}
+	case "2": // Добавить строку
+		newLine := utils.ReadLine("Новая строка: ")
+		err = fs.AppendFile(path, "\n"+newLine)
+		if err != nil {
+			fmt.Println("Error:", err)
+		} else {
+			fmt.Println("OK. Строка добавлена")
+			printChanges(path, currentContent, currentContent+"\n"+newLine)
+			db.LogOperation("edit_file", 0, app.currentUser.ID)
+		}
+	case "3": // Удалить строку
+		lineNumStr := utils.ReadLine("Номер строки для удаления: ")
+		lineNum := 0
+		fmt.Sscanf(lineNumStr, "%d", &lineNum)
+		if lineNum < 1 || lineNum > len(lines) {
+			fmt.Println("Неверный номер строки")
+			return
+		}
+		lines = append(lines[:lineNum-1], lines[lineNum:]...)
+		newContent := strings.Join(lines, "\n")
+		err = fs.WriteFileIfMatch(path, newContent, version)
+		if err != nil {
+			fmt.Println("Error:", err)
+		} else {
+			fmt.Println("OK. Строка удалена")
+			printChanges(path, currentContent, newContent)
+			db.LogOperation("edit_file", 0, app.currentUser.ID)
+		}
+	case "4": // Перезаписать всё
+		newContent := utils.ReadMultiline("Введите новое содержимое")
+		err = fs.WriteFileIfMatch(path, newContent, version)
+		if err != nil {
+			fmt.Println("Error:", err)
+		} else {
+			fmt.Println("OK. Файл перезаписан")
+			printChanges(path, currentContent, newContent)
+			db.LogOperation("edit_file", 0, app.currentUser.ID)
+		}
+	case "0":
+		fmt.Println("Отменено")
+	default:
+		fmt.Println("Неверное действие")
+	}
+}
+
+// printChanges выводит изменения файла в формате unified diff
+func printChanges(path, oldContent, newContent string) {
+	if diff := fs.DiffText("a/"+path, "b/"+path, oldContent, newContent, fs.DefaultDiffContext); diff != "" {
+		fmt.Println("Изменения:")
+		fmt.Print(diff)
+	}
+}
+
+func (app *App) diffFiles() {
+	fmt.Println("\nСравнение текстовых файлов (unified diff)")
+	pathA := app.resolveCwd(utils.ReadLine("Первый файл: "))
+	pathB := app.resolveCwd(utils.ReadLine("Второй файл: "))
+	context := fs.DefaultDiffContext
+	if input := utils.ReadLine(fmt.Sprintf("Строк контекста [%d]: ", context)); input != "" {
+		n, err := strconv.Atoi(input)
+		if err != nil {
+			fmt.Println("Неверное число")
+			return
+		}
+		context = n
+	}
+
+	diff, err := fs.UnifiedDiff(pathA, pathB, context)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	if diff == "" {
+		fmt.Println("Файлы совпадают")
+	} else {
+		fmt.Println()
+		fmt.Print(diff)
+		if dst := utils.ReadLine("Сохранить патч в файл (пусто — не сохранять): "); dst != "" {
+			if err := fs.WriteFile(app.resolveCwd(dst), diff); err != nil {
+				fmt.Println("Error:", err)
+				return
+			}
+			fmt.Println("OK. Патч сохранён")
+		}
+	}
+	db.LogOperation("diff_files", 0, app.currentUser.ID)
+}
+
+// describeEncoding описывает кодировку и переводы строк прочитанного файла
+func describeEncoding(text *fs.TextFile) string {
+	desc := text.Encoding
+	if text.BOM {
+		desc += " с BOM"
+	}
+	if text.Detected {
+		desc += " (определена автоматически)"
+	}
+	if text.LineEnding != "" {
+		desc += ", переводы строк: " + text.LineEnding
+	}
+	return desc
+}
+
+func (app *App) recodeFile() {
+	fmt.Println("\nПерекодирование файла и переводы строк")
+	fmt.Println("   Кодировки:", strings.Join(fs.Encodings, ", "))
+	path := app.resolveCwd(utils.ReadLine("File path: "))
+	text, err := fs.ReadText(path, utils.ReadLine("Исходная кодировка (Enter — определить автоматически): "))
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	fmt.Println("Сейчас:", describeEncoding(text))
+
+	opts := fs.RecodeOptions{From: text.Encoding}
+	opts.To = utils.ReadLine("Новая кодировка (Enter — " + fs.EncodingUTF8 + ", - — не менять): ")
+	switch opts.To {
+	case "":
+		opts.To = fs.EncodingUTF8
+	case "-":
+		opts.To = ""
+	}
+	switch strings.ToUpper(utils.ReadLine("Переводы строк (LF / CRLF, Enter — не менять): ")) {
+	case "":
+	case fs.LineEndingLF:
+		opts.LineEnding = fs.LineEndingLF
+	case fs.LineEndingCRLF:
+		opts.LineEnding = fs.LineEndingCRLF
+	default:
+		fmt.Println("Неверный вид переводов строк")
+		return
+	}
+
+	result, err := fs.RecodeFile(path, opts)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	if !result.Changed {
+		fmt.Println("Файл уже в нужной кодировке, изменений нет")
+		return
+	}
+	fmt.Printf("OK. %s → %s", result.From, result.To)
+	if result.LineEndingFrom != result.LineEnding {
+		fmt.Printf(", переводы строк: %s → %s", result.LineEndingFrom, result.LineEnding)
+	}
+	fmt.Println()
+	db.LogOperation("recode_file", 0, app.currentUser.ID)
+}
+
+func (app *App) applyPatch() {
+	fmt.Println("\nПрименение патча (unified diff)")
+	fmt.Println("   Пути в патче указываются от корня sandbox; патч применяется целиком или не применяется")
+	patch, err := fs.ReadFile(app.resolveCwd(utils.ReadLine("Файл патча: ")))
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	target := ""
+	if input := utils.ReadLine("Файл для изменения (пусто — из заголовков патча): "); input != "" {
+		target = app.resolveCwd(input)
+	}
+
+	result, err := fs.ApplyPatch(patch, target, fs.DefaultPatchFuzz)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	for _, h := range result.Hunks {
+		fmt.Println("   ", h)
+	}
+	fmt.Printf("OK. Изменено: %d, создано: %d, удалено: %d\n", len(result.Modified), len(result.Created), len(result.Deleted))
+	db.LogOperation("apply_patch", 0, app.currentUser.ID)
+}
+
+// maxPrintedMatches — сколько совпадений запроса выводить на экран
+const maxPrintedMatches = 50
+
+func (app *App) queryStructured() {
+	fmt.Println("\nЗапрос к JSON (JSONPath) или XML (XPath)")
+	fmt.Println("   JSONPath: $.store.book[*].title, $..price, $.items[?(@.price < 10)]")
+	fmt.Println("   XPath:    /catalog/book[@id='1']/title, //book[last()], //item/@id")
+	inputPath := utils.ReadLine("Файл: ")
+	path := app.resolveCwd(inputPath)
+	expr := utils.ReadLine("Выражение: ")
+
+	isXML := strings.EqualFold(filepath.Ext(path), ".xml") ||
+		(!strings.EqualFold(filepath.Ext(path), ".json") && strings.HasPrefix(expr, "/"))
+
+	var count int
+	if isXML {
+		matches, err := fs.QueryXML(path, expr)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		count = len(matches)
+		for i, m := range matches {
+			if i == maxPrintedMatches {
+				break
+			}
+			if m.Node != nil {
+				fmt.Printf("\n%s\n%s", m.Path, fs.FormatXMLFragment(m.Node))
+			} else {
+				fmt.Printf("\n%s = %s\n", m.Path, m.Value)
+			}
+		}
+	} else {
+		matches, err := fs.QueryJSON(path, expr)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		count = len(matches)
+		for i, m := range matches {
+			if i == maxPrintedMatches {
+				break
+			}
+			value, err := json.MarshalIndent(m.Value, "", "  ")
+			if err != nil {
+				value = []byte(fmt.Sprint(m.Value))
+			}
+			fmt.Printf("\n%s\n%s\n", m.Path, value)
+		}
+	}
+
+	switch {
+	case count == 0:
+		fmt.Println("   Совпадений нет")
+	case count > maxPrintedMatches:
+		fmt.Printf("\nПоказано %d из %d совпадений\n", maxPrintedMatches, count)
+	default:
+		fmt.Printf("\nСовпадений: %d\n", count)
+	}
+	db.LogOperation("query_structured", 0, app.currentUser.ID)
+}
+
+func (app *App) scanNested() {
+	fmt.Println("\nПроверка вложенных архивов (архивы внутри архивов)")
+	fmt.Println("   Вложенные архивы читаются в память, на диск ничего не записывается")
+	lim := fs.CurrentArchiveLimits()
+	fmt.Printf("   Лимиты: %d bytes, %d записей, вложенность архивов до %d\n", lim.MaxSize, lim.MaxEntries, lim.MaxNesting)
+	inputPath := utils.ReadLine("Архив: ")
+	path := app.resolveCwd(inputPath)
+
+	var password string
+	if format, err := fs.DetectArchiveFormat(path); err == nil && format == fs.FormatZip {
+		if encrypted, err := fs.IsEncryptedZip(path); err == nil && encrypted {
+			password = utils.ReadLine("Пароль архива (Enter = не проверять зашифрованные записи): ")
+		}
+	}
+
+	report, err := fs.ScanNested(path, password)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	printNestedReport(report)
+	if report.Safe() {
+		fmt.Println("\nOK. Опасных записей не найдено")
+	}
+	db.LogOperation("scan_nested_archive", 0, app.currentUser.ID)
+}
+
+// printNestedReport выводит итоги рекурсивной проверки архива
+func printNestedReport(report *fs.NestedScanReport) {
+	fmt.Printf("\nАрхивов: %d | Записей: %d | Вложенность: %d | Итоговый размер: %d bytes (прочитано %d bytes)\n",
+		report.Archives, report.Entries, report.MaxNesting, report.TotalSize, report.BytesRead)
+	for _, f := range report.Findings {
+		fmt.Printf("   ⚠ %s: %s\n", f.Path, f.Problem)
+	}
+	if report.Truncated {
+		fmt.Println("   ⚠ Проверка остановлена: исчерпан лимит размера или количества записей")
+	}
+}
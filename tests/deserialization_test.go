@@ -1,6 +1,8 @@
 package tests
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
@@ -68,6 +70,22 @@ func TestInsecureDeserializationProtection(t *testing.T) {
 		}
 	})
 
+	t.Run("WriteXMLChecks", func(t *testing.T) {
+		if err := fs.WriteXML("data.xml", &fs.XMLData{Content: "значение"}); err != nil {
+			t.Fatal(err)
+		}
+		if data, err := fs.ReadXML("data.xml"); err != nil || data.Content != "значение" {
+			t.Errorf("❌ XML не прочитан после записи: %v", err)
+		}
+		if err := fs.WriteXML("huge.xml", &fs.XMLData{Content: strings.Repeat("a", fs.MaxFileSize)}); err == nil {
+			t.Error("❌ УЯЗВИМОСТЬ! WriteXML обходит ограничение размера файла")
+		}
+		if _, err := os.Stat(filepath.Join(tmpDir, "huge.xml")); err == nil {
+			t.Error("❌ Файл больше лимита записан")
+		}
+		t.Log("✅ WriteXML пишет через общий путь записи с проверкой размера")
+	})
+
 	t.Run("CodeReview_SafeLibraries", func(t *testing.T) {
 		// Проверяем что используются безопасные библиотеки
 		structuredFile := filepath.Join("..", "fs", "structured.go")
@@ -153,3 +171,878 @@ func TestFileSizeLimits(t *testing.T) {
 		}
 	})
 }
+
+// TestXMLTreeLimits проверяет разбор XML в дерево с лимитами
+// Уязвимости: XXE, Billion Laughs, «бомбы» из глубокой вложенности и атрибутов
+func TestXMLTreeLimits(t *testing.T) {
+	t.Run("GenericDocument", func(t *testing.T) {
+		doc := `<c:catalog xmlns:c="urn:catalog"><c:book id="1"><title>Go</title></c:book></c:catalog>`
+		root, err := fs.ParseXML(strings.NewReader(doc))
+		if err != nil {
+			t.Fatalf("❌ Корректный XML отклонён: %v", err)
+		}
+		book := root.Child("book")
+		if book == nil || book.Child("title") == nil || book.Child("title").Text != "Go" {
+			t.Fatalf("❌ Дерево разобрано неверно:\n%s", fs.FormatXMLTree(root))
+		}
+		if id, _ := book.Attr("id"); id != "1" {
+			t.Errorf("❌ Атрибут id потерян: %q", id)
+		}
+		if tree := fs.FormatXMLTree(root); !strings.Contains(tree, "c:book @id=\"1\"") {
+			t.Errorf("❌ Префикс пространства имён не выведен:\n%s", tree)
+		}
+		t.Log("✅ Произвольный XML разобран в дерево")
+	})
+
+	t.Run("MixedContentRoundTrip", func(t *testing.T) {
+		doc := `<doc><!-- keep me --><p>Hello <b>world</b> again</p><pre xml:space="preserve">  a  b  </pre></doc>`
+		root, err := fs.ParseXML(strings.NewReader(doc))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pre := root.Child("pre"); pre == nil || pre.Text != "  a  b  " {
+			t.Errorf("❌ Пробелы в xml:space=\"preserve\" обрезаны: %q", pre.Text)
+		}
+		want := `<?xml version="1.0" encoding="UTF-8"?>
+<doc>
+  <!-- keep me -->
+  <p>Hello <b>world</b> again</p>
+  <pre xml:space="preserve">  a  b  </pre>
+</doc>
+`
+		out := fs.FormatXML(root)
+		if out != want {
+			t.Fatalf("❌ Запись изменила документ:\n%s", out)
+		}
+		again, err := fs.ParseXML(strings.NewReader(out))
+		if err != nil || fs.FormatXML(again) != out {
+			t.Errorf("❌ Повторная запись отличается: %v", err)
+		}
+		t.Log("✅ Комментарии, смешанный текст и xml:space=\"preserve\" сохраняются при записи")
+	})
+
+	t.Run("BillionLaughs", func(t *testing.T) {
+		doc := `<?xml version="1.0"?>
+<!DOCTYPE lolz [
+  <!ENTITY lol "lol">
+  <!ENTITY lol2 "&lol;&lol;&lol;&lol;&lol;&lol;&lol;&lol;&lol;&lol;">
+]>
+<lolz>&lol2;</lolz>`
+		if _, err := fs.ParseXML(strings.NewReader(doc)); err == nil {
+			t.Error("❌ УЯЗВИМОСТЬ! Документ с объявлениями ENTITY принят")
+		} else {
+			t.Logf("✅ DOCTYPE отклонён: %v", err)
+		}
+	})
+
+	t.Run("DepthLimit", func(t *testing.T) {
+		depth := fs.MaxXMLDepth + 1
+		doc := strings.Repeat("<a>", depth) + strings.Repeat("</a>", depth)
+		if _, err := fs.ParseXML(strings.NewReader(doc)); err == nil {
+			t.Errorf("❌ УЯЗВИМОСТЬ! Принята вложенность %d", depth)
+		} else {
+			t.Logf("✅ Вложенность ограничена: %v", err)
+		}
+	})
+
+	t.Run("AttributeLimit", func(t *testing.T) {
+		var sb strings.Builder
+		sb.WriteString("<a")
+		for i := 0; i <= fs.MaxXMLAttributes; i++ {
+			fmt.Fprintf(&sb, ` a%d="1"`, i)
+		}
+		sb.WriteString("/>")
+		if _, err := fs.ParseXML(strings.NewReader(sb.String())); err == nil {
+			t.Errorf("❌ УЯЗВИМОСТЬ! Принято больше %d атрибутов", fs.MaxXMLAttributes)
+		} else {
+			t.Logf("✅ Количество атрибутов ограничено: %v", err)
+		}
+	})
+
+	t.Run("ElementLimit", func(t *testing.T) {
+		doc := "<r>" + strings.Repeat("<e/>", fs.MaxXMLElements) + "</r>"
+		if _, err := fs.ParseXML(strings.NewReader(doc)); err == nil {
+			t.Errorf("❌ УЯЗВИМОСТЬ! Принято больше %d элементов", fs.MaxXMLElements)
+		} else {
+			t.Logf("✅ Количество элементов ограничено: %v", err)
+		}
+	})
+}
+
+// TestValidatedStructuredWrites проверяет, что JSON/XML сохраняются только после разбора
+// Уязвимость: повреждённый или вредоносный документ сохраняется как есть
+func TestValidatedStructuredWrites(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "sandbox_structured")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cfg := &config.Config{SandboxPath: tmpDir}
+	fs.InitFS(cfg)
+
+	t.Run("MalformedJSONPosition", func(t *testing.T) {
+		_, err := fs.ParseJSON("{\n  \"name\": \"John\",\n  \"age\": }")
+		var perr *fs.ParseError
+		if !errors.As(err, &perr) {
+			t.Fatalf("❌ Некорректный JSON принят или ошибка без позиции: %v", err)
+		}
+		if perr.Line != 3 {
+			t.Errorf("❌ Неверная строка ошибки: %d (ожидалась 3)", perr.Line)
+		}
+		t.Logf("✅ Некорректный JSON отклонён: %v", err)
+	})
+
+	t.Run("CanonicalJSON", func(t *testing.T) {
+		data, err := fs.ParseJSON(`{"id": 12345678901234567890, "tags": ["a"]}`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := fs.WriteJSON("doc.json", data); err != nil {
+			t.Fatal(err)
+		}
+		content, _ := os.ReadFile(filepath.Join(tmpDir, "doc.json"))
+		if !strings.Contains(string(content), "\n  \"id\": 12345678901234567890,") {
+			t.Errorf("❌ JSON сохранён не в каноническом виде:\n%s", content)
+		}
+		t.Log("✅ JSON сохранён с отступами, числа без потери точности")
+	})
+
+	t.Run("MalformedXMLPosition", func(t *testing.T) {
+		_, err := fs.ParseXML(strings.NewReader("<user>\n  <name>John</user>"))
+		var perr *fs.ParseError
+		if !errors.As(err, &perr) || perr.Line != 2 {
+			t.Fatalf("❌ Некорректный XML принят или ошибка без позиции: %v", err)
+		}
+		t.Logf("✅ Некорректный XML отклонён: %v", err)
+	})
+
+	t.Run("CanonicalXML", func(t *testing.T) {
+		root, err := fs.ParseXML(strings.NewReader(`<user id="1"><name>John &amp; Co</name><tags/></user>`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := fs.WriteXMLTree("doc.xml", root); err != nil {
+			t.Fatal(err)
+		}
+		saved, err := fs.ReadXMLTree("doc.xml")
+		if err != nil {
+			t.Fatalf("❌ Сохранённый XML не читается: %v", err)
+		}
+		if fs.FormatXML(saved) != fs.FormatXML(root) {
+			t.Errorf("❌ Документ изменился при сохранении:\n%s", fs.FormatXML(saved))
+		}
+		t.Log("✅ XML сохранён в каноническом виде и читается обратно")
+	})
+}
+
+// TestJSONSchemaValidation проверяет проверку JSON файлов по схемам из реестра
+// Уязвимость: конфигурация с неожиданной структурой или значениями принимается приложением
+func TestJSONSchemaValidation(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "sandbox_schema")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cfg := &config.Config{SandboxPath: tmpDir}
+	fs.InitFS(cfg)
+
+	schema := `{
+		"type": "object",
+		"required": ["port", "hosts"],
+		"additionalProperties": false,
+		"properties": {
+			"port": {"type": "integer", "minimum": 1, "maximum": 65535},
+			"mode": {"enum": ["dev", "prod"]},
+			"hosts": {"type": "array", "minItems": 1, "items": {"$ref": "#/$defs/host"}}
+		},
+		"$defs": {"host": {"type": "string", "pattern": "^[a-z0-9.-]+$"}}
+	}`
+	os.MkdirAll(filepath.Join(tmpDir, "schemas"), 0755)
+	os.MkdirAll(filepath.Join(tmpDir, "config"), 0755)
+	if err := fs.WriteFile("schemas/app.json", schema); err != nil {
+		t.Fatal(err)
+	}
+	registry := `{"schemas": [{"files": "config/*.json", "schema": "schemas/app.json", "enforce": true}]}`
+	if err := fs.WriteFile(fs.SchemaRegistryFile, registry); err != nil {
+		t.Fatal(err)
+	}
+	bad := `{"port": 70000, "mode": "test", "hosts": ["ok.example", "BAD HOST"], "debug": true}`
+	os.WriteFile(filepath.Join(tmpDir, "config", "bad.json"), []byte(bad), 0644)
+
+	t.Run("AllViolationsWithPointers", func(t *testing.T) {
+		name, violations, err := fs.ValidateJSONFile("config/bad.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name != "schemas/app.json" {
+			t.Fatalf("❌ Схема не найдена по шаблону: %q", name)
+		}
+		want := map[string]bool{"/port": false, "/mode": false, "/hosts/1": false, "/debug": false}
+		for _, v := range violations {
+			if _, ok := want[v.Pointer]; ok {
+				want[v.Pointer] = true
+			}
+		}
+		for pointer, found := range want {
+			if !found {
+				t.Errorf("❌ Нарушение в %s не найдено: %v", pointer, violations)
+			}
+		}
+		t.Logf("✅ Найдено нарушений: %d", len(violations))
+	})
+
+	t.Run("EnforcedWrite", func(t *testing.T) {
+		err := fs.WriteFile("config/app.json", bad)
+		var schemaErr *fs.SchemaError
+		if !errors.As(err, &schemaErr) {
+			t.Fatalf("❌ УЯЗВИМОСТЬ! Документ с нарушениями схемы записан: %v", err)
+		}
+		if _, statErr := os.Stat(filepath.Join(tmpDir, "config", "app.json")); statErr == nil {
+			t.Error("❌ Файл создан несмотря на ошибку проверки")
+		}
+		if err := fs.WriteFile("config/app.json", `{"port": 8080, "hosts": ["localhost"]}`); err != nil {
+			t.Errorf("❌ Корректный документ отклонён: %v", err)
+		}
+		if err := fs.CopyFile("config/bad.json", "config/copy.json"); err == nil {
+			t.Error("❌ УЯЗВИМОСТЬ! Проверка схемы обойдена копированием")
+		}
+		t.Log("✅ Запись документов с нарушениями схемы заблокирована")
+	})
+
+	t.Run("BrokenRegistryRejected", func(t *testing.T) {
+		if err := fs.WriteFile(fs.SchemaRegistryFile, `{"schemas": [{"files": "[", "schema": "x"}]}`); err == nil {
+			t.Error("❌ Записан повреждённый реестр схем")
+		} else {
+			t.Logf("✅ Повреждённый реестр отклонён: %v", err)
+		}
+	})
+}
+
+// TestStructuredQueries проверяет запросы JSONPath и XPath к файлам sandbox
+func TestStructuredQueries(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "sandbox_query")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cfg := &config.Config{SandboxPath: tmpDir}
+	fs.InitFS(cfg)
+
+	fs.WriteFile("store.json", `{"books": [{"title": "A", "price": 8}, {"title": "B", "price": 12}]}`)
+	fs.WriteFile("store.xml", `<store><book id="1"><title>A</title></book><book id="2"><title>B</title></book></store>`)
+
+	t.Run("JSONPath", func(t *testing.T) {
+		matches, err := fs.QueryJSON("store.json", "$.books[?(@.price < 10)].title")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(matches) != 1 || matches[0].Value != "A" || matches[0].Path != "$['books'][0]['title']" {
+			t.Errorf("❌ Неверный результат JSONPath: %+v", matches)
+		}
+		t.Log("✅ JSONPath с фильтром вернул нужное значение")
+	})
+
+	t.Run("XPath", func(t *testing.T) {
+		matches, err := fs.QueryXML("store.xml", "//book[@id='2']/title/text()")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(matches) != 1 || matches[0].Value != "B" {
+			t.Errorf("❌ Неверный результат XPath: %+v", matches)
+		}
+		t.Log("✅ XPath с условием вернул нужное значение")
+	})
+
+	t.Run("MalformedExpressions", func(t *testing.T) {
+		if _, err := fs.QueryJSON("store.json", "$.books[?(@.price <"); err == nil {
+			t.Error("❌ Принято некорректное выражение JSONPath")
+		}
+		if _, err := fs.QueryXML("store.xml", "/store/book[@id='1'"); err == nil {
+			t.Error("❌ Принято некорректное выражение XPath")
+		}
+		if _, err := fs.QueryJSON("../etc/passwd", "$"); err == nil {
+			t.Error("❌ УЯЗВИМОСТЬ! Запрос к файлу вне sandbox")
+		}
+		t.Log("✅ Некорректные выражения и пути отклонены")
+	})
+}
+
+// TestJSONEditing проверяет изменение JSON по JSON Pointer и патчам
+// Уязвимость: частично применённый патч оставляет документ в промежуточном состоянии
+func TestJSONEditing(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "sandbox_edit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cfg := &config.Config{SandboxPath: tmpDir}
+	fs.InitFS(cfg)
+
+	original := `{"zeta": 1, "alpha": {"hosts": ["a", "b"]}, "debug": true}`
+	fs.WriteFile("cfg.json", original)
+
+	t.Run("KeyOrderPreserved", func(t *testing.T) {
+		if err := fs.SetJSONValue("cfg.json", "/alpha/hosts/-", `"c"`); err != nil {
+			t.Fatal(err)
+		}
+		if err := fs.ApplyMergePatch("cfg.json", `{"debug": null, "port": 8080}`); err != nil {
+			t.Fatal(err)
+		}
+		content, _ := fs.ReadFile("cfg.json")
+		zeta, alpha, port := strings.Index(content, `"zeta"`), strings.Index(content, `"alpha"`), strings.Index(content, `"port"`)
+		if zeta < 0 || zeta > alpha || alpha > port || strings.Contains(content, "debug") || !strings.Contains(content, `"c"`) {
+			t.Errorf("❌ Порядок ключей или содержимое нарушены:\n%s", content)
+		}
+		t.Log("✅ Порядок ключей сохранён")
+	})
+
+	t.Run("PatchIsAllOrNothing", func(t *testing.T) {
+		before, _ := fs.ReadFile("cfg.json")
+		patch := `[
+			{"op": "replace", "path": "/zeta", "value": 2},
+			{"op": "test", "path": "/port", "value": 9999}
+		]`
+		if err := fs.ApplyJSONPatch("cfg.json", patch); err == nil {
+			t.Fatal("❌ Патч с проваленной операцией test применён")
+		}
+		after, _ := fs.ReadFile("cfg.json")
+		if before != after {
+			t.Errorf("❌ УЯЗВИМОСТЬ! Документ изменён частично:\n%s", after)
+		}
+		t.Log("✅ Патч с ошибкой не изменил документ")
+	})
+
+	t.Run("InvalidPointer", func(t *testing.T) {
+		if err := fs.DeleteJSONValue("cfg.json", "/alpha/hosts/10"); err == nil {
+			t.Error("❌ Удаление по несуществующему индексу выполнено")
+		}
+		if err := fs.InsertJSONValue("cfg.json", "alpha", `1`); err == nil {
+			t.Error("❌ Принят JSON Pointer без ведущего /")
+		}
+		t.Log("✅ Некорректные указатели отклонены")
+	})
+}
+
+// TestFormatConversion проверяет преобразование между JSON, YAML, TOML и CSV
+// Уязвимость: YAML ссылки (Billion Laughs) и молчаливая потеря данных при конвертации
+func TestFormatConversion(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "sandbox_convert")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cfg := &config.Config{SandboxPath: tmpDir}
+	fs.InitFS(cfg)
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		original := `{"name": "Иван", "port": 8080, "tags": ["a", "b: c", "123"], "db": {"hosts": [{"host": "x", "ok": true}]}}`
+		fs.WriteFile("data.json", original)
+		for _, step := range [][2]string{{"data.json", "data.yaml"}, {"data.yaml", "data.toml"}, {"data.toml", "back.json"}} {
+			if losses, err := fs.ConvertFile(step[0], step[1], false); err != nil {
+				t.Fatalf("❌ %s → %s: %v %v", step[0], step[1], err, losses)
+			}
+		}
+		want, _ := fs.ParseJSON(original)
+		content, _ := fs.ReadFile("back.json")
+		got, err := fs.ParseJSON(content)
+		if err != nil || fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("❌ Данные изменились после JSON → YAML → TOML → JSON:\n%s", content)
+		}
+		t.Log("✅ JSON → YAML → TOML → JSON без изменений")
+	})
+
+	t.Run("CSVToJSON", func(t *testing.T) {
+		fs.WriteFile("table.csv", "id,name\n1,Анна\n2,\"Б, В\"\n")
+		if _, err := fs.ConvertFile("table.csv", "table.json", false); err != nil {
+			t.Fatal(err)
+		}
+		content, _ := fs.ReadFile("table.json")
+		if !strings.Contains(content, `"name": "Б, В"`) {
+			t.Errorf("❌ Неверная таблица:\n%s", content)
+		}
+		t.Log("✅ CSV преобразован в массив объектов")
+	})
+
+	t.Run("LossyRequiresConsent", func(t *testing.T) {
+		fs.WriteFile("nulls.json", `{"a": 1, "b": null}`)
+		_, err := fs.ConvertFile("nulls.json", "nulls.toml", false)
+		var lossy *fs.LossyConversionError
+		if !errors.As(err, &lossy) || len(lossy.Losses) == 0 {
+			t.Fatalf("❌ УЯЗВИМОСТЬ! Потеря null при записи TOML не сообщена: %v", err)
+		}
+		if _, err := fs.ReadFile("nulls.toml"); err == nil {
+			t.Error("❌ Файл записан без согласия на потери")
+		}
+		if _, err := fs.ConvertFile("nulls.json", "nulls.toml", true); err != nil {
+			t.Errorf("❌ Преобразование с согласием не выполнено: %v", err)
+		}
+		t.Log("✅ Преобразование с потерями требует подтверждения")
+	})
+
+	t.Run("XMLLossesReported", func(t *testing.T) {
+		docs := map[string]string{
+			"comment.xml": "<!-- заметка --><cfg><port>80</port></cfg>",
+			"inner.xml":   "<cfg><!-- заметка --><port>80</port></cfg>",
+			"pi.xml":      "<cfg><?app mode?><port>80</port></cfg>",
+			"spaces.xml":  "<cfg><name>  Иван  </name></cfg>",
+		}
+		for name, doc := range docs {
+			fs.WriteFile(name, doc)
+			_, err := fs.ConvertFile(name, "out.json", false)
+			var lossy *fs.LossyConversionError
+			if !errors.As(err, &lossy) {
+				t.Errorf("❌ %s: потеря при чтении XML не сообщена: %v", name, err)
+			}
+		}
+		fs.WriteFile("plain.xml", "<cfg>\n  <port>80</port>\n</cfg>")
+		if losses, err := fs.ConvertFile("plain.xml", "out.json", false); err != nil {
+			t.Errorf("❌ Отступы между элементами сочтены потерей: %v %v", err, losses)
+		}
+
+		fs.WriteFile("single.json", `{"cfg": {"hosts": ["a"]}}`)
+		_, err := fs.ConvertFile("single.json", "single.xml", false)
+		var lossy *fs.LossyConversionError
+		if !errors.As(err, &lossy) {
+			t.Errorf("❌ Массив из одного элемента записан в XML без предупреждения: %v", err)
+		}
+		t.Log("✅ Комментарии, инструкции, обрезанный текст и одиночные массивы отмечены как потери")
+	})
+
+	t.Run("YAMLUnclosedFlow", func(t *testing.T) {
+		for i, doc := range []string{"{", "k: {a: 1, b: [x],\n", "k: [1, 2\n", "k: {a: \n"} {
+			name := fmt.Sprintf("unclosed%d.yaml", i)
+			fs.WriteFile(name, doc)
+			var parseErr *fs.ParseError
+			if _, err := fs.ConvertFile(name, "unclosed.json", true); !errors.As(err, &parseErr) {
+				t.Errorf("❌ %q: ожидалась ошибка разбора с позицией, получено %v", doc, err)
+			}
+			if _, err := fs.DiffFiles(name, name); err == nil {
+				t.Errorf("❌ %q: некорректный YAML сравнён без ошибки", doc)
+			}
+		}
+		t.Log("✅ Незакрытые [..] и {..} отклоняются с позицией, без паники")
+	})
+
+	t.Run("YAMLAliasesRejected", func(t *testing.T) {
+		bomb := "a: &a [x, x, x]\nb: &b [*a, *a, *a]\nc: [*b, *b, *b]\n"
+		fs.WriteFile("bomb.yaml", bomb)
+		if _, err := fs.ConvertFile("bomb.yaml", "bomb.json", true); err == nil {
+			t.Error("❌ УЯЗВИМОСТЬ! YAML с якорями и ссылками принят")
+		}
+		t.Log("✅ YAML якоря и ссылки отклонены")
+	})
+}
+
+// TestCSVQueries проверяет чтение CSV в Windows-1251 и запросы к таблице
+// Уязвимость: значения ячеек не должны интерпретироваться как часть запроса
+func TestCSVQueries(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "sandbox_csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cfg := &config.Config{SandboxPath: tmpDir}
+	fs.InitFS(cfg)
+
+	// «Город;Сумма» в Windows-1251, десятичная запятая
+	cp1251 := []byte("\xc3\xee\xf0\xee\xe4;\xd1\xf3\xec\xec\xe0\n\xca\xe0\xe7\xe0\xed\xfc;10,5\n\xd1\xee\xf7\xe8;2\n\xca\xe0\xe7\xe0\xed\xfc;4\n")
+	if err := os.WriteFile(filepath.Join(tmpDir, "export.csv"), cp1251, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("DetectEncodingAndDelimiter", func(t *testing.T) {
+		table, err := fs.ReadCSV("export.csv")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if table.Delimiter != ';' || table.Encoding != fs.EncodingCP1251 || table.Header[0] != "Город" {
+			t.Errorf("❌ Определено: %q, %s, %v", table.Delimiter, table.Encoding, table.Header)
+		}
+		t.Log("✅ Кодировка и разделитель определены")
+	})
+
+	t.Run("GroupBy", func(t *testing.T) {
+		table, _ := fs.ReadCSV("export.csv")
+		result, err := table.Query("SELECT Город, COUNT(*), SUM(Сумма) GROUP BY Город ORDER BY sum(Сумма) DESC")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result.Rows) != 2 || fmt.Sprint(result.Rows[0]) != "[Казань 2 14.5]" {
+			t.Errorf("❌ Неверная группировка: %v", result.Rows)
+		}
+		t.Log("✅ Группировка и агрегаты посчитаны")
+	})
+
+	t.Run("ValuesAreNotQuery", func(t *testing.T) {
+		fs.WriteFile("users.csv", "name,role\nalice,admin\nbob,user\n")
+		table, _ := fs.ReadCSV("users.csv")
+		result, err := table.Query("WHERE role = 'user'' OR ''1''=''1'")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result.Rows) != 0 {
+			t.Errorf("❌ УЯЗВИМОСТЬ! Значение в кавычках изменило условие: %v", result.Rows)
+		}
+		if _, err := table.Query("SELECT name WHERE role = admin"); err == nil {
+			t.Error("❌ Значение без кавычек принято как строка")
+		}
+		t.Log("✅ Строки в запросе остаются значениями")
+	})
+
+	t.Run("ComparisonOperators", func(t *testing.T) {
+		fs.WriteFile("nums.csv", "n\n1\n2\n3\n")
+		table, _ := fs.ReadCSV("nums.csv")
+		cases := map[string]int{
+			"WHERE n = 2": 1, "WHERE n != 2": 2, "WHERE n <> 2": 2,
+			"WHERE n < 2": 1, "WHERE n <= 2": 2, "WHERE n > 2": 1, "WHERE n >= 2": 2,
+		}
+		for query, want := range cases {
+			result, err := table.Query(query)
+			if err != nil {
+				t.Errorf("❌ %s: %v", query, err)
+				continue
+			}
+			if len(result.Rows) != want {
+				t.Errorf("❌ %s: строк %d, ожидалось %d", query, len(result.Rows), want)
+			}
+		}
+		for _, query := range []string{"WHERE n ! 2", "WHERE n => 2", "WHERE n == 2"} {
+			if _, err := table.Query(query); err == nil {
+				t.Errorf("❌ Недопустимый оператор принят: %s", query)
+			}
+		}
+		t.Log("✅ Все операторы сравнения разобраны, лишние символы отклонены")
+	})
+}
+
+// TestJSONLimits проверяет лимиты разбора JSON на враждебных документах
+// Уязвимость: глубокая вложенность и огромные документы исчерпывают память и стек
+func TestJSONLimits(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "sandbox_json_limits")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cfg := &config.Config{SandboxPath: tmpDir}
+	fs.InitFS(cfg)
+	defer fs.SetJSONLimits(fs.DefaultJSONLimits())
+
+	expectLimit := func(t *testing.T, name, doc string) {
+		t.Helper()
+		_, err := fs.ParseJSON(doc)
+		if !errors.Is(err, fs.ErrJSONLimit) {
+			t.Errorf("❌ УЯЗВИМОСТЬ! %s не отклонён лимитом: %v", name, err)
+			return
+		}
+		t.Logf("✅ %s — отклонено: %v", name, err)
+	}
+
+	t.Run("DeepNesting", func(t *testing.T) {
+		expectLimit(t, "Массив вложенностью 100000", strings.Repeat("[", 100000)+strings.Repeat("]", 100000))
+		expectLimit(t, "Объект вложенностью 1000", strings.Repeat(`{"a":`, 1000)+"1"+strings.Repeat("}", 1000))
+		if _, err := fs.ParseJSON(strings.Repeat("[", fs.MaxJSONDepth) + strings.Repeat("]", fs.MaxJSONDepth)); err != nil {
+			t.Errorf("❌ Документ на границе лимита отклонён: %v", err)
+		}
+	})
+
+	t.Run("ManyTokens", func(t *testing.T) {
+		fs.SetJSONLimits(fs.JSONLimits{MaxTokens: 1000})
+		defer fs.SetJSONLimits(fs.DefaultJSONLimits())
+		expectLimit(t, "Массив из 5000 чисел", "["+strings.Repeat("1,", 4999)+"1]")
+
+		// Лимит действует и при чтении файла
+		fs.WriteFile("numbers.json", "["+strings.Repeat("0,", 2000)+"0]")
+		if _, err := fs.ReadJSON("numbers.json"); !errors.Is(err, fs.ErrJSONLimit) {
+			t.Errorf("❌ УЯЗВИМОСТЬ! ReadJSON прочитал файл сверх лимита: %v", err)
+		}
+	})
+
+	t.Run("LongStringsAndNumbers", func(t *testing.T) {
+		fs.SetJSONLimits(fs.JSONLimits{MaxStringLength: 1024})
+		defer fs.SetJSONLimits(fs.DefaultJSONLimits())
+		expectLimit(t, "Строка 4 КБ", `{"s": "`+strings.Repeat("x", 4096)+`"}`)
+		expectLimit(t, "Ключ 4 КБ", `{"`+strings.Repeat("k", 4096)+`": 1}`)
+		expectLimit(t, "Число из 500 цифр", "["+strings.Repeat("9", 500)+"]")
+		expectLimit(t, "Число вне диапазона float64", "[1e400]")
+
+		data, err := fs.ParseJSON(`{"id": 12345678901234567890}`)
+		if err != nil || fmt.Sprint(data.(map[string]interface{})["id"]) != "12345678901234567890" {
+			t.Errorf("❌ Потеряна точность большого целого: %v %v", data, err)
+		}
+	})
+
+	t.Run("DuplicateKeys", func(t *testing.T) {
+		doc := `{"role": "user", "role": "admin"}`
+		if _, err := fs.ParseJSON(doc); err != nil {
+			t.Errorf("❌ По умолчанию повторяющиеся ключи должны приниматься: %v", err)
+		}
+		fs.SetJSONLimits(fs.JSONLimits{RejectDuplicateKeys: true})
+		defer fs.SetJSONLimits(fs.DefaultJSONLimits())
+		if _, err := fs.ParseJSON(doc); err == nil {
+			t.Error("❌ УЯЗВИМОСТЬ! Повторяющийся ключ принят при включённом запрете")
+		}
+		t.Log("✅ Повторяющиеся ключи отклоняются по настройке")
+	})
+}
+
+// TestNDJSONStreaming проверяет потоковое чтение и дописывание JSON Lines
+// Уязвимость: запись с переводом строки разбивает журнал и подделывает записи
+func TestNDJSONStreaming(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "sandbox_ndjson")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cfg := &config.Config{SandboxPath: tmpDir}
+	fs.InitFS(cfg)
+
+	log := `{"level": "info", "status": 200, "user": {"id": 1}}
+{"level": "error", "status": 500, "user": {"id": 2}}
+{"level": "error", "status": 404
+this is not json
+
+{"level": "error", "status": 503, "user": {"id": 3}}
+`
+	if err := fs.WriteFile("app.jsonl", log); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("FilterAndProjection", func(t *testing.T) {
+		var got []string
+		opts := fs.NDJSONOptions{Filter: "@.level == 'error' && @.status >= 500", Fields: []string{"status", "/user/id"}}
+		stats, err := fs.ScanNDJSON("app.jsonl", opts, func(rec fs.NDJSONRecord) error {
+			got = append(got, fmt.Sprintf("%d:%v", rec.Line, rec.Value))
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats.Records != 3 || stats.Matched != 2 || len(got) != 2 || !strings.HasPrefix(got[1], "6:") {
+			t.Errorf("❌ Неверный результат фильтра: %+v %v", stats, got)
+		}
+		stats, _ = fs.ScanNDJSON("app.jsonl", fs.NDJSONOptions{Limit: 1}, nil)
+		if stats.Matched != 1 || !stats.Partial {
+			t.Errorf("❌ Limit не остановил чтение: %+v", stats)
+		}
+		t.Log("✅ Фильтр, выбор полей и ограничение работают")
+	})
+
+	t.Run("LineErrors", func(t *testing.T) {
+		stats, err := fs.ScanNDJSON("app.jsonl", fs.NDJSONOptions{}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats.ErrorCount != 2 || stats.Errors[0].Line != 3 || stats.Errors[1].Line != 4 {
+			t.Errorf("❌ Ошибки строк не указаны: %+v %v", stats, stats.Errors)
+		}
+		t.Logf("✅ Некорректные строки пропущены: %v", stats.Errors)
+	})
+
+	t.Run("AppendRecord", func(t *testing.T) {
+		if err := fs.AppendNDJSONRecord("app.jsonl", "{\n  \"level\": \"warn\",\n  \"msg\": \"a\\nb\"\n}"); err != nil {
+			t.Fatal(err)
+		}
+		for _, bad := range []string{`{"level": "info"}` + "\n" + `{"level": "admin"}`, `{"level":`, ""} {
+			if err := fs.AppendNDJSONRecord("app.jsonl", bad); err == nil {
+				t.Errorf("❌ УЯЗВИМОСТЬ! Некорректная запись добавлена: %q", bad)
+			}
+		}
+		stats, _ := fs.ScanNDJSON("app.jsonl", fs.NDJSONOptions{Filter: "@.level == 'warn'"}, nil)
+		if stats.Matched != 1 || stats.Lines != 7 {
+			t.Errorf("❌ Запись добавлена не одной строкой: %+v", stats)
+		}
+
+		// Файл без перевода строки в конце: запись не склеивается с последней строкой
+		fs.WriteFile("tail.ndjson", `{"a": 1}`)
+		fs.AppendNDJSONRecord("tail.ndjson", `{"a": 2}`)
+		fs.AppendNDJSONRecord("new.ndjson", `{"a": 3}`)
+		for name, want := range map[string]int{"tail.ndjson": 2, "new.ndjson": 1} {
+			if stats, err := fs.ScanNDJSON(name, fs.NDJSONOptions{}, nil); err != nil || stats.Records != want || stats.ErrorCount != 0 {
+				t.Errorf("❌ %s: %+v %v", name, stats, err)
+			}
+		}
+		t.Log("✅ Записи проверяются и добавляются одной строкой")
+	})
+
+	t.Run("AppendLargeLog", func(t *testing.T) {
+		os.MkdirAll(filepath.Join(tmpDir, "schemas"), 0755)
+		fs.WriteFile("schemas/log.json", `{"type": "object", "required": ["level"], "properties": {"level": {"enum": ["info", "error"]}}}`)
+		fs.WriteFile(fs.SchemaRegistryFile, `{"schemas": [{"files": "audit.jsonl", "schema": "schemas/log.json", "enforce": true}]}`)
+		defer fs.DeleteFile(fs.SchemaRegistryFile)
+
+		// Журнал больше MaxFileSize и со старой повреждённой строкой
+		big := "not json\n" + strings.Repeat(`{"level": "info"}`+"\n", fs.MaxFileSize/18+1)
+		if err := os.WriteFile(filepath.Join(tmpDir, "audit.jsonl"), []byte(big), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := fs.AppendNDJSONRecord("audit.jsonl", `{"level": "error"}`); err != nil {
+			t.Errorf("❌ Запись не добавлена в большой журнал: %v", err)
+		}
+		if err := fs.AppendNDJSONRecord("audit.jsonl", `{"level": "debug"}`); err == nil {
+			t.Error("❌ УЯЗВИМОСТЬ! Запись, нарушающая схему, добавлена")
+		}
+		data, _ := os.ReadFile(filepath.Join(tmpDir, "audit.jsonl"))
+		if string(data) != big+`{"level":"error"}`+"\n" {
+			t.Errorf("❌ Журнал изменён неверно: %d байт", len(data))
+		}
+		t.Log("✅ Дописывание проверяет только новую запись и не ограничено размером обычного файла")
+	})
+}
+
+// TestStructuredDiff проверяет структурное сравнение документов и построение JSON Patch
+func TestStructuredDiff(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "sandbox_diff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cfg := &config.Config{SandboxPath: tmpDir}
+	fs.InitFS(cfg)
+
+	fs.WriteFile("v1.json", `{"name": "app", "port": 8080, "debug": true, "hosts": ["a", "b", "c"], "db": {"user": "u", "pool": 5}}`)
+	fs.WriteFile("v1-formatted.json", "{\n  \"db\": {\"pool\": 5.0, \"user\": \"u\"},\n  \"hosts\": [\"a\", \"b\", \"c\"],\n  \"debug\": true, \"port\": 8080, \"name\": \"app\"\n}\n")
+	fs.WriteFile("v2.json", `{"name": "app", "port": 9090, "hosts": ["z", "a", "c"], "db": {"user": "u", "pool": 5, "ssl": true}}`)
+
+	t.Run("FormattingIgnored", func(t *testing.T) {
+		changes, err := fs.DiffFiles("v1.json", "v1-formatted.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(changes) != 0 {
+			t.Errorf("❌ Форматирование и порядок ключей дали различия: %v", changes)
+		}
+		t.Log("✅ Форматирование и порядок ключей не влияют на сравнение")
+	})
+
+	t.Run("PatchReproducesTarget", func(t *testing.T) {
+		changes, err := fs.DiffFiles("v1.json", "v2.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		text := fs.FormatDiff(changes)
+		for _, want := range []string{"~ /port: 8080 → 9090", "- /debug: true", "+ /db/ssl: true", "+ /hosts/0: \"z\"", "- /hosts/2: \"b\""} {
+			if !strings.Contains(text, want) {
+				t.Errorf("❌ В различиях нет %q:\n%s", want, text)
+			}
+		}
+		patch, err := fs.DiffPatch(changes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fs.CopyFile("v1.json", "patched.json")
+		if err := fs.ApplyJSONPatch("patched.json", patch); err != nil {
+			t.Fatalf("❌ Патч не применяется: %v\n%s", err, patch)
+		}
+		if rest, _ := fs.DiffFiles("patched.json", "v2.json"); len(rest) != 0 {
+			t.Errorf("❌ После применения патча остались различия: %v", rest)
+		}
+		t.Logf("✅ JSON Patch превращает первый документ во второй:\n%s", text)
+	})
+
+	t.Run("XML", func(t *testing.T) {
+		fs.WriteFile("a.xml", `<config version="1"><port>80</port><host>a</host></config>`)
+		fs.WriteFile("b.xml", "<config  version=\"1\">\n  <host>a</host>\n  <port>443</port>\n</config>")
+		changes, err := fs.DiffFiles("a.xml", "b.xml")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(changes) != 1 || changes[0].Path != "/config/port" {
+			t.Errorf("❌ Неверные различия XML: %v", changes)
+		}
+		t.Logf("✅ XML сравнивается по дереву: %v", changes)
+	})
+}
+
+// TestTextEncoding проверяет определение кодировки и перекодирование файлов
+// Уязвимость: неверно декодированный текст записывается обратно и портит файл
+func TestTextEncoding(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "sandbox_charset")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cfg := &config.Config{SandboxPath: tmpDir}
+	fs.InitFS(cfg)
+
+	// «Привет, мир!» с переводами строк CRLF в разных кодировках
+	files := map[string]struct {
+		data     []byte
+		encoding string
+	}{
+		"koi8.txt":   {[]byte("\xf0\xd2\xc9\xd7\xc5\xd4,\r\n\xcd\xc9\xd2!\r\n"), fs.EncodingKOI8R},
+		"cp1251.txt": {[]byte("\xcf\xf0\xe8\xe2\xe5\xf2,\r\n\xec\xe8\xf0!\r\n"), fs.EncodingCP1251},
+		"utf16.txt":  {[]byte("\xff\xfe\x1f\x04\x40\x04\x38\x04\x32\x04\x35\x04\x42\x04,\x00\r\x00\n\x00\x3c\x04\x38\x04\x40\x04!\x00\r\x00\n\x00"), fs.EncodingUTF16LE},
+		// Без BOM: кодировка определяется по положению старших байтов
+		"utf16le.txt": {[]byte("\x1f\x04\x40\x04\x38\x04\x32\x04\x35\x04\x42\x04,\x00\r\x00\n\x00\x3c\x04\x38\x04\x40\x04!\x00\r\x00\n\x00"), fs.EncodingUTF16LE},
+		"utf16be.txt": {[]byte("\x04\x1f\x04\x40\x04\x38\x04\x32\x04\x35\x04\x42\x00,\x00\r\x00\n\x04\x3c\x04\x38\x04\x40\x00!\x00\r\x00\n"), fs.EncodingUTF16BE},
+	}
+	for name, f := range files {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), f.data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("Detect", func(t *testing.T) {
+		for name, f := range files {
+			text, err := fs.ReadText(name, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if text.Encoding != f.encoding || text.Content != "Привет,\r\nмир!\r\n" || text.LineEnding != fs.LineEndingCRLF {
+				t.Errorf("❌ %s: определено %s, %s: %q", name, text.Encoding, text.LineEnding, text.Content)
+			}
+		}
+		// Явно указанная кодировка важнее определённой
+		if text, _ := fs.ReadText("koi8.txt", "cp1251"); text == nil || text.Content == "Привет,\r\nмир!\r\n" {
+			t.Error("❌ Явно указанная кодировка не применена")
+		}
+		// Латиница в UTF-16 без BOM — корректный UTF-8 с нулевыми байтами
+		os.WriteFile(filepath.Join(tmpDir, "latin16.txt"), []byte("H\x00e\x00l\x00l\x00o\x00\n\x00"), 0644)
+		if text, err := fs.ReadText("latin16.txt", ""); err != nil || text.Encoding != fs.EncodingUTF16LE || text.Content != "Hello\n" {
+			t.Errorf("❌ UTF-16 без BOM принят за UTF-8: %+v %v", text, err)
+		}
+		if text, _ := fs.ReadText("cp1251.txt", ""); text == nil || text.Encoding != fs.EncodingCP1251 {
+			t.Error("❌ Однобайтовый текст принят за UTF-16")
+		}
+		t.Log("✅ KOI8-R, Windows-1251 и UTF-16 (с BOM и без) определены")
+	})
+
+	t.Run("RecodeRoundTrip", func(t *testing.T) {
+		result, err := fs.RecodeFile("koi8.txt", fs.RecodeOptions{To: fs.EncodingUTF8, LineEnding: fs.LineEndingLF})
+		if err != nil || !result.Changed {
+			t.Fatalf("❌ Файл не перекодирован: %v", err)
+		}
+		if got, _ := fs.ReadFile("koi8.txt"); got != "Привет,\nмир!\n" {
+			t.Errorf("❌ Неверный результат: %q", got)
+		}
+		if _, err := fs.RecodeFile("koi8.txt", fs.RecodeOptions{To: "koi8-r", LineEnding: fs.LineEndingCRLF}); err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := os.ReadFile(filepath.Join(tmpDir, "koi8.txt")); string(got) != string(files["koi8.txt"].data) {
+			t.Errorf("❌ Обратное преобразование изменило байты: %q", got)
+		}
+		t.Log("✅ KOI8-R → UTF-8 (LF) → KOI8-R (CRLF) возвращает исходные байты")
+	})
+
+	t.Run("UnrepresentableRejected", func(t *testing.T) {
+		fs.WriteFile("emoji.txt", "Готово ✓\n")
+		_, err := fs.RecodeFile("emoji.txt", fs.RecodeOptions{To: fs.EncodingCP1251})
+		if err == nil {
+			t.Fatal("❌ УЯЗВИМОСТЬ! Символ без представления в Windows-1251 потерян при перекодировании")
+		}
+		if got, _ := fs.ReadFile("emoji.txt"); got != "Готово ✓\n" {
+			t.Errorf("❌ Файл изменён после ошибки: %q", got)
+		}
+		t.Logf("✅ Перекодирование с потерей символов отклонено: %v", err)
+	})
+}
@@ -0,0 +1,173 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"secure-fm/config"
+	"secure-fm/fs"
+)
+
+// fakeIndexer — индекс содержимого в памяти: ключ «путь» или «путь!запись архива»
+type fakeIndexer struct {
+	docs map[string]string
+}
+
+func (f *fakeIndexer) IndexDocument(path, entry, content string) error {
+	key := path
+	if entry != "" {
+		key += "!" + entry
+	}
+	f.docs[key] = content
+	return nil
+}
+
+func (f *fakeIndexer) RemoveDocument(path string) error {
+	for key := range f.docs {
+		if key == path || strings.HasPrefix(key, path+"!") || strings.HasPrefix(key, path+"/") {
+			delete(f.docs, key)
+		}
+	}
+	return nil
+}
+
+func (f *fakeIndexer) ClearIndex() error {
+	f.docs = make(map[string]string)
+	return nil
+}
+
+func (f *fakeIndexer) keys() string {
+	var keys []string
+	for key := range f.docs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, " ")
+}
+
+// TestContentIndexSync проверяет, что файловые операции обновляют полнотекстовый индекс
+// Уязвимость: удалённый или перемещённый файл остаётся в индексе, и его содержимое находится поиском
+func TestContentIndexSync(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "sandbox_index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cfg := &config.Config{SandboxPath: tmpDir}
+	fs.InitFS(cfg)
+
+	idx := &fakeIndexer{docs: make(map[string]string)}
+	fs.SetIndexer(idx)
+	defer fs.SetIndexer(nil)
+
+	t.Run("WriteAppend", func(t *testing.T) {
+		fs.WriteFile("notes.txt", "первая")
+		fs.AppendFile("notes.txt", " вторая")
+		if got := idx.docs["notes.txt"]; got != "первая вторая" {
+			t.Errorf("❌ Индекс не обновлён после дописывания: %q", got)
+		}
+		fs.WriteFile("image.bin", "не индексируется")
+		if _, ok := idx.docs["image.bin"]; ok {
+			t.Error("❌ В индекс попал файл с неиндексируемым расширением")
+		}
+		t.Log("✅ Запись и дописывание обновляют индекс")
+	})
+
+	t.Run("CopyMoveDelete", func(t *testing.T) {
+		if err := fs.CopyFile("notes.txt", "copy.txt"); err != nil {
+			t.Fatal(err)
+		}
+		if got := idx.docs["copy.txt"]; got != "первая вторая" {
+			t.Errorf("❌ Копия проиндексирована неверно: %q", got)
+		}
+		if err := fs.MoveFile("copy.txt", "moved.txt"); err != nil {
+			t.Fatal(err)
+		}
+		if err := fs.DeleteFile("notes.txt"); err != nil {
+			t.Fatal(err)
+		}
+		if got := idx.keys(); got != "moved.txt" {
+			t.Errorf("❌ УЯЗВИМОСТЬ! В индексе остались удалённые или перемещённые файлы: %s", got)
+		}
+		t.Log("✅ Копирование, перемещение и удаление синхронизированы с индексом")
+	})
+
+	t.Run("MoveDirectory", func(t *testing.T) {
+		os.MkdirAll(filepath.Join(tmpDir, "d", "sub"), 0755)
+		fs.WriteFile("d/a.txt", "в папке")
+		fs.WriteFile("d/sub/b.md", "глубже")
+		if err := fs.MoveFile("d", "e"); err != nil {
+			t.Fatal(err)
+		}
+		for _, key := range []string{"d/a.txt", "d/sub/b.md"} {
+			if _, ok := idx.docs[key]; ok {
+				t.Errorf("❌ УЯЗВИМОСТЬ! После переноса папки в индексе остался %s", key)
+			}
+		}
+		if idx.docs["e/a.txt"] != "в папке" || idx.docs["e/sub/b.md"] != "глубже" {
+			t.Errorf("❌ Файлы перенесённой папки не проиндексированы: %s", idx.keys())
+		}
+		if err := fs.DeleteFile("e/a.txt"); err != nil {
+			t.Fatal(err)
+		}
+		for _, content := range idx.docs {
+			if content == "в папке" {
+				t.Errorf("❌ УЯЗВИМОСТЬ! Содержимое удалённого файла осталось в индексе: %s", idx.keys())
+			}
+		}
+		t.Log("✅ Перенос папки переиндексирует её файлы, старые пути удаляются")
+	})
+
+	t.Run("SkipExtractStage", func(t *testing.T) {
+		os.MkdirAll(filepath.Join(tmpDir, ".extract-123", "data"), 0755)
+		os.WriteFile(filepath.Join(tmpDir, ".extract-123", "data", "half.txt"), []byte("недораспакованный"), 0644)
+		defer os.RemoveAll(filepath.Join(tmpDir, ".extract-123"))
+		if _, err := fs.ReindexAll(); err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(idx.keys(), ".extract-") {
+			t.Errorf("❌ Временная папка распаковки попала в индекс: %s", idx.keys())
+		}
+		page, err := fs.Search("", fs.SearchOptions{NameGlob: "half*"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Results) != 0 {
+			t.Errorf("❌ Временная папка распаковки попала в поиск: %v", page.Results)
+		}
+		t.Log("✅ Временные папки распаковки не индексируются и не ищутся")
+	})
+
+	t.Run("Unzip", func(t *testing.T) {
+		os.MkdirAll(filepath.Join(tmpDir, "src"), 0755)
+		fs.WriteFile("src/readme.md", "внутри архива")
+		if err := fs.CreateZip("src", "pack.zip"); err != nil {
+			t.Fatal(err)
+		}
+		if err := fs.Unzip("pack.zip", "out"); err != nil {
+			t.Fatal(err)
+		}
+		var archived, extracted bool
+		for key, content := range idx.docs {
+			if content != "внутри архива" {
+				continue
+			}
+			archived = archived || strings.HasPrefix(key, "pack.zip!")
+			extracted = extracted || strings.HasPrefix(key, "out"+string(filepath.Separator))
+		}
+		if !archived || !extracted {
+			t.Errorf("❌ Архив или распакованные файлы не проиндексированы: %s", idx.keys())
+		}
+		if err := fs.DeleteFile("pack.zip"); err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(idx.keys(), "pack.zip") {
+			t.Errorf("❌ УЯЗВИМОСТЬ! Записи удалённого архива остались в индексе: %s", idx.keys())
+		}
+		t.Log("✅ Распаковка индексирует архив и файлы, удаление архива убирает его записи")
+	})
+}
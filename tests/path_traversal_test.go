@@ -1,8 +1,11 @@
 package tests
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"secure-fm/config"
@@ -92,3 +95,200 @@ func TestPathTraversal(t *testing.T) {
 		})
 	}
 }
+
+// TestSearchSandboxBoundary проверяет, что поиск не выходит за пределы sandbox
+// Уязвимость: символическая ссылка внутри sandbox указывает на внешнюю директорию
+func TestSearchSandboxBoundary(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "sandbox_search")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	outsideDir, err := os.MkdirTemp("", "outside_search")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(outsideDir)
+
+	cfg := &config.Config{SandboxPath: tmpDir}
+	fs.InitFS(cfg)
+
+	os.MkdirAll(filepath.Join(tmpDir, "docs"), 0755)
+	os.WriteFile(filepath.Join(tmpDir, "docs", "report.txt"), []byte("inside"), 0644)
+	os.WriteFile(filepath.Join(outsideDir, "secret.txt"), []byte("outside"), 0644)
+
+	if err := os.Symlink(outsideDir, filepath.Join(tmpDir, "escape")); err != nil {
+		t.Skipf("символические ссылки недоступны: %v", err)
+	}
+
+	t.Run("SymlinkSkipped", func(t *testing.T) {
+		page, err := fs.Search(".", fs.SearchOptions{NameGlob: "*.txt"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, r := range page.Results {
+			if strings.Contains(r.Path, "secret") || strings.HasPrefix(r.Path, "escape") {
+				t.Errorf("❌ УЯЗВИМОСТЬ! Поиск вышел за пределы sandbox через ссылку: %s", r.Path)
+			}
+		}
+		if page.Total != 1 {
+			t.Errorf("Ожидался 1 результат, получено %d", page.Total)
+		} else {
+			t.Logf("✅ Символическая ссылка пропущена, найдено: %s", page.Results[0].Path)
+		}
+	})
+
+	t.Run("TraversalRoot", func(t *testing.T) {
+		if _, err := fs.Search("../", fs.SearchOptions{}); err == nil {
+			t.Error("❌ УЯЗВИМОСТЬ! Поиск от корня вне sandbox разрешён")
+		} else {
+			t.Logf("✅ ЗАЩИТА РАБОТАЕТ: %v", err)
+		}
+	})
+
+	t.Run("SymlinkRoot", func(t *testing.T) {
+		if _, err := fs.Search("escape", fs.SearchOptions{}); err == nil {
+			t.Error("❌ УЯЗВИМОСТЬ! Поиск по символической ссылке разрешён")
+		} else {
+			t.Logf("✅ ЗАЩИТА РАБОТАЕТ: %v", err)
+		}
+	})
+
+	t.Run("SymlinkParent", func(t *testing.T) {
+		// Корень поиска — обычная директория, но путь к ней проходит через ссылку
+		os.MkdirAll(filepath.Join(outsideDir, "sub"), 0755)
+		os.WriteFile(filepath.Join(outsideDir, "sub", "secret.txt"), []byte("outside"), 0644)
+
+		page, err := fs.Search("escape/sub", fs.SearchOptions{})
+		if err == nil {
+			t.Errorf("❌ УЯЗВИМОСТЬ! Поиск через родительскую ссылку разрешён, найдено: %d", page.Total)
+		} else {
+			t.Logf("✅ ЗАЩИТА РАБОТАЕТ: %v", err)
+		}
+	})
+}
+
+// TestPatchSandboxBoundary проверяет diff и применение патчей
+// Уязвимость: пути в заголовках патча (---/+++) указывают за пределы sandbox
+func TestPatchSandboxBoundary(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "sandbox_patch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cfg := &config.Config{SandboxPath: tmpDir}
+	fs.InitFS(cfg)
+
+	t.Run("DiffAndApply", func(t *testing.T) {
+		fs.WriteFile("old.txt", "1\n2\n3\n4\n5\n6\n7\n8\n9\n")
+		fs.WriteFile("new.txt", "1\n2\n3\n4\nfive\n6\n7\n8\n9\n10")
+		diff, err := fs.UnifiedDiff("old.txt", "new.txt", 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(diff, "@@ -3,7 +3,8 @@\n 3\n 4\n-5\n+five\n") || !strings.Contains(diff, "+10\n\\ No newline at end of file") {
+			t.Errorf("❌ Неверный unified diff:\n%s", diff)
+		}
+
+		// Файл сдвинут на две строки и одна строка контекста изменена: нужны смещение и fuzz
+		diff = strings.ReplaceAll(diff, "b/new.txt", "b/old.txt")
+		fs.WriteFile("old.txt", "a\nb\n1\n2\nthree\n4\n5\n6\n7\n8\n9\n")
+		if _, err := fs.ApplyPatch(diff, "", 0); err == nil {
+			t.Error("❌ Патч применён без fuzz к несовпадающему контексту")
+		}
+		result, err := fs.ApplyPatch(diff, "", fs.DefaultPatchFuzz)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, _ := fs.ReadFile("old.txt")
+		if got != "a\nb\n1\n2\nthree\n4\nfive\n6\n7\n8\n9\n10" || result.Hunks[0].Offset != 2 || result.Hunks[0].Fuzz != 1 {
+			t.Errorf("❌ Неверный результат патча: %q %v", got, result.Hunks)
+		}
+		if got := fs.DiffText("a", "b", "1\n2\n", "1\n3\n", -5); got != fs.DiffText("a", "b", "1\n2\n", "1\n3\n", 0) {
+			t.Errorf("❌ Отрицательный контекст не приведён к нулю:\n%s", got)
+		}
+		t.Logf("✅ Патч применён: %v", result.Hunks)
+	})
+
+	t.Run("OutsidePaths", func(t *testing.T) {
+		os.WriteFile(filepath.Join(tmpDir, "keep.txt"), []byte("x\n"), 0644)
+		for _, target := range []string{"a/../../outside.txt", "/tmp/outside.txt", "sub/../../outside.txt", "%2e%2e/outside.txt", "..\\outside.txt"} {
+			// Первый файл патча корректен: при ошибке во втором не должен измениться и он
+			patch := "--- keep.txt\n+++ keep.txt\n@@ -1 +1 @@\n-x\n+y\n" +
+				"--- /dev/null\n+++ " + target + "\n@@ -0,0 +1 @@\n+pwned\n"
+			if _, err := fs.ApplyPatch(patch, "", fs.DefaultPatchFuzz); err == nil {
+				t.Errorf("❌ УЯЗВИМОСТЬ! Патч записал файл по пути %q", target)
+			}
+		}
+		if data, _ := os.ReadFile(filepath.Join(tmpDir, "keep.txt")); string(data) != "x\n" {
+			t.Errorf("❌ Патч применён частично: %q", data)
+		}
+		if _, err := os.Stat(filepath.Join(filepath.Dir(tmpDir), "outside.txt")); err == nil {
+			t.Error("❌ УЯЗВИМОСТЬ! Файл создан вне sandbox")
+		}
+		t.Log("✅ Пути вне sandbox в патче отклоняются, файлы не изменяются")
+	})
+
+	t.Run("AllOrNothing", func(t *testing.T) {
+		fs.WriteFile("first.txt", "x\n")
+		// Второй файл не может быть записан: его папки нет
+		patch := "--- first.txt\n+++ first.txt\n@@ -1 +1 @@\n-x\n+y\n" +
+			"--- /dev/null\n+++ missing/second.txt\n@@ -0,0 +1 @@\n+z\n"
+		if _, err := fs.ApplyPatch(patch, "", fs.DefaultPatchFuzz); err == nil {
+			t.Fatal("❌ Патч записал файл в несуществующую папку")
+		}
+		if got, _ := fs.ReadFile("first.txt"); got != "x\n" {
+			t.Errorf("❌ Ошибка записи второго файла оставила первый изменённым: %q", got)
+		}
+
+		// Второй файл постоянно дописывается другим пользователем: при конфликте
+		// его версии первый файл должен остаться прежним
+		body := "b\n" + strings.Repeat("строка\n", 100000)
+		fs.WriteFile("second.txt", body)
+		patch = "--- first.txt\n+++ first.txt\n@@ -1 +1 @@\n-x\n+y\n" +
+			"--- second.txt\n+++ second.txt\n@@ -1 +1 @@\n-b\n+c\n"
+		stop := make(chan struct{})
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; ; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+					fs.WriteFile("second.txt", body+fmt.Sprint(i))
+				}
+			}
+		}()
+		conflicts := 0
+		for i := 0; i < 50 && conflicts < 5; i++ {
+			_, err := fs.ApplyPatch(patch, "", fs.DefaultPatchFuzz)
+			switch {
+			case errors.Is(err, fs.ErrVersionConflict):
+				conflicts++
+				if got, _ := fs.ReadFile("first.txt"); got != "x\n" {
+					t.Fatalf("❌ Конфликт версии второго файла оставил первый изменённым: %q", got)
+				}
+			case err == nil:
+				fs.WriteFile("first.txt", "x\n")
+			}
+		}
+		close(stop)
+		<-done
+
+		// Удаление выполняется вместе с остальными изменениями патча
+		fs.WriteFile("first.txt", "x\n")
+		fs.WriteFile("second.txt", "b\n")
+		patch = "--- first.txt\n+++ first.txt\n@@ -1 +1 @@\n-x\n+y\n" +
+			"--- second.txt\n+++ /dev/null\n@@ -1 +0,0 @@\n-b\n"
+		if _, err := fs.ApplyPatch(patch, "", fs.DefaultPatchFuzz); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fs.ReadFile("second.txt"); err == nil {
+			t.Error("❌ Файл не удалён патчем")
+		}
+		t.Logf("✅ Патч применяется целиком или не применяется (конфликтов версий: %d)", conflicts)
+	})
+}
@@ -1,12 +1,17 @@
 package tests
 
 import (
+	"bufio"
+	"errors"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
 
 	"secure-fm/config"
+	"secure-fm/editor"
 	"secure-fm/fs"
 )
 
@@ -137,3 +142,145 @@ func min(a, b int) int {
 	}
 	return b
 }
+
+// TestEditorConflict проверяет полноэкранный редактор на сценарии нажатий клавиш
+// Уязвимость: редактор перезаписывает изменения, сделанные другим пользователем во время редактирования
+func TestEditorConflict(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "sandbox_editor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cfg := &config.Config{SandboxPath: tmpDir}
+	fs.InitFS(cfg)
+
+	const (
+		ctrlQ, ctrlR, ctrlS, ctrlY, ctrlZ = "\x11", "\x12", "\x13", "\x19", "\x1a"
+		down, end, left                   = "\x1b[B", "\x1b[F", "\x1b[D"
+	)
+	run := func(t *testing.T, e *editor.Editor, keys string) bool {
+		t.Helper()
+		saved, err := e.Run(bufio.NewReader(strings.NewReader(keys)), io.Discard, func() (int, int) { return 10, 40 })
+		if err != nil {
+			t.Fatal(err)
+		}
+		return saved
+	}
+
+	t.Run("EditUndoReplace", func(t *testing.T) {
+		fs.WriteFile("notes.txt", "alpha\r\nbeta\r\ngamma\r\n")
+		e, err := editor.Open("notes.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Многострочная вставка в конец второй строки, удаление символа, отмена и повтор,
+		// замена всех «a» на «A»
+		keys := down + end + "!\rnew line" + left + "\x7f" + ctrlZ + ctrlY +
+			ctrlR + "a\rA\ra" + ctrlS + ctrlQ
+		if !run(t, e, keys) {
+			t.Fatal("❌ Файл не сохранён")
+		}
+		got, _ := fs.ReadFile("notes.txt")
+		if want := "AlphA\r\nbetA!\r\nnew lie\r\ngAmmA\r\n"; got != want {
+			t.Errorf("❌ Неверное содержимое: %q, ожидалось %q", got, want)
+		}
+		t.Log("✅ Вставка, отмена, повтор и замена работают; переводы строк CRLF сохранены")
+	})
+
+	t.Run("ConflictDetected", func(t *testing.T) {
+		fs.WriteFile("shared.txt", "v1\n")
+		e, err := editor.Open("shared.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Пока файл открыт в редакторе, его изменяет другой пользователь
+		fs.WriteFile("shared.txt", "чужая правка\n")
+
+		if run(t, e, "mine "+ctrlS+"n"+ctrlQ+ctrlQ) {
+			t.Error("❌ УЯЗВИМОСТЬ! Сохранение без подтверждения перезаписало чужие изменения")
+		}
+		if got, _ := fs.ReadFile("shared.txt"); got != "чужая правка\n" {
+			t.Errorf("❌ УЯЗВИМОСТЬ! Чужие изменения потеряны: %q", got)
+		}
+		t.Log("✅ Изменение файла на диске обнаружено, сохранение отменено")
+	})
+
+	t.Run("UnsafeFiles", func(t *testing.T) {
+		os.WriteFile(filepath.Join(tmpDir, "bin.dat"), []byte{0x7f, 'E', 'L', 'F', 0}, 0644)
+		for _, path := range []string{"bin.dat", "../outside.txt"} {
+			if _, err := editor.Open(path); err == nil {
+				t.Errorf("❌ Файл %s открыт в редакторе", path)
+			}
+		}
+		t.Log("✅ Двоичные файлы и пути вне sandbox не открываются")
+	})
+}
+
+// TestOptimisticConcurrency проверяет условную запись по версии файла
+// Уязвимость: «потерянное обновление» — запись на основе устаревшего чтения затирает чужие изменения
+func TestOptimisticConcurrency(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "sandbox_version")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cfg := &config.Config{SandboxPath: tmpDir}
+	fs.InitFS(cfg)
+
+	t.Run("LostUpdate", func(t *testing.T) {
+		fs.WriteFile("doc.txt", "v1\n")
+		// Два пользователя читают одну версию файла
+		_, v1, _ := fs.ReadFileVersion("doc.txt")
+		_, v2, _ := fs.ReadFileVersion("doc.txt")
+
+		if err := fs.WriteFileIfMatch("doc.txt", "правка первого\n", v1); err != nil {
+			t.Fatalf("❌ Запись с актуальной версией отклонена: %v", err)
+		}
+		err := fs.WriteFileIfMatch("doc.txt", "правка второго\n", v2)
+		if !errors.Is(err, fs.ErrVersionConflict) {
+			t.Errorf("❌ УЯЗВИМОСТЬ! Запись с устаревшей версией не отклонена: %v", err)
+		}
+		if got, _ := fs.ReadFile("doc.txt"); got != "правка первого\n" {
+			t.Errorf("❌ УЯЗВИМОСТЬ! Изменения первого пользователя потеряны: %q", got)
+		}
+		t.Logf("✅ Устаревшая запись отклонена: %v", err)
+	})
+
+	t.Run("CreateOnly", func(t *testing.T) {
+		if err := fs.WriteFileIfMatch("new.txt", "first\n", ""); err != nil {
+			t.Fatalf("❌ Создание нового файла отклонено: %v", err)
+		}
+		if err := fs.WriteFileIfMatch("new.txt", "second\n", ""); !errors.Is(err, fs.ErrVersionConflict) {
+			t.Errorf("❌ УЯЗВИМОСТЬ! Существующий файл перезаписан как новый: %v", err)
+		}
+		t.Log("✅ Пустая версия создаёт файл, только если его ещё нет")
+	})
+
+	t.Run("ConcurrentWriters", func(t *testing.T) {
+		fs.WriteFile("counter.txt", "0")
+		_, version, _ := fs.ReadFileVersion("counter.txt")
+
+		const writers = 20
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		succeeded := 0
+		for i := 0; i < writers; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				if fs.WriteFileIfMatch("counter.txt", strings.Repeat("x", i+1), version) == nil {
+					mu.Lock()
+					succeeded++
+					mu.Unlock()
+				}
+			}(i)
+		}
+		wg.Wait()
+		if succeeded != 1 {
+			t.Errorf("❌ УЯЗВИМОСТЬ! С одной версией успешно записали %d потоков, ожидался 1", succeeded)
+		}
+		t.Logf("✅ Из %d одновременных записей с одной версией прошла одна", writers)
+	})
+}
@@ -1,10 +1,16 @@
 package tests
 
 import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+
+	"secure-fm/db"
 )
 
 // TestSQLInjectionProtection проверяет защиту от SQL-инъекций
@@ -17,6 +23,7 @@ func TestSQLInjectionProtection(t *testing.T) {
 		filepath.Join("..", "db", "users.go"),
 		filepath.Join("..", "db", "files.go"),
 		filepath.Join("..", "db", "logs.go"),
+		filepath.Join("..", "db", "index.go"),
 		filepath.Join("..", "db", "db.go"),
 	}
 
@@ -126,3 +133,80 @@ func TestPasswordHashing(t *testing.T) {
 		t.Log("✅ Пароли хранятся как хеши (password_hash)")
 	}
 }
+
+// recordedQuery — запрос, выполненный через recordingDriver
+type recordedQuery struct {
+	query string
+	args  []driver.Value
+}
+
+// recordingDriver — драйвер database/sql без базы данных: запоминает запросы
+// и аргументы. UPDATE ... RETURNING не находит строк, INSERT ... RETURNING возвращает id 1
+type recordingDriver struct {
+	queries *[]recordedQuery
+}
+
+func (d recordingDriver) Open(string) (driver.Conn, error) { return recordingConn(d), nil }
+
+type recordingConn recordingDriver
+
+func (c recordingConn) Prepare(query string) (driver.Stmt, error) {
+	return recordingStmt{conn: c, query: query}, nil
+}
+func (c recordingConn) Close() error { return nil }
+func (c recordingConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("транзакции не поддерживаются")
+}
+
+type recordingStmt struct {
+	conn  recordingConn
+	query string
+}
+
+func (s recordingStmt) Close() error  { return nil }
+func (s recordingStmt) NumInput() int { return -1 }
+func (s recordingStmt) Exec(args []driver.Value) (driver.Result, error) {
+	*s.conn.queries = append(*s.conn.queries, recordedQuery{s.query, args})
+	return driver.RowsAffected(1), nil
+}
+func (s recordingStmt) Query(args []driver.Value) (driver.Rows, error) {
+	*s.conn.queries = append(*s.conn.queries, recordedQuery{s.query, args})
+	return &recordingRows{left: strings.HasPrefix(strings.TrimSpace(s.query), "INSERT")}, nil
+}
+
+type recordingRows struct {
+	left bool
+}
+
+func (r *recordingRows) Columns() []string { return []string{"id"} }
+func (r *recordingRows) Close() error      { return nil }
+func (r *recordingRows) Next(dest []driver.Value) error {
+	if !r.left {
+		return io.EOF
+	}
+	r.left = false
+	dest[0] = int64(1)
+	return nil
+}
+
+var recordingQueries []recordedQuery
+
+func init() {
+	sql.Register("recording", recordingDriver{queries: &recordingQueries})
+}
+
+// useRecordingDB подменяет db.DB на записывающий драйвер до конца теста
+func useRecordingDB(t *testing.T) *[]recordedQuery {
+	conn, err := sql.Open("recording", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := db.DB
+	db.DB = conn
+	recordingQueries = nil
+	t.Cleanup(func() {
+		db.DB = previous
+		conn.Close()
+	})
+	return &recordingQueries
+}
@@ -1,12 +1,20 @@
 package tests
 
 import (
+	"archive/tar"
 	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"secure-fm/config"
+	"secure-fm/db"
 	"secure-fm/fs"
 )
 
@@ -39,7 +47,7 @@ func TestZipBombProtection(t *testing.T) {
 	t.Run("OversizedTotal", func(t *testing.T) {
 		// Проверяем лимит общего размера (100 MB)
 		t.Log("✅ Защита: MaxDecompressedSize = 100 MB")
-		t.Log("✅ Защита: LimitReader ограничивает поток чтения")
+		t.Log("✅ Защита: LimitReader считает фактические байты, превышение — ошибка, а не обрезание")
 	})
 }
 
@@ -87,6 +95,838 @@ func TestZipSlipProtection(t *testing.T) {
 	}
 }
 
+// TestArchiveInspection проверяет, что просмотр архива находит опасные записи без записи на диск
+func TestArchiveInspection(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "sandbox_inspect")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cfg := &config.Config{SandboxPath: tmpDir}
+	fs.InitFS(cfg)
+
+	createZipWithPath(t, filepath.Join(tmpDir, "slip.zip"), "../../evil.txt")
+	createDeflateBomb(t, filepath.Join(tmpDir, "ratio.zip"), 1, 10*1024*1024)
+
+	for _, name := range []string{"slip.zip", "ratio.zip"} {
+		t.Run(name, func(t *testing.T) {
+			report, err := fs.InspectArchive(name)
+			if err != nil {
+				t.Logf("✅ Архив отклонён при чтении: %v", err)
+				return
+			}
+			if report.Safe() {
+				t.Errorf("❌ УЯЗВИМОСТЬ! Опасный архив %s помечен как безопасный", name)
+			} else {
+				for _, e := range report.Entries {
+					t.Logf("✅ %s: %v", e.Name, e.Problems)
+				}
+			}
+		})
+	}
+
+	entries, _ := os.ReadDir(tmpDir)
+	if len(entries) != 2 {
+		t.Errorf("❌ Просмотр архива изменил содержимое sandbox: %d объектов", len(entries))
+	}
+}
+
+// TestTarAttacks проверяет защиту распаковки TAR/TAR.GZ/GZIP
+// Уязвимость: path traversal, ссылки за пределы папки, устройства и gzip-бомбы в архиве
+func TestTarAttacks(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "sandbox_tar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cfg := &config.Config{SandboxPath: tmpDir}
+	fs.InitFS(cfg)
+
+	testCases := []struct {
+		name    string
+		headers []*tar.Header
+		desc    string
+	}{
+		{
+			name:    "Traversal",
+			headers: []*tar.Header{{Name: "../../evil.txt", Typeflag: tar.TypeReg, Mode: 0644}},
+			desc:    "Файл с путём за пределами папки",
+		},
+		{
+			name:    "AbsoluteSymlink",
+			headers: []*tar.Header{{Name: "passwd", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"}},
+			desc:    "Символическая ссылка на абсолютный путь",
+		},
+		{
+			name:    "RelativeSymlinkEscape",
+			headers: []*tar.Header{{Name: "up", Typeflag: tar.TypeSymlink, Linkname: "../.."}},
+			desc:    "Символическая ссылка наверх",
+		},
+		{
+			name: "WriteThroughSymlink",
+			headers: []*tar.Header{
+				{Name: "dir", Typeflag: tar.TypeSymlink, Linkname: "sub"},
+				{Name: "dir/file.txt", Typeflag: tar.TypeReg, Mode: 0644},
+			},
+			desc: "Запись файла через символическую ссылку",
+		},
+		{
+			name:    "HardlinkEscape",
+			headers: []*tar.Header{{Name: "shadow", Typeflag: tar.TypeLink, Linkname: "../../etc/shadow"}},
+			desc:    "Жёсткая ссылка за пределы папки",
+		},
+		{
+			name:    "CharDevice",
+			headers: []*tar.Header{{Name: "null", Typeflag: tar.TypeChar, Devmajor: 1, Devminor: 3}},
+			desc:    "Символьное устройство",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			archiveName := tc.name + ".tar.gz"
+			createTarGz(t, filepath.Join(tmpDir, archiveName), tc.headers, []byte("malicious content"))
+
+			err := fs.ExtractTar(archiveName, "extracted_"+tc.name)
+			if err != nil {
+				t.Logf("✅ ЗАЩИТА TAR: %s - %v", tc.desc, err)
+			} else {
+				t.Errorf("❌ УЯЗВИМОСТЬ! %s: архив был распакован!", tc.desc)
+			}
+		})
+	}
+
+	t.Run("GzipBomb", func(t *testing.T) {
+		// 20 MB нулей сжимаются примерно в 20 KB (степень сжатия ~1000:1)
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		gz.Write(make([]byte, 20*1024*1024))
+		gz.Close()
+		os.WriteFile(filepath.Join(tmpDir, "bomb.gz"), buf.Bytes(), 0644)
+
+		err := fs.Gunzip("bomb.gz", "bomb.bin")
+		if err != nil {
+			t.Logf("✅ ЗАЩИТА ОТ GZIP-БОМБЫ: %v", err)
+		} else {
+			t.Error("❌ УЯЗВИМОСТЬ! gzip-бомба была распакована")
+		}
+		if _, statErr := os.Stat(filepath.Join(tmpDir, "bomb.bin")); statErr == nil {
+			t.Error("❌ Частично распакованный файл не удалён")
+		}
+	})
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		os.MkdirAll(filepath.Join(tmpDir, "src", "nested"), 0755)
+		os.WriteFile(filepath.Join(tmpDir, "src", "nested", "a.txt"), []byte("hello"), 0644)
+
+		if err := fs.CreateArchive([]string{"src"}, "src.tar.gz"); err != nil {
+			t.Fatal(err)
+		}
+		if err := fs.ExtractArchive("src.tar.gz", "restored", fs.ExtractOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(filepath.Join(tmpDir, "restored", "src", "nested", "a.txt"))
+		if err != nil || string(data) != "hello" {
+			t.Errorf("Ожидалось содержимое 'hello', получено %q (%v)", data, err)
+		} else {
+			t.Log("✅ TAR.GZ: создание и распаковка работают")
+		}
+	})
+}
+
+// TestArchiveLimits проверяет лимиты распаковки по фактическим байтам
+// Уязвимость: доверие заголовкам архива и молчаливое обрезание файлов вместо ошибки
+func TestArchiveLimits(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "sandbox_limits")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cfg := &config.Config{
+		SandboxPath:       tmpDir,
+		ArchiveMaxSize:    4 * 1024 * 1024,
+		ArchiveMaxEntries: 5,
+		ArchiveMaxDepth:   4,
+	}
+	fs.InitFS(cfg)
+	defer fs.SetArchiveLimits(fs.ArchiveLimits{})
+
+	noise := make([]byte, 1536*1024)
+	rand.Read(noise)
+
+	tests := []struct {
+		name  string
+		desc  string
+		build func(path string)
+	}{
+		{"total_size", "несжимаемые данные сверх лимита общего размера", func(path string) {
+			createZipFiles(t, path, []string{"a.bin", "b.bin", "c.bin"}, noise)
+		}},
+		{"too_many", "записей больше лимита", func(path string) {
+			createZipFiles(t, path, []string{"1", "2", "3", "4", "5", "6"}, []byte("x"))
+		}},
+		{"too_deep", "слишком глубокая вложенность пути", func(path string) {
+			createZipFiles(t, path, []string{"ok.txt", "a/b/c/d/e.txt"}, []byte("x"))
+		}},
+		{"ratio", "фактическая степень сжатия выше лимита", func(path string) {
+			createDeflateBomb(t, path, 1, 3*1024*1024)
+		}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.build(filepath.Join(tmpDir, tc.name+".zip"))
+
+			// В папке назначения уже есть файл пользователя — он должен уцелеть
+			destDir := filepath.Join(tmpDir, "out_"+tc.name)
+			os.MkdirAll(destDir, 0755)
+			os.WriteFile(filepath.Join(destDir, "keep.txt"), []byte("keep"), 0644)
+
+			err := fs.Unzip(tc.name+".zip", "out_"+tc.name)
+			if err != nil {
+				t.Logf("✅ ЗАЩИТА: %s - %v", tc.desc, err)
+			} else {
+				t.Errorf("❌ УЯЗВИМОСТЬ! %s: архив был распакован!", tc.desc)
+			}
+
+			entries, _ := os.ReadDir(destDir)
+			if len(entries) != 1 || entries[0].Name() != "keep.txt" {
+				t.Errorf("❌ Частично распакованные данные не удалены: %d записей в папке назначения", len(entries))
+			}
+		})
+	}
+
+	t.Run("WithinLimits", func(t *testing.T) {
+		createZipFiles(t, filepath.Join(tmpDir, "ok.zip"), []string{"a/b/c/d.txt", "e.bin"}, noise)
+		if err := fs.Unzip("ok.zip", "out_ok"); err != nil {
+			t.Fatalf("Архив в пределах лимитов отклонён: %v", err)
+		}
+		info, err := os.Stat(filepath.Join(tmpDir, "out_ok", "e.bin"))
+		if err != nil || info.Size() != int64(len(noise)) {
+			t.Errorf("❌ Файл распакован не полностью: %v", err)
+		} else {
+			t.Log("✅ Архив в пределах лимитов распакован полностью")
+		}
+	})
+}
+
+// TestTransactionalExtraction проверяет распаковку через временную папку
+// Уязвимость: ошибка на середине архива оставляет часть файлов и перезаписывает существующие
+func TestTransactionalExtraction(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "sandbox_staging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cfg := &config.Config{SandboxPath: tmpDir}
+	fs.InitFS(cfg)
+
+	createZipFiles(t, filepath.Join(tmpDir, "update.zip"), []string{"a.txt", "b.txt"}, []byte("new"))
+
+	prepare := func(dir string) string {
+		os.MkdirAll(filepath.Join(tmpDir, dir), 0755)
+		os.WriteFile(filepath.Join(tmpDir, dir, "a.txt"), []byte("old"), 0644)
+		return filepath.Join(tmpDir, dir)
+	}
+	read := func(path string) string {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "<нет файла>"
+		}
+		return string(data)
+	}
+
+	t.Run("ConflictAbortsAll", func(t *testing.T) {
+		dir := prepare("conflict")
+		err := fs.ExtractArchive("update.zip", "conflict", fs.ExtractOptions{})
+		if err == nil {
+			t.Error("❌ УЯЗВИМОСТЬ! Существующий файл перезаписан без разрешения")
+		} else {
+			t.Logf("✅ Конфликт обнаружен до изменений: %v", err)
+		}
+		if read(filepath.Join(dir, "a.txt")) != "old" || read(filepath.Join(dir, "b.txt")) != "<нет файла>" {
+			t.Error("❌ Папка назначения изменена, хотя распаковка отменена")
+		}
+	})
+
+	t.Run("Skip", func(t *testing.T) {
+		dir := prepare("skip")
+		if err := fs.ExtractArchive("update.zip", "skip", fs.ExtractOptions{Overwrite: fs.OverwriteSkip}); err != nil {
+			t.Fatal(err)
+		}
+		if read(filepath.Join(dir, "a.txt")) != "old" || read(filepath.Join(dir, "b.txt")) != "new" {
+			t.Error("❌ Политика пропуска работает неверно")
+		} else {
+			t.Log("✅ Существующий файл сохранён, новый распакован")
+		}
+	})
+
+	t.Run("Replace", func(t *testing.T) {
+		dir := prepare("replace")
+		if err := fs.ExtractArchive("update.zip", "replace", fs.ExtractOptions{Overwrite: fs.OverwriteReplace}); err != nil {
+			t.Fatal(err)
+		}
+		if read(filepath.Join(dir, "a.txt")) != "new" {
+			t.Error("❌ Политика замены не заменила файл")
+		} else {
+			t.Log("✅ Существующий файл заменён")
+		}
+	})
+
+	t.Run("FailureLeavesNoTrace", func(t *testing.T) {
+		// Первая запись корректна, вторая — Zip Slip
+		createZipFiles(t, filepath.Join(tmpDir, "half.zip"), []string{"good.txt", "../evil.txt"}, []byte("x"))
+		dir := prepare("half")
+
+		err := fs.ExtractArchive("half.zip", "half", fs.ExtractOptions{Overwrite: fs.OverwriteReplace})
+		if err == nil {
+			t.Fatal("❌ УЯЗВИМОСТЬ! Архив с Zip Slip распакован")
+		}
+		if read(filepath.Join(dir, "good.txt")) != "<нет файла>" || read(filepath.Join(dir, "a.txt")) != "old" {
+			t.Error("❌ УЯЗВИМОСТЬ! Частично распакованные файлы попали в папку назначения")
+		} else {
+			t.Logf("✅ Папка назначения не изменена: %v", err)
+		}
+
+		leftovers, _ := filepath.Glob(filepath.Join(tmpDir, ".extract-*"))
+		if len(leftovers) > 0 {
+			t.Errorf("❌ Временная папка не удалена: %v", leftovers)
+		}
+	})
+}
+
+// TestReproducibleZip проверяет воспроизводимые архивы и восстановление метаданных
+// Уязвимость: архив раскрывает права и время файлов хоста, а распаковка сохраняет setuid и запись для всех
+func TestReproducibleZip(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "sandbox_repro")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cfg := &config.Config{SandboxPath: tmpDir}
+	fs.InitFS(cfg)
+
+	src := filepath.Join(tmpDir, "src")
+	os.MkdirAll(filepath.Join(src, "cache"), 0755)
+	os.WriteFile(filepath.Join(src, "b.txt"), []byte("bbb"), 0666)
+	os.WriteFile(filepath.Join(src, "a.png"), []byte("png"), 0600)
+	os.WriteFile(filepath.Join(src, "cache", "tmp.bin"), []byte("x"), 0644)
+	os.Chmod(filepath.Join(src, "b.txt"), 0666)
+
+	opts := fs.ZipOptions{Deterministic: true, Exclude: []string{"cache"}}
+
+	t.Run("Deterministic", func(t *testing.T) {
+		if err := fs.CreateZipWithOptions([]string{"src"}, "first.zip", opts); err != nil {
+			t.Fatal(err)
+		}
+		later := time.Now().Add(time.Hour)
+		os.Chtimes(filepath.Join(src, "b.txt"), later, later)
+		if err := fs.CreateZipWithOptions([]string{"src"}, "second.zip", opts); err != nil {
+			t.Fatal(err)
+		}
+
+		first, _ := os.ReadFile(filepath.Join(tmpDir, "first.zip"))
+		second, _ := os.ReadFile(filepath.Join(tmpDir, "second.zip"))
+		if !bytes.Equal(first, second) {
+			t.Error("❌ Архивы с одинаковым содержимым различаются")
+		} else {
+			t.Log("✅ Архив воспроизводим побайтно")
+		}
+
+		r, err := zip.OpenReader(filepath.Join(tmpDir, "first.zip"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+		for _, f := range r.File {
+			if strings.Contains(f.Name, "cache") {
+				t.Errorf("❌ Исключённая запись попала в архив: %s", f.Name)
+			}
+			if f.Name == "src/a.png" && f.Method != zip.Store {
+				t.Error("❌ Уже сжатый формат сжат повторно")
+			}
+			if f.Name == "src/b.txt" && f.Mode().Perm() != 0644 {
+				t.Errorf("❌ Права хоста попали в архив: %v", f.Mode().Perm())
+			}
+		}
+	})
+
+	t.Run("UnsafeModesOnExtract", func(t *testing.T) {
+		modified := time.Date(2020, 5, 17, 12, 0, 0, 0, time.UTC)
+		f, _ := os.Create(filepath.Join(tmpDir, "modes.zip"))
+		w := zip.NewWriter(f)
+		header := &zip.FileHeader{Name: "run.sh", Method: zip.Deflate, Modified: modified}
+		header.SetMode(os.ModeSetuid | 0777)
+		fw, _ := w.CreateHeader(header)
+		fw.Write([]byte("#!/bin/sh"))
+		w.Close()
+		f.Close()
+
+		if err := fs.Unzip("modes.zip", "modes"); err != nil {
+			t.Fatal(err)
+		}
+		info, err := os.Stat(filepath.Join(tmpDir, "modes", "run.sh"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode()&os.ModeSetuid != 0 || info.Mode().Perm()&0022 != 0 {
+			t.Errorf("❌ УЯЗВИМОСТЬ! Опасные права сохранены: %v", info.Mode())
+		} else {
+			t.Logf("✅ Права ограничены до %v", info.Mode().Perm())
+		}
+		if !info.ModTime().Equal(modified) {
+			t.Errorf("❌ Время изменения не восстановлено: %v", info.ModTime())
+		}
+	})
+}
+
+// TestEncryptedZip проверяет архивы AES-256 (WinZip AE-2)
+// Уязвимость: подмена зашифрованных данных или бомба внутри шифрованной записи обходят проверки
+func TestEncryptedZip(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "sandbox_aes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cfg := &config.Config{SandboxPath: tmpDir}
+	fs.InitFS(cfg)
+
+	os.MkdirAll(filepath.Join(tmpDir, "secret"), 0755)
+	content := bytes.Repeat([]byte("конфиденциально "), 1000)
+	os.WriteFile(filepath.Join(tmpDir, "secret", "report.txt"), content, 0644)
+
+	const password = "partner-pass-1"
+	if err := fs.CreateZipWithOptions([]string{"secret"}, "secret.zip", fs.ZipOptions{Password: password}); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, _ := os.ReadFile(filepath.Join(tmpDir, "secret.zip"))
+	if bytes.Contains(raw, []byte("конфиденциально")) {
+		t.Error("❌ УЯЗВИМОСТЬ! Открытый текст виден в архиве")
+	}
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		if err := fs.ExtractArchive("secret.zip", "ok", fs.ExtractOptions{Password: password}); err != nil {
+			t.Fatal(err)
+		}
+		data, _ := os.ReadFile(filepath.Join(tmpDir, "ok", "secret", "report.txt"))
+		if !bytes.Equal(data, content) {
+			t.Error("❌ Расшифрованное содержимое не совпадает")
+		} else {
+			t.Log("✅ Архив AES-256 создан и расшифрован")
+		}
+	})
+
+	t.Run("WrongPassword", func(t *testing.T) {
+		for _, pw := range []string{"", "wrong-password"} {
+			if err := fs.ExtractArchive("secret.zip", "wrong", fs.ExtractOptions{Password: pw}); err == nil {
+				t.Errorf("❌ УЯЗВИМОСТЬ! Архив распакован с паролем %q", pw)
+			} else {
+				t.Logf("✅ Пароль %q отклонён: %v", pw, err)
+			}
+		}
+	})
+
+	t.Run("Tampered", func(t *testing.T) {
+		// Меняем байт внутри шифротекста — HMAC должен это обнаружить
+		zr, err := zip.NewReader(bytes.NewReader(raw), int64(len(raw)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		offset, err := zr.File[len(zr.File)-1].DataOffset()
+		if err != nil {
+			t.Fatal(err)
+		}
+		tampered := append([]byte(nil), raw...)
+		tampered[offset+16+2+1] ^= 0x01 // соль (16) + проверочное значение (2) + байт шифротекста
+		os.WriteFile(filepath.Join(tmpDir, "tampered.zip"), tampered, 0644)
+
+		err = fs.ExtractArchive("tampered.zip", "tampered", fs.ExtractOptions{Password: password})
+		if err == nil {
+			t.Error("❌ УЯЗВИМОСТЬ! Изменённый шифротекст принят")
+		} else {
+			t.Logf("✅ Подмена обнаружена: %v", err)
+		}
+		if _, statErr := os.Stat(filepath.Join(tmpDir, "tampered")); statErr == nil {
+			t.Error("❌ Данные из изменённого архива попали в папку назначения")
+		}
+	})
+
+	t.Run("EncryptedBomb", func(t *testing.T) {
+		os.WriteFile(filepath.Join(tmpDir, "zeros.bin"), make([]byte, 20*1024*1024), 0644)
+		if err := fs.CreateZipWithOptions([]string{"zeros.bin"}, "bomb.zip", fs.ZipOptions{Password: password}); err != nil {
+			t.Fatal(err)
+		}
+		err := fs.ExtractArchive("bomb.zip", "bomb", fs.ExtractOptions{Password: password})
+		if err == nil {
+			t.Error("❌ УЯЗВИМОСТЬ! Бомба внутри зашифрованной записи распакована")
+		} else {
+			t.Logf("✅ ЗАЩИТА ОТ ZIP-БОМБЫ после расшифровки: %v", err)
+		}
+	})
+}
+
+// TestNestedArchives проверяет рекурсивную проверку вложенных архивов
+// Уязвимость: бомба или Zip Slip во вложенном архиве не видны при проверке внешнего
+func TestNestedArchives(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "sandbox_nested")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cfg := &config.Config{SandboxPath: tmpDir, ArchiveMaxNesting: 2}
+	fs.InitFS(cfg)
+
+	zeros := make([]byte, 4*1024*1024)
+	bomb := buildZip(t, []string{"zeros.bin"}, [][]byte{zeros})
+	slip := buildZip(t, []string{"../../evil.sh"}, [][]byte{[]byte("evil")})
+	clean := buildZip(t, []string{"a.txt", "b.txt"}, [][]byte{[]byte("hello"), []byte("world")})
+
+	tests := []struct {
+		name string
+		data []byte
+		desc string
+	}{
+		{"bomb", buildZip(t, []string{"inner.zip"}, [][]byte{bomb}), "ZIP-бомба внутри архива"},
+		{"slip", buildZip(t, []string{"docs/inner.zip"}, [][]byte{slip}), "Zip Slip во вложенном архиве"},
+		{"deep", buildZip(t, []string{"l1.zip"}, [][]byte{
+			buildZip(t, []string{"l2.zip"}, [][]byte{buildZip(t, []string{"l3.zip"}, [][]byte{clean})}),
+		}), "вложенность архивов выше лимита"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			os.WriteFile(filepath.Join(tmpDir, tc.name+".zip"), tc.data, 0644)
+			report, err := fs.ScanNested(tc.name+".zip", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if report.Safe() {
+				t.Errorf("❌ УЯЗВИМОСТЬ! %s не обнаружено", tc.desc)
+				return
+			}
+			for _, f := range report.Findings {
+				t.Logf("✅ %s: %s — %s", tc.desc, f.Path, f.Problem)
+			}
+		})
+	}
+
+	t.Run("CleanNested", func(t *testing.T) {
+		os.WriteFile(filepath.Join(tmpDir, "clean.zip"), buildZip(t, []string{"inner.zip"}, [][]byte{clean}), 0644)
+		report, err := fs.ScanNested("clean.zip", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !report.Safe() || report.Archives != 2 || report.TotalSize != 10 {
+			t.Errorf("Ожидался безопасный отчёт (2 архива, 10 байт), получено %+v", report)
+		} else {
+			t.Log("✅ Вложенный архив без проблем проверен полностью")
+		}
+		if _, err := os.Stat(filepath.Join(tmpDir, "inner.zip")); err == nil {
+			t.Error("❌ Проверка записала вложенный архив на диск")
+		}
+	})
+}
+
+// TestArchiveUpdate проверяет архивы из нескольких источников, выборочную распаковку и изменение ZIP
+// Уязвимость: перезапись архива теряет его права доступа или переносит в архив права хоста
+func TestArchiveUpdate(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "sandbox_update")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cfg := &config.Config{SandboxPath: tmpDir}
+	fs.InitFS(cfg)
+
+	os.MkdirAll(filepath.Join(tmpDir, "docs"), 0755)
+	os.WriteFile(filepath.Join(tmpDir, "docs", "a.txt"), []byte("a"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "docs", "old.log"), []byte("log"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "notes.txt"), []byte("v1"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "new.txt"), []byte("v2"), 0666)
+	os.Chmod(filepath.Join(tmpDir, "new.txt"), 0666|os.ModeSetgid)
+
+	entries := func(t *testing.T, name string) map[string]*zip.File {
+		t.Helper()
+		r, err := zip.OpenReader(filepath.Join(tmpDir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { r.Close() })
+		files := make(map[string]*zip.File)
+		for _, f := range r.File {
+			files[f.Name] = f
+		}
+		return files
+	}
+
+	t.Run("MultiSource", func(t *testing.T) {
+		for _, target := range []string{"multi.zip", "multi.tar.gz"} {
+			if err := fs.CreateArchive([]string{"docs", "notes.txt"}, target); err != nil {
+				t.Fatalf("❌ %s: %v", target, err)
+			}
+			if err := fs.ExtractArchive(target, "out_"+target, fs.ExtractOptions{}); err != nil {
+				t.Fatal(err)
+			}
+			for _, name := range []string{"docs/a.txt", "docs/old.log", "notes.txt"} {
+				if _, err := os.Stat(filepath.Join(tmpDir, "out_"+target, name)); err != nil {
+					t.Errorf("❌ %s: нет записи %s", target, name)
+				}
+			}
+		}
+		if err := fs.CreateArchive([]string{"notes.txt", "notes.txt"}, "dup.zip"); err == nil {
+			t.Error("❌ Повторяющиеся имена записей приняты")
+		}
+		t.Log("✅ Архив из нескольких источников создан и распакован")
+	})
+
+	t.Run("Patterns", func(t *testing.T) {
+		opts := fs.ExtractOptions{Patterns: []string{"*.txt"}}
+		if err := fs.ExtractArchive("multi.zip", "selected", opts); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(filepath.Join(tmpDir, "selected", "docs", "old.log")); err == nil {
+			t.Error("❌ Распакована запись, не подходящая под шаблон")
+		}
+		if _, err := os.Stat(filepath.Join(tmpDir, "selected", "docs", "a.txt")); err != nil {
+			t.Error("❌ Шаблон не сравнивается с базовым именем записи")
+		}
+		if err := fs.ExtractArchive("multi.zip", "none", fs.ExtractOptions{Patterns: []string{"*.exe"}}); err == nil {
+			t.Error("❌ Шаблон без совпадений не сообщён")
+		}
+		t.Log("✅ Выборочная распаковка по шаблонам")
+	})
+
+	t.Run("AddReplaceRemove", func(t *testing.T) {
+		os.Chmod(filepath.Join(tmpDir, "multi.zip"), 0640)
+		result, err := fs.UpdateZip("multi.zip", fs.ZipUpdate{
+			Add:    map[string]string{"notes.txt": "new.txt", "extra/b.txt": "new.txt"},
+			Remove: []string{"docs/old.log"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Added != 1 || result.Replaced != 1 || result.Removed != 1 {
+			t.Errorf("❌ Неверный итог: %+v", *result)
+		}
+		files := entries(t, "multi.zip")
+		if _, ok := files["docs/old.log"]; ok || len(files) != 4 {
+			t.Errorf("❌ Неверный состав архива: %d записей", len(files))
+		}
+		if f := files["notes.txt"]; f == nil || f.Mode()&(os.ModeSetgid|0022) != 0 {
+			t.Errorf("❌ УЯЗВИМОСТЬ! Права хоста перенесены в архив: %v", f.Mode())
+		}
+		if info, _ := os.Stat(filepath.Join(tmpDir, "multi.zip")); info.Mode().Perm() != 0640 {
+			t.Errorf("❌ Права архива изменены: %v", info.Mode().Perm())
+		}
+		t.Log("✅ Записи добавлены, заменены и удалены; права архива сохранены")
+	})
+
+	t.Run("DuplicateNames", func(t *testing.T) {
+		createZipFiles(t, filepath.Join(tmpDir, "twice.zip"), []string{"x.txt", "x.txt", "y.txt"}, []byte("old"))
+		result, err := fs.UpdateZip("twice.zip", fs.ZipUpdate{Add: map[string]string{"x.txt": "notes.txt"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Added != 0 || result.Replaced != 1 || len(entries(t, "twice.zip")) != 2 {
+			t.Errorf("❌ Неверный итог при повторяющемся имени: %+v", *result)
+		}
+		_, err = fs.UpdateZip("twice.zip", fs.ZipUpdate{Add: map[string]string{"y.txt": "notes.txt", "./y.txt": "new.txt"}})
+		if err == nil {
+			t.Error("❌ Одна запись добавлена дважды под разными написаниями")
+		}
+		t.Log("✅ Повторяющиеся имена учитываются один раз")
+	})
+
+	t.Run("AtomicOnError", func(t *testing.T) {
+		before, _ := os.ReadFile(filepath.Join(tmpDir, "multi.zip"))
+		updates := []fs.ZipUpdate{
+			{Remove: []string{"*.exe"}},
+			{Add: map[string]string{"../evil.txt": "notes.txt"}},
+			{Add: map[string]string{"ok.txt": "missing.txt"}},
+		}
+		for _, update := range updates {
+			if _, err := fs.UpdateZip("multi.zip", update); err == nil {
+				t.Errorf("❌ Некорректное изменение принято: %+v", update)
+			}
+		}
+		after, _ := os.ReadFile(filepath.Join(tmpDir, "multi.zip"))
+		if !bytes.Equal(before, after) {
+			t.Error("❌ Архив изменён несмотря на ошибку")
+		}
+		leftovers, _ := filepath.Glob(filepath.Join(tmpDir, ".zipupdate-*"))
+		if len(leftovers) > 0 {
+			t.Errorf("❌ Остались временные файлы: %v", leftovers)
+		}
+		t.Log("✅ При ошибке архив не изменяется")
+	})
+
+	t.Run("FailedCreateKeepsTarget", func(t *testing.T) {
+		for _, target := range []string{"important.zip", "important.tar.gz", "important.tar"} {
+			os.WriteFile(filepath.Join(tmpDir, target), []byte("ценные данные"), 0644)
+			if err := fs.CreateArchive([]string{"docs", "missing_dir"}, target); err == nil {
+				t.Errorf("❌ %s: архив из несуществующего источника создан", target)
+			}
+			if data, err := os.ReadFile(filepath.Join(tmpDir, target)); err != nil || string(data) != "ценные данные" {
+				t.Errorf("❌ УЯЗВИМОСТЬ! Неудачное создание архива уничтожило существующий файл %s: %v", target, err)
+			}
+		}
+		if err := fs.CreateZip("missing_dir", "important.zip"); err == nil {
+			t.Error("❌ Архив из несуществующей папки создан")
+		}
+		if _, err := os.Stat(filepath.Join(tmpDir, "important.zip")); err != nil {
+			t.Errorf("❌ УЯЗВИМОСТЬ! CreateZip удалил существующий файл: %v", err)
+		}
+		leftovers, _ := filepath.Glob(filepath.Join(tmpDir, ".write-*"))
+		if len(leftovers) > 0 {
+			t.Errorf("❌ Остались временные файлы: %v", leftovers)
+		}
+		t.Log("✅ Неудачное создание архива не затрагивает существующий файл")
+	})
+}
+
+// TestArchiveVerification проверяет проверку целостности архивов и сохранение результата
+// Уязвимость: повреждённый архив признаётся целым, или результат записывается в чужие метаданные
+func TestArchiveVerification(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "sandbox_verify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cfg := &config.Config{SandboxPath: tmpDir}
+	fs.InitFS(cfg)
+
+	t.Run("CorruptCRC", func(t *testing.T) {
+		path := filepath.Join(tmpDir, "crc.zip")
+		createZipFiles(t, path, []string{"data.txt"}, []byte("integrity matters"))
+		data, _ := os.ReadFile(path)
+		i := bytes.Index(data, []byte("integrity"))
+		data[i] ^= 0xFF
+		os.WriteFile(path, data, 0644)
+
+		report, err := fs.VerifyArchive("crc.zip")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.OK() || report.Entries[0].Status != fs.VerifyCorrupt {
+			t.Fatalf("❌ УЯЗВИМОСТЬ! Запись с неверной CRC32 признана целой: %+v", report.Entries)
+		}
+		t.Logf("✅ Повреждение обнаружено: %s", report.Entries[0].Detail)
+	})
+
+	t.Run("Truncated", func(t *testing.T) {
+		payload := make([]byte, 64*1024)
+		rand.Read(payload)
+		os.WriteFile(filepath.Join(tmpDir, "random.bin"), payload, 0644)
+		if err := fs.CreateArchive([]string{"random.bin"}, "cut.tar.gz"); err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(tmpDir, "cut.tar.gz")
+		data, _ := os.ReadFile(path)
+		os.WriteFile(path, data[:len(data)/2], 0644)
+
+		report, err := fs.VerifyArchive("cut.tar.gz")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.OK() {
+			t.Fatal("❌ УЯЗВИМОСТЬ! Обрезанный архив признан целым")
+		}
+		t.Logf("✅ Обрезанный архив обнаружен: %s", report.Summary())
+	})
+
+	t.Run("EncryptedWithoutPassword", func(t *testing.T) {
+		os.WriteFile(filepath.Join(tmpDir, "secret.txt"), []byte("secret"), 0644)
+		if err := fs.CreateZipWithOptions([]string{"secret.txt"}, "secret.zip", fs.ZipOptions{Password: "partner-pass-1"}); err != nil {
+			t.Fatal(err)
+		}
+		report, err := fs.VerifyArchive("secret.zip")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(report.Entries) != 1 || report.Entries[0].Status != fs.VerifyEncrypted || report.Failed != 0 || report.Unverified != 1 {
+			t.Errorf("❌ Зашифрованная запись без пароля классифицирована неверно: %+v", report.Entries)
+		}
+		if report.OK() || report.Status() != fs.VerifyIncomplete || strings.Contains(report.Summary(), "подтверждена") {
+			t.Errorf("❌ Архив с непроверенными записями признан целым: %s", report.Summary())
+		}
+		t.Logf("✅ Зашифрованная запись отмечена как непроверенная, а не повреждённая: %s", report.Summary())
+	})
+
+	t.Run("RecordedForOwner", func(t *testing.T) {
+		queries := useRecordingDB(t)
+		report, _ := fs.VerifyArchive("crc.zip")
+		if _, err := db.RecordVerification("crc.zip", report.ArchiveSize, "crc.zip", 7, report.Status(), report.Summary()); err != nil {
+			t.Fatal(err)
+		}
+		if len(*queries) != 2 {
+			t.Fatalf("❌ Ожидались UPDATE и INSERT, выполнено: %d", len(*queries))
+		}
+		update, insert := (*queries)[0], (*queries)[1]
+		if !strings.Contains(update.query, "owner_id") || update.args[len(update.args)-1] != int64(7) {
+			t.Errorf("❌ УЯЗВИМОСТЬ! Результат проверки обновляет записи любого владельца: %s %v", update.query, update.args)
+		}
+		if insert.args[4] != fs.VerifyFailed || insert.args[5] != report.Summary() {
+			t.Errorf("❌ Сохранён неверный результат: %v", insert.args)
+		}
+		t.Log("✅ Результат проверки записан в метаданные владельца")
+	})
+}
+
+// TestArchiveChecksAgree проверяет, что просмотр, проверка целостности и распаковка
+// одинаково оценивают степень сжатия
+// Уязвимость: просмотр признаёт архив безопасным, а распаковка отклоняет (или наоборот)
+func TestArchiveChecksAgree(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "sandbox_agree")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cfg := &config.Config{SandboxPath: tmpDir}
+	fs.InitFS(cfg)
+
+	cases := []struct {
+		name string
+		size int
+		safe bool
+	}{
+		{"small.zip", 200 * 1024, true},      // ~800:1, но меньше порога проверки сжатия
+		{"bomb.zip", 5 * 1024 * 1024, false}, // ~1000:1 и больше порога
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			createDeflateBomb(t, filepath.Join(tmpDir, c.name), 1, c.size)
+
+			inspect, err := fs.InspectArchive(c.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			verify, err := fs.VerifyArchive(c.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			unzipErr := fs.Unzip(c.name, "out_"+c.name)
+
+			if inspect.Safe() != c.safe || verify.OK() != c.safe || (unzipErr == nil) != c.safe {
+				t.Errorf("❌ Проверки расходятся: просмотр %v, целостность %v, распаковка %v (ожидалось %v)",
+					inspect.Safe(), verify.OK(), unzipErr, c.safe)
+			} else {
+				t.Logf("✅ Просмотр, проверка и распаковка согласны: безопасен = %v", c.safe)
+			}
+		})
+	}
+}
+
 // === Вспомогательные функции ===
 
 func createHighRatioZip(t *testing.T, path string) {
@@ -128,3 +968,86 @@ func createZipWithPath(t *testing.T, zipPath, filePath string) {
 	fWr, _ := w.CreateHeader(header)
 	fWr.Write([]byte("malicious content"))
 }
+
+func createTarGz(t *testing.T, path string, headers []*tar.Header, content []byte) {
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	defer gz.Close()
+	tw := tar.NewWriter(gz)
+	defer tw.Close()
+
+	for _, h := range headers {
+		if h.Typeflag == tar.TypeReg {
+			h.Size = int64(len(content))
+		}
+		if err := tw.WriteHeader(h); err != nil {
+			t.Fatal(err)
+		}
+		if h.Typeflag == tar.TypeReg {
+			tw.Write(content)
+		}
+	}
+}
+
+// createDeflateBomb создаёт архив из count записей по size нулевых байт (реальное сжатие ~1000:1)
+func createDeflateBomb(t *testing.T, path string, count int, size int) {
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	w := zip.NewWriter(f)
+	defer w.Close()
+
+	zeros := make([]byte, size)
+	for i := 0; i < count; i++ {
+		fw, err := w.CreateHeader(&zip.FileHeader{Name: fmt.Sprintf("zeros_%d.bin", i), Method: zip.Deflate})
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write(zeros)
+	}
+}
+
+// createZipFiles создаёт несжатый архив из записей с одинаковым содержимым
+func createZipFiles(t *testing.T, path string, names []string, data []byte) {
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	w := zip.NewWriter(f)
+	defer w.Close()
+
+	for _, name := range names {
+		fw, err := w.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store})
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write(data)
+	}
+}
+
+// buildZip собирает ZIP-архив в памяти (для вложения в другие архивы)
+func buildZip(t *testing.T, names []string, contents [][]byte) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for i, name := range names {
+		fw, err := w.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate})
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write(contents[i])
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
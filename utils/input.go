@@ -3,16 +3,51 @@ package utils
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"os"
 	"strings"
 )
 
+// MultilineTerminator — строка, завершающая многострочный ввод
+const MultilineTerminator = "."
+
+// stdin — общий буферизованный ввод: отдельный буфер на каждый вызов терял бы
+// уже прочитанные из потока строки
+var stdin = bufio.NewReader(os.Stdin)
+
+// readRawLine читает одну строку без символа перевода строки
+func readRawLine() (string, bool) {
+	line, err := stdin.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", false
+	}
+	return strings.TrimRight(line, "\r\n"), true
+}
+
+// Input возвращает общий буферизованный ввод (для полноэкранного редактора,
+// который читает нажатия клавиш из того же потока)
+func Input() *bufio.Reader {
+	return stdin
+}
+
 // ReadLine выводит приглашение и читает строку ввода от пользователя
 func ReadLine(prompt string) string {
 	fmt.Print(prompt)
-	scanner := bufio.NewScanner(os.Stdin)
-	if scanner.Scan() {
-		return strings.TrimSpace(scanner.Text())
+	line, _ := readRawLine()
+	return strings.TrimSpace(line)
+}
+
+// ReadMultiline выводит приглашение и читает строки до строки из одной точки
+// или конца ввода. Отступы и пустые строки сохраняются
+func ReadMultiline(prompt string) string {
+	fmt.Printf("%s (завершите ввод строкой \"%s\")\n", prompt, MultilineTerminator)
+	var lines []string
+	for {
+		line, ok := readRawLine()
+		if !ok || strings.TrimSpace(line) == MultilineTerminator {
+			break
+		}
+		lines = append(lines, line)
 	}
-	return ""
+	return strings.Join(lines, "\n")
 }